@@ -0,0 +1,102 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// AuditVerdict 一批pod的校验结果
+	// AuditVerdict the verdicts of the checks of a batch
+	AuditVerdict = "Verdict"
+	// AuditSuspend operator暂停了工作负载
+	// AuditSuspend the operator suspended a workload
+	AuditSuspend = "Suspend"
+	// AuditUnsuspend operator解除了工作负载的暂停
+	// AuditUnsuspend the operator lifted the suspension of a workload
+	AuditUnsuspend = "Unsuspend"
+	// AuditBypass 用户带上忽略暂停的label恢复了被暂停的工作负载
+	// AuditBypass a user resumed a suspended workload with the label ignoring the suspension
+	AuditBypass = "Bypass"
+	// AuditRollback 用户把被暂停的工作负载回滚到校验通过的版本
+	// AuditRollback a user rolled a suspended workload back to the verified revision
+	AuditRollback = "Rollback"
+	// AuditConfigChange OpsConfigInfo的配置发生了变化
+	// AuditConfigChange the settings of an OpsConfigInfo changed
+	AuditConfigChange = "ConfigChange"
+	// AuditBreakGlass 用户带上强制更新原因在冻结窗口内更新了工作负载
+	// AuditBreakGlass a user updated a workload inside a freeze window with a break-glass reason
+	AuditBreakGlass = "BreakGlass"
+)
+
+// AuditRecordSpec defines an entry of the audit trail, it can't be changed once it is written
+// +kubebuilder:validation:XValidation:rule="self == oldSelf",message="audit records are immutable"
+type AuditRecordSpec struct {
+	// Action 记录的动作，Verdict、Suspend、Unsuspend、Bypass、Rollback、ConfigChange或者BreakGlass
+	// Action the recorded action, Verdict, Suspend, Unsuspend, Bypass, Rollback, ConfigChange or BreakGlass
+	// +kubebuilder:validation:Enum=Verdict;Suspend;Unsuspend;Bypass;Rollback;ConfigChange;BreakGlass
+	Action string `json:"action"`
+	// User 发起动作的用户，operator自己的动作为空
+	// User who took the action, it is empty for the actions of the operator
+	User string `json:"user,omitempty"`
+	// Kind Name 动作针对的对象，对象在记录所在的namespace中
+	// Kind Name the object the action applies to, it is in the namespace of the record
+	Kind           string `json:"kind"`
+	Name           string `json:"name"`
+	ChangeWorkload string `json:"changeWorkload,omitempty"`
+	ChangePod      string `json:"changePod,omitempty"`
+	Revision       string `json:"revision,omitempty"`
+	// Verdict 校验的结论，Results中是每个pod的结论
+	// Verdict the conclusion of the checks, the Results hold the verdict of every pod
+	Verdict string       `json:"verdict,omitempty"`
+	Results []PodSummary `json:"results,omitempty"`
+	Message string       `json:"message,omitempty"`
+	// Details 和动作相关的其他信息，例如配置的版本和内容的哈希
+	// Details the other facts of the action, such as the generation and the content hash of a config
+	Details  map[string]string `json:"details,omitempty"`
+	Time     string            `json:"time"`
+	TimeUnix int64             `json:"timeUnix"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:printcolumn:name="Action",type="string",JSONPath=".spec.action",description="The recorded action"
+//+kubebuilder:printcolumn:name="Kind",type="string",JSONPath=".spec.kind",description="The kind of the object"
+//+kubebuilder:printcolumn:name="Name",type="string",JSONPath=".spec.name",description="The name of the object"
+//+kubebuilder:printcolumn:name="User",type="string",JSONPath=".spec.user",description="Who took the action"
+//+kubebuilder:printcolumn:name="Time",type="string",JSONPath=".spec.time",description="When the action was taken"
+
+// AuditRecord is the Schema for the auditrecords API, it is an append-only entry of the trail of the defense decisions
+type AuditRecord struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec AuditRecordSpec `json:"spec"`
+}
+
+//+kubebuilder:object:root=true
+
+// AuditRecordList contains a list of AuditRecord
+type AuditRecordList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []AuditRecord `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&AuditRecord{}, &AuditRecordList{})
+}
@@ -0,0 +1,82 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// CallbackPending 回调早于changePod就绪到达，等待changePod进入对应的提交状态
+	// CallbackPending the callback arrived before the changePod was ready, it waits for the changePod to reach the submitted status of its stage
+	CallbackPending = ""
+	// CallbackApplied 回调已经应用到changePod，保留到过期用于去重
+	// CallbackApplied the callback has been applied to the changePod, it is kept until it expires for dedupe
+	CallbackApplied = "Applied"
+)
+
+// ChangeCallbackSpec defines the desired state of ChangeCallback
+type ChangeCallbackSpec struct {
+	// RequestId 回调的请求id，同一个请求id的回调只会被保存一次
+	// RequestId the request id of the callback, callbacks with the same request id are saved once
+	RequestId       string `json:"requestId"`
+	NodeId          string `json:"nodeId"`
+	BizExecOrderId  string `json:"bizExecOrderId,omitempty"`
+	ChangeSceneKey  string `json:"changeSceneKey,omitempty"`
+	DefenseStage    string `json:"defenseStage"`
+	Verdict         string `json:"verdict"`
+	Msg             string `json:"msg,omitempty"`
+	ReceiveTime     string `json:"receiveTime"`
+	ReceiveTimeUnix int64  `json:"receiveTimeUnix"`
+}
+
+// ChangeCallbackStatus defines the observed state of ChangeCallback
+type ChangeCallbackStatus struct {
+	Status          string `json:"status"`
+	ChangePod       string `json:"changePod,omitempty"`
+	AppliedTime     string `json:"appliedTime,omitempty"`
+	AppliedTimeUnix int64  `json:"appliedTimeUnix,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="NodeId",type="string",JSONPath=".spec.nodeId",description="The node id of the callback"
+//+kubebuilder:printcolumn:name="Stage",type="string",JSONPath=".spec.defenseStage",description="The defense stage of the callback"
+//+kubebuilder:printcolumn:name="Status",type="string",JSONPath=".status.status",description="The status of the callback"
+//+kubebuilder:printcolumn:name="ReceiveTime",type="string",JSONPath=".spec.receiveTime",description="The receive time of the callback"
+
+// ChangeCallback is the Schema for the changecallbacks API, it keeps an OpsCloud check callback that arrived before its changePod was ready
+type ChangeCallback struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ChangeCallbackSpec   `json:"spec,omitempty"`
+	Status ChangeCallbackStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// ChangeCallbackList contains a list of ChangeCallback
+type ChangeCallbackList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ChangeCallback `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&ChangeCallback{}, &ChangeCallbackList{})
+}
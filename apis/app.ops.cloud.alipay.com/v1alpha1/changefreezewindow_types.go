@@ -0,0 +1,106 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// FreezeRange 一段冻结时间，cron表达式加持续时间，或者绝对的起止时间
+// FreezeRange a range of frozen time, either a cron schedule with a duration or an absolute start and end
+type FreezeRange struct {
+	// Schedule 每次冻结开始时间的cron表达式，标准的5段格式
+	// Schedule the cron schedule of the starts of the range, in the standard 5 field format
+	Schedule string `json:"schedule,omitempty"`
+	// Duration 从Schedule的每次开始冻结的时长
+	// Duration how long the range lasts from every start of the Schedule
+	Duration *metav1.Duration `json:"duration,omitempty"`
+	// Start End 绝对的冻结起止时间，End不包含在内
+	// Start End the absolute start and end of the range, End is excluded
+	Start *metav1.Time `json:"start,omitempty"`
+	End   *metav1.Time `json:"end,omitempty"`
+}
+
+// FreezeExemption 不受冻结限制的工作负载，填写的条件都满足时豁免
+// FreezeExemption the workloads the freeze doesn't apply to, a workload is exempt when it meets every condition that is set
+type FreezeExemption struct {
+	Namespace string                `json:"namespace,omitempty"`
+	Name      string                `json:"name,omitempty"`
+	Selector  *metav1.LabelSelector `json:"selector,omitempty"`
+}
+
+// ChangeFreezeWindowSpec defines the desired state of ChangeFreezeWindow
+type ChangeFreezeWindowSpec struct {
+	// Ranges 冻结的时间段，任意一段生效时窗口生效
+	// Ranges the frozen ranges of time, the window is active while any of them is
+	Ranges []FreezeRange `json:"ranges"`
+	// TimeZone cron表达式使用的时区，默认UTC
+	// TimeZone the time zone of the cron schedules, UTC by default
+	TimeZone string `json:"timeZone,omitempty"`
+	// NamespaceSelector Selector 冻结的namespace和工作负载，为空时冻结全部
+	// NamespaceSelector Selector the namespaces and the workloads that are frozen, empty selects all of them
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+	Selector          *metav1.LabelSelector `json:"selector,omitempty"`
+	Exemptions        []FreezeExemption     `json:"exemptions,omitempty"`
+	// Reason 冻结的原因，拒绝更新时返回给用户
+	// Reason why the changes are frozen, it is returned with the denials
+	Reason string `json:"reason,omitempty"`
+}
+
+// ChangeFreezeWindowStatus defines the observed state of ChangeFreezeWindow
+type ChangeFreezeWindowStatus struct {
+	Active bool `json:"active"`
+	// ActiveStart ActiveEnd 生效中的冻结时间段
+	// ActiveStart ActiveEnd the frozen range of time in effect
+	ActiveStart *metav1.Time `json:"activeStart,omitempty"`
+	ActiveEnd   *metav1.Time `json:"activeEnd,omitempty"`
+	// NextStart 下一次冻结开始的时间
+	// NextStart when the next frozen range starts
+	NextStart *metav1.Time `json:"nextStart,omitempty"`
+	Message   string       `json:"message,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:resource:scope=Cluster
+//+kubebuilder:printcolumn:name="Active",type="boolean",JSONPath=".status.active",description="Whether the window is in effect"
+//+kubebuilder:printcolumn:name="ActiveEnd",type="string",JSONPath=".status.activeEnd",description="When the range in effect ends"
+//+kubebuilder:printcolumn:name="NextStart",type="string",JSONPath=".status.nextStart",description="When the next range starts"
+//+kubebuilder:printcolumn:name="Reason",type="string",JSONPath=".spec.reason",description="Why the changes are frozen"
+
+// ChangeFreezeWindow is the Schema for the changefreezewindows API, the validating webhook denies the template updates
+// of the selected workloads while it is active
+type ChangeFreezeWindow struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ChangeFreezeWindowSpec   `json:"spec,omitempty"`
+	Status ChangeFreezeWindowStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// ChangeFreezeWindowList contains a list of ChangeFreezeWindow
+type ChangeFreezeWindowList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ChangeFreezeWindow `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&ChangeFreezeWindow{}, &ChangeFreezeWindowList{})
+}
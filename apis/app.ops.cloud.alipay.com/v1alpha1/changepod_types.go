@@ -87,6 +87,52 @@ type ChangePodStatus struct {
 	PostSubmitTimeUnix   int64  `json:"postSubmitTimeUnix,omitempty"`
 	PreTimeoutThreshold  int    `json:"preTimeoutThreshold,omitempty"`
 	PostTimeoutThreshold int    `json:"postTimeOutThreshold,omitempty"`
+	// BatchStartTimeUnix 批次通过前置校验进入后置等待的时间，重试时保持不变，后置提交延迟从这个时间开始计算
+	// BatchStartTimeUnix the time the batch passed the pre check and entered post wait, it is kept across retries and
+	// the post submit delay is measured from it
+	BatchStartTimeUnix int64 `json:"batchStartTimeUnix,omitempty"`
+
+	// FailPolicy 管控端调用失败或校验超时时生效的策略：pass、fail或retry
+	// FailPolicy the policy applied when the defense backend fails or a check times out: pass, fail or retry
+	FailPolicy string `json:"failPolicy,omitempty"`
+	// RetryCount retry策略下已经重试的次数
+	// RetryCount the number of retries made under the retry policy
+	RetryCount int `json:"retryCount,omitempty"`
+
+	// Checker 给出校验结果的检查器：opscloud或者本地检查器pod-health、prometheus、log-pattern
+	// Checker the source of the verdicts: opscloud or one of the local checkers pod-health, prometheus and log-pattern
+	Checker string `json:"checker,omitempty"`
+	// PodHealth 本地检查器在观察窗口内记录的pod健康信息
+	// PodHealth the pod health recorded by the local checker during the observation window
+	PodHealth []PodHealth `json:"podHealth,omitempty"`
+	// ChangeScene 提交到管控端的租户和变更场景，第一次提交前解析，同一个changePod的请求保持一致
+	// ChangeScene the tenant and change scene submitted to OpsCloud, it is resolved before the first submit so every request of the changePod agrees
+	ChangeScene *ChangeScene `json:"changeScene,omitempty"`
+}
+
+// ChangeScene 管控端请求中的租户、变更场景和变更阶段
+// ChangeScene the tenant, change scenario and change phase of the OpsCloud requests
+type ChangeScene struct {
+	TenantCode   string `json:"tenantCode"`
+	ScenarioCode string `json:"scenarioCode"`
+	Phase        string `json:"phase"`
+	SceneKey     string `json:"sceneKey"`
+}
+
+// PodHealth 本地检查器对单个pod的观察记录
+// PodHealth the observations of the local checker on a pod
+type PodHealth struct {
+	Pod string `json:"pod"`
+	// ReadyTime 最近一次观察到ready时ready条件的变化时间，未ready时为0
+	// ReadyTime the transition time of the ready condition when the pod was last seen ready, zero while it is not ready
+	ReadyTime      int64 `json:"readyTime,omitempty"`
+	ReadinessFlaps int   `json:"readinessFlaps,omitempty"`
+	// Restarts 观察窗口内容器重启次数之和
+	// Restarts the sum of the container restarts during the observation window
+	Restarts int32 `json:"restarts,omitempty"`
+	// RestartBaseline 第一次观察到各容器时的重启次数
+	// RestartBaseline the restart count of each container when it was first observed
+	RestartBaseline map[string]int32 `json:"restartBaseline,omitempty"`
 }
 
 //+kubebuilder:object:root=true
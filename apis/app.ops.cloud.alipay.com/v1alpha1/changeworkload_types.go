@@ -42,6 +42,14 @@ const (
 	// TimeOutPreThreshold 超时，已调用管控端生成发布单，但已发布的数量未达到设置值，超时使用未达到阈值的发布数量生成ChangePod
 	// TimeOutPreThreshold Timeout, the control side has been called to generate the release order, but the number of published has not reached the set value, and the number of published that has not reached the threshold is used to generate ChangePod
 	TimeOutPreThreshold = "TimeOutPreThreshold"
+	// Queued 排队，运行中的变更达到并发上限或者上游工作负载的变更还没有成功，工作负载被暂停直到可以运行
+	// Queued, the running changes reached the concurrency limit or the change of an upstream workload has not succeeded
+	// yet, the workload is paused until the change may run
+	Queued = "Queued"
+	// Cancelled 取消，上游工作负载的变更被暂停，工作负载保持暂停，新的版本会重新等待上游；或者变更被同一个工作负载新版本的变更取代
+	// Cancelled, the change of an upstream workload is suspended, the workload is kept paused and a new revision of it
+	// waits for the upstreams again; or the change is superseded by the change of a new revision of the same workload
+	Cancelled = "Cancelled"
 )
 
 // ChangeWorkloadSpec defines the desired state of ChangeWorkload
@@ -58,6 +66,45 @@ type ChangeWorkloadSpec struct {
 	CreateTime        string          `json:"createTime"`
 	CreateTimeUnix    int64           `json:"createTimeUnix"`
 	AppName           string          `json:"appName"`
+	// Scale 副本扩容触发的ChangeWorkload，只校验扩容新增的pod，模板发布时为空
+	// Scale the replica scale-up a ChangeWorkload is created for, only the added pods are checked, it is empty for a template rollout
+	Scale *ScaleChange `json:"scale,omitempty"`
+	// Config 被引用的ConfigMap和Secret的内容变更，配置热加载时单独创建ChangeWorkload，否则随着重启的模板发布一起记录
+	// Config the content change of the referenced ConfigMaps and Secrets, a hot-reloaded one gets a ChangeWorkload of its
+	// own, the others are recorded with the template rollout that restarts the pods
+	Config *ConfigChange `json:"config,omitempty"`
+	// Batches 按照Argo Rollout的canary步骤或者CloneSet和Advanced StatefulSet的partition划分的每批pod数，最后一批重复使用，为空时每批使用CountThreshold
+	// Batches the pods of every batch split by the canary steps of an Argo Rollout or the partition of a CloneSet or an
+	// Advanced StatefulSet, the last one repeats, CountThreshold sizes every batch when it is empty
+	Batches []int32 `json:"batches,omitempty"`
+	// UpdateRevision OpenKruise CloneSet和Advanced StatefulSet的updateRevision，其他工作负载为空
+	// UpdateRevision the updateRevision of an OpenKruise CloneSet or Advanced StatefulSet, it is empty for the other workloads
+	UpdateRevision string `json:"updateRevision,omitempty"`
+	// DependsOn 上游deployment，格式为namespace/name，它们当前版本的变更成功后这个变更才开始
+	// DependsOn the upstream deployments as namespace/name, the change starts once the changes of their current revisions succeed
+	DependsOn []string `json:"dependsOn,omitempty"`
+}
+
+// ScaleChange 一次副本扩容，From为扩容前已经校验过的副本数
+// ScaleChange a replica scale-up, From is the replicas defended before the scale-up
+type ScaleChange struct {
+	From int32 `json:"from"`
+	To   int32 `json:"to"`
+}
+
+// ConfigChange 被引用配置的一次内容变更，Revision为变更后全部被引用配置内容的摘要
+// ConfigChange a content change of the referenced configs, Revision is the digest of the content of all of them after the change
+type ConfigChange struct {
+	Revision string          `json:"revision"`
+	Objects  []ChangedConfig `json:"objects"`
+}
+
+// ChangedConfig 一个内容变更的ConfigMap或者Secret，Keys为新增、修改和删除的key
+// ChangedConfig a ConfigMap or Secret whose content changed, Keys are the added, modified and removed keys
+type ChangedConfig struct {
+	Kind string   `json:"kind"`
+	Name string   `json:"name"`
+	Keys []string `json:"keys"`
 }
 
 type DefensePolicy struct {
@@ -71,6 +118,11 @@ type PodSummary struct {
 	Pod       string `json:"pod"`
 	Ip        string `json:"ip"`
 	Namespace string `json:"namespace"`
+	// Node Zone Region pod所在的节点和节点的拓扑标签
+	// Node Zone Region the node of the pod and the topology labels of the node
+	Node   string `json:"node,omitempty"`
+	Zone   string `json:"zone,omitempty"`
+	Region string `json:"region,omitempty"`
 
 	Verdict string `json:"verdict,omitempty"`
 	Message string `json:"message,omitempty"`
@@ -89,12 +141,26 @@ type ChangeWorkloadStatus struct {
 	EntryTimeUnix        int64        `json:"entryTimeUnix,omitempty"`
 	UpdateTime           string       `json:"updateTime"`
 	UpdateTimeUnix       int64        `json:"updateTimeUnix"`
+	// DryRun 观察模式，完整执行防御流程但从不暂停发布
+	// DryRun observe-only mode, the full defense flow runs but the release is never suspended
+	DryRun bool `json:"dryRun,omitempty"`
+	// WouldSuspend 观察模式下校验失败，非观察模式时发布会被暂停
+	// WouldSuspend a check failed in dry-run mode, the release would have been suspended otherwise
+	WouldSuspend         bool   `json:"wouldSuspend,omitempty"`
+	WouldSuspendTime     string `json:"wouldSuspendTime,omitempty"`
+	WouldSuspendTimeUnix int64  `json:"wouldSuspendTimeUnix,omitempty"`
+	// QueuePosition 排队时在namespace或者集群排队中的位置，从1开始，等待上游时为0，QueueReason 排队或者取消的原因
+	// QueuePosition the place from 1 in the queue of the namespace or the cluster while it is queued and 0 while it waits
+	// for the upstreams, QueueReason why it is queued or cancelled
+	QueuePosition int    `json:"queuePosition,omitempty"`
+	QueueReason   string `json:"queueReason,omitempty"`
 }
 
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
 //+kubebuilder:printcolumn:name="Status",type="string",JSONPath=".status.status",description="The status of the changeworkload"
 //+kubebuilder:printcolumn:name="CreateTime",type="string",JSONPath=".spec.createTime",description="The create time of the changeworkload"
+//+kubebuilder:printcolumn:name="QueuePosition",type="integer",JSONPath=".status.queuePosition",description="The place in the queue of the changeworkload"
 
 // ChangeWorkload is the Schema for the changeworkloads API
 type ChangeWorkload struct {
@@ -22,9 +22,309 @@ limitations under the License.
 package v1alpha1
 
 import (
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AuditRecord) DeepCopyInto(out *AuditRecord) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AuditRecord.
+func (in *AuditRecord) DeepCopy() *AuditRecord {
+	if in == nil {
+		return nil
+	}
+	out := new(AuditRecord)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *AuditRecord) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AuditRecordList) DeepCopyInto(out *AuditRecordList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]AuditRecord, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AuditRecordList.
+func (in *AuditRecordList) DeepCopy() *AuditRecordList {
+	if in == nil {
+		return nil
+	}
+	out := new(AuditRecordList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *AuditRecordList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AuditRecordSpec) DeepCopyInto(out *AuditRecordSpec) {
+	*out = *in
+	if in.Results != nil {
+		in, out := &in.Results, &out.Results
+		*out = make([]PodSummary, len(*in))
+		copy(*out, *in)
+	}
+	if in.Details != nil {
+		in, out := &in.Details, &out.Details
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AuditRecordSpec.
+func (in *AuditRecordSpec) DeepCopy() *AuditRecordSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(AuditRecordSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ChangeCallback) DeepCopyInto(out *ChangeCallback) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	out.Spec = in.Spec
+	out.Status = in.Status
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ChangeCallback.
+func (in *ChangeCallback) DeepCopy() *ChangeCallback {
+	if in == nil {
+		return nil
+	}
+	out := new(ChangeCallback)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ChangeCallback) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ChangeCallbackList) DeepCopyInto(out *ChangeCallbackList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]ChangeCallback, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ChangeCallbackList.
+func (in *ChangeCallbackList) DeepCopy() *ChangeCallbackList {
+	if in == nil {
+		return nil
+	}
+	out := new(ChangeCallbackList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ChangeCallbackList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ChangeCallbackSpec) DeepCopyInto(out *ChangeCallbackSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ChangeCallbackSpec.
+func (in *ChangeCallbackSpec) DeepCopy() *ChangeCallbackSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ChangeCallbackSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ChangeCallbackStatus) DeepCopyInto(out *ChangeCallbackStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ChangeCallbackStatus.
+func (in *ChangeCallbackStatus) DeepCopy() *ChangeCallbackStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ChangeCallbackStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ChangeFreezeWindow) DeepCopyInto(out *ChangeFreezeWindow) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ChangeFreezeWindow.
+func (in *ChangeFreezeWindow) DeepCopy() *ChangeFreezeWindow {
+	if in == nil {
+		return nil
+	}
+	out := new(ChangeFreezeWindow)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ChangeFreezeWindow) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ChangeFreezeWindowList) DeepCopyInto(out *ChangeFreezeWindowList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]ChangeFreezeWindow, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ChangeFreezeWindowList.
+func (in *ChangeFreezeWindowList) DeepCopy() *ChangeFreezeWindowList {
+	if in == nil {
+		return nil
+	}
+	out := new(ChangeFreezeWindowList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ChangeFreezeWindowList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ChangeFreezeWindowSpec) DeepCopyInto(out *ChangeFreezeWindowSpec) {
+	*out = *in
+	if in.Ranges != nil {
+		in, out := &in.Ranges, &out.Ranges
+		*out = make([]FreezeRange, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.NamespaceSelector != nil {
+		in, out := &in.NamespaceSelector, &out.NamespaceSelector
+		*out = new(v1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Selector != nil {
+		in, out := &in.Selector, &out.Selector
+		*out = new(v1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Exemptions != nil {
+		in, out := &in.Exemptions, &out.Exemptions
+		*out = make([]FreezeExemption, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ChangeFreezeWindowSpec.
+func (in *ChangeFreezeWindowSpec) DeepCopy() *ChangeFreezeWindowSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ChangeFreezeWindowSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ChangeFreezeWindowStatus) DeepCopyInto(out *ChangeFreezeWindowStatus) {
+	*out = *in
+	if in.ActiveStart != nil {
+		in, out := &in.ActiveStart, &out.ActiveStart
+		*out = (*in).DeepCopy()
+	}
+	if in.ActiveEnd != nil {
+		in, out := &in.ActiveEnd, &out.ActiveEnd
+		*out = (*in).DeepCopy()
+	}
+	if in.NextStart != nil {
+		in, out := &in.NextStart, &out.NextStart
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ChangeFreezeWindowStatus.
+func (in *ChangeFreezeWindowStatus) DeepCopy() *ChangeFreezeWindowStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ChangeFreezeWindowStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ChangePod) DeepCopyInto(out *ChangePod) {
 	*out = *in
@@ -112,6 +412,18 @@ func (in *ChangePodStatus) DeepCopyInto(out *ChangePodStatus) {
 		*out = make([]PodSummary, len(*in))
 		copy(*out, *in)
 	}
+	if in.PodHealth != nil {
+		in, out := &in.PodHealth, &out.PodHealth
+		*out = make([]PodHealth, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.ChangeScene != nil {
+		in, out := &in.ChangeScene, &out.ChangeScene
+		*out = new(ChangeScene)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ChangePodStatus.
@@ -124,6 +436,21 @@ func (in *ChangePodStatus) DeepCopy() *ChangePodStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ChangeScene) DeepCopyInto(out *ChangeScene) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ChangeScene.
+func (in *ChangeScene) DeepCopy() *ChangeScene {
+	if in == nil {
+		return nil
+	}
+	out := new(ChangeScene)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ChangeWorkload) DeepCopyInto(out *ChangeWorkload) {
 	*out = *in
@@ -191,6 +518,26 @@ func (in *ChangeWorkloadSpec) DeepCopyInto(out *ChangeWorkloadSpec) {
 		*out = make([]DefensePolicy, len(*in))
 		copy(*out, *in)
 	}
+	if in.Scale != nil {
+		in, out := &in.Scale, &out.Scale
+		*out = new(ScaleChange)
+		**out = **in
+	}
+	if in.Config != nil {
+		in, out := &in.Config, &out.Config
+		*out = new(ConfigChange)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Batches != nil {
+		in, out := &in.Batches, &out.Batches
+		*out = make([]int32, len(*in))
+		copy(*out, *in)
+	}
+	if in.DependsOn != nil {
+		in, out := &in.DependsOn, &out.DependsOn
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ChangeWorkloadSpec.
@@ -238,6 +585,48 @@ func (in *ChangeWorkloadStatus) DeepCopy() *ChangeWorkloadStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ChangedConfig) DeepCopyInto(out *ChangedConfig) {
+	*out = *in
+	if in.Keys != nil {
+		in, out := &in.Keys, &out.Keys
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ChangedConfig.
+func (in *ChangedConfig) DeepCopy() *ChangedConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(ChangedConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ConfigChange) DeepCopyInto(out *ConfigChange) {
+	*out = *in
+	if in.Objects != nil {
+		in, out := &in.Objects, &out.Objects
+		*out = make([]ChangedConfig, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ConfigChange.
+func (in *ConfigChange) DeepCopy() *ConfigChange {
+	if in == nil {
+		return nil
+	}
+	out := new(ConfigChange)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *DefensePolicy) DeepCopyInto(out *DefensePolicy) {
 	*out = *in
@@ -253,6 +642,54 @@ func (in *DefensePolicy) DeepCopy() *DefensePolicy {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FreezeExemption) DeepCopyInto(out *FreezeExemption) {
+	*out = *in
+	if in.Selector != nil {
+		in, out := &in.Selector, &out.Selector
+		*out = new(v1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FreezeExemption.
+func (in *FreezeExemption) DeepCopy() *FreezeExemption {
+	if in == nil {
+		return nil
+	}
+	out := new(FreezeExemption)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FreezeRange) DeepCopyInto(out *FreezeRange) {
+	*out = *in
+	if in.Duration != nil {
+		in, out := &in.Duration, &out.Duration
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.Start != nil {
+		in, out := &in.Start, &out.Start
+		*out = (*in).DeepCopy()
+	}
+	if in.End != nil {
+		in, out := &in.End, &out.End
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FreezeRange.
+func (in *FreezeRange) DeepCopy() *FreezeRange {
+	if in == nil {
+		return nil
+	}
+	out := new(FreezeRange)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *OpsConfigInfo) DeepCopyInto(out *OpsConfigInfo) {
 	*out = *in
@@ -342,6 +779,28 @@ func (in *OpsConfigInfoStatus) DeepCopy() *OpsConfigInfoStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PodHealth) DeepCopyInto(out *PodHealth) {
+	*out = *in
+	if in.RestartBaseline != nil {
+		in, out := &in.RestartBaseline, &out.RestartBaseline
+		*out = make(map[string]int32, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PodHealth.
+func (in *PodHealth) DeepCopy() *PodHealth {
+	if in == nil {
+		return nil
+	}
+	out := new(PodHealth)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *PodSummary) DeepCopyInto(out *PodSummary) {
 	*out = *in
@@ -356,3 +815,18 @@ func (in *PodSummary) DeepCopy() *PodSummary {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ScaleChange) DeepCopyInto(out *ScaleChange) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ScaleChange.
+func (in *ScaleChange) DeepCopy() *ScaleChange {
+	if in == nil {
+		return nil
+	}
+	out := new(ScaleChange)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -0,0 +1,80 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/utils/native"
+)
+
+// AdvancedStatefulSetMutator 给OpenKruise Advanced StatefulSet的模板打上版本label
+// AdvancedStatefulSetMutator sets the version label of the template of an OpenKruise Advanced StatefulSet
+type AdvancedStatefulSetMutator struct{}
+
+// AdvancedStatefulSetValidator 和Deployment一样校验Advanced StatefulSet的更新
+// AdvancedStatefulSetValidator validates the updates of an Advanced StatefulSet like the Deployment one
+type AdvancedStatefulSetValidator struct {
+	recorder record.EventRecorder
+}
+
+// advancedStatefulSetWorkload operator会写入Advanced StatefulSet的partition和暂停
+// advancedStatefulSetWorkload is an Advanced StatefulSet, the operator writes its partition and pause
+var advancedStatefulSetWorkload = templateWorkload{
+	kind:             "advancedstatefulset",
+	getReplicas:      native.GetAdvancedStatefulSetReplicas,
+	partitionFields:  native.AdvancedStatefulSetPartitionFields,
+	getPartition:     native.GetAdvancedStatefulSetPartition,
+	controllerFields: [][]string{native.AdvancedStatefulSetPausedFields},
+}
+
+//+kubebuilder:webhook:path=/mutate-apps-kruise-io-v1beta1-statefulset,mutating=true,failurePolicy=fail,sideEffects=NoneOnDryRun,groups=apps.kruise.io,resources=statefulsets,verbs=create;update,versions=v1beta1,name=madvancedstatefulset.kb.io,admissionReviewVersions=v1
+
+// Handle sets the version label of the Advanced StatefulSet
+func (m *AdvancedStatefulSetMutator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	return mutateTemplate(req, native.GetAdvancedStatefulSetTemplate)
+}
+
+//+kubebuilder:webhook:path=/validate-apps-kruise-io-v1beta1-statefulset,mutating=false,failurePolicy=fail,sideEffects=NoneOnDryRun,groups=apps.kruise.io,resources=statefulsets,verbs=update,versions=v1beta1,name=vadvancedstatefulset.kb.io,admissionReviewVersions=v1
+
+// Handle validates the Advanced StatefulSet object, the partition held by the operator is not a template change
+func (v *AdvancedStatefulSetValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	return validateTemplate(ctx, v.recorder, advancedStatefulSetWorkload, req)
+}
+
+// AdvancedStatefulSetWebhook is an Admission Webhook for OpenKruise Advanced StatefulSet objects
+type AdvancedStatefulSetWebhook struct {
+	Validator *AdvancedStatefulSetValidator
+	Mutator   *AdvancedStatefulSetMutator
+}
+
+// SetupWebhookWithManager registers the Admission Webhook, it is harmless without the Advanced StatefulSet CRD installed
+func (w *AdvancedStatefulSetWebhook) SetupWebhookWithManager(mgr manager.Manager) error {
+	w.Validator = &AdvancedStatefulSetValidator{recorder: mgr.GetEventRecorderFor("advancedstatefulset-validator")}
+	w.Mutator = &AdvancedStatefulSetMutator{}
+	mgr.GetWebhookServer().Register("/validate-apps-kruise-io-v1beta1-statefulset", &admission.Webhook{
+		Handler: admission.HandlerFunc(w.Validator.Handle),
+	})
+	mgr.GetWebhookServer().Register("/mutate-apps-kruise-io-v1beta1-statefulset", &admission.Webhook{
+		Handler: admission.HandlerFunc(w.Mutator.Handle),
+	})
+	return nil
+}
@@ -0,0 +1,82 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/apis/app.ops.cloud.alipay.com/v1alpha1"
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/audit"
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/utils"
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/utils/native"
+)
+
+// auditOverrides 按准入的决定带上发起请求的用户记录绕过暂停和回滚到校验通过的版本，requestUid唯一确定一次准入请求
+// auditOverrides records by the admission decision the bypasses of a suspension and the rollbacks to the verified
+// revision with the requesting user, the requestUid identifies the admission request
+func auditOverrides(ctx context.Context, requestUid string, username string, kind string, object metav1.Object, old metav1.Object) {
+	revision := object.GetLabels()[native.AdmissionWebhookVersionLabel]
+	if workload, bypassed := getBypassedChangeWorkload(ctx, object, old); bypassed {
+		spec := v1alpha1.AuditRecordSpec{
+			Action:   v1alpha1.AuditBypass,
+			User:     username,
+			Kind:     kind,
+			Revision: revision,
+			Message:  fmt.Sprintf("%s bypassed the suspension of the %s with the label %s", username, kind, utils.IgnoredSuspendLabel),
+		}
+		if workload != nil {
+			spec.ChangeWorkload = workload.Name
+			spec.Revision = workload.Spec.Reversion
+			spec.Results = workload.Status.DefenseCheckFailPods
+			spec.Message = fmt.Sprintf("%s bypassed the suspension of the %s by the ChangeWorkload %s with the label %s", username,
+				kind, workload.Name, utils.IgnoredSuspendLabel)
+		}
+		recordAdmissionAudit(ctx, requestUid, object, spec)
+		return
+	}
+	// 暂停策略只在模板换成校验通过的版本时放行被暂停的工作负载的模板更新
+	// the suspend policy only admits a template update of a suspended workload changing to the verified revision
+	if !isSuspended(object.GetLabels(), old.GetLabels()) {
+		return
+	}
+	verified := old.GetAnnotations()[utils.VerifiedRevisionAnnotation]
+	previous := old.GetLabels()[native.AdmissionWebhookVersionLabel]
+	if verified == "" || revision != verified || previous == verified {
+		return
+	}
+	recordAdmissionAudit(ctx, requestUid, object, v1alpha1.AuditRecordSpec{
+		Action:   v1alpha1.AuditRollback,
+		User:     username,
+		Kind:     kind,
+		Revision: verified,
+		Message:  fmt.Sprintf("%s rolled the suspended %s back from the revision %s to the verified revision %s", username, kind, previous, verified),
+	})
+}
+
+// recordAdmissionAudit 写入准入请求的审计记录，写入失败只记录日志，审计不阻塞请求
+// recordAdmissionAudit writes the audit record of an admission request, a failure is only logged so that the request
+// is never blocked by the audit trail
+func recordAdmissionAudit(ctx context.Context, requestUid string, object metav1.Object, spec v1alpha1.AuditRecordSpec) {
+	spec.Name = object.GetName()
+	key := "admission/" + requestUid + "/" + spec.Action
+	if err := audit.Record(ctx, utils.App.Client, object.GetNamespace(), key, spec); err != nil {
+		deploymentlog.Error(err, "write audit record error", "namespace", object.GetNamespace(), "name", object.GetName(), "action", spec.Action)
+	}
+}
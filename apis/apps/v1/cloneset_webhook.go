@@ -0,0 +1,80 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/utils/native"
+)
+
+// CloneSetMutator 给OpenKruise CloneSet的模板打上版本label
+// CloneSetMutator sets the version label of the template of an OpenKruise CloneSet
+type CloneSetMutator struct{}
+
+// CloneSetValidator 和Deployment一样校验CloneSet的更新
+// CloneSetValidator validates the updates of a CloneSet like the Deployment one
+type CloneSetValidator struct {
+	recorder record.EventRecorder
+}
+
+// cloneSetWorkload operator会写入CloneSet的partition和暂停
+// cloneSetWorkload is a CloneSet, the operator writes its partition and pause
+var cloneSetWorkload = templateWorkload{
+	kind:             "cloneset",
+	getReplicas:      native.GetCloneSetReplicas,
+	partitionFields:  native.CloneSetPartitionFields,
+	getPartition:     native.GetCloneSetPartition,
+	controllerFields: [][]string{native.CloneSetPausedFields},
+}
+
+//+kubebuilder:webhook:path=/mutate-apps-kruise-io-v1alpha1-cloneset,mutating=true,failurePolicy=fail,sideEffects=NoneOnDryRun,groups=apps.kruise.io,resources=clonesets,verbs=create;update,versions=v1alpha1,name=mcloneset.kb.io,admissionReviewVersions=v1
+
+// Handle sets the version label of the CloneSet
+func (m *CloneSetMutator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	return mutateTemplate(req, native.GetCloneSetTemplate)
+}
+
+//+kubebuilder:webhook:path=/validate-apps-kruise-io-v1alpha1-cloneset,mutating=false,failurePolicy=fail,sideEffects=NoneOnDryRun,groups=apps.kruise.io,resources=clonesets,verbs=update,versions=v1alpha1,name=vcloneset.kb.io,admissionReviewVersions=v1
+
+// Handle validates the CloneSet object, the partition held by the operator is not a template change
+func (v *CloneSetValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	return validateTemplate(ctx, v.recorder, cloneSetWorkload, req)
+}
+
+// CloneSetWebhook is an Admission Webhook for OpenKruise CloneSet objects
+type CloneSetWebhook struct {
+	Validator *CloneSetValidator
+	Mutator   *CloneSetMutator
+}
+
+// SetupWebhookWithManager registers the Admission Webhook, it is harmless without the CloneSet CRD installed
+func (w *CloneSetWebhook) SetupWebhookWithManager(mgr manager.Manager) error {
+	w.Validator = &CloneSetValidator{recorder: mgr.GetEventRecorderFor("cloneset-validator")}
+	w.Mutator = &CloneSetMutator{}
+	mgr.GetWebhookServer().Register("/validate-apps-kruise-io-v1alpha1-cloneset", &admission.Webhook{
+		Handler: admission.HandlerFunc(w.Validator.Handle),
+	})
+	mgr.GetWebhookServer().Register("/mutate-apps-kruise-io-v1alpha1-cloneset", &admission.Webhook{
+		Handler: admission.HandlerFunc(w.Mutator.Handle),
+	})
+	return nil
+}
@@ -0,0 +1,120 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	v1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/apis/app.ops.cloud.alipay.com/v1alpha1"
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/concurrency"
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/utils"
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/utils/native"
+)
+
+// getConcurrencyLimit 不等待地读取全局配置的并发限制，没有配置或者配置还没有就绪时不限制
+// getConcurrencyLimit reads the concurrency limit from the global config without waiting, nothing is limited without it
+// or before it is ready
+func getConcurrencyLimit() concurrency.Limit {
+	return concurrency.GetLimit(utils.CurrentConfigConcurrency())
+}
+
+// holdQueuedDeployment 排队模式下名额已满时暂停新版本的发布，ChangeWorkload获得名额后由operator恢复，观察模式下只记录本应暂停的事件
+// holdQueuedDeployment pauses the release of a new revision when the slots are taken in the hold mode, the operator
+// resumes it once its ChangeWorkload gets a slot, only the would-hold event is recorded in dry-run mode
+func holdQueuedDeployment(ctx context.Context, recorder record.EventRecorder, deployment *v1.Deployment) {
+	limit := getConcurrencyLimit()
+	if !limit.Enabled() || limit.Mode != concurrency.ModeHold || deployment.Spec.Paused {
+		return
+	}
+	decision, err := decideConcurrency(ctx, limit, deployment.Namespace, deployment.Name)
+	if err != nil {
+		// 读取变更失败时不暂停，由ChangeWorkload排队时暂停
+		// the deployment is not paused when the changes can't be read, it is paused when its ChangeWorkload is queued
+		deploymentlog.Error(err, "decide concurrency error", "namespace", deployment.Namespace, "name", deployment.Name)
+		return
+	}
+	if decision.Admit {
+		return
+	}
+	if utils.IsAdmissionDryRun(ctx, utils.App.Client, deployment.Namespace) {
+		recordDryRun(recorder, deployment, utils.EventReasonWouldHold, "dry-run: the release would have been held: %s", decision.Reason)
+		return
+	}
+	deploymentlog.Info("hold the deployment until its change gets a slot", "namespace", deployment.Namespace,
+		"name", deployment.Name, "position", decision.Position, "reason", decision.Reason)
+	deployment.Spec.Paused = true
+	if deployment.Annotations == nil {
+		deployment.Annotations = map[string]string{}
+	}
+	deployment.Annotations[utils.QueueHeldAnnotation] = utils.True
+}
+
+// validateConcurrency 拒绝模式下名额已满时拒绝deployment的模板更新
+// validateConcurrency denies the template updates of a deployment when the slots are taken in the deny mode
+func (v *DeploymentValidator) validateConcurrency(ctx context.Context, req admission.Request, r v1.Deployment, old v1.Deployment) error {
+	templateChanged := !equality.Semantic.DeepEqual(old.Spec.Template, r.Spec.Template)
+	return validateConcurrencyLimit(ctx, requestRecorder(v.recorder, req), "deployment", &r, templateChanged)
+}
+
+// validateConcurrencyLimit 拒绝模式下名额已满时拒绝工作负载的模板更新，观察模式下只记录本应拒绝的事件
+// validateConcurrencyLimit denies the template updates of a workload when the slots are taken in the deny mode, only the
+// would-deny event is recorded in dry-run mode
+func validateConcurrencyLimit(ctx context.Context, recorder record.EventRecorder, kind string, r client.Object, templateChanged bool) error {
+	limit := getConcurrencyLimit()
+	if !limit.Enabled() || limit.Mode != concurrency.ModeDeny || !templateChanged {
+		return nil
+	}
+	decision, err := decideConcurrency(ctx, limit, r.GetNamespace(), r.GetName())
+	if err != nil {
+		// 读取变更失败时不阻塞发布
+		// the releases are not blocked when the changes can't be read
+		deploymentlog.Error(err, "decide concurrency error", "namespace", r.GetNamespace(), "name", r.GetName())
+		return nil
+	}
+	if decision.Admit {
+		return nil
+	}
+	message := fmt.Sprintf("%s %s can't start a new change, too many changes are in flight: %s", kind, r.GetName(), decision.Reason)
+	if utils.IsAdmissionDryRun(ctx, utils.App.Client, r.GetNamespace()) {
+		recordDryRun(recorder, r, utils.EventReasonWouldDeny, "dry-run: the update would have been denied, %s", message)
+		return nil
+	}
+	return errors.New(message)
+}
+
+// decideConcurrency 按缓存中的ChangeWorkload判断工作负载的新变更能否立即运行，同一个工作负载其他版本的变更被新变更取代，不计入
+// decideConcurrency decides by the cached ChangeWorkloads whether the new change of the workload may run now, the changes
+// of the other revisions of the same workload are superseded by the new one and not counted
+func decideConcurrency(ctx context.Context, limit concurrency.Limit, namespace string, name string) (concurrency.Decision, error) {
+	running, queued, err := limit.List(ctx, utils.App.Client, utils.ChangeWorkloadFieldStatus, func(workload *v1alpha1.ChangeWorkload) bool {
+		return workload.Namespace == namespace && workload.Labels[native.DeploymentNameLabel] == name
+	})
+	if err != nil {
+		return concurrency.Decision{}, err
+	}
+	change := concurrency.Change{Namespace: namespace, Name: name, CreateTimeUnix: time.Now().Unix()}
+	return limit.Decide(change, running, queued), nil
+}
@@ -0,0 +1,101 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	v1 "k8s.io/api/apps/v1"
+	"k8s.io/client-go/tools/record"
+
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/dependency"
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/utils"
+)
+
+// validateDependencies 拒绝非法的上游和依赖自己的deployment
+// validateDependencies denies the invalid upstreams and a deployment depending on itself
+func validateDependencies(r v1.Deployment) error {
+	upstreams, err := dependency.ParseUpstreams(r.Annotations[utils.DependsOnAnnotation], r.Namespace)
+	if err != nil {
+		return fmt.Errorf("invalid annotation %s: %v", utils.DependsOnAnnotation, err)
+	}
+	for _, upstream := range upstreams {
+		if upstream == r.Namespace+"/"+r.Name {
+			return fmt.Errorf("invalid annotation %s: deployment %s can't depend on itself", utils.DependsOnAnnotation, r.Name)
+		}
+	}
+	return nil
+}
+
+// validateDependencyCycle 拒绝和上游形成依赖环的deployment，上游的annotation从缓存读取
+// validateDependencyCycle denies a deployment making a dependency cycle with its upstreams, the annotations of the
+// upstreams are read from the cache
+func validateDependencyCycle(ctx context.Context, r v1.Deployment) error {
+	upstreams, err := dependency.ParseUpstreams(r.Annotations[utils.DependsOnAnnotation], r.Namespace)
+	if err != nil || len(upstreams) == 0 {
+		return nil
+	}
+	cycle, err := dependency.FindCycle(ctx, utils.App.Client, utils.DependsOnAnnotation, r.Namespace+"/"+r.Name, upstreams)
+	if err != nil {
+		// 读取上游失败时不阻塞发布
+		// the releases are not blocked when the upstreams can't be read
+		deploymentlog.Error(err, "find dependency cycle error", "namespace", r.Namespace, "name", r.Name)
+		return nil
+	}
+	if cycle != nil {
+		return fmt.Errorf("invalid annotation %s: deployment %s makes a dependency cycle %s", utils.DependsOnAnnotation,
+			r.Name, strings.Join(cycle, " -> "))
+	}
+	return nil
+}
+
+// holdDependentDeployment 上游的变更还没有成功时暂停新版本的发布，上游的变更都成功后由operator恢复，观察模式下只记录本应暂停的事件
+// holdDependentDeployment pauses the release of a new revision while the changes of the upstreams have not succeeded, the
+// operator resumes it once all of them succeed, only the would-hold event is recorded in dry-run mode
+func holdDependentDeployment(ctx context.Context, recorder record.EventRecorder, deployment *v1.Deployment) {
+	if deployment.Spec.Paused {
+		return
+	}
+	upstreams, err := dependency.ParseUpstreams(deployment.Annotations[utils.DependsOnAnnotation], deployment.Namespace)
+	if err != nil || len(upstreams) == 0 {
+		return
+	}
+	result, err := dependency.Check(ctx, utils.App.Client, upstreams, time.Now().Add(utils.DependencyMissingTimeout*time.Second))
+	if err != nil {
+		// 读取上游失败时不暂停，由ChangeWorkload等待上游时暂停
+		// the deployment is not paused when the upstreams can't be read, it is paused when its ChangeWorkload waits for them
+		deploymentlog.Error(err, "check upstreams error", "namespace", deployment.Namespace, "name", deployment.Name)
+		return
+	}
+	if result.State == dependency.StateReady {
+		return
+	}
+	if utils.IsAdmissionDryRun(ctx, utils.App.Client, deployment.Namespace) {
+		recordDryRun(recorder, deployment, utils.EventReasonWouldHold, "dry-run: the release would have been held: %s", result.Reason)
+		return
+	}
+	deploymentlog.Info("hold the deployment until its upstreams succeed", "namespace", deployment.Namespace,
+		"name", deployment.Name, "state", result.State, "reason", result.Reason)
+	deployment.Spec.Paused = true
+	if deployment.Annotations == nil {
+		deployment.Annotations = map[string]string{}
+	}
+	deployment.Annotations[utils.DependencyHeldAnnotation] = utils.True
+}
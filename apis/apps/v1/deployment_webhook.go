@@ -18,20 +18,24 @@ package v1
 
 import (
 	"context"
-	"crypto/md5"
-	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"net/http"
 
 	admissionv1 "k8s.io/api/admission/v1"
 	v1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/revision"
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/suspend"
 	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/utils"
 	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/utils/native"
 )
@@ -81,6 +85,17 @@ func (v *DeploymentValidator) InjectRecorder(recorder record.EventRecorder) {
 func (v *DeploymentValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
 	deployment := &v1.Deployment{}
 
+	// 删除请求只有旧对象
+	// a delete request only carries the old object
+	if req.Operation == admissionv1.Delete {
+		if err := v.decoder.DecodeRaw(req.OldObject, deployment); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		if err := v.ValidateDelete(*deployment); err != nil {
+			return admission.Denied(err.Error())
+		}
+		return admission.Allowed("")
+	}
 	err := v.decoder.DecodeRaw(req.Object, deployment)
 	if err != nil {
 		return admission.Errored(http.StatusBadRequest, err)
@@ -101,15 +116,26 @@ func (v *DeploymentValidator) Handle(ctx context.Context, req admission.Request)
 		if err := v.ValidateUpdate(*deployment, *oldDeployment); err != nil {
 			return admission.Denied(err.Error())
 		}
+		if err := v.validateFreeze(ctx, req, *deployment, *oldDeployment); err != nil {
+			return admission.Denied(err.Error())
+		}
+		if err := v.validateConcurrency(ctx, req, *deployment, *oldDeployment); err != nil {
+			return admission.Denied(err.Error())
+		}
+		if !isDryRunRequest(req) {
+			notifyOverrides(ctx, req.UserInfo.Username, *deployment, *oldDeployment)
+			auditOverrides(ctx, string(req.UID), req.UserInfo.Username, "deployment", deployment, oldDeployment)
+		}
 		// v.recorder.Event(deployment, "Normal", "Updated", "Deployment updated")
-		return admission.Allowed("")
-	case admissionv1.Delete:
-		return admission.Allowed("")
+		if equality.Semantic.DeepEqual(oldDeployment.Spec.Template, deployment.Spec.Template) {
+			return admission.Allowed("")
+		}
+		return admission.Allowed("").WithWarnings(getDefendingWarnings(ctx, oldDeployment)...)
 	}
 	return admission.Allowed("")
 }
 
-//+kubebuilder:webhook:path=/mutate-apps-v1-deployment,mutating=true,failurePolicy=fail,sideEffects=None,groups=apps,resources=deployments,verbs=create;update,versions=v1,name=mdeployment.kb.io,admissionReviewVersions=v1
+//+kubebuilder:webhook:path=/mutate-apps-v1-deployment,mutating=true,failurePolicy=fail,sideEffects=NoneOnDryRun,groups=apps,resources=deployments,verbs=create;update,versions=v1,name=mdeployment.kb.io,admissionReviewVersions=v1
 
 // Handle validates the Deployment object
 func (m *DeploymentMutator) Handle(ctx context.Context, req admission.Request) admission.Response {
@@ -119,21 +145,34 @@ func (m *DeploymentMutator) Handle(ctx context.Context, req admission.Request) a
 	if err != nil {
 		return admission.Errored(http.StatusBadRequest, err)
 	}
-	// get the hash of the Deployment object
-	hash, err := getDeploymentTemplateHash(*deployment)
+	var oldTemplate *corev1.PodTemplateSpec
+	if req.Operation == admissionv1.Update {
+		oldDeployment := &v1.Deployment{}
+		if err := m.decoder.DecodeRaw(req.OldObject, oldDeployment); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		oldTemplate = &oldDeployment.Spec.Template
+	}
+	// get the version of the Deployment template
+	version, inputs, newRevision, err := getTemplateVersion(deployment.Spec.Template, oldTemplate)
 	if err != nil {
 		return admission.Errored(http.StatusInternalServerError, err)
 	}
-	// if the hash hasn't changed, admit the object
-	oldHash := deployment.Labels[native.AdmissionWebhookVersionLabel]
-	if oldHash == hash {
+	// if the version hasn't changed, admit the object
+	if deployment.Labels[native.AdmissionWebhookVersionLabel] == version && deployment.Spec.Template.Labels[native.AdmissionWebhookVersionLabel] == version {
 		return admission.Allowed("")
 	}
-	delete(deployment.Labels, utils.DefenseStatusLabel)
-	// set the hash as an annotation on the Deployment object
-	deployment.Labels[native.AdmissionWebhookVersionLabel] = hash
-	// set the hash as an annotation on the Deployment spec.template
-	deployment.Spec.Template.Labels[native.AdmissionWebhookVersionLabel] = hash
+	// set the version as a label on the Deployment object
+	setVersion(deployment, version, inputs, newRevision)
+	// set the version as a label on the Deployment spec.template
+	if deployment.Spec.Template.Labels == nil {
+		deployment.Spec.Template.Labels = map[string]string{}
+	}
+	deployment.Spec.Template.Labels[native.AdmissionWebhookVersionLabel] = version
+	if newRevision {
+		holdDependentDeployment(ctx, requestRecorder(m.recorder, req), deployment)
+		holdQueuedDeployment(ctx, requestRecorder(m.recorder, req), deployment)
+	}
 	patch, err := json.Marshal(deployment)
 	if err != nil {
 		return admission.Errored(http.StatusInternalServerError, err)
@@ -172,53 +211,236 @@ func (w *DeploymentWebhook) SetupWebhookWithManager(mgr manager.Manager) error {
 	return nil
 }
 
-// TODO(user): change verbs to "verbs=create;update;delete" if you want to enable deletion validation.
-//+kubebuilder:webhook:path=/validate-apps-v1-deployment,mutating=false,failurePolicy=fail,sideEffects=None,groups=apps,resources=deployments,verbs=create;update,versions=v1,name=vdeployment.kb.io,admissionReviewVersions=v1
+//+kubebuilder:webhook:path=/validate-apps-v1-deployment,mutating=false,failurePolicy=fail,sideEffects=NoneOnDryRun,groups=apps,resources=deployments,verbs=create;update;delete,versions=v1,name=vdeployment.kb.io,admissionReviewVersions=v1
 
 // ValidateCreate implements webhook.Validator so a webhook will be registered for the type
 func (v *DeploymentValidator) ValidateCreate(r v1.Deployment) error {
 	deploymentlog.Info("validate create", "name", r.Name)
 
-	// TODO(user): fill in your validation logic upon object creation.
-	return nil
+	if err := validateDependencies(r); err != nil {
+		return err
+	}
+	return validateDependencyCycle(context.Background(), r)
 }
 
 // ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
 func (v *DeploymentValidator) ValidateUpdate(r v1.Deployment, old v1.Deployment) error {
 	deploymentlog.Info("validate update", "name", r.Name)
 
-	// TODO(user): fill in your validation logic upon object update.
-	if _, ok := r.Labels[utils.IgnoredSuspendLabel]; ok {
+	if err := validateDependencies(r); err != nil {
+		return err
+	}
+	if r.Annotations[utils.DependsOnAnnotation] != old.Annotations[utils.DependsOnAnnotation] {
+		if err := validateDependencyCycle(context.Background(), r); err != nil {
+			return err
+		}
+	}
+	if !isSuspended(r.Labels, old.Labels) {
 		return nil
 	}
-	if _, ok := old.Labels[utils.SuspendLabel]; ok {
-		return fmt.Errorf("deployment %s is suspended", old.Name)
+	// 手动去掉暂停label需要带上忽略暂停的label
+	// removing the suspend label by hand takes the label ignoring the suspension
+	if _, ok := r.Labels[utils.SuspendLabel]; !ok {
+		return explainSuspension("deployment", &old, validateSuspended("deployment", old.Name, r.Labels, old.Labels))
 	}
-	return nil
+	policy, ok := getSuspendPolicy()
+	if !ok {
+		return explainSuspension("deployment", &old, validateSuspended("deployment", old.Name, r.Labels, old.Labels))
+	}
+	oldSpec, newSpec := old.Spec.DeepCopy(), r.Spec.DeepCopy()
+	oldSpec.Replicas, newSpec.Replicas = nil, nil
+	oldSpec.Template, newSpec.Template = corev1.PodTemplateSpec{}, corev1.PodTemplateSpec{}
+	return explainSuspension("deployment", &old, policy.ValidateUpdate("deployment", old.Name, suspend.Update{
+		OldReplicas:      getReplicas(old.Spec.Replicas),
+		NewReplicas:      getReplicas(r.Spec.Replicas),
+		Version:          r.Spec.Template.Labels[native.AdmissionWebhookVersionLabel],
+		VerifiedRevision: old.Annotations[utils.VerifiedRevisionAnnotation],
+		TemplateChanged:  !equality.Semantic.DeepEqual(old.Spec.Template, r.Spec.Template),
+		OtherSpecChanged: !equality.Semantic.DeepEqual(oldSpec, newSpec),
+	}))
 }
 
 // ValidateDelete implements webhook.Validator so a webhook will be registered for the type
 func (v *DeploymentValidator) ValidateDelete(r v1.Deployment) error {
 	deploymentlog.Info("validate delete", "name", r.Name)
 
-	// TODO(user): fill in your validation logic upon object deletion.
+	if !isSuspended(r.Labels, r.Labels) {
+		return nil
+	}
+	// 删除namespace时不阻塞其中的deployment
+	// the deployments of a namespace being deleted are not blocked
+	namespace := &corev1.Namespace{}
+	if err := utils.App.Client.Get(context.Background(), client.ObjectKey{Name: r.Namespace}, namespace); err == nil && namespace.DeletionTimestamp != nil {
+		return nil
+	}
+	policy, ok := getSuspendPolicy()
+	if !ok {
+		return nil
+	}
+	return explainSuspension("deployment", &r, policy.ValidateDelete("deployment", r.Name))
+}
+
+// recordDryRun 观察模式下记录本应执行的拒绝或者暂停
+// recordDryRun records the denial or the hold that would have been made outside of dry-run mode
+func recordDryRun(recorder record.EventRecorder, object runtime.Object, reason string, messageFmt string, args ...interface{}) {
+	deploymentlog.Info("dry-run: "+reason, "message", fmt.Sprintf(messageFmt, args...))
+	if recorder != nil {
+		recorder.Eventf(object, corev1.EventTypeWarning, reason, messageFmt, args...)
+	}
+}
+
+// isDryRunRequest 试运行的请求不产生通知、审计记录和事件等副作用
+// isDryRunRequest a dry-run request makes no side effects such as the notifications, the audit records and the events
+func isDryRunRequest(req admission.Request) bool {
+	return req.DryRun != nil && *req.DryRun
+}
+
+// requestRecorder 试运行的请求不记录事件，返回nil
+// requestRecorder returns nil for a dry-run request so no event is recorded
+func requestRecorder(recorder record.EventRecorder, req admission.Request) record.EventRecorder {
+	if isDryRunRequest(req) {
+		return nil
+	}
+	return recorder
+}
+
+// getSuspendPolicy 不等待地读取全局配置的暂停策略，没有配置或者配置还没有就绪时返回false，此时拒绝被暂停的deployment的所有更新
+// getSuspendPolicy reads the suspend policy from the global config without waiting, it returns false without one or
+// before it is ready and every update of a suspended deployment is denied then
+func getSuspendPolicy() (suspend.Policy, bool) {
+	content := utils.CurrentConfigSuspend()
+	if content == "" {
+		return suspend.Policy{}, false
+	}
+	policy, err := suspend.ParsePolicy(content)
+	if err != nil {
+		deploymentlog.Error(err, "parse suspend policy error")
+		return suspend.Policy{}, false
+	}
+	return policy, true
+}
+
+// isSuspended 旧对象是否被暂停并且新对象没有带上忽略暂停的label
+// isSuspended reports whether the old object is suspended and the new one doesn't carry the label ignoring the suspension
+func isSuspended(labels map[string]string, oldLabels map[string]string) bool {
+	if _, ok := labels[utils.IgnoredSuspendLabel]; ok {
+		return false
+	}
+	_, ok := oldLabels[utils.SuspendLabel]
+	return ok
+}
+
+// isSuspensionBypassed 被暂停的工作负载的更新带上了忽略暂停的标签，暂停校验被跳过
+// isSuspensionBypassed whether an update of a suspended workload carries the label ignoring the suspension, so the
+// suspension check is skipped
+func isSuspensionBypassed(labels map[string]string, oldLabels map[string]string) bool {
+	_, suspended := oldLabels[utils.SuspendLabel]
+	return suspended && !isSuspended(labels, oldLabels)
+}
+
+// getReplicas 没有设置副本数时默认1个
+// getReplicas defaults the unset replicas to 1
+func getReplicas(replicas *int32) int32 {
+	if replicas == nil {
+		return 1
+	}
+	return *replicas
+}
+
+// getRevisionHashConfig 不等待地读取全局配置的版本hash忽略列表，没有配置或者配置还没有就绪时不忽略任何内容
+// getRevisionHashConfig reads the ignore list of the revision hash from the global config without waiting, nothing is
+// ignored without it or before it is ready
+func getRevisionHashConfig() revision.Config {
+	content := utils.CurrentConfigRevisionHash()
+	if content == "" {
+		return revision.DefaultConfig
+	}
+	config, err := revision.ParseConfig(content)
+	if err != nil {
+		deploymentlog.Error(err, "parse revision hash config error")
+		return revision.DefaultConfig
+	}
+	return config
+}
+
+// validateSuspended 拒绝更新被暂停的工作负载，带上忽略暂停label的更新除外
+// validateSuspended denies the updates of a suspended workload except the ones carrying the label ignoring the suspension
+func validateSuspended(kind string, name string, labels map[string]string, oldLabels map[string]string) error {
+	if _, ok := labels[utils.IgnoredSuspendLabel]; ok {
+		return nil
+	}
+	if _, ok := oldLabels[utils.SuspendLabel]; ok {
+		return fmt.Errorf("%s %s is suspended", kind, name)
+	}
 	return nil
 }
 
-// getTemplateHash 计算 PodTemplateSpec 的 32 长度的 hash 值
-func getDeploymentTemplateHash(deployment v1.Deployment) (string, error) {
-	// 获取template，将label中的version字段删除，生成一个hash值，作为新的version
-	deploymentTemplate := deployment.Spec.Template
-	delete(deploymentTemplate.Labels, native.AdmissionWebhookVersionLabel)
-	//记录日志
-	logger := utils.NewLogger().WithName("getHash")
-	//将deploymentTemplate转换为json格式
-	jsonBytes, err := json.Marshal(deploymentTemplate)
+// getTemplateVersion 计算pod模板的版本，规范化后的模板没有变化时沿用原来的版本，包括旧的hash算法得到的版本，修改忽略列表或者升级
+// operator都不会产生新的版本。oldTemplate在创建时为nil
+// getTemplateVersion computes the version of the pod template, the current version is kept while the canonical template
+// is unchanged, including a version hashed by the former algorithm, so neither editing the ignore list nor upgrading the
+// operator makes a new revision. oldTemplate is nil on create
+func getTemplateVersion(template corev1.PodTemplateSpec, oldTemplate *corev1.PodTemplateSpec) (version string, inputs []byte, newRevision bool, err error) {
+	config := getRevisionHashConfig()
+	if version, inputs, err = getTemplateHash(template, config); err != nil {
+		return "", nil, false, err
+	}
+	if oldTemplate == nil {
+		return version, inputs, true, nil
+	}
+	oldVersion, ok := oldTemplate.Labels[native.AdmissionWebhookVersionLabel]
+	if !ok {
+		return version, inputs, true, nil
+	}
+	oldHash, _, err := getTemplateHash(*oldTemplate, config)
+	if err != nil {
+		return "", nil, false, err
+	}
+	if oldHash == version {
+		return oldVersion, inputs, false, nil
+	}
+	return version, inputs, true, nil
+}
+
+// setVersion 给工作负载打上版本label，新的版本重新从模板发布开始防御并记录hash的摘要
+// setVersion sets the version label of the workload, a new revision starts its defense over from the template rollout
+// and records the summary of its hash
+func setVersion(object metav1.Object, version string, inputs []byte, newRevision bool) {
+	labels := object.GetLabels()
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	if newRevision && labels[native.AdmissionWebhookVersionLabel] != version {
+		delete(labels, utils.DefenseStatusLabel)
+		annotations := object.GetAnnotations()
+		if annotations == nil {
+			annotations = map[string]string{}
+		}
+		// 新的版本重新从模板发布开始防御
+		// the defense of a new revision starts over from its template rollout
+		delete(annotations, utils.ChangeRevisionAnnotation)
+		// 只记录字段路径和取值的hash，完整的模板可能很大并且包含密钥
+		// only the field paths and the hashes of their values are recorded, the full template may be large and hold credentials
+		if summary, err := revision.Summarize(version, inputs); err == nil {
+			annotations[utils.RevisionHashSummaryAnnotation] = summary
+		} else {
+			utils.NewLogger().WithName("setVersion").Error(err, "summarize revision hash error")
+		}
+		object.SetAnnotations(annotations)
+	}
+	labels[native.AdmissionWebhookVersionLabel] = version
+	object.SetLabels(labels)
+}
+
+// getTemplateHash 计算规范化后的PodTemplateSpec的32位SHA-256 hash，同时返回参与计算的内容，version label本身不参与计算
+// getTemplateHash computes the 32 character SHA-256 hash of the canonical PodTemplateSpec along with the content it is
+// computed over, the version label itself is left out
+func getTemplateHash(template corev1.PodTemplateSpec, config revision.Config) (string, []byte, error) {
+	config.IgnoredLabels = append([]string{native.AdmissionWebhookVersionLabel}, config.IgnoredLabels...)
+	hash, inputs, err := revision.Hash(template, config)
 	if err != nil {
-		logger.Error(err, fmt.Sprintf("Error marshalling object: %v", err))
-		return "", err
+		utils.NewLogger().WithName("getHash").Error(err, "hash pod template error")
+		return "", nil, err
 	}
-	//计算json格式的hash值
-	hashBytes := md5.Sum(jsonBytes)
-	return hex.EncodeToString(hashBytes[:]), nil
+	return hash, inputs, nil
 }
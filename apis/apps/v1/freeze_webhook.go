@@ -0,0 +1,137 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	v1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/apis/app.ops.cloud.alipay.com/v1alpha1"
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/freeze"
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/utils"
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/utils/native"
+)
+
+// validateFreeze 拒绝冻结窗口内的deployment模板更新
+// validateFreeze denies the template updates of a deployment inside a freeze window
+func (v *DeploymentValidator) validateFreeze(ctx context.Context, req admission.Request, r v1.Deployment, old v1.Deployment) error {
+	templateChanged := !equality.Semantic.DeepEqual(old.Spec.Template, r.Spec.Template)
+	return validateFreezeWindows(ctx, v.recorder, "deployment", req, &r, &old, templateChanged)
+}
+
+// validateFreezeWindows 拒绝冻结窗口内的工作负载模板更新，带上新的强制更新原因时放行，不是试运行的请求记录事件和审计记录，观察模式下只记录
+// 本应拒绝的事件
+// validateFreezeWindows denies the template updates of a workload inside a freeze window, an update with a new
+// break-glass reason is allowed and recorded in an event and an audit record unless the request is a dry run, only the
+// would-deny event is recorded in dry-run mode
+func validateFreezeWindows(ctx context.Context, recorder record.EventRecorder, kind string, req admission.Request, r client.Object, old metav1.Object, templateChanged bool) error {
+	if !templateChanged {
+		return nil
+	}
+	windows, err := getFreezeWindows(ctx, r.GetNamespace(), r.GetName(), r.GetLabels())
+	if err != nil {
+		// 读取冻结窗口失败时不阻塞发布
+		// the releases are not blocked when the freeze windows can't be read
+		deploymentlog.Error(err, "get freeze windows error", "namespace", r.GetNamespace(), "name", r.GetName())
+		return nil
+	}
+	if len(windows) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(windows))
+	for _, window := range windows {
+		names = append(names, window.Name)
+	}
+	if reason := r.GetAnnotations()[utils.FreezeBreakGlassAnnotation]; reason != "" && reason != old.GetAnnotations()[utils.FreezeBreakGlassAnnotation] {
+		username := req.UserInfo.Username
+		deploymentlog.Info("break the glass of the freeze windows", "kind", kind, "namespace", r.GetNamespace(), "name", r.GetName(),
+			"windows", names, "user", username, "reason", reason)
+		// 试运行的请求不记录事件和审计记录
+		// a dry-run request records neither the event nor the audit record
+		if isDryRunRequest(req) {
+			return nil
+		}
+		if recorder != nil {
+			recorder.Eventf(r, corev1.EventTypeWarning, utils.EventReasonFreezeBreakGlass,
+				"%s broke the glass of the freeze windows %s: %s", username, strings.Join(names, ","), reason)
+		}
+		recordAdmissionAudit(ctx, string(req.UID), r, v1alpha1.AuditRecordSpec{
+			Action:   v1alpha1.AuditBreakGlass,
+			User:     username,
+			Kind:     kind,
+			Revision: r.GetLabels()[native.AdmissionWebhookVersionLabel],
+			Message:  fmt.Sprintf("%s broke the glass of the freeze windows %s: %s", username, strings.Join(names, ","), reason),
+			Details:  map[string]string{"windows": strings.Join(names, ","), "reason": reason},
+		})
+		return nil
+	}
+	window := windows[0]
+	message := fmt.Sprintf("%s %s is frozen by the change freeze window %s until %s", kind, r.GetName(), window.Name,
+		window.Status.ActiveEnd.UTC().Format(time.RFC3339))
+	if window.Spec.Reason != "" {
+		message = fmt.Sprintf("%s: %s", message, window.Spec.Reason)
+	}
+	if utils.IsAdmissionDryRun(ctx, utils.App.Client, r.GetNamespace()) {
+		recordDryRun(requestRecorder(recorder, req), r, utils.EventReasonWouldDeny, "dry-run: the update would have been denied, %s", message)
+		return nil
+	}
+	return fmt.Errorf("%s, set the annotation %s to a new reason to break the glass", message, utils.FreezeBreakGlassAnnotation)
+}
+
+// getFreezeWindows 返回现在生效并且冻结这个工作负载的窗口，窗口的状态按现在计算
+// getFreezeWindows returns the windows in effect now that freeze the workload, their status is computed for now
+func getFreezeWindows(ctx context.Context, namespace string, name string, labels map[string]string) ([]v1alpha1.ChangeFreezeWindow, error) {
+	windowList := &v1alpha1.ChangeFreezeWindowList{}
+	if err := utils.App.Client.List(ctx, windowList); err != nil {
+		return nil, err
+	}
+	if len(windowList.Items) == 0 {
+		return nil, nil
+	}
+	ns := &corev1.Namespace{}
+	if err := utils.App.Client.Get(ctx, client.ObjectKey{Name: namespace}, ns); err != nil {
+		return nil, err
+	}
+	target := freeze.Target{Namespace: namespace, Name: name, Labels: labels, NamespaceLabels: ns.Labels}
+	now := time.Now()
+	windows := make([]v1alpha1.ChangeFreezeWindow, 0)
+	for _, window := range windowList.Items {
+		window.Status = freeze.StatusAt(&window.Spec, now)
+		if !window.Status.Active {
+			continue
+		}
+		selected, err := freeze.Selects(&window.Spec, target)
+		if err != nil {
+			deploymentlog.Error(err, "select freeze window error", "window", window.Name)
+			continue
+		}
+		if selected {
+			windows = append(windows, window)
+		}
+	}
+	return windows, nil
+}
@@ -0,0 +1,97 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	v1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/notify"
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/utils"
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/utils/native"
+)
+
+// notifyOverrides 通知用户手动绕过防御的更新：恢复被暂停的deployment，或者在冻结窗口内强制更新
+// notifyOverrides notifies the updates overriding the defense by hand: resuming a suspended deployment, or breaking the
+// glass of a freeze window. The sinks are read without waiting for the config, nothing is notified before it is ready
+func notifyOverrides(ctx context.Context, username string, r v1.Deployment, old v1.Deployment) {
+	config := notify.GetConfig(utils.CurrentConfigNotification())
+	if len(config.Sinks) == 0 {
+		return
+	}
+	var messages []string
+	if message := describeResume(ctx, username, r, old); message != "" {
+		messages = append(messages, message)
+	}
+	if message := describeBreakGlass(ctx, username, r, old); message != "" {
+		messages = append(messages, message)
+	}
+	if len(messages) == 0 {
+		return
+	}
+	sent := notify.DefaultNotifier.Notify(config, notify.Event{
+		Type:      notify.EventOverride,
+		Namespace: r.Namespace,
+		Kind:      "deployment",
+		Name:      r.Name,
+		Revision:  r.Labels[native.AdmissionWebhookVersionLabel],
+		Message:   strings.Join(messages, "; "),
+		User:      username,
+		Time:      time.Now(),
+	})
+	deploymentlog.Info("notify the override", "namespace", r.Namespace, "name", r.Name, "user", username, "sinks", sent)
+}
+
+// describeResume 用户带上忽略暂停的标签绕过暂停时返回说明，operator在校验通过后自己恢复的不算
+// describeResume describes a user bypassing the suspension with the label ignoring it, the operator lifting the
+// suspension after the check passes is not an override
+func describeResume(ctx context.Context, username string, r v1.Deployment, old v1.Deployment) string {
+	workload, bypassed := getBypassedChangeWorkload(ctx, &r, &old)
+	if !bypassed {
+		return ""
+	}
+	if workload == nil {
+		return fmt.Sprintf("%s resumed the suspended deployment", username)
+	}
+	return fmt.Sprintf("%s resumed the deployment suspended by the ChangeWorkload %s", username, workload.Name)
+}
+
+// describeBreakGlass 用户带上新的强制更新原因在冻结窗口内更新模板时返回说明
+// describeBreakGlass describes a user updating the template inside a freeze window with a new break-glass reason
+func describeBreakGlass(ctx context.Context, username string, r v1.Deployment, old v1.Deployment) string {
+	reason := r.Annotations[utils.FreezeBreakGlassAnnotation]
+	if reason == "" || reason == old.Annotations[utils.FreezeBreakGlassAnnotation] {
+		return ""
+	}
+	if equality.Semantic.DeepEqual(old.Spec.Template, r.Spec.Template) {
+		return ""
+	}
+	windows, err := getFreezeWindows(ctx, r.Namespace, r.Name, r.Labels)
+	if err != nil || len(windows) == 0 {
+		return ""
+	}
+	names := make([]string, 0, len(windows))
+	for _, window := range windows {
+		names = append(names, window.Name)
+	}
+	return fmt.Sprintf("%s broke the glass of the freeze windows %s: %s", username, strings.Join(names, ","), reason)
+}
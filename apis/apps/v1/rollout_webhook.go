@@ -0,0 +1,79 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/utils/native"
+)
+
+// RolloutMutator 和Deployment一样给Argo Rollout的模板打上版本label，Rollout通过unstructured读写，不会丢失未知字段
+// RolloutMutator sets the version label of the template of an Argo Rollout like the Deployment one, the Rollout is read
+// and written as unstructured so no unknown field is lost
+type RolloutMutator struct{}
+
+// RolloutValidator 和Deployment一样校验Argo Rollout的更新
+// RolloutValidator validates the updates of an Argo Rollout like the Deployment one
+type RolloutValidator struct {
+	recorder record.EventRecorder
+}
+
+// rolloutWorkload Argo Rollouts控制器会写入spec.paused
+// rolloutWorkload is an Argo Rollout, the Argo Rollouts controller writes spec.paused
+var rolloutWorkload = templateWorkload{
+	kind:             "rollout",
+	getReplicas:      native.GetRolloutReplicas,
+	controllerFields: [][]string{{"spec", "paused"}},
+}
+
+//+kubebuilder:webhook:path=/mutate-argoproj-io-v1alpha1-rollout,mutating=true,failurePolicy=fail,sideEffects=NoneOnDryRun,groups=argoproj.io,resources=rollouts,verbs=create;update,versions=v1alpha1,name=mrollout.kb.io,admissionReviewVersions=v1
+
+// Handle sets the version label of the Rollout
+func (m *RolloutMutator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	return mutateTemplate(req, native.GetRolloutTemplate)
+}
+
+//+kubebuilder:webhook:path=/validate-argoproj-io-v1alpha1-rollout,mutating=false,failurePolicy=fail,sideEffects=NoneOnDryRun,groups=argoproj.io,resources=rollouts,verbs=update,versions=v1alpha1,name=vrollout.kb.io,admissionReviewVersions=v1
+
+// Handle validates the Rollout object, the pause written by the Argo Rollouts controller is not a spec change
+func (v *RolloutValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	return validateTemplate(ctx, v.recorder, rolloutWorkload, req)
+}
+
+// RolloutWebhook is an Admission Webhook for Argo Rollout objects
+type RolloutWebhook struct {
+	Validator *RolloutValidator
+	Mutator   *RolloutMutator
+}
+
+// SetupWebhookWithManager registers the Admission Webhook, it is harmless without the Rollout CRD installed
+func (w *RolloutWebhook) SetupWebhookWithManager(mgr manager.Manager) error {
+	w.Validator = &RolloutValidator{recorder: mgr.GetEventRecorderFor("rollout-validator")}
+	w.Mutator = &RolloutMutator{}
+	mgr.GetWebhookServer().Register("/validate-argoproj-io-v1alpha1-rollout", &admission.Webhook{
+		Handler: admission.HandlerFunc(w.Validator.Handle),
+	})
+	mgr.GetWebhookServer().Register("/mutate-argoproj-io-v1alpha1-rollout", &admission.Webhook{
+		Handler: admission.HandlerFunc(w.Mutator.Handle),
+	})
+	return nil
+}
@@ -0,0 +1,165 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/apis/app.ops.cloud.alipay.com/v1alpha1"
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/utils"
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/utils/native"
+)
+
+// maxFailedPodsInReason 拒绝原因中最多列出的校验失败的pod
+// maxFailedPodsInReason the most failed pods listed in a denial reason
+const maxFailedPodsInReason = 5
+
+// explainSuspension 在被暂停的工作负载的拒绝原因后补充暂停的时间、暂停它的ChangeWorkload、校验失败的pod和原因，以及如何恢复或者回滚
+// explainSuspension follows the denial of a suspended workload with when it was suspended, the ChangeWorkload suspending
+// it, the failed pods with their verdicts and how to resume or roll it back
+func explainSuspension(kind string, object metav1.Object, err error) error {
+	if err == nil {
+		return nil
+	}
+	suspendedAt, ok := object.GetLabels()[utils.SuspendLabel]
+	if !ok {
+		return err
+	}
+	workload, getErr := getSuspendingChangeWorkload(context.Background(), object)
+	if getErr != nil {
+		// 读取ChangeWorkload失败时只省略详细信息
+		// only the details are left out when the ChangeWorkload can't be read
+		deploymentlog.Error(getErr, "get suspending change workload error", "namespace", object.GetNamespace(), "name", object.GetName())
+	}
+	reason := err.Error() + "."
+	if unix, parseErr := strconv.ParseInt(suspendedAt, utils.NumberTen, 64); parseErr == nil {
+		reason = fmt.Sprintf("%s It was suspended at %s", reason, time.Unix(unix, 0).UTC().Format(time.RFC3339))
+		if workload != nil {
+			reason = fmt.Sprintf("%s by the ChangeWorkload %s", reason, workload.Name)
+		}
+		reason += "."
+	} else if workload != nil {
+		reason = fmt.Sprintf("%s It was suspended by the ChangeWorkload %s.", reason, workload.Name)
+	}
+	if workload != nil && len(workload.Status.DefenseCheckFailPods) > 0 {
+		reason = fmt.Sprintf("%s Failed pods: %s.", reason, describeFailedPods(workload.Status.DefenseCheckFailPods))
+	}
+	hint := fmt.Sprintf("To resume, remove the label %s and add the label %s=%s.", utils.SuspendLabel, utils.IgnoredSuspendLabel, utils.True)
+	// 只有deployment可以按策略回滚到校验通过的版本
+	// only a deployment may roll back to the verified revision by the policy
+	if verified := object.GetAnnotations()[utils.VerifiedRevisionAnnotation]; verified != "" && kind == "deployment" {
+		if policy, ok := getSuspendPolicy(); ok && policy.AllowVerifiedRevision {
+			hint = fmt.Sprintf("Roll back to the verified revision %s, or remove the label %s and add the label %s=%s to resume.",
+				verified, utils.SuspendLabel, utils.IgnoredSuspendLabel, utils.True)
+		}
+	}
+	return fmt.Errorf("%s %s", reason, hint)
+}
+
+// describeFailedPods 列出校验失败的pod和原因，超过maxFailedPodsInReason的只给出数量
+// describeFailedPods lists the failed pods with their verdicts, the ones beyond maxFailedPodsInReason are only counted
+func describeFailedPods(pods []v1alpha1.PodSummary) string {
+	described := make([]string, 0, maxFailedPodsInReason+1)
+	for i, pod := range pods {
+		if i == maxFailedPodsInReason {
+			described = append(described, fmt.Sprintf("and %d more", len(pods)-maxFailedPodsInReason))
+			break
+		}
+		verdict := pod.Verdict
+		if verdict == "" {
+			verdict = utils.ChangePodVerdictFail
+		}
+		if pod.Message != "" {
+			verdict = fmt.Sprintf("%s: %s", verdict, pod.Message)
+		}
+		described = append(described, fmt.Sprintf("%s (%s)", pod.Pod, verdict))
+	}
+	return strings.Join(described, ", ")
+}
+
+// getSuspendingChangeWorkload 获取暂停工作负载的最近一个ChangeWorkload，没有时返回nil
+// getSuspendingChangeWorkload gets the latest ChangeWorkload suspending the workload, it is nil without one
+func getSuspendingChangeWorkload(ctx context.Context, object metav1.Object) (*v1alpha1.ChangeWorkload, error) {
+	workloadList := &v1alpha1.ChangeWorkloadList{}
+	if err := utils.App.Client.List(ctx, workloadList, client.InNamespace(object.GetNamespace()),
+		client.MatchingLabels{native.DeploymentNameLabel: object.GetName()}); err != nil {
+		return nil, err
+	}
+	var suspending *v1alpha1.ChangeWorkload
+	for i := range workloadList.Items {
+		workload := &workloadList.Items[i]
+		if workload.Status.Status != v1alpha1.Suspend {
+			continue
+		}
+		if suspending == nil || workload.Spec.CreateTimeUnix > suspending.Spec.CreateTimeUnix {
+			suspending = workload
+		}
+	}
+	return suspending, nil
+}
+
+// getBypassedChangeWorkload 被暂停的工作负载的更新带上忽略暂停的标签跳过了暂停校验时返回true和暂停它的ChangeWorkload，读取不到
+// ChangeWorkload时只返回true。operator在校验通过后自己解除暂停时ChangeWorkload不是Suspend状态，不算绕过
+// getBypassedChangeWorkload returns true with the ChangeWorkload suspending the workload when an update of the suspended
+// workload skipped the suspension check with the label ignoring the suspension, only true is returned when the
+// ChangeWorkload can't be read. The operator lifting the suspension itself after the checks pass is not a bypass
+// because the ChangeWorkload is not Suspend then
+func getBypassedChangeWorkload(ctx context.Context, object metav1.Object, old metav1.Object) (*v1alpha1.ChangeWorkload, bool) {
+	if !isSuspensionBypassed(object.GetLabels(), old.GetLabels()) {
+		return nil, false
+	}
+	workload := &v1alpha1.ChangeWorkload{}
+	if err := utils.App.Client.Get(ctx, client.ObjectKey{Namespace: old.GetNamespace(), Name: native.GetChangeWorkloadName(old)}, workload); err != nil {
+		return nil, true
+	}
+	if workload.Status.Status != v1alpha1.Suspend {
+		return nil, false
+	}
+	return workload, true
+}
+
+// getDefendingWarnings 旧版本的变更还在防御中时提醒新版本会在它结束前开始自己的变更
+// getDefendingWarnings warns that the new revision starts its own change before the change of the previous revision,
+// which is still being defended, finishes
+func getDefendingWarnings(ctx context.Context, old metav1.Object) []string {
+	version := old.GetLabels()[native.AdmissionWebhookVersionLabel]
+	if version == "" {
+		return nil
+	}
+	workload := &v1alpha1.ChangeWorkload{}
+	if err := utils.App.Client.Get(ctx, client.ObjectKey{Namespace: old.GetNamespace(), Name: native.GetChangeWorkloadName(old)}, workload); err != nil {
+		return nil
+	}
+	status := workload.Status.Status
+	switch status {
+	case v1alpha1.Init:
+		status = "Init"
+	case v1alpha1.Running, v1alpha1.TimeOutPreThreshold, v1alpha1.Queued:
+	default:
+		return nil
+	}
+	return []string{fmt.Sprintf("the change %s of the previous revision %s is still being defended (%s, %d pods passed and %d failed the checks), "+
+		"the new revision starts its own change before that one finishes", workload.Name, version, status,
+		len(workload.Status.DefenseCheckPassPods), len(workload.Status.DefenseCheckFailPods))}
+}
@@ -0,0 +1,206 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+	"net/http"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/suspend"
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/utils"
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/utils/native"
+)
+
+// templateGetter 读取第三方工作负载的pod模板，没有模板时返回false
+// templateGetter reads the pod template of a third-party workload, it returns false without a template
+type templateGetter func(object *unstructured.Unstructured) (*corev1.PodTemplateSpec, bool, error)
+
+// mutateTemplate 和Deployment一样给第三方工作负载的模板打上版本label，工作负载通过unstructured读写，不会丢失未知字段
+// mutateTemplate sets the version label of the template of a third-party workload like the Deployment one, the workload
+// is read and written as unstructured so no unknown field is lost
+func mutateTemplate(req admission.Request, getTemplate templateGetter) admission.Response {
+	object := &unstructured.Unstructured{}
+	if err := object.UnmarshalJSON(req.Object.Raw); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	template, found, err := getTemplate(object)
+	if err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	// 没有模板的工作负载不防御，例如通过workloadRef引用Deployment模板的Rollout
+	// a workload without a template is not defended, such as a Rollout referencing the template of a Deployment by workloadRef
+	if !found {
+		return admission.Allowed("")
+	}
+	var oldTemplate *corev1.PodTemplateSpec
+	if req.Operation == admissionv1.Update {
+		oldObject := &unstructured.Unstructured{}
+		if err := oldObject.UnmarshalJSON(req.OldObject.Raw); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		if oldTemplate, found, err = getTemplate(oldObject); err != nil || !found {
+			oldTemplate = nil
+		}
+	}
+	version, inputs, newRevision, err := getTemplateVersion(*template, oldTemplate)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	// if the version hasn't changed, admit the object
+	if object.GetLabels()[native.AdmissionWebhookVersionLabel] == version && template.Labels[native.AdmissionWebhookVersionLabel] == version {
+		return admission.Allowed("")
+	}
+	setVersion(object, version, inputs, newRevision)
+	if err := unstructured.SetNestedField(object.Object, version, "spec", "template", "metadata", "labels", native.AdmissionWebhookVersionLabel); err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	patch, err := object.MarshalJSON()
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	return admission.PatchResponseFromRaw(req.Object.Raw, patch)
+}
+
+// templateWorkload 描述第三方工作负载在校验时需要的字段
+// templateWorkload describes the fields of a third-party workload needed by the validation
+type templateWorkload struct {
+	// kind 工作负载的类型
+	// kind is the kind of the workload
+	kind string
+	// getReplicas 读取工作负载的副本数
+	// getReplicas reads the replicas of the workload
+	getReplicas func(object *unstructured.Unstructured) int32
+	// partitionFields 工作负载partition的字段，没有partition时为空，调小partition会放出更多pod，视为spec变化
+	// partitionFields are the fields of the partition of the workload, empty without one, lowering the partition lets
+	// more pods out so it is a spec change
+	partitionFields []string
+	// getPartition 读取工作负载的partition
+	// getPartition reads the partition of the workload
+	getPartition func(object *unstructured.Unstructured) int32
+	// controllerFields 第三方控制器或者operator写入的spec字段，不视为spec变化
+	// controllerFields are the spec fields written by the third-party controller or the operator, they are not a spec change
+	controllerFields [][]string
+}
+
+// validateTemplate 和Deployment一样依次校验第三方工作负载的暂停策略、冻结窗口和并发限制，第三方控制器和operator写入的spec字段不视为
+// 变化，例如Rollout的暂停和CloneSet的partition
+// validateTemplate validates the suspend policy, the freeze windows and the concurrency limit of a third-party workload
+// in turn like the Deployment one, the spec fields written by the third-party controller and the operator are not
+// changes, such as the pause of a Rollout and the partition of a CloneSet
+func validateTemplate(ctx context.Context, recorder record.EventRecorder, workload templateWorkload, req admission.Request) admission.Response {
+	if req.Operation != admissionv1.Update {
+		return admission.Allowed("")
+	}
+	object := &unstructured.Unstructured{}
+	if err := object.UnmarshalJSON(req.Object.Raw); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	oldObject := &unstructured.Unstructured{}
+	if err := oldObject.UnmarshalJSON(req.OldObject.Raw); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	template, _, _ := unstructured.NestedMap(object.Object, "spec", "template")
+	oldTemplate, _, _ := unstructured.NestedMap(oldObject.Object, "spec", "template")
+	templateChanged := !equality.Semantic.DeepEqual(template, oldTemplate)
+	if err := validateTemplateSuspended(workload, object, oldObject, templateChanged); err != nil {
+		return admission.Denied(explainSuspension(workload.kind, oldObject, err).Error())
+	}
+	if err := validateFreezeWindows(ctx, recorder, workload.kind, req, object, oldObject, templateChanged); err != nil {
+		return admission.Denied(err.Error())
+	}
+	if err := validateConcurrencyLimit(ctx, requestRecorder(recorder, req), workload.kind, object, templateChanged); err != nil {
+		return admission.Denied(err.Error())
+	}
+	if !isDryRunRequest(req) {
+		auditOverrides(ctx, string(req.UID), req.UserInfo.Username, workload.kind, object, oldObject)
+	}
+	if !templateChanged {
+		return admission.Allowed("")
+	}
+	return admission.Allowed("").WithWarnings(getDefendingWarnings(ctx, oldObject)...)
+}
+
+// validateTemplateSuspended 和Deployment一样按暂停策略校验被暂停的第三方工作负载的更新，没有策略时拒绝模板、副本数和其他spec的变化
+// validateTemplateSuspended validates the updates of a suspended third-party workload by the suspend policy like the
+// Deployment one, the changes of the template, the replicas and the rest of the spec are denied without a policy
+func validateTemplateSuspended(workload templateWorkload, object *unstructured.Unstructured, oldObject *unstructured.Unstructured, templateChanged bool) error {
+	if !isSuspended(object.GetLabels(), oldObject.GetLabels()) {
+		return nil
+	}
+	// 手动去掉暂停label需要带上忽略暂停的label
+	// removing the suspend label by hand takes the label ignoring the suspension
+	if _, ok := object.GetLabels()[utils.SuspendLabel]; !ok {
+		return validateSuspended(workload.kind, oldObject.GetName(), object.GetLabels(), oldObject.GetLabels())
+	}
+	update := suspend.Update{
+		OldReplicas:      workload.getReplicas(oldObject),
+		NewReplicas:      workload.getReplicas(object),
+		VerifiedRevision: oldObject.GetAnnotations()[utils.VerifiedRevisionAnnotation],
+		TemplateChanged:  templateChanged,
+		OtherSpecChanged: isOtherSpecChanged(workload, object, oldObject),
+	}
+	if template, found, err := unstructured.NestedStringMap(object.Object, "spec", "template", "metadata", "labels"); err == nil && found {
+		update.Version = template[native.AdmissionWebhookVersionLabel]
+	}
+	policy, ok := getSuspendPolicy()
+	if !ok {
+		if update.TemplateChanged || update.OtherSpecChanged || update.OldReplicas != update.NewReplicas {
+			return validateSuspended(workload.kind, oldObject.GetName(), object.GetLabels(), oldObject.GetLabels())
+		}
+		return nil
+	}
+	return policy.ValidateUpdate(workload.kind, oldObject.GetName(), update)
+}
+
+// isOtherSpecChanged 副本数和模板以外的spec是否变化，控制器写入的字段除外，调小partition视为变化
+// isOtherSpecChanged reports whether the spec other than the replicas and the template has changed, except the fields
+// written by the controllers, lowering the partition is a change
+func isOtherSpecChanged(workload templateWorkload, object *unstructured.Unstructured, oldObject *unstructured.Unstructured) bool {
+	if len(workload.partitionFields) > 0 && workload.getPartition(object) < workload.getPartition(oldObject) {
+		return true
+	}
+	spec, _, _ := unstructured.NestedMap(object.Object, "spec")
+	oldSpec, _, _ := unstructured.NestedMap(oldObject.Object, "spec")
+	fields := append([][]string{{"spec", "replicas"}, {"spec", "template"}}, workload.controllerFields...)
+	if len(workload.partitionFields) > 0 {
+		fields = append(fields, workload.partitionFields)
+	}
+	for _, field := range fields {
+		removeSpecField(spec, field[1:])
+		removeSpecField(oldSpec, field[1:])
+	}
+	return !equality.Semantic.DeepEqual(spec, oldSpec)
+}
+
+// removeSpecField 删除spec的字段和因此变空的父字段，operator第一次写入partition时会创建它的父字段
+// removeSpecField removes a field of the spec and the parents left empty by it, the operator creates the parents of
+// the partition when it first writes one
+func removeSpecField(spec map[string]interface{}, fields []string) {
+	unstructured.RemoveNestedField(spec, fields...)
+	for i := len(fields) - 1; i > 0; i-- {
+		if parent, found, err := unstructured.NestedMap(spec, fields[:i]...); err == nil && found && len(parent) == 0 {
+			unstructured.RemoveNestedField(spec, fields[:i]...)
+		}
+	}
+}
@@ -37,6 +37,7 @@ import (
 
 	//+kubebuilder:scaffold:imports
 	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/rest"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -44,7 +45,10 @@ import (
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/apis/app.ops.cloud.alipay.com/v1alpha1"
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/revision"
 	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/utils"
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/utils/native"
 )
 
 // These tests use Ginkgo (BDD-style Go testing framework). Refer to
@@ -70,7 +74,7 @@ var _ = BeforeSuite(func() {
 	By("bootstrapping test environment")
 	testEnv = &envtest.Environment{
 		CRDDirectoryPaths:     []string{filepath.Join("..", "..", "..", "config", "crd", "bases")},
-		ErrorIfCRDPathMissing: false,
+		ErrorIfCRDPathMissing: true,
 		WebhookInstallOptions: envtest.WebhookInstallOptions{
 			Paths: []string{filepath.Join("..", "..", "..", "config", "webhook")},
 		},
@@ -83,7 +87,10 @@ var _ = BeforeSuite(func() {
 	Expect(cfg).NotTo(BeNil())
 
 	scheme := runtime.NewScheme()
-	// err = AddToScheme(scheme)
+	err = clientgoscheme.AddToScheme(scheme)
+	Expect(err).NotTo(HaveOccurred())
+
+	err = v1alpha1.AddToScheme(scheme)
 	Expect(err).NotTo(HaveOccurred())
 
 	err = admissionv1.AddToScheme(scheme)
@@ -94,6 +101,8 @@ var _ = BeforeSuite(func() {
 	k8sClient, err = client.New(cfg, client.Options{Scheme: scheme})
 	Expect(err).NotTo(HaveOccurred())
 	Expect(k8sClient).NotTo(BeNil())
+	// the validators read the ChangeWorkloads through the global client
+	utils.App.Client = k8sClient
 
 	// start webhook server using Manager
 	webhookInstallOptions := &testEnv.WebhookInstallOptions
@@ -204,7 +213,72 @@ var _ = Describe("Deployment Validator", func() {
 
 		// verify that the response is a denied response
 		Expect(response.Allowed).To(BeFalse())
-		Expect(string(response.Result.Reason)).To(Equal("deployment test-deployment is suspended"))
+		Expect(string(response.Result.Reason)).To(HavePrefix("deployment test-deployment is suspended. It was suspended at "))
+		Expect(string(response.Result.Reason)).To(HaveSuffix(fmt.Sprintf("To resume, remove the label %s and add the label %s=true.",
+			utils.SuspendLabel, utils.IgnoredSuspendLabel)))
+	})
+
+	It("should explain the suspension with the ChangeWorkload and its failed pods", func() {
+		suspendedAt := time.Now().Unix()
+		workload := &v1alpha1.ChangeWorkload{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "suspended-deployment--x--v2",
+				Namespace: "default",
+				Labels:    map[string]string{native.DeploymentNameLabel: "suspended-deployment"},
+			},
+			Spec: v1alpha1.ChangeWorkloadSpec{
+				ChangeWorkloadId: "suspended-deployment--x--v2",
+				ServiceName:      "suspended-deployment",
+				Reversion:        "v2",
+				AppName:          "suspended-deployment",
+				CreateTime:       time.Unix(suspendedAt, 0).Format(time.DateTime),
+				CreateTimeUnix:   suspendedAt,
+			},
+		}
+		Expect(k8sClient.Create(ctx, workload)).To(Succeed())
+		workload.Status = v1alpha1.ChangeWorkloadStatus{
+			Status:         v1alpha1.Suspend,
+			UpdateTime:     time.Unix(suspendedAt, 0).Format(time.DateTime),
+			UpdateTimeUnix: suspendedAt,
+			DefenseCheckFailPods: []v1alpha1.PodSummary{
+				{Pod: "suspended-deployment-1", Verdict: utils.ChangePodVerdictFail, Message: "error rate too high"},
+				{Pod: "suspended-deployment-2"},
+			},
+		}
+		Expect(k8sClient.Status().Update(ctx, workload)).To(Succeed())
+
+		oldDeployment := &v1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "suspended-deployment",
+				Namespace: "default",
+				Labels:    map[string]string{utils.SuspendLabel: strconv.FormatInt(suspendedAt, utils.NumberTen)},
+			},
+		}
+		// removing the suspend label without the label ignoring the suspension is denied before the suspend policy is read
+		newDeployment := oldDeployment.DeepCopy()
+		newDeployment.Labels = nil
+		deploymentJSON, err := json.Marshal(newDeployment)
+		Expect(err).NotTo(HaveOccurred())
+		oldDeploymentJSON, err := json.Marshal(oldDeployment)
+		Expect(err).NotTo(HaveOccurred())
+
+		response := validator.Handle(context.Background(), admission.Request{
+			AdmissionRequest: admissionv1.AdmissionRequest{
+				Kind:      metav1.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"},
+				Resource:  metav1.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"},
+				Operation: admissionv1.Update,
+				Object:    runtime.RawExtension{Raw: deploymentJSON},
+				OldObject: runtime.RawExtension{Raw: oldDeploymentJSON},
+			},
+		})
+
+		Expect(response.Allowed).To(BeFalse())
+		Expect(string(response.Result.Reason)).To(Equal(fmt.Sprintf("deployment suspended-deployment is suspended. "+
+			"It was suspended at %s by the ChangeWorkload %s. "+
+			"Failed pods: suspended-deployment-1 (%s: error rate too high), suspended-deployment-2 (%s). "+
+			"To resume, remove the label %s and add the label %s=true.",
+			time.Unix(suspendedAt, 0).UTC().Format(time.RFC3339), workload.Name, utils.ChangePodVerdictFail,
+			utils.ChangePodVerdictFail, utils.SuspendLabel, utils.IgnoredSuspendLabel)))
 	})
 
 	It("should allow a valid Deployment", func() {
@@ -254,4 +328,107 @@ var _ = Describe("Deployment Validator", func() {
 		// verify that the response is an allowed response
 		Expect(response.Allowed).To(BeTrue())
 	})
+
+	It("should hash a template without waiting for the revision hash config", func() {
+		// the webhook suite never runs ConfigRun, so the config is never ready
+		template := corev1.PodTemplateSpec{
+			ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": "test"}},
+			Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "test-container", Image: "nginx"}}},
+		}
+		expected, _, err := getTemplateHash(template, revision.DefaultConfig)
+		Expect(err).NotTo(HaveOccurred())
+
+		version, _, newRevision, err := getTemplateVersion(template, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(newRevision).To(BeTrue())
+		Expect(version).To(Equal(expected))
+	})
+
+	It("should decide the delete of a suspended Deployment without waiting for the suspend policy", func() {
+		// the webhook suite never runs ConfigRun, so the policy is never ready and the delete is left to the default
+		deployment := &v1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "suspended-delete",
+				Namespace: "default",
+				Labels:    map[string]string{utils.SuspendLabel: strconv.FormatInt(time.Now().Unix(), utils.NumberTen)},
+			},
+		}
+		deploymentJSON, err := json.Marshal(deployment)
+		Expect(err).NotTo(HaveOccurred())
+
+		response := validator.Handle(context.Background(), admission.Request{
+			AdmissionRequest: admissionv1.AdmissionRequest{
+				Kind:      metav1.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"},
+				Resource:  metav1.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"},
+				Operation: admissionv1.Delete,
+				OldObject: runtime.RawExtension{Raw: deploymentJSON},
+			},
+		})
+
+		Expect(response.Allowed).To(BeTrue())
+	})
+
+	It("should version a new Deployment without waiting for the concurrency limit", func() {
+		// the webhook suite never runs ConfigRun, so the limit is never ready and nothing is limited
+		scheme := runtime.NewScheme()
+		Expect(v1.AddToScheme(scheme)).To(Succeed())
+		mutator := &DeploymentMutator{}
+		Expect(mutator.InjectDecoder(scheme)).To(Succeed())
+		deployment := &v1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "unlimited-deployment", Namespace: "default"},
+			Spec: v1.DeploymentSpec{
+				Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "test"}},
+				Template: corev1.PodTemplateSpec{
+					ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": "test"}},
+					Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "test-container", Image: "nginx"}}},
+				},
+			},
+		}
+		deploymentJSON, err := json.Marshal(deployment)
+		Expect(err).NotTo(HaveOccurred())
+
+		response := mutator.Handle(context.Background(), admission.Request{
+			AdmissionRequest: admissionv1.AdmissionRequest{
+				Kind:      metav1.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"},
+				Resource:  metav1.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"},
+				Operation: admissionv1.Create,
+				Object:    runtime.RawExtension{Raw: deploymentJSON},
+			},
+		})
+
+		Expect(response.Allowed).To(BeTrue())
+		Expect(response.Patches).NotTo(BeEmpty())
+	})
+
+	It("should allow a template update without waiting for the notification sinks", func() {
+		// the webhook suite never runs ConfigRun, so the sinks are never ready and nothing is notified
+		oldDeployment := &v1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "unnotified-deployment", Namespace: "default"},
+			Spec: v1.DeploymentSpec{
+				Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "test"}},
+				Template: corev1.PodTemplateSpec{
+					ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": "test"}},
+					Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "test-container", Image: "nginx"}}},
+				},
+			},
+		}
+		newDeployment := oldDeployment.DeepCopy()
+		newDeployment.Spec.Template.Spec.Containers[0].Image = "nginx:latest"
+		deploymentJSON, err := json.Marshal(newDeployment)
+		Expect(err).NotTo(HaveOccurred())
+		oldDeploymentJSON, err := json.Marshal(oldDeployment)
+		Expect(err).NotTo(HaveOccurred())
+
+		response := validator.Handle(context.Background(), admission.Request{
+			AdmissionRequest: admissionv1.AdmissionRequest{
+				Kind:      metav1.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"},
+				Resource:  metav1.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"},
+				Operation: admissionv1.Update,
+				Object:    runtime.RawExtension{Raw: deploymentJSON},
+				OldObject: runtime.RawExtension{Raw: oldDeploymentJSON},
+			},
+		})
+
+		Expect(response.Allowed).To(BeTrue())
+	})
 })
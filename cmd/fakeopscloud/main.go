@@ -0,0 +1,53 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// fakeopscloud runs a local OpsCloud for developing the operator without a real OpsCloud.
+// Start the operator with OPSCLOUD_DOMAIN=http://localhost:8081 to use it.
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"time"
+
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/test/fakeopscloud"
+)
+
+func main() {
+	var addr string
+	var callbackURL string
+	var callbackDelay time.Duration
+	var rulesFile string
+	flag.StringVar(&addr, "addr", ":8081", "The address the fake OpsCloud binds to.")
+	flag.StringVar(&callbackURL, "callback-url", fakeopscloud.DefaultCallbackURL, "The callback api of the operator.")
+	flag.DurationVar(&callbackDelay, "callback-delay", fakeopscloud.DefaultCallbackDelay, "The delay of callbacks whose rule does not set one.")
+	flag.StringVar(&rulesFile, "rules", "", "A json file with the verdict rules, every check passes when empty.")
+	flag.Parse()
+
+	options := fakeopscloud.Options{CallbackURL: callbackURL, CallbackDelay: callbackDelay}
+	if rulesFile != "" {
+		rules, err := fakeopscloud.LoadRules(rulesFile)
+		if err != nil {
+			log.Fatal("load rules: ", err)
+		}
+		options.Rules = rules
+	}
+	log.Printf("fake OpsCloud listening on %s, calling back %s", addr, callbackURL)
+	if err := http.ListenAndServe(addr, fakeopscloud.New(options).Handler()); err != nil {
+		log.Fatal("ListenAndServe: ", err)
+	}
+}
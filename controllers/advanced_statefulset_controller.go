@@ -0,0 +1,140 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/apis/app.ops.cloud.alipay.com/v1alpha1"
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/resource"
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/utils"
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/utils/native"
+)
+
+const (
+	advancedStatefulSetWorkCount = 5
+)
+
+// AdvancedStatefulSetReconciler 和CloneSet一样为OpenKruise Advanced StatefulSet的每个updateRevision创建ChangeWorkload，
+// partition对应ChangePod的批次，校验失败时停住partition。扩容和配置变更的防御只支持Deployment
+// AdvancedStatefulSetReconciler creates a ChangeWorkload for every updateRevision of an OpenKruise Advanced StatefulSet
+// like the CloneSet one, the partition maps to the batches of ChangePods and a failed verdict holds the partition. The
+// scale-up and config change defenses are Deployment only
+type AdvancedStatefulSetReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+}
+
+//+kubebuilder:rbac:groups=apps.kruise.io,resources=statefulsets,verbs=get;list;watch;update;patch
+//+kubebuilder:rbac:groups=apps.kruise.io,resources=statefulsets/status,verbs=get
+
+// Reconcile creates the ChangeWorkload of the updateRevision of the Advanced StatefulSet and marks the revision defended
+func (r *AdvancedStatefulSetReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx).WithName("AdvancedStatefulSetReconciler Reconcile")
+	statefulSet := native.NewAdvancedStatefulSet()
+	if err := r.Get(ctx, req.NamespacedName, statefulSet); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	if isDefensed(statefulSet.GetLabels()) {
+		return ctrl.Result{}, nil
+	}
+	// 等待Advanced StatefulSet控制器为当前模板生成updateRevision，status更新后会再次触发
+	// wait for the Advanced StatefulSet controller to make the updateRevision of the current template, the status update
+	// triggers again
+	updateRevision, ok := native.GetAdvancedStatefulSetUpdateRevision(statefulSet)
+	if !ok {
+		logger.Info("wait for the updateRevision", utils.LogStatefulSetResource, utils.GetResource(statefulSet))
+		return ctrl.Result{}, nil
+	}
+	// 创建workload
+	// create workload
+	if err := r.createChangeWorkload(ctx, statefulSet, updateRevision); err != nil {
+		logger.Error(err, "AdvancedStatefulSetReconciler createChangeWorkload error", utils.LogStatefulSetResource, utils.GetResource(statefulSet))
+		return ctrl.Result{}, err
+	}
+	// 给statefulSet打上防御标签
+	// add defensed label to statefulSet
+	if err := r.defenseProcessedStatefulSet(ctx, statefulSet); err != nil {
+		logger.Error(err, "AdvancedStatefulSetReconciler defenseProcessedStatefulSet error", utils.LogStatefulSetResource, utils.GetResource(statefulSet))
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{}, nil
+}
+
+// SetupWithManager sets up the controller with the Manager, the Advanced StatefulSet CRD must be installed.
+func (r *AdvancedStatefulSetReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(native.NewAdvancedStatefulSet()).
+		Owns(&v1alpha1.ChangeWorkload{}).
+		// Set the maximum number of concurrency
+		WithOptions(controller.Options{MaxConcurrentReconciles: advancedStatefulSetWorkCount}).
+		// 和cloneSet一样只处理webhook打上版本并且还没有防御的statefulSet
+		// like the cloneSets only the statefulSets versioned by the webhook and not defended yet are handled
+		WithEventFilter(predicate.Funcs{
+			UpdateFunc: func(e event.UpdateEvent) bool {
+				return isAdmissionWebhook(e.ObjectNew.GetLabels()) && !isDefensed(e.ObjectNew.GetLabels())
+			},
+			CreateFunc: func(e event.CreateEvent) bool {
+				return isAdmissionWebhook(e.Object.GetLabels()) && !isDefensed(e.Object.GetLabels())
+			},
+		}).
+		Complete(r)
+}
+
+// createChangeWorkload 创建statefulSet的updateRevision的ChangeWorkload，已经存在时忽略
+// createChangeWorkload creates the ChangeWorkload of the updateRevision of the statefulSet, an existing one is kept
+func (r *AdvancedStatefulSetReconciler) createChangeWorkload(ctx context.Context, statefulSet *unstructured.Unstructured, updateRevision string) error {
+	logger := log.FromContext(ctx).WithName("createChangeWorkload")
+	factory := &resource.AdvancedStatefulSetChangeWorkloadFactory{StatefulSet: statefulSet, UpdateRevision: updateRevision}
+	workload := factory.NewInstance().(*v1alpha1.ChangeWorkload)
+	if err := controllerutil.SetControllerReference(statefulSet, workload, r.Scheme); err != nil {
+		return err
+	}
+	if err := r.Create(ctx, workload); err != nil && !errors.IsAlreadyExists(err) {
+		logger.Error(err, "create workload error", utils.LogStatefulSetResource, utils.GetResource(statefulSet))
+		return err
+	}
+	if err := supersedeChangeWorkloads(ctx, r.Client, workload); err != nil {
+		logger.Error(err, "supersede change workloads error", utils.LogStatefulSetResource, utils.GetResource(statefulSet))
+		return err
+	}
+	logger.Info("create workload", utils.LogStatefulSetResource, utils.GetResource(statefulSet), utils.LogChangeWorkloadResource, utils.GetResource(workload),
+		"updateRevision", updateRevision, "batches", workload.Spec.Batches)
+	return nil
+}
+
+// defenseProcessedStatefulSet 给statefulSet打上defense-status=Processed标记
+// defenseProcessedStatefulSet sets the label defense-status=Processed for the statefulSet
+func (r *AdvancedStatefulSetReconciler) defenseProcessedStatefulSet(ctx context.Context, statefulSet *unstructured.Unstructured) error {
+	patch := client.MergeFrom(statefulSet.DeepCopy())
+	labels := statefulSet.GetLabels()
+	labels[utils.DefenseStatusLabel] = utils.DefenseStatusLabelProcessed
+	delete(labels, utils.IgnoredSuspendLabel)
+	statefulSet.SetLabels(labels)
+	return r.Patch(ctx, statefulSet, patch)
+}
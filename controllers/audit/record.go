@@ -0,0 +1,63 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package audit
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/apis/app.ops.cloud.alipay.com/v1alpha1"
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/resource"
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/utils"
+)
+
+// Record 写入一条审计记录并输出一行json日志，key唯一确定一个动作，同一个key的记录只写一次
+// Record writes an audit record and logs it as a json line, the key identifies the action so the record of a key is
+// written once
+func Record(ctx context.Context, c client.Client, namespace string, key string, spec v1alpha1.AuditRecordSpec) error {
+	factory := resource.NativeAuditRecordFactory{Key: key, Namespace: namespace, Spec: spec}
+	auditRecord, ok := factory.NewInstance().(*v1alpha1.AuditRecord)
+	if !ok {
+		return fmt.Errorf("NewInstance audit record type error")
+	}
+	if err := c.Create(ctx, auditRecord); err != nil {
+		if errors.IsAlreadyExists(err) {
+			return nil
+		}
+		return err
+	}
+	log.Log.WithName("audit").Info("audit record", "namespace", namespace, "name", auditRecord.Name, "record", auditRecord.Spec)
+	return nil
+}
+
+// VerdictOf 一批pod的结论，任何一个pod没有通过时为FAIL，没有结果时为空
+// VerdictOf the conclusion of a batch, it is FAIL when any pod didn't pass and empty without results
+func VerdictOf(results []v1alpha1.PodSummary) string {
+	if len(results) == 0 {
+		return ""
+	}
+	for _, result := range results {
+		if result.Verdict != utils.ChangePodVerdictPass {
+			return utils.ChangePodVerdictFail
+		}
+	}
+	return utils.ChangePodVerdictPass
+}
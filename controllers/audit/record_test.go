@@ -0,0 +1,77 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package audit
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/apis/app.ops.cloud.alipay.com/v1alpha1"
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/utils"
+)
+
+func TestRecord(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := v1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).Build()
+	spec := v1alpha1.AuditRecordSpec{Action: v1alpha1.AuditBypass, User: "alice", Kind: "deployment", Name: "nginx"}
+	for i := 0; i < 2; i++ {
+		if err := Record(context.Background(), c, "shop", "admission/uid-1/Bypass", spec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := Record(context.Background(), c, "shop", "admission/uid-2/Bypass", spec); err != nil {
+		t.Fatal(err)
+	}
+	records := &v1alpha1.AuditRecordList{}
+	if err := c.List(context.Background(), records); err != nil {
+		t.Fatal(err)
+	}
+	if len(records.Items) != 2 {
+		t.Fatalf("expected one record per key, got %d", len(records.Items))
+	}
+	record := records.Items[0]
+	if !strings.HasPrefix(record.Name, utils.AuditRecordNamePrefix) || record.Namespace != "shop" {
+		t.Fatalf("unexpected record %s/%s", record.Namespace, record.Name)
+	}
+	if record.Labels[utils.AuditActionLabel] != v1alpha1.AuditBypass || record.Labels[utils.AuditTargetLabel] != "nginx" {
+		t.Fatalf("unexpected labels %v", record.Labels)
+	}
+	if record.Spec.User != "alice" || record.Spec.TimeUnix == 0 || record.Spec.Time == "" {
+		t.Fatalf("unexpected spec %+v", record.Spec)
+	}
+}
+
+func TestVerdictOf(t *testing.T) {
+	pass := v1alpha1.PodSummary{Pod: "a", Verdict: utils.ChangePodVerdictPass}
+	fail := v1alpha1.PodSummary{Pod: "b", Verdict: utils.ChangePodVerdictFail}
+	if verdict := VerdictOf([]v1alpha1.PodSummary{pass, pass}); verdict != utils.ChangePodVerdictPass {
+		t.Fatalf("expected PASS, got %s", verdict)
+	}
+	if verdict := VerdictOf([]v1alpha1.PodSummary{pass, fail}); verdict != utils.ChangePodVerdictFail {
+		t.Fatalf("expected FAIL, got %s", verdict)
+	}
+	if verdict := VerdictOf(nil); verdict != "" {
+		t.Fatalf("expected no verdict, got %s", verdict)
+	}
+}
@@ -0,0 +1,335 @@
+package callback
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/apis/app.ops.cloud.alipay.com/v1alpha1"
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/utils"
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/utils/native"
+)
+
+// ChangeWorkloadSummary is a change of a workload in the lists
+type ChangeWorkloadSummary struct {
+	Name           string `json:"name"`
+	Namespace      string `json:"namespace"`
+	Kind           string `json:"kind"`
+	DeploymentName string `json:"deploymentName"`
+	Version        string `json:"version"`
+	Status         string `json:"status"`
+	PassPods       int    `json:"passPods"`
+	FailPods       int    `json:"failPods"`
+	DryRun         bool   `json:"dryRun,omitempty"`
+	WouldSuspend   bool   `json:"wouldSuspend,omitempty"`
+	QueuePosition  int    `json:"queuePosition,omitempty"`
+	CreateTimeUnix int64  `json:"createTimeUnix"`
+	EntryTimeUnix  int64  `json:"entryTimeUnix,omitempty"`
+	UpdateTimeUnix int64  `json:"updateTimeUnix"`
+}
+
+// ChangeWorkloadDetail is a change with its batches and verdicts
+type ChangeWorkloadDetail struct {
+	ChangeWorkloadSummary
+	CountThreshold    int                   `json:"countThreshold"`
+	WaitTimeThreshold int                   `json:"waitTimeThreshold"`
+	Batches           []int32               `json:"batches,omitempty"`
+	DependsOn         []string              `json:"dependsOn,omitempty"`
+	QueueReason       string                `json:"queueReason,omitempty"`
+	PassPodResults    []v1alpha1.PodSummary `json:"passPodResults"`
+	FailPodResults    []v1alpha1.PodSummary `json:"failPodResults"`
+	ChangePods        []ChangePodDetail     `json:"changePods"`
+}
+
+// ChangePodDetail is a batch of a change with its verdicts and timings
+type ChangePodDetail struct {
+	Name               string                `json:"name"`
+	Batch              int                   `json:"batch"`
+	Status             string                `json:"status"`
+	Message            string                `json:"message,omitempty"`
+	Checker            string                `json:"checker,omitempty"`
+	FailPolicy         string                `json:"failPolicy,omitempty"`
+	RetryCount         int                   `json:"retryCount,omitempty"`
+	Pods               []v1alpha1.PodSummary `json:"pods"`
+	Results            []v1alpha1.PodSummary `json:"results"`
+	CreateTimeUnix     int64                 `json:"createTimeUnix"`
+	PreSubmitTimeUnix  int64                 `json:"preSubmitTimeUnix,omitempty"`
+	PostSubmitTimeUnix int64                 `json:"postSubmitTimeUnix,omitempty"`
+	UpdateTimeUnix     int64                 `json:"updateTimeUnix"`
+}
+
+// ListChangeWorkloads lists the changes newest first, filtered by namespace, deployment, status and a range of create
+// times in unix seconds, the page starts from 1
+func ListChangeWorkloads(c *gin.Context) {
+	logger := utils.NewLogger().WithName("ListChangeWorkloads")
+	page, pageSize, err := getPage(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, utils.GetCommonCallbackErr(err))
+		return
+	}
+	since, err := getUnixQuery(c, "since")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, utils.GetCommonCallbackErr(err))
+		return
+	}
+	until, err := getUnixQuery(c, "until")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, utils.GetCommonCallbackErr(err))
+		return
+	}
+	deploymentName := c.Query("deployment")
+	status := c.Query("status")
+	workloads, err := listChangeWorkloads(c, c.Query("namespace"), func(workload *v1alpha1.ChangeWorkload) bool {
+		if _, name := native.GetChangeWorkloadTarget(workload); deploymentName != "" && name != deploymentName {
+			return false
+		}
+		if status != "" && getStatusName(workload.Status.Status) != status {
+			return false
+		}
+		if since > 0 && workload.Spec.CreateTimeUnix < since {
+			return false
+		}
+		return until == 0 || workload.Spec.CreateTimeUnix <= until
+	})
+	if err != nil {
+		logger.Error(err, "ListChangeWorkloads: get workload list error")
+		c.JSON(http.StatusInternalServerError, utils.GetCommonCallbackErr(err))
+		return
+	}
+	start := (page - 1) * pageSize
+	if start > len(workloads) {
+		start = len(workloads)
+	}
+	end := start + pageSize
+	if end > len(workloads) {
+		end = len(workloads)
+	}
+	success := utils.GetCommonCallbackSuccess()
+	success["total"] = len(workloads)
+	success["page"] = page
+	success["pageSize"] = pageSize
+	success["changeWorkloads"] = workloads[start:end]
+	c.JSON(http.StatusOK, success)
+}
+
+// GetChangeWorkload gets a change with its batches, the verdicts of its pods and their timings
+func GetChangeWorkload(c *gin.Context) {
+	logger := utils.NewLogger().WithName("GetChangeWorkload")
+	namespace, name := c.Query("namespace"), c.Query("name")
+	if namespace == "" || name == "" {
+		c.JSON(http.StatusBadRequest, utils.GetCommonCallbackErr(fmt.Errorf("namespace and name are required")))
+		return
+	}
+	workload := v1alpha1.ChangeWorkload{}
+	if err := utils.App.Client.Get(c, client.ObjectKey{Namespace: namespace, Name: name}, &workload); err != nil {
+		logger.Error(err, "GetChangeWorkload: get workload error", "namespace", namespace, "name", name)
+		c.JSON(getErrorStatus(err), utils.GetCommonCallbackErr(err))
+		return
+	}
+	changePodList := v1alpha1.ChangePodList{}
+	if err := utils.App.Client.List(c, &changePodList, client.InNamespace(namespace),
+		client.MatchingFields{utils.ChangePodFieldChangeWorkloadId: workload.Name}); err != nil {
+		logger.Error(err, "GetChangeWorkload: get changePod list error", "namespace", namespace, "name", name)
+		c.JSON(http.StatusInternalServerError, utils.GetCommonCallbackErr(err))
+		return
+	}
+	changePods := make([]ChangePodDetail, 0, len(changePodList.Items))
+	for _, changePod := range changePodList.Items {
+		changePods = append(changePods, ChangePodDetail{
+			Name:               changePod.Name,
+			Batch:              getBatchNumber(changePod.Name),
+			Status:             changePod.Status.Status,
+			Message:            changePod.Status.Message,
+			Checker:            changePod.Status.Checker,
+			FailPolicy:         changePod.Status.FailPolicy,
+			RetryCount:         changePod.Status.RetryCount,
+			Pods:               nonNilPods(changePod.Spec.PodInfos),
+			Results:            nonNilPods(changePod.Status.PodResults),
+			CreateTimeUnix:     changePod.Spec.CreateTimeUnix,
+			PreSubmitTimeUnix:  changePod.Status.PreSubmitTimeUnix,
+			PostSubmitTimeUnix: changePod.Status.PostSubmitTimeUnix,
+			UpdateTimeUnix:     changePod.Status.UpdateTimeUnix,
+		})
+	}
+	sort.Slice(changePods, func(i, j int) bool {
+		return changePods[i].Batch < changePods[j].Batch
+	})
+	success := utils.GetCommonCallbackSuccess()
+	success["changeWorkload"] = ChangeWorkloadDetail{
+		ChangeWorkloadSummary: getChangeWorkloadSummary(&workload),
+		CountThreshold:        workload.Spec.CountThreshold,
+		WaitTimeThreshold:     workload.Spec.WaitTimeThreshold,
+		Batches:               workload.Spec.Batches,
+		DependsOn:             workload.Spec.DependsOn,
+		QueueReason:           workload.Status.QueueReason,
+		PassPodResults:        nonNilPods(workload.Status.DefenseCheckPassPods),
+		FailPodResults:        nonNilPods(workload.Status.DefenseCheckFailPods),
+		ChangePods:            changePods,
+	}
+	c.JSON(http.StatusOK, success)
+}
+
+// GetDeploymentHistory gets the change history of a deployment: its changes newest first and the audit records of the
+// suspensions, bypasses and rollbacks
+func GetDeploymentHistory(c *gin.Context) {
+	logger := utils.NewLogger().WithName("GetDeploymentHistory")
+	namespace, name := c.Query("namespace"), c.Query("name")
+	if namespace == "" || name == "" {
+		c.JSON(http.StatusBadRequest, utils.GetCommonCallbackErr(fmt.Errorf("namespace and name are required")))
+		return
+	}
+	workloads, err := listChangeWorkloads(c, namespace, func(workload *v1alpha1.ChangeWorkload) bool {
+		kind, target := native.GetChangeWorkloadTarget(workload)
+		return kind == "deployment" && target == name
+	})
+	if err != nil {
+		logger.Error(err, "GetDeploymentHistory: get workload list error", "namespace", namespace, "name", name)
+		c.JSON(http.StatusInternalServerError, utils.GetCommonCallbackErr(err))
+		return
+	}
+	auditRecordList := v1alpha1.AuditRecordList{}
+	if err := utils.App.Client.List(c, &auditRecordList, client.InNamespace(namespace),
+		client.MatchingLabels{utils.AuditTargetLabel: name}); err != nil {
+		logger.Error(err, "GetDeploymentHistory: get audit record list error", "namespace", namespace, "name", name)
+		c.JSON(http.StatusInternalServerError, utils.GetCommonCallbackErr(err))
+		return
+	}
+	auditRecords := make([]v1alpha1.AuditRecordSpec, 0, len(auditRecordList.Items))
+	for _, auditRecord := range auditRecordList.Items {
+		if auditRecord.Spec.Kind == "deployment" {
+			auditRecords = append(auditRecords, auditRecord.Spec)
+		}
+	}
+	sort.SliceStable(auditRecords, func(i, j int) bool {
+		return auditRecords[i].TimeUnix > auditRecords[j].TimeUnix
+	})
+	success := utils.GetCommonCallbackSuccess()
+	success["changeWorkloads"] = workloads
+	success["auditRecords"] = auditRecords
+	c.JSON(http.StatusOK, success)
+}
+
+// listChangeWorkloads 列出namespace中满足条件的ChangeWorkload，按创建时间从新到旧排列，namespace为空时列出全部
+// listChangeWorkloads lists the ChangeWorkloads of the namespace that match, newest first, every namespace is listed
+// when it is empty
+func listChangeWorkloads(c *gin.Context, namespace string, match func(*v1alpha1.ChangeWorkload) bool) ([]ChangeWorkloadSummary, error) {
+	workloadList := v1alpha1.ChangeWorkloadList{}
+	if err := utils.App.Client.List(c, &workloadList, client.InNamespace(namespace)); err != nil {
+		return nil, err
+	}
+	workloads := make([]ChangeWorkloadSummary, 0, len(workloadList.Items))
+	for i := range workloadList.Items {
+		if match(&workloadList.Items[i]) {
+			workloads = append(workloads, getChangeWorkloadSummary(&workloadList.Items[i]))
+		}
+	}
+	sort.Slice(workloads, func(i, j int) bool {
+		if workloads[i].CreateTimeUnix != workloads[j].CreateTimeUnix {
+			return workloads[i].CreateTimeUnix > workloads[j].CreateTimeUnix
+		}
+		if workloads[i].Namespace != workloads[j].Namespace {
+			return workloads[i].Namespace < workloads[j].Namespace
+		}
+		return workloads[i].Name < workloads[j].Name
+	})
+	return workloads, nil
+}
+
+func getChangeWorkloadSummary(workload *v1alpha1.ChangeWorkload) ChangeWorkloadSummary {
+	kind, name := native.GetChangeWorkloadTarget(workload)
+	return ChangeWorkloadSummary{
+		Name:           workload.Name,
+		Namespace:      workload.Namespace,
+		Kind:           kind,
+		DeploymentName: name,
+		Version:        workload.Spec.Reversion,
+		Status:         getStatusName(workload.Status.Status),
+		PassPods:       len(workload.Status.DefenseCheckPassPods),
+		FailPods:       len(workload.Status.DefenseCheckFailPods),
+		DryRun:         workload.Status.DryRun,
+		WouldSuspend:   workload.Status.WouldSuspend,
+		QueuePosition:  workload.Status.QueuePosition,
+		CreateTimeUnix: workload.Spec.CreateTimeUnix,
+		EntryTimeUnix:  workload.Status.EntryTimeUnix,
+		UpdateTimeUnix: workload.Status.UpdateTimeUnix,
+	}
+}
+
+// getStatusName 初始化状态的ChangeWorkload状态为空，返回Init
+// getStatusName the status of an initializing ChangeWorkload is empty, it is named Init
+func getStatusName(status string) string {
+	if status == v1alpha1.Init {
+		return "Init"
+	}
+	return status
+}
+
+// getBatchNumber 批次的序号，从changePod名称的最后一段得到，从1开始
+// getBatchNumber the number of the batch, it is the last part of the changePod name and starts from 1
+func getBatchNumber(name string) int {
+	number, err := strconv.Atoi(name[strings.LastIndex(name, utils.MetaMark)+len(utils.MetaMark):])
+	if err != nil {
+		return 0
+	}
+	return number
+}
+
+// getPage 读取分页参数，page从1开始，pageSize默认QueryDefaultPageSize，不超过QueryMaxPageSize
+// getPage reads the pagination, the page starts from 1 and the pageSize is QueryDefaultPageSize by default and at most
+// QueryMaxPageSize
+func getPage(c *gin.Context) (int, int, error) {
+	page, pageSize := utils.NumberOne, utils.QueryDefaultPageSize
+	if value := c.Query("page"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < utils.NumberOne {
+			return 0, 0, fmt.Errorf("page must be a positive integer")
+		}
+		page = parsed
+	}
+	if value := c.Query("pageSize"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < utils.NumberOne || parsed > utils.QueryMaxPageSize {
+			return 0, 0, fmt.Errorf("pageSize must be between 1 and %d", utils.QueryMaxPageSize)
+		}
+		pageSize = parsed
+	}
+	return page, pageSize, nil
+}
+
+// getUnixQuery 读取unix秒的时间参数，没有时为0
+// getUnixQuery reads a time parameter in unix seconds, it is 0 when absent
+func getUnixQuery(c *gin.Context, key string) (int64, error) {
+	value := c.Query(key)
+	if value == "" {
+		return 0, nil
+	}
+	parsed, err := strconv.ParseInt(value, utils.NumberTen, 64)
+	if err != nil || parsed < 0 {
+		return 0, fmt.Errorf("%s must be a time in unix seconds", key)
+	}
+	return parsed, nil
+}
+
+// getErrorStatus 对象不存在时返回404，其他错误返回500
+// getErrorStatus 404 for a missing object and 500 for the other errors
+func getErrorStatus(err error) int {
+	if errors.IsNotFound(err) {
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
+
+// nonNilPods 空列表序列化为[]而不是null
+// nonNilPods an empty list is serialized as [] instead of null
+func nonNilPods(pods []v1alpha1.PodSummary) []v1alpha1.PodSummary {
+	if pods == nil {
+		return []v1alpha1.PodSummary{}
+	}
+	return pods
+}
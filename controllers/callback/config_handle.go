@@ -0,0 +1,152 @@
+package callback
+
+import (
+	"net/http"
+	"net/url"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/checker"
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/concurrency"
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/notify"
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/revision"
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/scene"
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/suspend"
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/utils"
+)
+
+// EffectiveConfig is the config the operator currently works with, the credentials in the urls and the header values
+// are left out
+type EffectiveConfig struct {
+	Batch            bool                      `json:"batch"`
+	BatchCount       int                       `json:"batchCount"`
+	BlockingUp       bool                      `json:"blockingUp"`
+	DryRun           bool                      `json:"dryRun"`
+	Prometheus       *checker.PrometheusConfig `json:"prometheus"`
+	LogPattern       *checker.LogPatternConfig `json:"logPattern"`
+	RevisionHash     revision.Config           `json:"revisionHash"`
+	SuspendPolicy    *suspend.Policy           `json:"suspendPolicy"`
+	ConcurrencyLimit concurrency.Limit         `json:"concurrencyLimit"`
+	Notification     []EffectiveNotifySink     `json:"notificationSinks"`
+	ChangeScene      scene.Mapping             `json:"changeScene"`
+	Errors           map[string]string         `json:"errors,omitempty"`
+}
+
+// EffectiveNotifySink is a notification sink without its secrets: the url keeps only its scheme and host and the
+// headers only their names
+type EffectiveNotifySink struct {
+	Name          string   `json:"name"`
+	URL           string   `json:"url"`
+	Format        string   `json:"format"`
+	Headers       []string `json:"headers,omitempty"`
+	Namespaces    []string `json:"namespaces,omitempty"`
+	Events        []string `json:"events,omitempty"`
+	MaxRetries    int      `json:"maxRetries,omitempty"`
+	RatePerMinute int      `json:"ratePerMinute,omitempty"`
+}
+
+// GetEffectiveConfig gets the config the operator currently works with, a checker that is not enabled is null and so is
+// the suspend policy without one, every update of a suspended deployment is denied then. The invalid contents are
+// reported in errors and the defaults apply to them like they do in the operator
+func GetEffectiveConfig(c *gin.Context) {
+	config := EffectiveConfig{
+		Batch:            utils.ConfigIsBatch(),
+		BatchCount:       utils.ConfigBatchCount(),
+		BlockingUp:       utils.ConfigIsBlockingUp(),
+		DryRun:           utils.ConfigIsDryRun(),
+		RevisionHash:     revision.DefaultConfig,
+		ConcurrencyLimit: concurrency.DefaultLimit,
+		Notification:     []EffectiveNotifySink{},
+		ChangeScene:      scene.DefaultMapping,
+		Errors:           map[string]string{},
+	}
+	if content := utils.ConfigPrometheus(); content != "" {
+		if prometheus, err := checker.ParsePrometheusConfig(content); err != nil {
+			config.Errors["prometheus"] = err.Error()
+		} else {
+			prometheus.Url = redactUrl(prometheus.Url, true)
+			config.Prometheus = &prometheus
+		}
+	}
+	if content := utils.ConfigLogPattern(); content != "" {
+		if logPattern, err := checker.ParseLogPatternConfig(content); err != nil {
+			config.Errors["logPattern"] = err.Error()
+		} else {
+			config.LogPattern = &logPattern
+		}
+	}
+	if content := utils.ConfigRevisionHash(); content != "" {
+		if revisionHash, err := revision.ParseConfig(content); err != nil {
+			config.Errors["revisionHash"] = err.Error()
+		} else {
+			config.RevisionHash = revisionHash
+		}
+	}
+	if content := utils.ConfigSuspend(); content != "" {
+		if policy, err := suspend.ParsePolicy(content); err != nil {
+			config.Errors["suspendPolicy"] = err.Error()
+		} else {
+			config.SuspendPolicy = &policy
+		}
+	}
+	if content := utils.ConfigConcurrency(); content != "" {
+		if limit, err := concurrency.ParseLimit(content); err != nil {
+			config.Errors["concurrencyLimit"] = err.Error()
+		} else {
+			config.ConcurrencyLimit = limit
+		}
+	}
+	if content := utils.ConfigNotification(); content != "" {
+		if notification, err := notify.ParseConfig(content); err != nil {
+			config.Errors["notificationSinks"] = err.Error()
+		} else {
+			for _, sink := range notification.Sinks {
+				config.Notification = append(config.Notification, getEffectiveNotifySink(sink))
+			}
+		}
+	}
+	if content := utils.ConfigChangeScene(); content != "" {
+		if mapping, err := scene.ParseMapping(content); err != nil {
+			config.Errors["changeScene"] = err.Error()
+		} else {
+			config.ChangeScene = mapping
+		}
+	}
+	success := utils.GetCommonCallbackSuccess()
+	success["config"] = config
+	c.JSON(http.StatusOK, success)
+}
+
+func getEffectiveNotifySink(sink notify.Sink) EffectiveNotifySink {
+	headers := make([]string, 0, len(sink.Headers))
+	for key := range sink.Headers {
+		headers = append(headers, key)
+	}
+	sort.Strings(headers)
+	return EffectiveNotifySink{
+		Name:          sink.Name,
+		URL:           redactUrl(sink.URL, false),
+		Format:        sink.Format,
+		Headers:       headers,
+		Namespaces:    sink.Namespaces,
+		Events:        sink.Events,
+		MaxRetries:    sink.MaxRetries,
+		RatePerMinute: sink.RatePerMinute,
+	}
+}
+
+// redactUrl 去掉url中的用户信息和查询参数，webhook地址的路径中常带有token，keepPath为false时也去掉路径
+// redactUrl drops the user info and the query of the url, the path of a webhook often carries its token and it is
+// dropped too when keepPath is false
+func redactUrl(value string, keepPath bool) string {
+	parsed, err := url.Parse(value)
+	if err != nil {
+		return ""
+	}
+	redacted := url.URL{Scheme: parsed.Scheme, Host: parsed.Host}
+	if keepPath {
+		redacted.Path = parsed.Path
+	}
+	return redacted.String()
+}
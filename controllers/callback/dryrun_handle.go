@@ -0,0 +1,54 @@
+package callback
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/apis/app.ops.cloud.alipay.com/v1alpha1"
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/utils"
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/utils/native"
+)
+
+// DryRunDecision is a release that would have been suspended in dry-run mode
+type DryRunDecision struct {
+	DeploymentName   string                `json:"deploymentName"`
+	Namespace        string                `json:"namespace"`
+	ChangeWorkload   string                `json:"changeWorkload"`
+	Version          string                `json:"version"`
+	Status           string                `json:"status"`
+	FailPods         []v1alpha1.PodSummary `json:"failPods"`
+	WouldSuspendTime string                `json:"wouldSuspendTime"`
+}
+
+// GetDryRunDecisions lists the would-block decisions made in dry-run mode, namespace is optional
+func GetDryRunDecisions(c *gin.Context) {
+	logger := utils.NewLogger().WithName("GetDryRunDecisions")
+	namespace := c.Query("namespace")
+	logger.Info("GetDryRunDecisions", "namespace", namespace)
+	workloadList := v1alpha1.ChangeWorkloadList{}
+	if err := utils.App.Client.List(c, &workloadList, client.InNamespace(namespace)); err != nil {
+		logger.Error(err, "GetDryRunDecisions: get workload list error")
+		c.JSON(http.StatusInternalServerError, utils.GetCommonCallbackErr(err))
+		return
+	}
+	decisions := make([]DryRunDecision, utils.NumberZero)
+	for _, workload := range workloadList.Items {
+		if !workload.Status.WouldSuspend {
+			continue
+		}
+		decisions = append(decisions, DryRunDecision{
+			DeploymentName:   workload.Labels[native.DeploymentNameLabel],
+			Namespace:        workload.Namespace,
+			ChangeWorkload:   workload.Name,
+			Version:          workload.Spec.Reversion,
+			Status:           workload.Status.Status,
+			FailPods:         workload.Status.DefenseCheckFailPods,
+			WouldSuspendTime: workload.Status.WouldSuspendTime,
+		})
+	}
+	success := utils.GetCommonCallbackSuccess()
+	success["decisions"] = decisions
+	c.JSON(http.StatusOK, success)
+}
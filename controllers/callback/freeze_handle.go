@@ -0,0 +1,55 @@
+package callback
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/apis/app.ops.cloud.alipay.com/v1alpha1"
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/freeze"
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/utils"
+)
+
+// FreezeWindow is a change freeze window in effect
+type FreezeWindow struct {
+	Name              string                     `json:"name"`
+	Reason            string                     `json:"reason"`
+	ActiveStart       *metav1.Time               `json:"activeStart"`
+	ActiveEnd         *metav1.Time               `json:"activeEnd"`
+	NamespaceSelector *metav1.LabelSelector      `json:"namespaceSelector,omitempty"`
+	Selector          *metav1.LabelSelector      `json:"selector,omitempty"`
+	Exemptions        []v1alpha1.FreezeExemption `json:"exemptions,omitempty"`
+}
+
+// GetFreezeWindows lists the change freeze windows in effect now
+func GetFreezeWindows(c *gin.Context) {
+	logger := utils.NewLogger().WithName("GetFreezeWindows")
+	windowList := v1alpha1.ChangeFreezeWindowList{}
+	if err := utils.App.Client.List(c, &windowList); err != nil {
+		logger.Error(err, "GetFreezeWindows: get change freeze window list error")
+		c.JSON(http.StatusInternalServerError, utils.GetCommonCallbackErr(err))
+		return
+	}
+	now := time.Now()
+	windows := make([]FreezeWindow, utils.NumberZero)
+	for _, window := range windowList.Items {
+		status := freeze.StatusAt(&window.Spec, now)
+		if !status.Active {
+			continue
+		}
+		windows = append(windows, FreezeWindow{
+			Name:              window.Name,
+			Reason:            window.Spec.Reason,
+			ActiveStart:       status.ActiveStart,
+			ActiveEnd:         status.ActiveEnd,
+			NamespaceSelector: window.Spec.NamespaceSelector,
+			Selector:          window.Spec.Selector,
+			Exemptions:        window.Spec.Exemptions,
+		})
+	}
+	success := utils.GetCommonCallbackSuccess()
+	success["windows"] = windows
+	c.JSON(http.StatusOK, success)
+}
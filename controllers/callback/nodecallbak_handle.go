@@ -2,14 +2,17 @@ package callback
 
 import (
 	"context"
+	"fmt"
 	"net/http"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"k8s.io/apimachinery/pkg/api/errors"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	"gitlab.alipay-inc.com/common_release/altershieldoperator/apis/app.ops.cloud.alipay.com/v1alpha1"
 	opscloudclient "gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/client"
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/resource"
 	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/utils"
 )
 
@@ -28,7 +31,6 @@ func CheckCallBackHandler(c *gin.Context) {
 	logger.Info("CheckCallBackHandler:callback data", "data", data)
 	// 获取node信息
 	// get node info
-	changePod := v1alpha1.ChangePod{}
 	changePodList := v1alpha1.ChangePodList{}
 	nodeId := data.CallbackRequest.NodeId
 	orderId := data.CallbackRequest.BizExecOrderId
@@ -37,59 +39,103 @@ func CheckCallBackHandler(c *gin.Context) {
 	if err := utils.App.Client.List(context.Background(), &changePodList,
 		client.MatchingFields{utils.ChangePodFieldChangePodId: nodeId}); err != nil {
 		logger.Error(err, "CheckCallBackHandler:get node error")
+		c.JSON(http.StatusInternalServerError, utils.GetCommonCallbackErr(err))
 		return
 	}
-	if utils.IsNotEmpty(changePodList.Items) {
-		changePod = changePodList.Items[utils.NumberZero]
+	// node还没有写入changePod时保存回调，等changePod进入提交状态后再应用
+	// save the callback when the node has not been written to a changePod yet, it is applied once the changePod is submitted
+	if !utils.IsNotEmpty(changePodList.Items) {
+		logger.Info("CheckCallBackHandler:node not found, save the callback", "nodeId", nodeId)
+		saveChangeCallback(c, data.CallbackRequest)
+		return
+	}
+	changePod := changePodList.Items[utils.NumberZero]
+	// 使用patch的方式更新node的status
+	// patch node status
+	patch := client.MergeFrom(changePod.DeepCopy())
+	if ApplyCheckCallback(&changePod, data.CallbackRequest) {
+		if err := utils.App.Client.Status().Patch(context.Background(), &changePod, patch); err != nil {
+			logger.Error(err, "CheckCallBackHandler:patch node status error", "stage", data.CallbackRequest.DefenseStageEnum)
+			c.JSON(http.StatusInternalServerError, utils.GetCommonCallbackErr(err))
+			return
+		}
+	} else if isEarlyCheckCallback(&changePod, data.CallbackRequest) {
+		logger.Info("CheckCallBackHandler:node is not submitted yet, save the callback", "nodeId", nodeId, "status", changePod.Status.Status)
+		saveChangeCallback(c, data.CallbackRequest)
+		return
 	} else {
-		logger.Info("CheckCallBackHandler:node not found")
-		c.JSON(http.StatusOK, utils.GetCommonCallbackSuccess())
+		logger.Info("CheckCallBackHandler:ignore the callback of the node", "nodeId", nodeId, "status", changePod.Status.Status, "stage", data.CallbackRequest.DefenseStageEnum)
 	}
-	if data.CallbackRequest.DefenseStageEnum == opscloudclient.DefenseStageEnumPre {
-		// 如果当前状态不是PRE_AOP，则不做任何操作
-		// if node status is not PRE_AOP, do nothing
-		if changePod.Status.Status == v1alpha1.PreSubmitted {
-			// 使用patch的方式更新node的status
-			// patch node status
-			patch := client.MergeFrom(changePod.DeepCopy())
-			changePod.Status.Status = v1alpha1.PostWait
-			changePod.Status.UpdateTime = utils.GetNowTime()
-			changePod.Status.UpdateTimeUnix = time.Now().Unix()
-			if err := utils.App.Client.Status().Patch(context.Background(), &changePod, patch); err != nil {
-				logger.Error(err, "DefenseStageEnumPre:patch node status error")
-				c.JSON(http.StatusInternalServerError, utils.GetCommonCallbackErr(err))
-				return
-			}
+	c.JSON(http.StatusOK, utils.GetCommonCallbackSuccess())
+}
 
+// ApplyCheckCallback 当changePod处于回调对应阶段的提交状态时，将回调结果写入changePod的status，返回是否已应用
+// ApplyCheckCallback writes the callback to the changePod status when the changePod is in the submitted status of the callback stage, it returns whether the callback was applied
+func ApplyCheckCallback(changePod *v1alpha1.ChangePod, request opscloudclient.OpsCloudChangeCheckCallbackRequest) bool {
+	switch {
+	// 如果当前状态不是PRE_AOP，则不做任何操作
+	// if node status is not PRE_AOP, do nothing
+	case request.DefenseStageEnum == opscloudclient.DefenseStageEnumPre && changePod.Status.Status == v1alpha1.PreSubmitted:
+		changePod.Status.Status = v1alpha1.PostWait
+		changePod.Status.BatchStartTimeUnix = time.Now().Unix()
+	// 如果当前状态不是POST_AOP状态，则不做任何操作
+	// if node status is not POST_AOP, do nothing
+	case request.DefenseStageEnum == opscloudclient.DefenseStageEnumPost && changePod.Status.Status == v1alpha1.PostSubmitted:
+		changePod.Status.Status = v1alpha1.PostFinish
+		// TODO 根据返回结果 更新status
+		changePod.Status.PodResults = make([]v1alpha1.PodSummary, utils.NumberZero)
+		for _, podInfo := range changePod.Spec.PodInfos {
+			podInfo.Verdict = request.Verdict.Verdict
+			podInfo.Message = request.Verdict.Msg
+			changePod.Status.PodResults = append(changePod.Status.PodResults, podInfo)
 		}
-		c.JSON(http.StatusOK, utils.GetCommonCallbackSuccess())
-	} else if data.CallbackRequest.DefenseStageEnum == opscloudclient.DefenseStageEnumPost {
-		// 如果当前状态不是POST_AOP状态，则不做任何操作
-		// if node status is not POST_AOP, do nothing
-		if changePod.Status.Status == v1alpha1.PostSubmitted {
-			// 使用patch的方式更新node的status
-			// patch node status
-			patch := client.MergeFrom(changePod.DeepCopy())
-			changePod.Status.Status = v1alpha1.PostFinish
-			// TODO 根据返回结果 更新status
-			changePod.Status.PodResults = changePod.Spec.PodInfos
-			for i := range changePod.Status.PodResults {
-				changePod.Status.PodResults[i].Verdict = data.CallbackRequest.Verdict.Verdict
-				changePod.Status.PodResults[i].Message = data.CallbackRequest.Verdict.Msg
-			}
-			changePod.Status.UpdateTime = utils.GetNowTime()
-			changePod.Status.UpdateTimeUnix = time.Now().Unix()
-			if err := utils.App.Client.Status().Patch(context.Background(), &changePod, patch); err != nil {
-				logger.Error(err, "DefenseStageEnumPost:patch node status error")
-				c.JSON(http.StatusInternalServerError, utils.GetCommonCallbackErr(err))
-				return
-			}
-		} else {
-			logger.Info("DefenseStageEnumPost:node status is not POST_AOP")
+	default:
+		return false
+	}
+	changePod.Status.UpdateTime = utils.GetNowTime()
+	changePod.Status.UpdateTimeUnix = time.Now().Unix()
+	return true
+}
+
+// isEarlyCheckCallback 判断回调是否早于changePod的提交状态到达，前置回调的node一定还没有写入，后置回调只可能在PostWait时提前
+// isEarlyCheckCallback reports whether the callback arrived before the changePod was submitted, the node of an early pre callback is never written yet so only a post callback during PostWait can be early
+func isEarlyCheckCallback(changePod *v1alpha1.ChangePod, request opscloudclient.OpsCloudChangeCheckCallbackRequest) bool {
+	return request.DefenseStageEnum == opscloudclient.DefenseStageEnumPost && changePod.Status.Status == v1alpha1.PostWait
+}
+
+// saveChangeCallback 保存提前到达的回调，请求id相同的回调视为重复回调
+// saveChangeCallback saves a callback that arrived early, a callback with a saved request id is a duplicate
+func saveChangeCallback(c *gin.Context, request opscloudclient.OpsCloudChangeCheckCallbackRequest) {
+	logger := utils.NewLogger().WithName("saveChangeCallback")
+	changeCallbackFactory := resource.NativeChangeCallbackFactory{RequestId: getCallbackRequestId(c, request), Request: request}
+	changeCallback, ok := changeCallbackFactory.NewInstance().(*v1alpha1.ChangeCallback)
+	if !ok {
+		err := fmt.Errorf("saveChangeCallback NewInstance change callback type error")
+		logger.Error(err, "saveChangeCallback NewInstance change callback type error")
+		c.JSON(http.StatusInternalServerError, utils.GetCommonCallbackErr(err))
+		return
+	}
+	if err := utils.App.Client.Create(context.Background(), changeCallback); err != nil {
+		if errors.IsAlreadyExists(err) {
+			logger.Info("saveChangeCallback:duplicate callback", "requestId", changeCallback.Spec.RequestId, "name", changeCallback.Name)
 			c.JSON(http.StatusOK, utils.GetCommonCallbackSuccess())
 			return
 		}
+		logger.Error(err, "saveChangeCallback:create change callback error", "requestId", changeCallback.Spec.RequestId)
+		c.JSON(http.StatusInternalServerError, utils.GetCommonCallbackErr(err))
+		return
+	}
+	logger.Info("saveChangeCallback:change callback saved", "requestId", changeCallback.Spec.RequestId, "name", changeCallback.Name)
+	c.JSON(http.StatusOK, utils.GetCommonCallbackSuccess())
+}
+
+// getCallbackRequestId 优先使用请求头中的请求id，没有时node和阶段唯一确定一次回调
+// getCallbackRequestId prefers the request id header, otherwise the node and the stage identify a callback
+func getCallbackRequestId(c *gin.Context, request opscloudclient.OpsCloudChangeCheckCallbackRequest) string {
+	if requestId := c.GetHeader(opscloudclient.HttpHeaderRequestId); requestId != "" {
+		return requestId
 	}
+	return fmt.Sprintf("%s/%s/%s", request.NodeId, request.DefenseStageEnum, request.Verdict.Verdict)
 }
 
 func LiveTest(c *gin.Context) {
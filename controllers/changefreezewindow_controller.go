@@ -0,0 +1,84 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/apis/app.ops.cloud.alipay.com/v1alpha1"
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/freeze"
+)
+
+// ChangeFreezeWindowReconciler 按现在的时间更新冻结窗口的状态，并在下一次生效或结束时再次更新。
+// 拒绝冻结窗口内的更新由webhook按请求时的时间判断，不依赖这里的状态
+// ChangeFreezeWindowReconciler keeps the status of a freeze window up to date with the time, it updates it again when the
+// window starts or ends next. The webhook denies the updates inside a window by the time of the request, it doesn't rely
+// on this status
+type ChangeFreezeWindowReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+}
+
+//+kubebuilder:rbac:groups=app.ops.cloud.alipay.com,resources=changefreezewindows,verbs=get;list;watch
+//+kubebuilder:rbac:groups=app.ops.cloud.alipay.com,resources=changefreezewindows/status,verbs=get;update;patch
+
+// Reconcile updates the status of the freeze window and requeues it for its next transition
+func (r *ChangeFreezeWindowReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx).WithName("ChangeFreezeWindowReconciler Reconcile")
+	window := &v1alpha1.ChangeFreezeWindow{}
+	if err := r.Get(ctx, req.NamespacedName, window); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	now := time.Now()
+	status := freeze.StatusAt(&window.Spec, now)
+	if !equality.Semantic.DeepEqual(window.Status, status) {
+		patch := client.MergeFrom(window.DeepCopy())
+		window.Status = status
+		if err := r.Status().Patch(ctx, window, patch); err != nil {
+			logger.Error(err, "update change freeze window status error", "window", window.Name)
+			return ctrl.Result{}, err
+		}
+	}
+	// 生效中的窗口在结束时再次更新，否则在下一次开始时更新
+	// an active window is updated again when it ends, otherwise when it starts next
+	next := status.NextStart
+	if status.Active {
+		next = status.ActiveEnd
+	}
+	if next == nil {
+		return ctrl.Result{}, nil
+	}
+	return ctrl.Result{RequeueAfter: next.Sub(now) + time.Second}, nil
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *ChangeFreezeWindowReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		// 只处理spec的变化，状态的更新不再触发
+		// only the spec changes are handled, the status updates don't trigger it again
+		For(&v1alpha1.ChangeFreezeWindow{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Complete(r)
+}
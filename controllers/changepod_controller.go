@@ -20,19 +20,28 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"sort"
 	"time"
 
 	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	"k8s.io/apimachinery/pkg/runtime"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/audit"
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/callback"
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/checker"
 	opsClient "gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/client"
 	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/utils"
 	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/utils/native"
@@ -48,11 +57,18 @@ const (
 type ChangePodReconciler struct {
 	client.Client
 	Scheme *runtime.Scheme
+	// LogSource log-pattern检查器读取日志的来源，为空时通过utils.App.K8sClient读取
+	// LogSource the source of the logs read by the log-pattern checker, utils.App.K8sClient is used when it is nil
+	LogSource checker.LogSource
 }
 
 //+kubebuilder:rbac:groups=app.ops.cloud.alipay.com,resources=changepods,verbs=get;list;watch;create;update;patch;delete;deletecollection
 //+kubebuilder:rbac:groups=app.ops.cloud.alipay.com,resources=changepods/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=app.ops.cloud.alipay.com,resources=changepods/finalizers,verbs=update
+//+kubebuilder:rbac:groups=app.ops.cloud.alipay.com,resources=changecallbacks,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=app.ops.cloud.alipay.com,resources=changecallbacks/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups="",resources=pods/log,verbs=get
+//+kubebuilder:rbac:groups="",resources=nodes,verbs=get;list;watch
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -82,13 +98,15 @@ func (r *ChangePodReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 	case v1alpha1.ExecuteInit:
 		return r.executeInitChangePodHandle(ctx, &changePod, &changeWorkload)
 	case v1alpha1.PreWait:
-		return r.preWaitChangePodHandle(ctx, &changePod)
+		return r.preWaitChangePodHandle(ctx, &changePod, &changeWorkload)
 	case v1alpha1.PostWait:
-		return r.postWaitChangePodHandle(ctx, &changePod)
+		return r.postWaitChangePodHandle(ctx, &changePod, &changeWorkload)
+	case v1alpha1.PreSubmitted, v1alpha1.PostSubmitted:
+		return r.submittedChangePodHandle(ctx, &changePod, &changeWorkload)
 	case v1alpha1.PostFinish:
-		return r.postFinishChangePodHandle(ctx, &changePod)
+		return r.postFinishChangePodHandle(ctx, &changePod, &changeWorkload)
 	case v1alpha1.PreTimeout, v1alpha1.PostTimeout, v1alpha1.PreFailed, v1alpha1.PostFailed:
-		return r.timeoutOrFailedChangePodHandle(ctx, &changePod)
+		return r.timeoutOrFailedChangePodHandle(ctx, &changePod, &changeWorkload)
 	}
 	return ctrl.Result{}, nil
 }
@@ -99,16 +117,42 @@ func (r *ChangePodReconciler) SetupWithManager(mgr ctrl.Manager) error {
 		return err
 	}
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&v1alpha1.ChangePod{}).
-		// Set the maximum number of concurrency
-		WithOptions(controller.Options{MaxConcurrentReconciles: changePodWorkCount}).
-		WithEventFilter(predicate.Funcs{
+		For(&v1alpha1.ChangePod{}, builder.WithPredicates(predicate.Funcs{
 			UpdateFunc: r.handleUpdateEvent,
 			CreateFunc: r.handleCreateEvent,
-		}).
+		})).
+		// 提前到达的回调保存后唤醒对应的changePod
+		// wake up the changePod of a callback that arrived early
+		Watches(&source.Kind{Type: &v1alpha1.ChangeCallback{}},
+			handler.EnqueueRequestsFromMapFunc(r.mapChangeCallbackToChangePod),
+			builder.WithPredicates(predicate.Funcs{
+				UpdateFunc: func(event.UpdateEvent) bool { return false },
+				DeleteFunc: func(event.DeleteEvent) bool { return false },
+			})).
+		// Set the maximum number of concurrency
+		WithOptions(controller.Options{MaxConcurrentReconciles: changePodWorkCount}).
 		Complete(r)
 }
 
+// mapChangeCallbackToChangePod 通过nodeId找到回调对应的changePod
+// mapChangeCallbackToChangePod finds the changePod of the callback by the nodeId
+func (r *ChangePodReconciler) mapChangeCallbackToChangePod(obj client.Object) []reconcile.Request {
+	changeCallback, ok := obj.(*v1alpha1.ChangeCallback)
+	if !ok {
+		return nil
+	}
+	changePodList := v1alpha1.ChangePodList{}
+	if err := r.List(context.Background(), &changePodList, client.MatchingFields{utils.ChangePodFieldChangePodId: changeCallback.Spec.NodeId}); err != nil {
+		log.Log.WithName("mapChangeCallbackToChangePod").Error(err, "list changePod by nodeId error", "nodeId", changeCallback.Spec.NodeId)
+		return nil
+	}
+	requests := make([]reconcile.Request, utils.NumberZero)
+	for _, changePod := range changePodList.Items {
+		requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&changePod)})
+	}
+	return requests
+}
+
 // setChangePodFieldIndex 设置changePod的索引
 // setChangePodFieldIndex sets the index of changePod
 func (r *ChangePodReconciler) setChangePodFieldIndex(mgr ctrl.Manager) error {
@@ -142,6 +186,17 @@ func (r *ChangePodReconciler) setChangePodFieldIndex(mgr ctrl.Manager) error {
 	}); err != nil {
 		return err
 	}
+	// 设置changeCallback的索引
+	// set the index of changeCallback
+	if err := indexer.IndexField(context.Background(), &v1alpha1.ChangeCallback{}, utils.ChangeCallbackFieldNodeId, func(rawObj client.Object) []string {
+		obj, ok := rawObj.(*v1alpha1.ChangeCallback)
+		if !ok {
+			return nil
+		}
+		return []string{obj.Spec.NodeId}
+	}); err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -188,14 +243,14 @@ func (r *ChangePodReconciler) executeInitChangePodHandle(ctx context.Context, ch
 			return ctrl.Result{}, err
 		}
 
-		// get threshold, if threshold is greater than the number of pods, select the threshold number of pods to write to changePod, otherwise write all pods to changePod
-		isGreaterThanThreshold := len(podArray) > workload.Spec.CountThreshold
-		if isGreaterThanThreshold {
-			podArray = podArray[:workload.Spec.CountThreshold]
-		}
+		// 按照挑选策略选出不超过阈值个数的pod写入changePod，第一批覆盖所有的故障域
+		// pick at most the threshold number of pods with the selection strategy and write them to changePod, the first
+		// batch covers every failure domain
+		nodes := getPodNodes(ctx, r.Client, podArray)
+		podArray = selectBatchPods(ctx, r.Client, workload, changePod, podArray, nodes)
 		changePod.Spec.PodInfos = []v1alpha1.PodSummary{}
 		for _, pod := range podArray {
-			changePod.Spec.PodInfos = append(changePod.Spec.PodInfos, getPreparingPodSummary(&pod, changePod.Labels[native.DeploymentNameLabel]))
+			changePod.Spec.PodInfos = append(changePod.Spec.PodInfos, getPreparingPodSummary(&pod, changePod.Labels[native.DeploymentNameLabel], nodes[pod.Spec.NodeName]))
 		}
 
 		// update changePod
@@ -222,12 +277,30 @@ func (r *ChangePodReconciler) executeInitChangePodHandle(ctx context.Context, ch
 
 // preWaitChangePodHandle 处理变更前置等待的changePod
 // preWaitChangePodHandle handles changePod of pre wait
-func (r *ChangePodReconciler) preWaitChangePodHandle(ctx context.Context, changePod *v1alpha1.ChangePod) (ctrl.Result, error) {
+func (r *ChangePodReconciler) preWaitChangePodHandle(ctx context.Context, changePod *v1alpha1.ChangePod, workload *v1alpha1.ChangeWorkload) (ctrl.Result, error) {
 	logger := log.FromContext(ctx).WithName("preWaitChangePodHandle")
 	logger.Info("change pod pre wait", utils.LogChangePodResource, utils.GetResource(changePod))
+	if changePod.Status.Checker == "" {
+		changePod.Status.Checker = getChecker(ctx, r.Client, workload)
+	}
+	// 本地检查器没有前置校验，直接进入后置等待
+	// the local checker has no pre check, go to post wait directly
+	if isLocalChecker(changePod.Status.Checker) {
+		setChangePodPostWaitStatus(changePod)
+		logger.Info("change pod pre wait to post wait", utils.LogChangePodResource, utils.GetResource(changePod), "checker", changePod.Status.Checker)
+		return ctrl.Result{}, r.updateChangePodStatus(ctx, changePod)
+	}
+	if changePod.Status.ChangeScene == nil {
+		changePod.Status.ChangeScene = getChangeScene(ctx, r.Client, workload)
+	}
 	// 提交变更开始通知并获取nodeId
 	// submit change start notify and get nodeId
-	if nodeId, err := submitChangeStartNotifyAndGetNodeId(changePod); err != nil {
+	if nodeId, err := r.submitChangeStartNotifyOnce(ctx, changePod); err != nil {
+		if errors.IsConflict(err) {
+			// 缓存中的changePod已经过期，由最新的changePod重新处理
+			// the cached changePod is stale, the latest one is handled again
+			return ctrl.Result{Requeue: true}, nil
+		}
 		logger.Error(err, "failed to submit change start notify for change pod", utils.LogChangePodResource, utils.GetResource(changePod))
 		// 更新为失败
 		// update to failure
@@ -246,12 +319,32 @@ func (r *ChangePodReconciler) preWaitChangePodHandle(ctx context.Context, change
 
 // postWaitChangePodHandle 处理变更后置等待的changePod
 // postWaitChangePodHandle handles the changePod of post wait
-func (r *ChangePodReconciler) postWaitChangePodHandle(ctx context.Context, changePod *v1alpha1.ChangePod) (ctrl.Result, error) {
+func (r *ChangePodReconciler) postWaitChangePodHandle(ctx context.Context, changePod *v1alpha1.ChangePod, workload *v1alpha1.ChangeWorkload) (ctrl.Result, error) {
 	logger := log.FromContext(ctx).WithName("postWaitChangePodHandle")
 	logger.Info("change pod post wait", utils.LogChangePodResource, utils.GetResource(changePod))
+	// 批次开始后经过配置的延迟再提交后置校验，让pod在后置校验前承接流量
+	// submit the post check once the configured delay since the batch started has elapsed, so the pods take traffic
+	// before they are checked
+	if wait := time.Until(time.Unix(getBatchStartTimeUnix(changePod), 0).Add(getPostSubmitDelay(ctx, r.Client, workload))); wait > 0 {
+		return ctrl.Result{RequeueAfter: wait}, nil
+	}
+	// 本地检查器从提交时开始观察窗口，超时阈值需要包含观察窗口
+	// the local checker starts its observation window on submit, the timeout threshold has to cover the window
+	if isLocalChecker(changePod.Status.Checker) {
+		setChangePodPostSubmittedStatus(changePod)
+		changePod.Status.PostTimeoutThreshold += int(getObservationWindow(ctx, r.Client, workload).Seconds())
+		changePod.Status.PodHealth = nil
+		logger.Info("change pod post wait to post submitted", utils.LogChangePodResource, utils.GetResource(changePod), "checker", changePod.Status.Checker)
+		return ctrl.Result{}, r.updateChangePodStatus(ctx, changePod)
+	}
+	// 升级前创建的changePod没有解析过变更场景
+	// a changePod created before the upgrade has no change scene resolved yet
+	if changePod.Status.ChangeScene == nil {
+		changePod.Status.ChangeScene = getChangeScene(ctx, r.Client, workload)
+	}
 	// 提交变更结束通知
 	// submit change finish notify
-	if _, err := opsClient.SubmitChangeFinishNotify(buildChangeFinishNotifyRequest(*changePod)); err != nil {
+	if _, err := opsClient.SubmitChangeFinishNotify(ctx, buildChangeFinishNotifyRequest(*changePod)); err != nil {
 		logger.Error(err, "failed to submit change finish notify for change pod", utils.LogChangePodResource, utils.GetResource(changePod))
 		// 更新为失败
 		// update to failure
@@ -267,21 +360,122 @@ func (r *ChangePodReconciler) postWaitChangePodHandle(ctx context.Context, chang
 	}
 }
 
-// timeoutOrFailedChangePodHandle 处理变更超时或失败的changePod
-// timeoutOrFailedChangePodHandle handles changePod that has timeout or failed
-func (r *ChangePodReconciler) postFinishChangePodHandle(ctx context.Context, changePod *v1alpha1.ChangePod) (ctrl.Result, error) {
-	return r.handleFinishedChangePod(ctx, changePod)
+// submittedChangePodHandle 应用changePod提交前已经到达的回调，本地检查器在这里给出校验结果
+// submittedChangePodHandle applies the callback that arrived before the changePod was submitted, the local checker gives its verdicts here
+func (r *ChangePodReconciler) submittedChangePodHandle(ctx context.Context, changePod *v1alpha1.ChangePod, workload *v1alpha1.ChangeWorkload) (ctrl.Result, error) {
+	logger := log.FromContext(ctx).WithName("submittedChangePodHandle")
+	switch changePod.Status.Checker {
+	case utils.CheckerPodHealth:
+		return r.podHealthCheckHandle(ctx, changePod, workload)
+	case utils.CheckerPrometheus:
+		return r.prometheusCheckHandle(ctx, changePod, workload)
+	case utils.CheckerLogPattern:
+		return r.logPatternCheckHandle(ctx, changePod, workload)
+	}
+	changeCallbackList := v1alpha1.ChangeCallbackList{}
+	if err := r.List(ctx, &changeCallbackList, client.InNamespace(utils.AlterShieldOperatorNamespace),
+		client.MatchingFields{utils.ChangeCallbackFieldNodeId: changePod.Status.ChangePodId}); err != nil {
+		logger.Error(err, "list change callback error", utils.LogChangePodResource, utils.GetResource(changePod))
+		return ctrl.Result{}, err
+	}
+	// 按照到达顺序应用第一个匹配当前状态的回调
+	// apply the first callback matching the current status in the order of arrival
+	sort.Slice(changeCallbackList.Items, func(i, j int) bool {
+		return changeCallbackList.Items[i].Spec.ReceiveTimeUnix < changeCallbackList.Items[j].Spec.ReceiveTimeUnix
+	})
+	for _, changeCallback := range changeCallbackList.Items {
+		if changeCallback.Status.Status != v1alpha1.CallbackPending || !callback.ApplyCheckCallback(changePod, buildCheckCallbackRequest(changeCallback)) {
+			continue
+		}
+		logger.Info("apply the saved change callback", utils.LogChangePodResource, utils.GetResource(changePod), "changeCallback", changeCallback.Name, "ChangePodStatus", changePod.Status.Status)
+		if err := r.updateChangePodStatus(ctx, changePod); err != nil {
+			return ctrl.Result{}, err
+		}
+		changeCallback.Status.Status = v1alpha1.CallbackApplied
+		changeCallback.Status.ChangePod = utils.GetResource(changePod)
+		changeCallback.Status.AppliedTime = utils.GetNowTime()
+		changeCallback.Status.AppliedTimeUnix = time.Now().Unix()
+		if err := r.Status().Update(ctx, &changeCallback); err != nil {
+			logger.Error(err, "update change callback status error", "changeCallback", changeCallback.Name)
+		}
+		return ctrl.Result{}, nil
+	}
+	return ctrl.Result{}, nil
 }
 
 // timeoutOrFailedChangePodHandle 处理变更超时或失败的changePod
 // timeoutOrFailedChangePodHandle handles changePod that has timeout or failed
-func (r *ChangePodReconciler) timeoutOrFailedChangePodHandle(ctx context.Context, changePod *v1alpha1.ChangePod) (ctrl.Result, error) {
-	return r.handleFinishedChangePod(ctx, changePod)
+func (r *ChangePodReconciler) postFinishChangePodHandle(ctx context.Context, changePod *v1alpha1.ChangePod, workload *v1alpha1.ChangeWorkload) (ctrl.Result, error) {
+	return r.handleFinishedChangePod(ctx, changePod, workload)
+}
+
+// timeoutOrFailedChangePodHandle 处理变更超时或失败的changePod，根据fail policy决定视为通过、失败或者重试
+// timeoutOrFailedChangePodHandle handles changePod that has timeout or failed, the fail policy decides whether it passes, fails or is retried
+func (r *ChangePodReconciler) timeoutOrFailedChangePodHandle(ctx context.Context, changePod *v1alpha1.ChangePod, workload *v1alpha1.ChangeWorkload) (ctrl.Result, error) {
+	logger := log.FromContext(ctx).WithName("timeoutOrFailedChangePodHandle")
+	failPolicy := getFailPolicy(ctx, r.Client, workload)
+	changePod.Status.FailPolicy = failPolicy
+	verdict := utils.ChangePodVerdictPass
+	switch failPolicy {
+	case utils.FailPolicyRetry:
+		if changePod.Status.RetryCount < utils.ChangePodMaxRetryTimes {
+			// 距离上次失败未达到重试间隔时，延迟处理
+			// requeue until the retry interval since the last failure has elapsed
+			if wait := changePod.Status.UpdateTimeUnix + utils.ChangePodRetryInterval - time.Now().Unix(); wait > utils.NumberZero {
+				return ctrl.Result{RequeueAfter: time.Duration(wait) * time.Second}, nil
+			}
+			return ctrl.Result{}, r.retryChangePod(ctx, changePod)
+		}
+		logger.Info("change pod retries are used up", utils.LogChangePodResource, utils.GetResource(changePod), "retryCount", changePod.Status.RetryCount)
+		verdict = utils.ChangePodVerdictFail
+	case utils.FailPolicyFail:
+		verdict = utils.ChangePodVerdictFail
+	}
+	// 记录失败策略给出的结果
+	// record the verdict given by the fail policy
+	changePod.Status.PodResults = make([]v1alpha1.PodSummary, utils.NumberZero)
+	for _, podInfo := range changePod.Spec.PodInfos {
+		podInfo.Verdict = verdict
+		podInfo.Message = fmt.Sprintf("%s, fail policy: %s", changePod.Status.Status, failPolicy)
+		changePod.Status.PodResults = append(changePod.Status.PodResults, podInfo)
+	}
+	return r.handleFinishedChangePod(ctx, changePod, workload)
+}
+
+// retryChangePod 将失败或超时的changePod退回到等待提交状态，重新提交对应阶段的校验
+// retryChangePod moves a failed or timed out changePod back to the wait status so the check of its stage is submitted again
+func (r *ChangePodReconciler) retryChangePod(ctx context.Context, changePod *v1alpha1.ChangePod) error {
+	logger := log.FromContext(ctx).WithName("retryChangePod")
+	// 重新提交前置校验时需要一个新的节点，清除上一次变更开始通知的nodeId
+	// the resubmitted pre check needs a new node, so the nodeId of the last change start notify is dropped
+	if _, ok := changePod.Annotations[utils.StartNotifyAnnotation]; ok && isPreStage(changePod.Status.Status) {
+		status := changePod.Status
+		delete(changePod.Annotations, utils.StartNotifyAnnotation)
+		if err := r.Update(ctx, changePod); err != nil {
+			return err
+		}
+		changePod.Status = status
+	}
+	changePod.Status.Message = changePod.Status.Status
+	changePod.Status.RetryCount++
+	if isPreStage(changePod.Status.Status) {
+		setChangePodPreWaitStatus(changePod)
+	} else {
+		setChangePodPostWaitStatus(changePod)
+	}
+	logger.Info("retry change pod", utils.LogChangePodResource, utils.GetResource(changePod), "retryCount", changePod.Status.RetryCount, "ChangePodStatus", changePod.Status.Status)
+	return r.updateChangePodStatus(ctx, changePod)
+}
+
+// isPreStage 失败或超时的changePod是否处于前置校验阶段
+// isPreStage whether a failed or timed out changePod is in the pre check stage
+func isPreStage(status string) bool {
+	return status == v1alpha1.PreTimeout || status == v1alpha1.PreFailed
 }
 
 // handleFinishedChangePod 处理变更完成的changePod，其中完成包括超时和失败
 // handleFinishedChangePod handles changePod that has finished, including timeout and failure
-func (r *ChangePodReconciler) handleFinishedChangePod(ctx context.Context, changePod *v1alpha1.ChangePod) (ctrl.Result, error) {
+func (r *ChangePodReconciler) handleFinishedChangePod(ctx context.Context, changePod *v1alpha1.ChangePod, workload *v1alpha1.ChangeWorkload) (ctrl.Result, error) {
 	logger := log.FromContext(ctx)
 	logger.Info("change pod timeout or failed or finish", utils.LogChangePodResource, utils.GetResource(changePod), "ChangePodStatus", changePod.Status.Status)
 	changePod.Status.Message = changePod.Status.Status
@@ -289,7 +483,19 @@ func (r *ChangePodReconciler) handleFinishedChangePod(ctx context.Context, chang
 	// set changePod to EXECUTE_DONE status
 	setChangePodDoneStatus(changePod)
 	logger.Info("change pod timeout or failed or finish to done", utils.LogChangePodResource, utils.GetResource(changePod), "oldChangePodStatus", changePod.Status.Status)
-	return ctrl.Result{}, r.updateChangePodStatus(ctx, changePod)
+	if err := r.updateChangePodStatus(ctx, changePod); err != nil {
+		return ctrl.Result{}, err
+	}
+	// 批次的结论确定后写入审计记录
+	// the verdicts of the batch are final now, write them to the audit trail
+	recordWorkloadAudit(ctx, r.Client, workload, "changepod/"+string(changePod.UID)+"/verdict", v1alpha1.AuditRecordSpec{
+		Action:    v1alpha1.AuditVerdict,
+		ChangePod: changePod.Name,
+		Verdict:   audit.VerdictOf(changePod.Status.PodResults),
+		Results:   changePod.Status.PodResults,
+		Message:   changePod.Status.Message,
+	})
+	return ctrl.Result{}, nil
 }
 
 // updateChangePodStatus 更新changePod状态
@@ -376,10 +582,46 @@ func (r *ChangePodReconciler) getAllPodsByChangePod(ctx context.Context, changeP
 	return podList.Items, nil
 }
 
+// submitChangeStartNotifyOnce 每个changePod只提交一次变更开始通知：提交前先写入意图注解，过期缓存的更新会冲突而不会重复提交，
+// 提交成功后把nodeId写入注解，之后的处理直接使用它
+// submitChangeStartNotifyOnce submits the change start notify of a changePod once: the intent is written to an
+// annotation before calling out so an update from a stale cache conflicts instead of submitting again, and the nodeId is
+// written to the annotation once the notify succeeds so the later handling reuses it
+func (r *ChangePodReconciler) submitChangeStartNotifyOnce(ctx context.Context, changePod *v1alpha1.ChangePod) (string, error) {
+	if nodeId := changePod.Annotations[utils.StartNotifyAnnotation]; nodeId != "" && nodeId != utils.StartNotifyPending {
+		return nodeId, nil
+	}
+	status := changePod.Status
+	if err := r.setStartNotifyAnnotation(ctx, changePod, utils.StartNotifyPending); err != nil {
+		return "", err
+	}
+	changePod.Status = status
+	nodeId, err := submitChangeStartNotifyAndGetNodeId(ctx, changePod)
+	if err != nil {
+		return "", err
+	}
+	if err := r.setStartNotifyAnnotation(ctx, changePod, nodeId); err != nil {
+		log.FromContext(ctx).Error(err, "record the nodeId of the change start notify error", utils.LogChangePodResource, utils.GetResource(changePod), "nodeId", nodeId)
+	}
+	changePod.Status = status
+	return nodeId, nil
+}
+
+// setStartNotifyAnnotation 更新变更开始通知的注解，基于读到的resourceVersion更新，changePod过期时返回冲突
+// setStartNotifyAnnotation updates the annotation of the change start notify on top of the resourceVersion read, it
+// returns a conflict when the changePod is stale
+func (r *ChangePodReconciler) setStartNotifyAnnotation(ctx context.Context, changePod *v1alpha1.ChangePod, value string) error {
+	if changePod.Annotations == nil {
+		changePod.Annotations = make(map[string]string)
+	}
+	changePod.Annotations[utils.StartNotifyAnnotation] = value
+	return r.Update(ctx, changePod)
+}
+
 // submitChangeStartNotifyAndGetNodeId 提交变更开始通知并获取nodeId
 // submitChangeStartNotifyAndGetNodeId submits the change start notification and gets the nodeId
-func submitChangeStartNotifyAndGetNodeId(changePod *v1alpha1.ChangePod) (string, error) {
-	result, err := opsClient.SubmitChangeStartNotify(buildChangeStartNotifyRequest(*changePod))
+func submitChangeStartNotifyAndGetNodeId(ctx context.Context, changePod *v1alpha1.ChangePod) (string, error) {
+	result, err := opsClient.SubmitChangeStartNotify(ctx, buildChangeStartNotifyRequest(*changePod))
 	if err != nil {
 		return "", err
 	}
@@ -420,6 +662,25 @@ func setChangePodPreWaitStatus(changePod *v1alpha1.ChangePod) {
 	setChangePodStatus(changePod, v1alpha1.PreWait)
 }
 
+// setChangePodPostWaitStatus 设置changePod为postWait状态，第一次进入时记录批次开始时间
+// setChangePodPostWaitStatus sets the changePod to the postWait state, the batch start time is recorded the first time
+func setChangePodPostWaitStatus(changePod *v1alpha1.ChangePod) {
+	setChangePodStatus(changePod, v1alpha1.PostWait)
+	if changePod.Status.BatchStartTimeUnix == utils.NumberZero {
+		changePod.Status.BatchStartTimeUnix = changePod.Status.UpdateTimeUnix
+	}
+}
+
+// getBatchStartTimeUnix 获取批次开始时间，升级前进入后置等待的changePod没有记录时使用更新时间
+// getBatchStartTimeUnix gets the batch start time, the update time is used for a changePod that entered post wait
+// before the upgrade and has none recorded
+func getBatchStartTimeUnix(changePod *v1alpha1.ChangePod) int64 {
+	if changePod.Status.BatchStartTimeUnix != utils.NumberZero {
+		return changePod.Status.BatchStartTimeUnix
+	}
+	return changePod.Status.UpdateTimeUnix
+}
+
 // setChangePodPreFailedStatus 设置changePod为preFailed状态
 // setChangePodPreFailedStatus sets the changePod to the preFailed state
 func setChangePodPreFailedStatus(changePod *v1alpha1.ChangePod) {
@@ -441,15 +702,27 @@ func setChangePodStatus(changePod *v1alpha1.ChangePod, status string) {
 }
 
 // getPreparingPodSummary 获取预校验的summary
-// getPreparingPodSummary get preparing pod summary
-func getPreparingPodSummary(pod *v1.Pod, deploymentName string) (podSummary v1alpha1.PodSummary) {
+// getPreparingPodSummary get preparing pod summary, the node is nil when it can't be read and the workspace is the zone
+// of the node, default when it has no zone
+func getPreparingPodSummary(pod *v1.Pod, deploymentName string, node *v1.Node) (podSummary v1alpha1.PodSummary) {
 	podSummary = v1alpha1.PodSummary{
 		App:       deploymentName,
-		Hostname:  pod.Name,
-		Workspace: "default",
+		Hostname:  pod.Spec.Hostname,
+		Workspace: utils.DefaultWorkspace,
 		Pod:       pod.Name,
 		Ip:        pod.Status.PodIP,
 		Namespace: pod.Namespace,
+		Node:      pod.Spec.NodeName,
+	}
+	if podSummary.Hostname == "" {
+		podSummary.Hostname = pod.Name
+	}
+	if node != nil {
+		podSummary.Zone = node.Labels[v1.LabelTopologyZone]
+		podSummary.Region = node.Labels[v1.LabelTopologyRegion]
+		if podSummary.Zone != "" {
+			podSummary.Workspace = podSummary.Zone
+		}
 	}
 	return podSummary
 }
@@ -466,18 +739,34 @@ func buildChangeStartNotifyRequest(changePod v1alpha1.ChangePod) opsClient.OpsCl
 		podInfos = append(podInfos, string(marshal))
 	}
 	request := opsClient.OpsCloudChangeExecBatchStartNotifyRequest{
-		ChangePhase:              utils.ChangePhase,
+		ChangePhase:              changePod.Status.ChangeScene.Phase,
 		Executor:                 utils.DefaultCreator,
 		EffectiveTargetType:      utils.StringRecordSpecEffectiveTargetType,
 		EffectiveTargetLocations: podInfos,
 		Platform:                 opsClient.Platform,
-		ChangeSceneKey:           utils.ChangeSceneKeyRollingUpdate,
+		ChangeSceneKey:           changePod.Status.ChangeScene.SceneKey,
 		BizExecOrderId:           changePod.Spec.ChangeWorkloadId,
-		TldcTenantCode:           utils.DefaultTldcTenantCode,
+		TldcTenantCode:           changePod.Status.ChangeScene.TenantCode,
 	}
 	return request
 }
 
+// buildCheckCallbackRequest 将保存的回调还原为管控端的回调请求
+// buildCheckCallbackRequest restores the saved callback to the OpsCloud callback request
+func buildCheckCallbackRequest(changeCallback v1alpha1.ChangeCallback) opsClient.OpsCloudChangeCheckCallbackRequest {
+	return opsClient.OpsCloudChangeCheckCallbackRequest{
+		NodeId:         changeCallback.Spec.NodeId,
+		ChangeSceneKey: changeCallback.Spec.ChangeSceneKey,
+		BizExecOrderId: changeCallback.Spec.BizExecOrderId,
+		Verdict: opsClient.OpsCloudChangeCheckVerdict{
+			Verdict: changeCallback.Spec.Verdict,
+			Msg:     changeCallback.Spec.Msg,
+			NodeId:  changeCallback.Spec.NodeId,
+		},
+		DefenseStageEnum: changeCallback.Spec.DefenseStage,
+	}
+}
+
 // buildChangeFinishNotifyRequest 构建变更结束通知请求
 // buildChangeFinishNotifyRequest builds the change finish notification request
 func buildChangeFinishNotifyRequest(changePod v1alpha1.ChangePod) opsClient.OpsCloudChangeFinishNotifyRequest {
@@ -486,9 +775,9 @@ func buildChangeFinishNotifyRequest(changePod v1alpha1.ChangePod) opsClient.OpsC
 		Success:        true,
 		ServiceResult:  "{}",
 		Platform:       opsClient.Platform,
-		ChangeSceneKey: utils.ChangeSceneKeyRollingUpdate,
+		ChangeSceneKey: changePod.Status.ChangeScene.SceneKey,
 		NodeId:         changePod.Status.ChangePodId,
-		TldcTenantCode: utils.DefaultTldcTenantCode,
+		TldcTenantCode: changePod.Status.ChangeScene.TenantCode,
 	}
 	return request
 }
@@ -0,0 +1,235 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/apis/app.ops.cloud.alipay.com/v1alpha1"
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/checker"
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/scene"
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/utils"
+)
+
+// getDefenseAnnotations 获取workload对应的deployment或者Argo Rollout和namespace的注解，deployment的注解在前
+// getDefenseAnnotations gets the annotations of the deployment or Argo Rollout and the namespace of the workload, the
+// deployment ones come first
+func getDefenseAnnotations(ctx context.Context, c client.Client, workload *v1alpha1.ChangeWorkload) []map[string]string {
+	logger := log.FromContext(ctx).WithName("getDefenseAnnotations")
+	owner, err := getWorkloadOwner(ctx, c, workload)
+	if err != nil {
+		logger.Error(err, "get deployment error", utils.LogChangeWorkloadResource, utils.GetResource(workload))
+		owner = &appsv1.Deployment{}
+		owner.SetNamespace(workload.Namespace)
+	}
+	return getDeploymentDefenseAnnotations(ctx, c, owner)
+}
+
+// getDeploymentDefenseAnnotations 获取deployment或者Argo Rollout和所在namespace的注解，deployment的注解在前
+// getDeploymentDefenseAnnotations gets the annotations of the deployment or Argo Rollout and its namespace, the deployment
+// ones come first
+func getDeploymentDefenseAnnotations(ctx context.Context, c client.Client, deployment client.Object) []map[string]string {
+	logger := log.FromContext(ctx).WithName("getDeploymentDefenseAnnotations")
+	annotations := make([]map[string]string, 0, 2)
+	annotations = append(annotations, deployment.GetAnnotations())
+	namespace := &v1.Namespace{}
+	if err := c.Get(ctx, client.ObjectKey{Name: deployment.GetNamespace()}, namespace); err != nil {
+		logger.Error(err, "get namespace error", utils.LogDeploymentResource, utils.GetResource(deployment))
+	} else {
+		annotations = append(annotations, namespace.Annotations)
+	}
+	return annotations
+}
+
+// lookupDefenseAnnotation 按顺序返回第一个合法的注解取值，都没有配置或者取值非法时返回false
+// lookupDefenseAnnotation returns the first valid value of the annotation in order, it returns false when the annotation is missing or invalid
+func lookupDefenseAnnotation(annotations []map[string]string, key string, valid func(string) bool) (string, bool) {
+	for _, annotation := range annotations {
+		if value, ok := annotation[key]; ok && valid(value) {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+// getFailPolicy 获取workload的fail policy，deployment的注解优先于namespace的注解，都没有配置时视为通过
+// getFailPolicy gets the fail policy of the workload, the deployment annotation takes precedence over the namespace one and the default is pass
+func getFailPolicy(ctx context.Context, c client.Client, workload *v1alpha1.ChangeWorkload) string {
+	if failPolicy, ok := lookupDefenseAnnotation(getDefenseAnnotations(ctx, c, workload), utils.FailPolicyAnnotation, isFailPolicy); ok {
+		return failPolicy
+	}
+	return utils.FailPolicyPass
+}
+
+// getChecker 获取给出校验结果的检查器，默认使用opscloud
+// getChecker gets the checker that gives the verdicts, opscloud by default
+func getChecker(ctx context.Context, c client.Client, workload *v1alpha1.ChangeWorkload) string {
+	if checkerName, ok := lookupDefenseAnnotation(getDefenseAnnotations(ctx, c, workload), utils.CheckerAnnotation, isChecker); ok {
+		return checkerName
+	}
+	return utils.CheckerOpsCloud
+}
+
+// getPodHealthChecker 获取本地pod健康检查器，注解未配置的参数使用默认值
+// getPodHealthChecker gets the local pod health checker, the settings without annotations use the defaults
+func getPodHealthChecker(ctx context.Context, c client.Client, workload *v1alpha1.ChangeWorkload) *checker.PodHealthChecker {
+	podHealthChecker := checker.NewPodHealthChecker()
+	annotations := getDefenseAnnotations(ctx, c, workload)
+	podHealthChecker.ObservationWindow = lookupObservationWindow(annotations)
+	if value, ok := lookupDefenseAnnotation(annotations, utils.MaxRestartsAnnotation, isNonNegativeInt); ok {
+		maxRestarts, _ := strconv.Atoi(value)
+		podHealthChecker.MaxRestarts = int32(maxRestarts)
+	}
+	if value, ok := lookupDefenseAnnotation(annotations, utils.MaxReadinessFlapsAnnotation, isNonNegativeInt); ok {
+		podHealthChecker.MaxReadinessFlaps, _ = strconv.Atoi(value)
+	}
+	return podHealthChecker
+}
+
+// getChangeScene 获取管控端请求的租户和变更场景，每一项依次按照deployment的注解、namespace的注解、namespace的标签和映射配置解析，
+// 都没有配置时使用默认值
+// getChangeScene gets the tenant and change scene of the OpsCloud requests, every item is resolved from the deployment
+// annotations, the namespace annotations, the namespace labels and then the mapping config, and falls back to its default
+func getChangeScene(ctx context.Context, c client.Client, workload *v1alpha1.ChangeWorkload) *v1alpha1.ChangeScene {
+	logger := log.FromContext(ctx).WithName("getChangeScene")
+	sources := getDefenseAnnotations(ctx, c, workload)
+	namespace := &v1.Namespace{}
+	if err := c.Get(ctx, client.ObjectKey{Name: workload.Namespace}, namespace); err != nil {
+		logger.Error(err, "get namespace error", utils.LogChangeWorkloadResource, utils.GetResource(workload))
+	} else {
+		sources = append(sources, namespace.Labels)
+	}
+	mapping := scene.DefaultMapping
+	if content := utils.ConfigChangeScene(); content != "" {
+		if parsed, err := scene.ParseMapping(content); err == nil {
+			mapping = parsed
+		}
+	}
+	mapped := mapping.Lookup(workload.Namespace)
+	lookup := func(key string, mappedValue string, defaultValue string) string {
+		if value, ok := lookupDefenseAnnotation(sources, key, isNotEmpty); ok {
+			return value
+		}
+		if mappedValue != "" {
+			return mappedValue
+		}
+		return defaultValue
+	}
+	return &v1alpha1.ChangeScene{
+		TenantCode:   lookup(utils.TenantCodeAnnotation, mapped.TenantCode, utils.DefaultTldcTenantCode),
+		ScenarioCode: lookup(utils.ChangeScenarioCodeAnnotation, mapped.ScenarioCode, utils.ChangeScenarioCode),
+		Phase:        lookup(utils.ChangePhaseAnnotation, mapped.Phase, utils.ChangePhase),
+		SceneKey:     lookup(utils.ChangeSceneKeyAnnotation, mapped.SceneKey, utils.ChangeSceneKeyRollingUpdate),
+	}
+}
+
+// getObservationWindow 获取本地检查器的观察窗口，默认60s
+// getObservationWindow gets the observation window of the local checkers, 60s by default
+func getObservationWindow(ctx context.Context, c client.Client, workload *v1alpha1.ChangeWorkload) time.Duration {
+	return lookupObservationWindow(getDefenseAnnotations(ctx, c, workload))
+}
+
+func lookupObservationWindow(annotations []map[string]string) time.Duration {
+	if value, ok := lookupDefenseAnnotation(annotations, utils.ObservationWindowAnnotation, isPositiveDuration); ok {
+		window, _ := time.ParseDuration(value)
+		return window
+	}
+	return checker.DefaultObservationWindow
+}
+
+// getBakeWindow 获取pod进入批次前需要连续ready的时长，取注解和工作负载minReadySeconds中较长的一个，没有owner的pod只按照namespace的注解
+// getBakeWindow gets how long the pod has to stay ready before it enters a batch, the longer of the annotation and the
+// minReadySeconds of the workload, only the namespace annotation applies to a pod without an owner
+func getBakeWindow(ctx context.Context, c client.Client, owner client.Object, namespace string) time.Duration {
+	if owner == nil {
+		owner = &appsv1.Deployment{}
+		owner.SetNamespace(namespace)
+	}
+	window := time.Duration(getOwnerMinReadySeconds(owner)) * time.Second
+	if value, ok := lookupDefenseAnnotation(getDeploymentDefenseAnnotations(ctx, c, owner), utils.BakeWindowAnnotation, isPositiveDuration); ok {
+		if bakeWindow, _ := time.ParseDuration(value); bakeWindow > window {
+			window = bakeWindow
+		}
+	}
+	return window
+}
+
+// getPostSubmitDelay 获取前置校验通过后提交后置校验前的等待时长，默认不等待
+// getPostSubmitDelay gets how long to wait after the pre check passes before the post check is submitted, no wait by default
+func getPostSubmitDelay(ctx context.Context, c client.Client, workload *v1alpha1.ChangeWorkload) time.Duration {
+	if value, ok := lookupDefenseAnnotation(getDefenseAnnotations(ctx, c, workload), utils.PostSubmitDelayAnnotation, isPositiveDuration); ok {
+		delay, _ := time.ParseDuration(value)
+		return delay
+	}
+	return 0
+}
+
+// reachesScaleThreshold 判断从from扩容到to新增的副本数是否达到阈值，阈值已经通过isScaleThreshold校验
+// reachesScaleThreshold reports whether the replicas added from from to to reach the threshold, which is validated by isScaleThreshold
+func reachesScaleThreshold(threshold string, from int32, to int32) bool {
+	added := int(to - from)
+	if added <= utils.NumberZero {
+		return false
+	}
+	if strings.HasSuffix(threshold, "%") {
+		value, _ := strconv.Atoi(strings.TrimSuffix(threshold, "%"))
+		return added*utils.NumberOneHundred >= value*int(from)
+	}
+	value, _ := strconv.Atoi(threshold)
+	return added >= value
+}
+
+// isLocalChecker 本地检查器没有前置校验，在提交后的观察窗口内给出校验结果
+// isLocalChecker the local checkers have no pre check, they give the verdicts within the observation window after submit
+func isLocalChecker(checkerName string) bool {
+	return checkerName == utils.CheckerPodHealth || checkerName == utils.CheckerPrometheus || checkerName == utils.CheckerLogPattern
+}
+
+func isFailPolicy(value string) bool {
+	return value == utils.FailPolicyPass || value == utils.FailPolicyFail || value == utils.FailPolicyRetry
+}
+
+func isChecker(value string) bool {
+	return value == utils.CheckerOpsCloud || isLocalChecker(value)
+}
+
+func isNotEmpty(value string) bool {
+	return value != ""
+}
+
+func isScaleThreshold(value string) bool {
+	number, err := strconv.Atoi(strings.TrimSuffix(value, "%"))
+	return err == nil && number > 0
+}
+
+func isPositiveDuration(value string) bool {
+	duration, err := time.ParseDuration(value)
+	return err == nil && duration > 0
+}
+
+func isNonNegativeInt(value string) bool {
+	number, err := strconv.Atoi(value)
+	return err == nil && number >= 0
+}
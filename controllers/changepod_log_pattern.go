@@ -0,0 +1,104 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/apis/app.ops.cloud.alipay.com/v1alpha1"
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/checker"
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/utils"
+)
+
+// logPatternCheckHandle 观察窗口结束后读取每个pod在窗口内的日志，按照日志规则的匹配次数给出校验结果并进入PostFinish，
+// 读取日志失败时进入PostFailed由fail policy处理
+// logPatternCheckHandle reads the logs of every pod within the observation window once it is over, it gives the verdicts
+// by the match counts of the log patterns and moves to PostFinish, a failed read moves to PostFailed and is handled by
+// the fail policy
+func (r *ChangePodReconciler) logPatternCheckHandle(ctx context.Context, changePod *v1alpha1.ChangePod, workload *v1alpha1.ChangeWorkload) (ctrl.Result, error) {
+	logger := log.FromContext(ctx).WithName("logPatternCheckHandle")
+	windowStart := time.Unix(changePod.Status.PostSubmitTimeUnix, 0)
+	if wait := time.Until(windowStart.Add(getObservationWindow(ctx, r.Client, workload))); wait > 0 {
+		return ctrl.Result{RequeueAfter: wait}, nil
+	}
+
+	podResults, err := r.checkLogPattern(ctx, changePod, windowStart)
+	if err != nil {
+		logger.Error(err, "log pattern check error", utils.LogChangePodResource, utils.GetResource(changePod))
+		setChangePodPostFailedStatus(changePod)
+		logger.Info("change pod post submitted to post failed", utils.LogChangePodResource, utils.GetResource(changePod), "checker", changePod.Status.Checker)
+		return ctrl.Result{}, r.updateChangePodStatus(ctx, changePod)
+	}
+	changePod.Status.PodResults = podResults
+	setChangePodStatus(changePod, v1alpha1.PostFinish)
+	logger.Info("change pod post submitted to post finish", utils.LogChangePodResource, utils.GetResource(changePod), "checker", changePod.Status.Checker)
+	return ctrl.Result{}, r.updateChangePodStatus(ctx, changePod)
+}
+
+// checkLogPattern 使用全局配置的日志规则逐个检查changePod的pod
+// checkLogPattern checks the pods of the changePod one by one with the log patterns of the global config
+func (r *ChangePodReconciler) checkLogPattern(ctx context.Context, changePod *v1alpha1.ChangePod, since time.Time) ([]v1alpha1.PodSummary, error) {
+	content := utils.ConfigLogPattern()
+	if content == "" {
+		return nil, fmt.Errorf("log pattern checker is not enabled")
+	}
+	config, err := checker.ParseLogPatternConfig(content)
+	if err != nil {
+		return nil, err
+	}
+	logSource := r.LogSource
+	if logSource == nil {
+		logSource = checker.ClientsetLogSource{Interface: utils.App.K8sClient}
+	}
+	logPatternChecker, err := checker.NewLogPatternChecker(config, logSource)
+	if err != nil {
+		return nil, err
+	}
+
+	podResults := make([]v1alpha1.PodSummary, utils.NumberZero)
+	for _, podInfo := range changePod.Spec.PodInfos {
+		podInfo.Verdict = utils.ChangePodVerdictPass
+		pod := &v1.Pod{}
+		if err := r.Get(ctx, types.NamespacedName{Namespace: podInfo.Namespace, Name: podInfo.Pod}, pod); err != nil {
+			if !errors.IsNotFound(err) {
+				return nil, err
+			}
+			// pod在窗口内被替换或者缩容，没有可以读取的日志，不能让替换掉的异常pod通过
+			// the pod is replaced or scaled down during the window, there are no logs left to read and a crashing pod
+			// that got replaced must not pass the batch
+			podInfo.Verdict = utils.ChangePodVerdictInconclusive
+			podInfo.Message = "pod is gone before its logs were read"
+		} else if passed, message, err := logPatternChecker.Check(ctx, pod, since); err != nil {
+			return nil, fmt.Errorf("pod %s: %w", podInfo.Pod, err)
+		} else {
+			if !passed {
+				podInfo.Verdict = utils.ChangePodVerdictFail
+			}
+			podInfo.Message = message
+		}
+		podResults = append(podResults, podInfo)
+	}
+	return podResults, nil
+}
@@ -0,0 +1,103 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/apis/app.ops.cloud.alipay.com/v1alpha1"
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/utils"
+)
+
+// podHealthCheckHandle 本地检查器在观察窗口内定期检查changePod的pod，发现不健康的pod或者窗口结束时给出校验结果并进入PostFinish
+// podHealthCheckHandle checks the pods of the changePod periodically during the observation window, it gives the verdicts
+// and moves to PostFinish once a pod is unhealthy or the window is over
+func (r *ChangePodReconciler) podHealthCheckHandle(ctx context.Context, changePod *v1alpha1.ChangePod, workload *v1alpha1.ChangeWorkload) (ctrl.Result, error) {
+	logger := log.FromContext(ctx).WithName("podHealthCheckHandle")
+	podHealthChecker := getPodHealthChecker(ctx, r.Client, workload)
+	windowStart := time.Unix(changePod.Status.PostSubmitTimeUnix, 0)
+	windowEnd := windowStart.Add(podHealthChecker.ObservationWindow)
+	windowEnded := !time.Now().Before(windowEnd)
+
+	podHealth := make([]v1alpha1.PodHealth, utils.NumberZero)
+	podResults := make([]v1alpha1.PodSummary, utils.NumberZero)
+	unhealthy := false
+	for _, podInfo := range changePod.Spec.PodInfos {
+		health := getPodHealth(changePod, podInfo.Pod)
+		podInfo.Verdict = utils.ChangePodVerdictPass
+		pod := &v1.Pod{}
+		if err := r.Get(ctx, types.NamespacedName{Namespace: podInfo.Namespace, Name: podInfo.Pod}, pod); err != nil {
+			if !errors.IsNotFound(err) {
+				logger.Error(err, "get pod error", utils.LogChangePodResource, utils.GetResource(changePod), "pod", podInfo.Pod)
+				return ctrl.Result{}, err
+			}
+			// pod在窗口内被替换或者缩容，没有可以观察的状态，不能让替换掉的异常pod通过
+			// the pod is replaced or scaled down during the window, there is nothing left to observe and a crashing pod
+			// that got replaced must not pass the batch
+			podInfo.Verdict = utils.ChangePodVerdictInconclusive
+			podInfo.Message = "pod is gone before the end of the observation window"
+			unhealthy = true
+		} else if reason := podHealthChecker.Check(pod, &health, windowStart, windowEnded); reason != "" {
+			podInfo.Verdict = utils.ChangePodVerdictFail
+			podInfo.Message = reason
+			unhealthy = true
+		} else {
+			podInfo.Message = fmt.Sprintf("pod is healthy, restarts: %d, readiness flaps: %d", health.Restarts, health.ReadinessFlaps)
+		}
+		podHealth = append(podHealth, health)
+		podResults = append(podResults, podInfo)
+	}
+	changed := !equality.Semantic.DeepEqual(podHealth, changePod.Status.PodHealth)
+	changePod.Status.PodHealth = podHealth
+
+	if unhealthy || windowEnded {
+		changePod.Status.PodResults = podResults
+		setChangePodStatus(changePod, v1alpha1.PostFinish)
+		logger.Info("change pod post submitted to post finish", utils.LogChangePodResource, utils.GetResource(changePod), "checker", changePod.Status.Checker, "unhealthy", unhealthy)
+		return ctrl.Result{}, r.updateChangePodStatus(ctx, changePod)
+	}
+	requeueAfter := time.Until(windowEnd)
+	if interval := utils.PodHealthCheckInterval * time.Second; requeueAfter > interval {
+		requeueAfter = interval
+	}
+	if changed {
+		if err := r.updateChangePodStatus(ctx, changePod); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+	return ctrl.Result{RequeueAfter: requeueAfter}, nil
+}
+
+// getPodHealth 获取pod在changePod中已有的健康记录
+// getPodHealth gets the health record of the pod in the changePod
+func getPodHealth(changePod *v1alpha1.ChangePod, podName string) v1alpha1.PodHealth {
+	for _, health := range changePod.Status.PodHealth {
+		if health.Pod == podName {
+			return health
+		}
+	}
+	return v1alpha1.PodHealth{Pod: podName}
+}
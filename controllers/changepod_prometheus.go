@@ -0,0 +1,175 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/apis/app.ops.cloud.alipay.com/v1alpha1"
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/checker"
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/utils"
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/utils/native"
+)
+
+const deploymentRevisionAnnotation = "deployment.kubernetes.io/revision"
+
+// prometheusCheckHandle 观察窗口结束后查询prometheus，对比这一批pod和上一个版本的指标给出校验结果并进入PostFinish，
+// 查询失败时进入PostFailed由fail policy处理
+// prometheusCheckHandle queries prometheus once the observation window is over, it compares the metrics of the pods of
+// the batch with the previous revision, gives the verdicts and moves to PostFinish, a failed query moves to PostFailed
+// and is handled by the fail policy
+func (r *ChangePodReconciler) prometheusCheckHandle(ctx context.Context, changePod *v1alpha1.ChangePod, workload *v1alpha1.ChangeWorkload) (ctrl.Result, error) {
+	logger := log.FromContext(ctx).WithName("prometheusCheckHandle")
+	window := getObservationWindow(ctx, r.Client, workload)
+	if wait := time.Until(time.Unix(changePod.Status.PostSubmitTimeUnix, 0).Add(window)); wait > 0 {
+		return ctrl.Result{RequeueAfter: wait}, nil
+	}
+
+	prometheusVerdict, message, err := r.checkPrometheus(ctx, changePod, workload, window)
+	if err != nil {
+		logger.Error(err, "prometheus check error", utils.LogChangePodResource, utils.GetResource(changePod))
+		setChangePodPostFailedStatus(changePod)
+		logger.Info("change pod post submitted to post failed", utils.LogChangePodResource, utils.GetResource(changePod), "checker", changePod.Status.Checker)
+		return ctrl.Result{}, r.updateChangePodStatus(ctx, changePod)
+	}
+	verdict := utils.ChangePodVerdictPass
+	switch prometheusVerdict {
+	case checker.VerdictFail:
+		verdict = utils.ChangePodVerdictFail
+	case checker.VerdictInconclusive:
+		verdict = utils.ChangePodVerdictInconclusive
+	}
+	changePod.Status.PodResults = make([]v1alpha1.PodSummary, utils.NumberZero)
+	for _, podInfo := range changePod.Spec.PodInfos {
+		podInfo.Verdict = verdict
+		podInfo.Message = message
+		changePod.Status.PodResults = append(changePod.Status.PodResults, podInfo)
+	}
+	setChangePodStatus(changePod, v1alpha1.PostFinish)
+	logger.Info("change pod post submitted to post finish", utils.LogChangePodResource, utils.GetResource(changePod), "checker", changePod.Status.Checker, "verdict", verdict)
+	return ctrl.Result{}, r.updateChangePodStatus(ctx, changePod)
+}
+
+// checkPrometheus 执行全局配置的查询，没有上一个版本时只比较绝对阈值
+// checkPrometheus runs the queries of the global config, only the absolute thresholds apply when there is no previous revision
+func (r *ChangePodReconciler) checkPrometheus(ctx context.Context, changePod *v1alpha1.ChangePod, workload *v1alpha1.ChangeWorkload, window time.Duration) (string, string, error) {
+	content := utils.ConfigPrometheus()
+	if content == "" {
+		return "", "", fmt.Errorf("prometheus checker is not enabled")
+	}
+	config, err := checker.ParsePrometheusConfig(content)
+	if err != nil {
+		return "", "", err
+	}
+	prometheusChecker, err := checker.NewPrometheusChecker(config)
+	if err != nil {
+		return "", "", err
+	}
+
+	pods := make([]string, 0, len(changePod.Spec.PodInfos))
+	for _, podInfo := range changePod.Spec.PodInfos {
+		pods = append(pods, podInfo.Pod)
+	}
+	deploymentName := workload.Labels[native.DeploymentNameLabel]
+	windowString := strconv.Itoa(int(window.Seconds())) + "s"
+	current := checker.PrometheusScope{
+		Namespace:  changePod.Namespace,
+		Deployment: deploymentName,
+		Version:    changePod.Labels[native.AdmissionWebhookVersionLabel],
+		Pods:       checker.PodsRegex(pods),
+		Window:     windowString,
+	}
+	var baseline *checker.PrometheusScope
+	previous, err := r.getPreviousReplicaSet(ctx, changePod.Namespace, deploymentName, current.Version)
+	if err != nil {
+		return "", "", err
+	}
+	if previous != nil {
+		baseline = &checker.PrometheusScope{
+			Namespace:  changePod.Namespace,
+			Deployment: deploymentName,
+			Version:    previous.Labels[native.AdmissionWebhookVersionLabel],
+			Pods:       regexp.QuoteMeta(previous.Name) + "-.*",
+			Window:     windowString,
+		}
+	}
+
+	queryCtx, cancel := context.WithTimeout(ctx, utils.PrometheusQueryTimeout*time.Second)
+	defer cancel()
+	return prometheusChecker.Check(queryCtx, current, baseline)
+}
+
+// getPreviousReplicaSet 获取deployment上一个版本的replicaSet，优先按照revision注解排序，没有时按照创建时间排序
+// getPreviousReplicaSet gets the replicaSet of the previous revision of the deployment, it sorts by the revision annotation
+// and falls back to the creation time
+func (r *ChangePodReconciler) getPreviousReplicaSet(ctx context.Context, namespace string, deploymentName string, version string) (*appsv1.ReplicaSet, error) {
+	replicaSetList := &appsv1.ReplicaSetList{}
+	if err := r.List(ctx, replicaSetList, client.InNamespace(namespace)); err != nil {
+		return nil, err
+	}
+	replicaSets := make([]appsv1.ReplicaSet, 0, len(replicaSetList.Items))
+	for _, replicaSet := range replicaSetList.Items {
+		if !isOwnedByDeployment(replicaSet.OwnerReferences, deploymentName) {
+			continue
+		}
+		if replicaSetVersion := replicaSet.Labels[native.AdmissionWebhookVersionLabel]; replicaSetVersion == "" || replicaSetVersion == version {
+			continue
+		}
+		replicaSets = append(replicaSets, replicaSet)
+	}
+	if len(replicaSets) == 0 {
+		return nil, nil
+	}
+	sort.Slice(replicaSets, func(i, j int) bool {
+		revisionI, errI := strconv.ParseInt(getReplicaSetRevision(&replicaSets[i]), 10, 64)
+		revisionJ, errJ := strconv.ParseInt(getReplicaSetRevision(&replicaSets[j]), 10, 64)
+		if errI == nil && errJ == nil && revisionI != revisionJ {
+			return revisionI > revisionJ
+		}
+		return replicaSets[j].CreationTimestamp.Before(&replicaSets[i].CreationTimestamp)
+	})
+	return &replicaSets[0], nil
+}
+
+// getReplicaSetRevision replicaSet的版本序号，由Deployment或者Argo Rollouts记录
+// getReplicaSetRevision the revision number of the replicaSet recorded by the Deployment or Argo Rollouts
+func getReplicaSetRevision(replicaSet *appsv1.ReplicaSet) string {
+	if revision, ok := replicaSet.Annotations[deploymentRevisionAnnotation]; ok {
+		return revision
+	}
+	return replicaSet.Annotations[native.RolloutRevisionAnnotation]
+}
+
+func isOwnedByDeployment(ownerReferences []metav1.OwnerReference, deploymentName string) bool {
+	for _, ownerReference := range ownerReferences {
+		if (ownerReference.Kind == native.DeploymentKind || ownerReference.Kind == native.RolloutKind) && ownerReference.Name == deploymentName {
+			return true
+		}
+	}
+	return false
+}
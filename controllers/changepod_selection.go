@@ -0,0 +1,109 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/apis/app.ops.cloud.alipay.com/v1alpha1"
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/selection"
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/utils"
+)
+
+// getBatchSelection 获取挑选每一批pod的策略，deployment的注解优先于namespace的注解，默认spread
+// getBatchSelection gets the strategy to pick the pods of every batch, the deployment annotation takes precedence over
+// the namespace one and the default is spread
+func getBatchSelection(ctx context.Context, c client.Client, workload *v1alpha1.ChangeWorkload) string {
+	if strategy, ok := lookupDefenseAnnotation(getDefenseAnnotations(ctx, c, workload), utils.BatchSelectionAnnotation, selection.IsStrategy); ok {
+		return strategy
+	}
+	return selection.StrategySpread
+}
+
+// getPodNodes 获取pod所在的节点，获取失败的节点被忽略，这些pod没有拓扑信息
+// getPodNodes gets the nodes of the pods, the nodes that can't be read are skipped and their pods have no topology
+func getPodNodes(ctx context.Context, c client.Client, pods []v1.Pod) map[string]*v1.Node {
+	logger := log.FromContext(ctx).WithName("getPodNodes")
+	nodes := make(map[string]*v1.Node)
+	for _, pod := range pods {
+		nodeName := pod.Spec.NodeName
+		if nodeName == "" {
+			continue
+		}
+		if _, ok := nodes[nodeName]; ok {
+			continue
+		}
+		node := &v1.Node{}
+		if err := c.Get(ctx, client.ObjectKey{Name: nodeName}, node); err != nil {
+			logger.Error(err, "get node error", utils.LogPodResource, utils.GetResource(&pod))
+			continue
+		}
+		nodes[nodeName] = node
+	}
+	return nodes
+}
+
+// selectBatchPods 按照策略挑选一批pod，按照canary步骤或者partition划分批次时取对应批次的pod数，spread策略下第一批至少包含每个故障域的一个pod
+// selectBatchPods picks the pods of a batch with the strategy, the batch takes the pods of its canary step or partition
+// when the batches follow them, with the spread strategy the first batch takes at least one pod of every failure domain
+func selectBatchPods(ctx context.Context, c client.Client, workload *v1alpha1.ChangeWorkload, changePod *v1alpha1.ChangePod,
+	pods []v1.Pod, nodes map[string]*v1.Node) []v1.Pod {
+	candidates := make([]selection.Candidate, 0, len(pods))
+	for _, pod := range pods {
+		candidate := selection.Candidate{Name: pod.Name, Node: pod.Spec.NodeName, CreateTime: pod.CreationTimestamp.Time}
+		if node, ok := nodes[pod.Spec.NodeName]; ok {
+			candidate.Zone = node.Labels[v1.LabelTopologyZone]
+			candidate.Region = node.Labels[v1.LabelTopologyRegion]
+		}
+		candidates = append(candidates, candidate)
+	}
+	strategy := getBatchSelection(ctx, c, workload)
+	count := getCountThreshold(workload, getChangePodNum(workload, changePod))
+	if strategy == selection.StrategySpread && isFirstChangePod(workload, changePod) {
+		if domains := selection.Domains(candidates); domains > count {
+			count = domains
+		}
+	}
+	selected := make([]v1.Pod, 0, count)
+	for _, index := range selection.Select(strategy, candidates, count, changePod.Name) {
+		selected = append(selected, pods[index])
+	}
+	return selected
+}
+
+// getChangePodNum changePod之前的批次数，和创建changePod时的序号一致，从0开始
+// getChangePodNum the number of batches before the changePod, it matches the number the changePod was created with and
+// starts from 0
+func getChangePodNum(workload *v1alpha1.ChangeWorkload, changePod *v1alpha1.ChangePod) int {
+	num, err := strconv.Atoi(strings.TrimPrefix(changePod.Name, workload.Name+utils.MetaMark))
+	if err != nil || num < utils.NumberOne {
+		return utils.NumberZero
+	}
+	return num - utils.NumberOne
+}
+
+// isFirstChangePod 是否为workload的第一批
+// isFirstChangePod whether the changePod is the first batch of the workload
+func isFirstChangePod(workload *v1alpha1.ChangeWorkload, changePod *v1alpha1.ChangePod) bool {
+	return changePod.Name == workload.Name+utils.MetaMark+strconv.Itoa(utils.NumberOne)
+}
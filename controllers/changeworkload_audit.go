@@ -0,0 +1,51 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/apis/app.ops.cloud.alipay.com/v1alpha1"
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/audit"
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/utils"
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/utils/native"
+)
+
+//+kubebuilder:rbac:groups=app.ops.cloud.alipay.com,resources=auditrecords,verbs=get;list;watch;create
+
+// recordWorkloadAudit 为ChangeWorkload所属的工作负载写入审计记录，写入失败只记录日志，审计不阻塞防御
+// recordWorkloadAudit writes the audit record of the workload the ChangeWorkload belongs to, a failure is only logged
+// so that the defense is never blocked by the audit trail
+func recordWorkloadAudit(ctx context.Context, c client.Client, workload *v1alpha1.ChangeWorkload, key string, spec v1alpha1.AuditRecordSpec) {
+	spec.Kind, spec.Name = native.GetChangeWorkloadTarget(workload)
+	spec.ChangeWorkload = workload.Name
+	spec.Revision = workload.Spec.Reversion
+	if err := audit.Record(ctx, c, workload.Namespace, key, spec); err != nil {
+		log.FromContext(ctx).WithName("recordWorkloadAudit").Error(err, "write audit record error",
+			utils.LogChangeWorkloadResource, utils.GetResource(workload), "action", spec.Action)
+	}
+}
+
+// suspensionAuditKey 一次暂停和解除暂停的审计记录键，每次暂停的时间不同
+// suspensionAuditKey the audit key of a suspension and of lifting it, every suspension has its own time
+func suspensionAuditKey(owner client.Object, action string, suspendedAt string) string {
+	return fmt.Sprintf("%s/%s/%s/%s/%s", getOwnerKind(owner), owner.GetNamespace(), owner.GetName(), action, suspendedAt)
+}
@@ -18,12 +18,13 @@ package controllers
 
 import (
 	"context"
+	"fmt"
 	"strconv"
+	"strings"
 	"time"
 
-	appsv1 "k8s.io/api/apps/v1"
 	v1 "k8s.io/api/core/v1"
-	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/event"
@@ -36,6 +37,7 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 
+	opsClient "gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/client"
 	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/resource"
 	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/utils"
 	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/utils/native"
@@ -50,13 +52,15 @@ const (
 // ChangeWorkloadReconciler reconciles a ChangeWorkload object
 type ChangeWorkloadReconciler struct {
 	client.Client
-	Scheme *runtime.Scheme
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
 }
 
 //+kubebuilder:rbac:groups=app.ops.cloud.alipay.com,resources=changeworkloads,verbs=get;list;watch;create;update;patch;delete;deletecollection
 //+kubebuilder:rbac:groups=app.ops.cloud.alipay.com,resources=changeworkloads/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=app.ops.cloud.alipay.com,resources=changeworkloads/finalizers,verbs=update
 //+kubebuilder:rbac:groups="apps",resources=replicasets,verbs=get;list;watch;update;patch
+//+kubebuilder:rbac:groups="",resources=events,verbs=create;patch
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -98,6 +102,8 @@ func (r *ChangeWorkloadReconciler) Reconcile(ctx context.Context, req ctrl.Reque
 	switch workload.Status.Status {
 	case v1alpha1.Init:
 		return r.initChangeWorkloadHandle(ctx, workload)
+	case v1alpha1.Queued:
+		return r.queueChangeWorkloadHandle(ctx, workload)
 	case v1alpha1.Success:
 		return r.successChangeWorkloadHandle(ctx, workload)
 	case v1alpha1.Running:
@@ -180,8 +186,12 @@ func (r *ChangeWorkloadReconciler) handleCreateEvent(e event.CreateEvent) bool {
 func (r *ChangeWorkloadReconciler) changeWorkloadHandleEvent(workload *v1alpha1.ChangeWorkload) bool {
 	isInitStatus := isInitStatusChangeWorkload(workload)
 	isFailedStatus := isFailedStatusChangeWorkload(workload)
-	// 如果是初始化状态或者失败状态，不处理
-	// if it is an initialization status or a failed status, it is not processed
+	// 如果是初始化状态或者失败状态，不处理，排队模式下或者等待上游时被暂停的工作负载不会产生pod，初始化状态的变更需要立即排队
+	// if it is an initialization status or a failed status, it is not processed, the workloads paused in the hold mode or
+	// for their upstreams create no pods so the changes of the initialization status are queued right away
+	if isInitStatus && (isQueueHolding() || len(workload.Spec.DependsOn) > 0) {
+		return true
+	}
 	if isInitStatus || isFailedStatus {
 		return false
 	}
@@ -191,16 +201,18 @@ func (r *ChangeWorkloadReconciler) changeWorkloadHandleEvent(workload *v1alpha1.
 // initChangeWorkloadHandle 处理init状态
 // initChangeWorkloadHandle handles the init status
 func (r *ChangeWorkloadReconciler) initChangeWorkloadHandle(ctx context.Context, changeWorkload *v1alpha1.ChangeWorkload) (ctrl.Result, error) {
-	//logger := log.FromContext(ctx).WithName("initChangeWorkloadHandle")
-	// 单机单元测试时，不需要调用ops-cloud接口
-	//_, err := opsClient.SubmitChangeExecOrder(buildChangeChangeWorkloadRequest(*changeWorkload))
-	//if err != nil {
-	//	logger.Error(err, "changePod to SubmitChangeFinishNotify failed", utils.LogChangeWorkloadResource, utils.GetResource(changeWorkload))
-	//	changeWorkload.Status.Status = v1alpha1.Failed
-	//	return ctrl.Result{}, r.updateWorkloadStatus(ctx, changeWorkload)
-	//}
-	changeWorkload.Status.Status = v1alpha1.Running
-	return ctrl.Result{}, r.updateWorkloadStatus(ctx, changeWorkload)
+	logger := log.FromContext(ctx).WithName("initChangeWorkloadHandle")
+	// 只有opscloud检查器需要变更单，本地检查器不调用ops-cloud接口，变更单按照bizExecOrderId提交，重复提交不会产生新的变更单
+	// only the opscloud checker needs an order, the local checkers never call ops-cloud, the order is submitted by its
+	// bizExecOrderId so submitting it again creates no new order
+	if getChecker(ctx, r.Client, changeWorkload) == utils.CheckerOpsCloud {
+		request := buildChangeChangeWorkloadRequest(*changeWorkload, getChangeScene(ctx, r.Client, changeWorkload))
+		if _, err := opsClient.SubmitChangeExecOrder(ctx, request); err != nil {
+			logger.Error(err, "submit change exec order error", utils.LogChangeWorkloadResource, utils.GetResource(changeWorkload))
+			return ctrl.Result{}, err
+		}
+	}
+	return r.queueChangeWorkloadHandle(ctx, changeWorkload)
 }
 
 // successChangeWorkloadHandle 处理success状态的changeWorkload
@@ -239,7 +251,23 @@ func (r *ChangeWorkloadReconciler) suspendChangeWorkloadHandle(ctx context.Conte
 		return ctrl.Result{}, err
 	}
 	// Sync current workload status
-	return ctrl.Result{}, r.syncChangeWorkloadStatus(ctx, workload)
+	if err := r.syncChangeWorkloadStatus(ctx, workload); err != nil {
+		return ctrl.Result{}, err
+	}
+	// 暂停期间每次处理都重新中止工作负载，Rollout的中止和partition可以绕过webhook被撤销，定期重新处理
+	// the workload is aborted again on every reconcile while suspended, the abort of a Rollout and a partition can be
+	// undone around the webhook so it is reconciled periodically
+	owner, err := getWorkloadOwner(ctx, r.Client, workload)
+	if err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	if _, suspended := owner.GetLabels()[utils.SuspendLabel]; !suspended || !(isRollout(owner) || isCloneSet(owner) || isAdvancedStatefulSet(owner)) {
+		return ctrl.Result{}, nil
+	}
+	if err := r.enforceSuspension(ctx, owner); err != nil {
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{RequeueAfter: utils.SuspensionEnforceInterval * time.Second}, nil
 }
 
 // waitTimeoutChangeWorkloadHandle 处理waitTimeout状态的changeWorkload
@@ -270,7 +298,7 @@ func (r *ChangeWorkloadReconciler) ensureInitChangePodCreatedIfNecessary(ctx con
 	var ifNecessary bool
 	if reachedThreshold {
 		// Check if preparing pod number reaches the threshold, if so, create a new changePod
-		ifNecessary = r.isDefensePreparingPodsThresholdReached(ctx, workload)
+		ifNecessary = r.isDefensePreparingPodsThresholdReached(ctx, workload, changePodNum)
 	} else {
 		// Check if there are preparing pods, if so, create a new changePod
 		ifNecessary = r.isDefensePreparingPodsExist(ctx, workload)
@@ -343,26 +371,103 @@ func (r *ChangeWorkloadReconciler) updateWorkloadStatus(ctx context.Context, wor
 	return nil
 }
 
-// addOrRemoveDeploymentSuspendLabel 添加或删除deployment的suspend label
-// addOrRemoveDeploymentSuspendLabel add or remove deployment suspend label
-func (r *ChangeWorkloadReconciler) addOrRemoveDeploymentSuspendLabel(ctx context.Context, deployment *appsv1.Deployment, add bool) error {
-	logger := log.FromContext(ctx).WithName("addOrRemoveDeploymentSuspendLabel")
-	patch := client.MergeFrom(deployment.DeepCopy())
-	if add && utils.ConfigIsBlockingUp() {
-		if _, ok := deployment.Labels[utils.SuspendLabel]; ok {
-			return nil
+// addOrRemoveSuspendLabel 添加或删除工作负载的suspend label，暂停的Rollout同时被中止，暂停的CloneSet和Advanced StatefulSet停住partition
+// addOrRemoveSuspendLabel add or remove the suspend label of the workload, a suspended Rollout is aborted as well and a
+// suspended CloneSet or Advanced StatefulSet holds its partition
+func (r *ChangeWorkloadReconciler) addOrRemoveSuspendLabel(ctx context.Context, owner client.Object, workload *v1alpha1.ChangeWorkload, add bool) error {
+	logger := log.FromContext(ctx).WithName("addOrRemoveSuspendLabel")
+	patch := client.MergeFrom(owner.DeepCopyObject().(client.Object))
+	labels := owner.GetLabels()
+	if labels == nil {
+		labels = make(map[string]string)
+	}
+	suspend := add && utils.ConfigIsBlockingUp()
+	suspendedAt, suspended := labels[utils.SuspendLabel]
+	if suspend {
+		// 已经暂停的工作负载不再打标签，但是每次都重新中止或者停住partition，避免暂停期间被重试或者放开partition
+		// an already suspended workload is not labeled again, but it is aborted or its partition is held again every time
+		// so it is neither retried nor its partition lowered while suspended
+		if suspended {
+			return r.enforceSuspension(ctx, owner)
 		}
-		deployment.Labels[utils.SuspendLabel] = strconv.FormatInt(time.Now().Unix(), utils.NumberTen)
+		suspendedAt = strconv.FormatInt(time.Now().Unix(), utils.NumberTen)
+		labels[utils.SuspendLabel] = suspendedAt
 	} else {
-		if _, ok := deployment.Labels[utils.SuspendLabel]; !ok {
+		if !suspended {
 			return nil
 		}
-		deployment.Labels[utils.IgnoredSuspendLabel] = utils.True
-		delete(deployment.Labels, utils.SuspendLabel)
-		delete(deployment.Labels, utils.DefenseStatusLabel)
+		labels[utils.IgnoredSuspendLabel] = utils.True
+		delete(labels, utils.SuspendLabel)
+		delete(labels, utils.DefenseStatusLabel)
 	}
-	if err := r.Patch(ctx, deployment, patch); err != nil {
-		logger.Error(err, "add or remove deployment suspend label error", utils.LogDeploymentResource, utils.GetResource(deployment))
+	owner.SetLabels(labels)
+	if err := r.Patch(ctx, owner, patch); err != nil {
+		logger.Error(err, "add or remove deployment suspend label error", utils.LogDeploymentResource, utils.GetResource(owner))
+		return err
+	}
+	if suspend {
+		recordWorkloadAudit(ctx, r.Client, workload, suspensionAuditKey(owner, v1alpha1.AuditSuspend, suspendedAt), v1alpha1.AuditRecordSpec{
+			Action:  v1alpha1.AuditSuspend,
+			Verdict: utils.ChangePodVerdictFail,
+			Results: workload.Status.DefenseCheckFailPods,
+			Message: fmt.Sprintf("suspended by the ChangeWorkload %s, %d pods failed the checks", workload.Name, len(workload.Status.DefenseCheckFailPods)),
+		})
+	} else {
+		recordWorkloadAudit(ctx, r.Client, workload, suspensionAuditKey(owner, v1alpha1.AuditUnsuspend, suspendedAt), v1alpha1.AuditRecordSpec{
+			Action:  v1alpha1.AuditUnsuspend,
+			Message: fmt.Sprintf("the suspension is lifted by the ChangeWorkload %s", workload.Name),
+		})
+	}
+	if suspend {
+		if err := r.enforceSuspension(ctx, owner); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// enforceSuspension 中止暂停的Rollout，停住暂停的CloneSet和Advanced StatefulSet的partition，Rollout被重试或者partition被放开后再次执行
+// enforceSuspension aborts a suspended Rollout and holds the partition of a suspended CloneSet or Advanced StatefulSet,
+// again after the Rollout is retried or the partition is lowered
+func (r *ChangeWorkloadReconciler) enforceSuspension(ctx context.Context, owner client.Object) error {
+	logger := log.FromContext(ctx).WithName("enforceSuspension")
+	if isRollout(owner) && !isRolloutAborted(owner) {
+		if err := abortRollout(ctx, r.Client, owner); err != nil {
+			logger.Error(err, "abort rollout error", utils.LogRolloutResource, utils.GetResource(owner))
+			return err
+		}
+		logger.Info("abort rollout", utils.LogRolloutResource, utils.GetResource(owner))
+	}
+	if isCloneSet(owner) || isAdvancedStatefulSet(owner) {
+		held, err := holdPartition(ctx, r.Client, owner)
+		if err != nil {
+			logger.Error(err, "hold partition error", "kind", getOwnerKind(owner), utils.LogDeploymentResource, utils.GetResource(owner))
+			return err
+		}
+		if held {
+			logger.Info("hold partition", "kind", getOwnerKind(owner), utils.LogDeploymentResource, utils.GetResource(owner))
+		}
+	}
+	return nil
+}
+
+// recordVerifiedRevision 把校验通过的版本记录到工作负载上，暂停后允许回滚到这个版本
+// recordVerifiedRevision records the revision that passed the checks on the workload, a suspended workload may roll back to it
+func (r *ChangeWorkloadReconciler) recordVerifiedRevision(ctx context.Context, owner client.Object, workload *v1alpha1.ChangeWorkload) error {
+	logger := log.FromContext(ctx).WithName("recordVerifiedRevision")
+	revision := workload.Labels[native.AdmissionWebhookVersionLabel]
+	if revision == "" || owner.GetAnnotations()[utils.VerifiedRevisionAnnotation] == revision {
+		return nil
+	}
+	patch := client.MergeFrom(owner.DeepCopyObject().(client.Object))
+	annotations := owner.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	annotations[utils.VerifiedRevisionAnnotation] = revision
+	owner.SetAnnotations(annotations)
+	if err := r.Patch(ctx, owner, patch); err != nil {
+		logger.Error(err, "record verified revision error", utils.LogDeploymentResource, utils.GetResource(owner))
 		return err
 	}
 	return nil
@@ -382,14 +487,27 @@ func (r *ChangeWorkloadReconciler) patchWorkloadEntryTime(ctx context.Context, w
 
 // isDefensePreparingPodsThresholdReached 获取当前workload下有finished label并且没有defense label的pod，如果个数大于等于阈值则返回true
 // isDefensePreparingPodsThresholdReached get pod list by four tuple, then filter pod with finished label and without defense label, if the number of pod is greater than or equal to threshold, return true
-func (r *ChangeWorkloadReconciler) isDefensePreparingPodsThresholdReached(ctx context.Context, changeWorkload *v1alpha1.ChangeWorkload) bool {
+func (r *ChangeWorkloadReconciler) isDefensePreparingPodsThresholdReached(ctx context.Context, changeWorkload *v1alpha1.ChangeWorkload, changePodNum int) bool {
 	logger := log.FromContext(ctx).WithName("isDefensePreparingPodsThresholdReached")
 	if podArray, err := r.getFinishedWithoutDefensedPodsByWorkload(ctx, changeWorkload); err != nil {
 		logger.Error(err, "get pod error", utils.LogChangeWorkloadResource, utils.GetResource(changeWorkload))
 		return false
 	} else {
-		return len(podArray) >= changeWorkload.Spec.CountThreshold
+		return len(podArray) >= getCountThreshold(changeWorkload, changePodNum)
+	}
+}
+
+// getCountThreshold 下一批的pod数，按照canary步骤划分批次时为对应步骤的pod数
+// getCountThreshold the pods of the next batch, it is the pods of the matching step when the batches follow the canary steps
+func getCountThreshold(changeWorkload *v1alpha1.ChangeWorkload, changePodNum int) int {
+	batches := changeWorkload.Spec.Batches
+	if len(batches) == 0 {
+		return changeWorkload.Spec.CountThreshold
+	}
+	if changePodNum >= len(batches) {
+		changePodNum = len(batches) - 1
 	}
+	return int(batches[changePodNum])
 }
 
 // isDefensePreparingPodsExist 获取当前workload下有finished label并且没有defense label的pod，如果存在则返回true
@@ -486,7 +604,15 @@ func (r *ChangeWorkloadReconciler) syncChangeWorkloadStatus(ctx context.Context,
 		for _, changePod := range changePods {
 			switch changePod.Status.Message {
 			case v1alpha1.PreTimeout, v1alpha1.PreFailed, v1alpha1.PostFailed, v1alpha1.PostTimeout:
-				successChangePods = append(successChangePods, changePod.Spec.PodInfos...)
+				// 根据fail policy给出的结果统计，没有结果的changePod视为通过
+				// count the verdicts given by the fail policy, a changePod without verdicts passes
+				if utils.IsNotEmpty(changePod.Status.PodResults) {
+					passPods, failedPods := getPassAndFailedPodsByPostFinishChangePod(&changePod)
+					successChangePods = append(successChangePods, passPods...)
+					failureChangePods = append(failureChangePods, failedPods...)
+				} else {
+					successChangePods = append(successChangePods, changePod.Spec.PodInfos...)
+				}
 			case v1alpha1.PostFinish:
 				passPods, failedPods := getPassAndFailedPodsByPostFinishChangePod(&changePod)
 				successChangePods = append(successChangePods, passPods...)
@@ -496,7 +622,7 @@ func (r *ChangeWorkloadReconciler) syncChangeWorkloadStatus(ctx context.Context,
 		// 更新workload的状态
 		// update workload status
 		passPods := utils.RemoveDuplicatePod(successChangePods, allPodMapByWorkload)
-		failPods := utils.RemoveDuplicatePod(failureChangePods, allPodMapByWorkload)
+		failPods := keepInconclusivePods(utils.RemoveDuplicatePod(failureChangePods, allPodMapByWorkload), failureChangePods, allPodMapByWorkload)
 		if utils.IsPodSummarySliceEqual(passPods, workload.Status.DefenseCheckPassPods) && utils.IsPodSummarySliceEqual(failPods, workload.Status.DefenseCheckFailPods) {
 			return nil
 		}
@@ -512,11 +638,22 @@ func (r *ChangeWorkloadReconciler) syncChangeWorkloadStatus(ctx context.Context,
 // validateChangeWorkloadSuccess 验证workload是否已经完成，完成是指workload中成功的pod数量去重后等于replicas，并且均为成功状态，这时证明所有的pod都已经完成了
 // validateChangeWorkloadSuccess validate whether workload is success, success means the number of success pod is equal to replicas after remove duplicate, and all of them are success status, then all pod is success
 func (r *ChangeWorkloadReconciler) validateChangeWorkloadSuccessOrSuspend(ctx context.Context, workload *v1alpha1.ChangeWorkload) error {
-	deployment, err := r.getDeploymentByWorkload(workload)
+	owner, err := getWorkloadOwner(ctx, r.Client, workload)
 	if err != nil {
 		return err
 	}
-	replicas := int(*deployment.Spec.Replicas)
+	replicas := int(getOwnerReplicas(owner))
+	// 扩容的ChangeWorkload只校验扩容新增的pod
+	// a scale-up ChangeWorkload only checks the added pods
+	checkedReplicas := replicas
+	if workload.Spec.Scale != nil {
+		checkedReplicas = replicas - int(workload.Spec.Scale.From)
+		if checkedReplicas < utils.NumberZero {
+			checkedReplicas = utils.NumberZero
+		}
+	}
+	dryRun := utils.IsDryRun(ctx, r.Client, workload.Namespace)
+	workload.Status.DryRun = dryRun
 	// 获取目前全部的有finished的label的pod
 	// get all pod with finished label
 	finishedPods, err := r.getFinishedPodsByWorkload(ctx, workload)
@@ -528,44 +665,68 @@ func (r *ChangeWorkloadReconciler) validateChangeWorkloadSuccessOrSuspend(ctx co
 	isAllPodFinished := len(finishedPods) >= replicas
 	// 判断changeWorkload中pass的pod数量是否等于replicas
 	// judge whether the number of pass pod in changeWorkload is equal to replicas
-	isAllPodPass := len(workload.Status.DefenseCheckPassPods) == replicas
+	isAllPodPass := len(workload.Status.DefenseCheckPassPods) == checkedReplicas
+	if dryRun {
+		// 观察模式下失败的pod不会暂停发布，全部pod校验完成即视为成功
+		// failed pods never suspend the release in dry-run mode, the workload succeeds once every pod is checked
+		isAllPodPass = len(workload.Status.DefenseCheckPassPods)+len(workload.Status.DefenseCheckFailPods) == checkedReplicas
+	}
 	if isAllPodFinished && isAllPodPass {
 		workload.Status.Status = v1alpha1.Success
 	}
 	// 判断changeWorkload中fail的pod数量是否不为空
 	// judge whether the number of fail pod in changeWorkload is not empty
 	isPodFail := len(workload.Status.DefenseCheckFailPods) > utils.NumberZero
+	wouldSuspend := false
 	if isPodFail {
-		workload.Status.Status = v1alpha1.Suspend
+		if dryRun {
+			wouldSuspend = recordWouldSuspend(workload)
+		} else {
+			workload.Status.Status = v1alpha1.Suspend
+		}
 	}
-	if err := r.addOrRemoveDeploymentSuspendLabel(ctx, deployment, isPodFail); err != nil {
+	if err := r.addOrRemoveSuspendLabel(ctx, owner, workload, isPodFail && !dryRun); err != nil {
 		return err
 	}
+	if workload.Status.Status == v1alpha1.Success && !isPodFail {
+		if err := r.recordVerifiedRevision(ctx, owner, workload); err != nil {
+			return err
+		}
+	}
 	if err := r.updateWorkloadStatus(ctx, workload); err != nil {
 		return err
 	}
+	// 状态保存后再发出事件，冲突重试时不会重复
+	// the event is emitted once the status is saved, so a retry after a conflict doesn't emit it again
+	if wouldSuspend {
+		r.emitWouldSuspend(owner, workload)
+	}
 	return nil
 }
 
-// getDeploymentByWorkload 通过workload获取deployment
-// getDeploymentByWorkload get deployment by workload
-func (r *ChangeWorkloadReconciler) getDeploymentByWorkload(workload *v1alpha1.ChangeWorkload) (deployment *appsv1.Deployment, err error) {
-	// 通过workload的ownerReference获取deployment
-	// get deployment by workload ownerReference
-	deployment = &appsv1.Deployment{}
-	ownerReferences := workload.OwnerReferences
-	for _, ownerReference := range ownerReferences {
-		if ownerReference.Kind == native.DeploymentKind {
-			if err := utils.App.Client.Get(context.Background(), client.ObjectKey{
-				Namespace: workload.Namespace,
-				Name:      ownerReference.Name,
-			}, deployment); err != nil {
-				return nil, err
-			}
-			break
-		}
+// recordWouldSuspend 观察模式下在状态中记录本应暂停的发布，返回是否为第一次记录
+// recordWouldSuspend records in the status a release that would have been suspended in dry-run mode, it returns whether
+// it is recorded for the first time
+func recordWouldSuspend(workload *v1alpha1.ChangeWorkload) bool {
+	if workload.Status.WouldSuspend {
+		return false
 	}
-	return deployment, nil
+	workload.Status.WouldSuspend = true
+	workload.Status.WouldSuspendTime = utils.GetNowTime()
+	workload.Status.WouldSuspendTimeUnix = time.Now().Unix()
+	return true
+}
+
+// emitWouldSuspend 发出本应暂停发布的事件
+// emitWouldSuspend emits the event of a release that would have been suspended
+func (r *ChangeWorkloadReconciler) emitWouldSuspend(owner client.Object, workload *v1alpha1.ChangeWorkload) {
+	failPods := make([]string, 0, len(workload.Status.DefenseCheckFailPods))
+	for _, pod := range workload.Status.DefenseCheckFailPods {
+		failPods = append(failPods, pod.Pod)
+	}
+	r.Recorder.Eventf(owner, v1.EventTypeWarning, utils.EventReasonWouldSuspend,
+		"dry-run: %s would have been suspended by revision %s, failed pods: %s",
+		getOwnerKind(owner), workload.Spec.Reversion, strings.Join(failPods, ","))
 }
 
 // getFinishedChangePodsByWorkload 通过workload获取所有的finished的changePod
@@ -605,22 +766,22 @@ func (r *ChangeWorkloadReconciler) getAllChangePodsByWorkload(ctx context.Contex
 // deleteOldChangeWorkload delete old changeWorkload by deployment name
 func (r *ChangeWorkloadReconciler) deleteOldChangeWorkload(ctx context.Context, changeWorkload *v1alpha1.ChangeWorkload) {
 	logger := log.FromContext(ctx).WithName("deleteOldChangeWorkload")
-	// 根据changeWorkload先获取deployment
-	// get deployment by changeWorkload
-	deployment := &appsv1.Deployment{}
-	if err := r.Get(ctx, types.NamespacedName{Namespace: changeWorkload.Namespace, Name: changeWorkload.Labels[native.DeploymentNameLabel]}, deployment); err != nil {
+	// 根据changeWorkload先获取deployment或者Argo Rollout
+	// get the deployment or Argo Rollout by changeWorkload
+	owner, err := getWorkloadOwner(ctx, r.Client, changeWorkload)
+	if err != nil {
 		logger.Error(err, "get deployment error", utils.LogChangeWorkloadResource, utils.GetResource(changeWorkload))
 		return
 	}
-	// 判断deployment的version是否与changeWorkload的version一致
-	// check if deployment version is same as changeWorkload version
-	if deployment.Labels[native.AdmissionWebhookVersionLabel] != changeWorkload.Labels[native.AdmissionWebhookVersionLabel] {
+	// 判断changeWorkload是否是deployment当前版本的changeWorkload，同一版本扩容后当前的changeWorkload为扩容的changeWorkload
+	// check if changeWorkload is the current changeWorkload of deployment, it is the scale-up one after a scale-up of the same version
+	if native.GetChangeWorkloadName(owner) != changeWorkload.Name {
 		return
 	}
 
 	// 获取所有与该 Deployment 相关的 ChangeWorkload 资源
 	// get all changeWorkload resource related to deployment
-	selector := client.MatchingLabels{native.DeploymentNameLabel: deployment.Name}
+	selector := client.MatchingLabels{native.DeploymentNameLabel: owner.GetName()}
 	changeWorkloadList := &v1alpha1.ChangeWorkloadList{}
 	if err := r.List(ctx, changeWorkloadList, client.InNamespace(changeWorkload.Namespace), selector); err != nil {
 		logger.Error(err, "list workload error", utils.LogChangeWorkloadResource, utils.GetResource(changeWorkload))
@@ -629,7 +790,7 @@ func (r *ChangeWorkloadReconciler) deleteOldChangeWorkload(ctx context.Context,
 	// 删除所有与该 Deployment 相关的 ChangeWorkload 资源 (除了当前正在处理的 ChangeWorkload)
 	// delete all changeWorkload resource related to deployment (except current changeWorkload)
 	for _, workload := range changeWorkloadList.Items {
-		if workload.Name != changeWorkload.Name {
+		if workload.Name != changeWorkload.Name && isControlledBy(&workload, owner) {
 			if err := r.Delete(ctx, &workload); err != nil {
 				logger.Error(err, "delete workload error", utils.LogChangeWorkloadResource, utils.GetResource(&workload))
 			}
@@ -693,22 +854,47 @@ func getPassAndFailedPodsByPostFinishChangePod(changePod *v1alpha1.ChangePod) (p
 	return passPods, failedPods
 }
 
+// keepInconclusivePods 观察窗口内消失的pod没有结论，保留在失败的pod中，替换掉异常的pod不能让批次通过
+// keepInconclusivePods keeps the pods that were gone during the observation window among the failed pods, replacing a
+// crashing pod must not let the batch pass
+func keepInconclusivePods(failPods []v1alpha1.PodSummary, failureChangePods []v1alpha1.PodSummary, podMap map[string]v1.Pod) []v1alpha1.PodSummary {
+	for _, pod := range failureChangePods {
+		if pod.Verdict != utils.ChangePodVerdictInconclusive {
+			continue
+		}
+		if _, ok := podMap[pod.Pod]; ok {
+			continue
+		}
+		kept := false
+		for _, failPod := range failPods {
+			if failPod.Pod == pod.Pod {
+				kept = true
+				break
+			}
+		}
+		if !kept {
+			failPods = append(failPods, pod)
+		}
+	}
+	return failPods
+}
+
 // buildChangeChangeWorkloadRequest 构建changeWorkload的请求
-// buildChangeChangeWorkloadRequest build changeWorkload request
-//func buildChangeChangeWorkloadRequest(workload v1alpha1.ChangeWorkload) opsClient.OpsCloudChangeExecOrderSubmitRequest {
-//	request := opsClient.OpsCloudChangeExecOrderSubmitRequest{
-//		BizExecOrderId:     workload.Spec.ChangeWorkloadId,
-//		Platform:           opsClient.Platform,
-//		ChangeSceneKey:     utils.ChangeSceneKeyRollingUpdate,
-//		ChangeApps:         []string{workload.Spec.AppName},
-//		ChangePhases:       []string{utils.ChangePhase},
-//		ChangeTitle:        fmt.Sprintf("小程序云发布-RollingUpdate-%s", workload.Spec.AppName),
-//		Creator:            utils.DefaultCreator,
-//		ChangeParamJson:    "{}",
-//		ChangeUrl:          "http://test.cn",
-//		TldcTenantCode:     utils.DefaultTldcTenantCode,
-//		ChangeContents:     opsClient.DefaultChangeContents,
-//		ChangeScenarioCode: utils.ChangeScenarioCode,
-//	}
-//	return request
-//}
+// buildChangeChangeWorkloadRequest build changeWorkload request, changeScene is resolved by getChangeScene
+func buildChangeChangeWorkloadRequest(workload v1alpha1.ChangeWorkload, changeScene *v1alpha1.ChangeScene) opsClient.OpsCloudChangeExecOrderSubmitRequest {
+	request := opsClient.OpsCloudChangeExecOrderSubmitRequest{
+		BizExecOrderId:     workload.Spec.ChangeWorkloadId,
+		Platform:           opsClient.Platform,
+		ChangeSceneKey:     changeScene.SceneKey,
+		ChangeApps:         []string{workload.Spec.AppName},
+		ChangePhases:       []string{changeScene.Phase},
+		ChangeTitle:        fmt.Sprintf("小程序云发布-RollingUpdate-%s", workload.Spec.AppName),
+		Creator:            utils.DefaultCreator,
+		ChangeParamJson:    "{}",
+		ChangeUrl:          "http://test.cn",
+		TldcTenantCode:     changeScene.TenantCode,
+		ChangeContents:     opsClient.DefaultChangeContents,
+		ChangeScenarioCode: changeScene.ScenarioCode,
+	}
+	return request
+}
@@ -0,0 +1,163 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/apis/app.ops.cloud.alipay.com/v1alpha1"
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/notify"
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/utils"
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/utils/native"
+)
+
+// ChangeWorkloadNotifyReconciler 在ChangeWorkload被暂停、成功或者超时时发送通知，通知过的状态记录在注解中，每个状态只通知一次
+// ChangeWorkloadNotifyReconciler notifies the sinks when a ChangeWorkload is suspended, succeeds or times out, the
+// notified status is recorded in an annotation so that every status is notified once
+type ChangeWorkloadNotifyReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+}
+
+//+kubebuilder:rbac:groups=app.ops.cloud.alipay.com,resources=changeworkloads,verbs=get;list;watch;update;patch
+
+// Reconcile records the status to notify before sending it, a notification is never sent twice
+func (r *ChangeWorkloadNotifyReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx).WithName("ChangeWorkloadNotifyReconciler Reconcile")
+	workload := &v1alpha1.ChangeWorkload{}
+	if err := r.Get(ctx, req.NamespacedName, workload); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	if !needsNotify(workload) {
+		return ctrl.Result{}, nil
+	}
+	patch := client.MergeFrom(workload.DeepCopy())
+	if workload.Annotations == nil {
+		workload.Annotations = make(map[string]string)
+	}
+	workload.Annotations[utils.NotifiedStatusAnnotation] = workload.Status.Status
+	if err := r.Patch(ctx, workload, patch); err != nil {
+		logger.Error(err, "record notified status error", utils.LogChangeWorkloadResource, utils.GetResource(workload))
+		return ctrl.Result{}, err
+	}
+	// 升级前已经完成的变更只记录不通知
+	// the changes done before the upgrade are only recorded
+	if time.Now().Unix()-workload.Status.UpdateTimeUnix > utils.ChangeWorkloadNotifyMaxAge {
+		return ctrl.Result{}, nil
+	}
+	notifyEvent := buildWorkloadNotifyEvent(workload)
+	sent := notify.DefaultNotifier.Notify(notify.GetConfig(utils.ConfigNotification()), notifyEvent)
+	logger.Info("notify change workload status", utils.LogChangeWorkloadResource, utils.GetResource(workload), "type", notifyEvent.Type, "sinks", sent)
+	return ctrl.Result{}, nil
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *ChangeWorkloadNotifyReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("changeworkload-notify").
+		For(&v1alpha1.ChangeWorkload{}).
+		WithEventFilter(predicate.Funcs{
+			CreateFunc: func(e event.CreateEvent) bool {
+				return isNotifyCandidate(e.Object)
+			},
+			UpdateFunc: func(e event.UpdateEvent) bool {
+				return isNotifyCandidate(e.ObjectNew)
+			},
+			DeleteFunc: func(e event.DeleteEvent) bool {
+				return false
+			},
+		}).
+		Complete(r)
+}
+
+func isNotifyCandidate(object client.Object) bool {
+	workload, ok := object.(*v1alpha1.ChangeWorkload)
+	return ok && needsNotify(workload)
+}
+
+// needsNotify ChangeWorkload是否进入了需要通知并且还没有通知过的状态
+// needsNotify reports whether the ChangeWorkload entered a status to notify that is not notified yet
+func needsNotify(workload *v1alpha1.ChangeWorkload) bool {
+	if _, ok := getNotifyEventType(workload.Status.Status); !ok {
+		return false
+	}
+	return workload.Annotations[utils.NotifiedStatusAnnotation] != workload.Status.Status
+}
+
+// getNotifyEventType ChangeWorkload状态对应的通知类型
+// getNotifyEventType the notification type of the ChangeWorkload status
+func getNotifyEventType(status string) (string, bool) {
+	switch status {
+	case v1alpha1.Suspend:
+		return notify.EventSuspend, true
+	case v1alpha1.Success:
+		return notify.EventSuccess, true
+	case v1alpha1.TimeOutPreThreshold:
+		return notify.EventTimeout, true
+	}
+	return "", false
+}
+
+// buildWorkloadNotifyEvent 根据ChangeWorkload的状态构建通知
+// buildWorkloadNotifyEvent builds the notification from the status of the ChangeWorkload
+func buildWorkloadNotifyEvent(workload *v1alpha1.ChangeWorkload) notify.Event {
+	eventType, _ := getNotifyEventType(workload.Status.Status)
+	kind, name := native.GetChangeWorkloadTarget(workload)
+	notifyEvent := notify.Event{
+		Type:           eventType,
+		Namespace:      workload.Namespace,
+		Kind:           kind,
+		Name:           name,
+		ChangeWorkload: workload.Name,
+		Revision:       workload.Spec.Reversion,
+		Time:           time.Unix(workload.Status.UpdateTimeUnix, 0),
+	}
+	switch eventType {
+	case notify.EventSuspend:
+		for _, pod := range workload.Status.DefenseCheckFailPods {
+			verdict := pod.Verdict
+			if verdict == "" {
+				verdict = utils.ChangePodVerdictFail
+			}
+			if pod.Message != "" {
+				verdict = fmt.Sprintf("%s: %s", verdict, pod.Message)
+			}
+			notifyEvent.FailedPods = append(notifyEvent.FailedPods, fmt.Sprintf("%s (%s)", pod.Pod, verdict))
+		}
+		notifyEvent.Message = fmt.Sprintf("the change %s of the revision %s is suspended, %d pods failed the checks",
+			workload.Name, workload.Spec.Reversion, len(workload.Status.DefenseCheckFailPods))
+	case notify.EventSuccess:
+		notifyEvent.Message = fmt.Sprintf("the change %s of the revision %s succeeded, %d pods passed the checks",
+			workload.Name, workload.Spec.Reversion, len(workload.Status.DefenseCheckPassPods))
+		if workload.Status.WouldSuspend {
+			notifyEvent.Message += ", it would have been suspended without the dry-run mode"
+		}
+	case notify.EventTimeout:
+		notifyEvent.Message = fmt.Sprintf("the change %s of the revision %s timed out after waiting %ds for its pods",
+			workload.Name, workload.Spec.Reversion, workload.Spec.WaitTimeThreshold)
+	}
+	return notifyEvent
+}
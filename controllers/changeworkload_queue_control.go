@@ -0,0 +1,236 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/apis/app.ops.cloud.alipay.com/v1alpha1"
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/concurrency"
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/dependency"
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/utils"
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/utils/native"
+)
+
+// queueLock 同一时间只判断一个变更，避免并发的reconcile占用同一个名额
+// queueLock only one change is decided at a time so the concurrent reconciles don't take the same slot
+var queueLock sync.Mutex
+
+// admittedChanges 刚刚获得名额的变更，缓存看到它们运行之前也计入运行中，由queueLock保护
+// admittedChanges the changes that just got a slot, they are counted as running before the cache sees them running,
+// guarded by queueLock
+var admittedChanges = map[client.ObjectKey]concurrency.Change{}
+
+// getAdmittedChanges 缓存中还没有运行的刚刚获得名额的变更，缓存已经看到的变更不再记录，skip返回true的被跳过
+// getAdmittedChanges returns the changes that just got a slot and aren't running in the cache yet, the ones the cache
+// already sees are forgotten, the ones skip returns true for are left out
+func (r *ChangeWorkloadReconciler) getAdmittedChanges(ctx context.Context, skip func(workload *v1alpha1.ChangeWorkload) bool) []concurrency.Change {
+	changes := make([]concurrency.Change, 0)
+	for key, change := range admittedChanges {
+		workload := &v1alpha1.ChangeWorkload{}
+		if err := r.Client.Get(ctx, key, workload); err != nil || (workload.Status.Status != v1alpha1.Init && workload.Status.Status != v1alpha1.Queued) {
+			delete(admittedChanges, key)
+			continue
+		}
+		if !skip(workload) {
+			changes = append(changes, change)
+		}
+	}
+	return changes
+}
+
+// isQueueHolding 是否配置了上限并且超过上限的变更排队等待
+// isQueueHolding reports whether a limit is set and the changes over it wait in the queue
+func isQueueHolding() bool {
+	limit := concurrency.GetLimit(utils.ConfigConcurrency())
+	return limit.Enabled() && limit.Mode == concurrency.ModeHold
+}
+
+// queueChangeWorkloadHandle 处理init和queued状态，上游的变更都已经成功并且名额有空余时变为running并恢复被暂停的工作负载，
+// 否则暂停工作负载并在状态中记录排队位置，上游的变更被暂停时取消
+// queueChangeWorkloadHandle handles the init and the queued status, the change turns running and its paused workload is
+// resumed once the changes of its upstreams succeeded and there is a slot, otherwise the workload is paused and the place
+// in the queue is kept in the status, the change is cancelled when the change of an upstream is suspended
+func (r *ChangeWorkloadReconciler) queueChangeWorkloadHandle(ctx context.Context, workload *v1alpha1.ChangeWorkload) (ctrl.Result, error) {
+	logger := log.FromContext(ctx).WithName("queueChangeWorkloadHandle")
+	owner, err := getWorkloadOwner(ctx, r.Client, workload)
+	if err != nil && !errors.IsNotFound(err) {
+		logger.Error(err, "get workload owner error", utils.LogChangeWorkloadResource, utils.GetResource(workload))
+		return ctrl.Result{}, err
+	}
+	decision := concurrency.Decision{Admit: true}
+	// 工作负载被暂停的原因，等待上游和排队分别记录
+	// why the workload is held, waiting for the upstreams and queueing are kept apart
+	holdReason := utils.QueueHeldAnnotation
+	if len(workload.Spec.DependsOn) > 0 {
+		deadline := time.Unix(workload.Spec.CreateTimeUnix, 0).Add(utils.DependencyMissingTimeout * time.Second)
+		result, err := dependency.Check(ctx, r.Client, workload.Spec.DependsOn, deadline)
+		if err != nil {
+			logger.Error(err, "check upstreams error", utils.LogChangeWorkloadResource, utils.GetResource(workload))
+			return ctrl.Result{}, err
+		}
+		switch result.State {
+		case dependency.StateCancelled:
+			if utils.IsDryRun(ctx, r.Client, workload.Namespace) {
+				r.recordDryRun(owner, utils.EventReasonWouldCancel, "dry-run: the change %s would have been cancelled: %s", workload.Name, result.Reason)
+				break
+			}
+			return ctrl.Result{}, r.cancelChangeWorkload(ctx, workload, owner, result.Reason)
+		case dependency.StateWaiting:
+			decision = concurrency.Decision{Reason: result.Reason}
+			holdReason = utils.DependencyHeldAnnotation
+		}
+	}
+	if limit := concurrency.GetLimit(utils.ConfigConcurrency()); decision.Admit && limit.Enabled() && limit.Mode == concurrency.ModeHold {
+		queueLock.Lock()
+		defer queueLock.Unlock()
+		// 同一个工作负载其他版本的变更被这个变更取代，不计入
+		// the changes of the other revisions of the same workload are superseded by this one and not counted
+		skip := func(other *v1alpha1.ChangeWorkload) bool {
+			return other.Namespace == workload.Namespace && other.Labels[native.DeploymentNameLabel] == workload.Labels[native.DeploymentNameLabel]
+		}
+		running, queued, err := limit.List(ctx, r.Client, utils.ChangeWorkloadFieldStatus, skip)
+		if err != nil {
+			logger.Error(err, "list change workloads error", utils.LogChangeWorkloadResource, utils.GetResource(workload))
+			return ctrl.Result{}, err
+		}
+		running = append(running, r.getAdmittedChanges(ctx, skip)...)
+		decision = limit.Decide(concurrency.NewChange(workload), running, queued)
+		if decision.Admit && !utils.IsDryRun(ctx, r.Client, workload.Namespace) {
+			admittedChanges[client.ObjectKeyFromObject(workload)] = concurrency.NewChange(workload)
+		}
+	}
+	// 观察模式下不排队，记录本应暂停的发布后直接运行
+	// the change is never queued in dry-run mode, the release that would have been held is recorded and it runs right away
+	if !decision.Admit && utils.IsDryRun(ctx, r.Client, workload.Namespace) {
+		r.recordDryRun(owner, utils.EventReasonWouldHold, "dry-run: the change %s would have been held: %s", workload.Name, decision.Reason)
+		decision = concurrency.Decision{Admit: true}
+	}
+	if decision.Admit {
+		if owner != nil {
+			for _, reason := range utils.HeldAnnotations {
+				if err := holdOrReleaseOwner(ctx, r.Client, owner, reason, false); err != nil {
+					logger.Error(err, "release workload owner error", utils.LogChangeWorkloadResource, utils.GetResource(workload))
+					return ctrl.Result{}, client.IgnoreNotFound(err)
+				}
+			}
+		}
+		if workload.Status.Status == v1alpha1.Queued {
+			logger.Info("dequeue change workload", utils.LogChangeWorkloadResource, utils.GetResource(workload))
+		}
+		workload.Status.Status = v1alpha1.Running
+		workload.Status.QueuePosition = utils.NumberZero
+		workload.Status.QueueReason = ""
+		return ctrl.Result{}, r.updateWorkloadStatus(ctx, workload)
+	}
+	requeue := ctrl.Result{RequeueAfter: utils.ChangeWorkloadQueueInterval * time.Second}
+	if owner != nil {
+		if err := holdOrReleaseOwner(ctx, r.Client, owner, holdReason, true); err != nil {
+			logger.Error(err, "hold workload owner error", utils.LogChangeWorkloadResource, utils.GetResource(workload))
+			return ctrl.Result{}, client.IgnoreNotFound(err)
+		}
+		// 排队说明上游都已经成功，等待上游的暂停在排队的暂停加上之后解除，工作负载保持暂停
+		// queueing means the upstreams succeeded, the hold for them is lifted after the queue one is set so the workload
+		// stays paused
+		if holdReason == utils.QueueHeldAnnotation {
+			if err := holdOrReleaseOwner(ctx, r.Client, owner, utils.DependencyHeldAnnotation, false); err != nil {
+				logger.Error(err, "release workload owner error", utils.LogChangeWorkloadResource, utils.GetResource(workload))
+				return ctrl.Result{}, client.IgnoreNotFound(err)
+			}
+		}
+	}
+	if workload.Status.Status == v1alpha1.Queued && workload.Status.QueuePosition == decision.Position &&
+		workload.Status.QueueReason == decision.Reason {
+		return requeue, nil
+	}
+	logger.Info("queue change workload", utils.LogChangeWorkloadResource, utils.GetResource(workload),
+		"position", decision.Position, "reason", decision.Reason)
+	workload.Status.Status = v1alpha1.Queued
+	workload.Status.QueuePosition = decision.Position
+	workload.Status.QueueReason = decision.Reason
+	return requeue, r.updateWorkloadStatus(ctx, workload)
+}
+
+// cancelChangeWorkload 上游的变更被暂停或者上游超时不存在时取消变更，工作负载保持暂停，直到用户恢复或者发布新的版本
+// cancelChangeWorkload cancels the change when the change of an upstream is suspended or an upstream is still missing
+// after the timeout, the workload is kept paused until its user resumes it or releases a new revision
+func (r *ChangeWorkloadReconciler) cancelChangeWorkload(ctx context.Context, workload *v1alpha1.ChangeWorkload, owner client.Object, reason string) error {
+	logger := log.FromContext(ctx).WithName("cancelChangeWorkload")
+	if owner != nil {
+		if err := holdOrReleaseOwner(ctx, r.Client, owner, utils.DependencyHeldAnnotation, true); err != nil {
+			logger.Error(err, "hold workload owner error", utils.LogChangeWorkloadResource, utils.GetResource(workload))
+			return client.IgnoreNotFound(err)
+		}
+		r.Recorder.Eventf(owner, corev1.EventTypeWarning, utils.EventReasonChangeCancelled, "the change %s is cancelled: %s", workload.Name, reason)
+	}
+	logger.Info("cancel change workload", utils.LogChangeWorkloadResource, utils.GetResource(workload), "reason", reason)
+	workload.Status.Status = v1alpha1.Cancelled
+	workload.Status.QueuePosition = utils.NumberZero
+	workload.Status.QueueReason = reason
+	return r.updateWorkloadStatus(ctx, workload)
+}
+
+// supersedeChangeWorkloads 同一个工作负载其他版本还在运行或者排队的变更被工作负载的当前变更取代，改为取消状态，不再占用并发名额
+// supersedeChangeWorkloads cancels the changes of the other revisions of the workload that are still running or queued,
+// they are superseded by the current change of the workload and no longer take a slot
+func supersedeChangeWorkloads(ctx context.Context, c client.Client, current *v1alpha1.ChangeWorkload) error {
+	logger := log.FromContext(ctx).WithName("supersedeChangeWorkloads")
+	workloadList := &v1alpha1.ChangeWorkloadList{}
+	if err := c.List(ctx, workloadList, client.InNamespace(current.Namespace),
+		client.MatchingLabels{native.DeploymentNameLabel: current.Labels[native.DeploymentNameLabel]}); err != nil {
+		return err
+	}
+	kind, name := native.GetChangeWorkloadTarget(current)
+	for i := range workloadList.Items {
+		workload := &workloadList.Items[i]
+		if otherKind, otherName := native.GetChangeWorkloadTarget(workload); workload.Name == current.Name || otherKind != kind || otherName != name {
+			continue
+		}
+		switch workload.Status.Status {
+		case v1alpha1.Init, v1alpha1.Running, v1alpha1.TimeOutPreThreshold, v1alpha1.Queued:
+		default:
+			continue
+		}
+		workload.Status.Status = v1alpha1.Cancelled
+		workload.Status.QueuePosition = utils.NumberZero
+		workload.Status.QueueReason = fmt.Sprintf("superseded by the change %s", current.Name)
+		workload.Status.UpdateTime = utils.GetNowTime()
+		workload.Status.UpdateTimeUnix = time.Now().Unix()
+		if err := c.Status().Update(ctx, workload); client.IgnoreNotFound(err) != nil {
+			return err
+		}
+		logger.Info("supersede change workload", utils.LogChangeWorkloadResource, utils.GetResource(workload), "current", current.Name)
+	}
+	return nil
+}
+
+// recordDryRun 观察模式下对工作负载发出本应执行的操作的事件
+// recordDryRun emits an event on the workload owner for what would have been done outside of dry-run mode
+func (r *ChangeWorkloadReconciler) recordDryRun(owner client.Object, reason string, messageFmt string, args ...interface{}) {
+	if owner != nil {
+		r.Recorder.Eventf(owner, corev1.EventTypeWarning, reason, messageFmt, args...)
+	}
+}
@@ -0,0 +1,208 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package checker
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// DefaultLogLimitBytes 每个容器最多读取的日志大小
+	// DefaultLogLimitBytes the most bytes of logs read from a container
+	DefaultLogLimitBytes = 10 * 1024 * 1024
+	// MaxSnippets 每个规则在校验结果中附带的匹配行数
+	// MaxSnippets the matched lines of a pattern attached to the verdict message
+	MaxSnippets      = 3
+	maxSnippetLength = 200
+	maxLogLineLength = 1024 * 1024
+)
+
+// LogPatternConfig 日志检查器的配置，保存在OpsConfigInfo的content中
+// LogPatternConfig the config of the log pattern checker, it is kept in the content of an OpsConfigInfo
+type LogPatternConfig struct {
+	Patterns []LogPattern `json:"patterns"`
+}
+
+// LogPattern 一个日志正则，匹配次数超过阈值时pod失败
+// LogPattern a log regex, the pod fails when it matches more often than the threshold
+type LogPattern struct {
+	Name      string `json:"name"`
+	Regex     string `json:"regex"`
+	Threshold int    `json:"threshold"`
+}
+
+// DefaultLogPatternConfig 默认配置：panic堆栈和框架的FATAL日志
+// DefaultLogPatternConfig the default config: panic stack traces and the FATAL markers of the framework
+var DefaultLogPatternConfig = LogPatternConfig{
+	Patterns: []LogPattern{
+		{Name: "panic", Regex: `^panic: |^goroutine \d+ \[running\]:`},
+		{Name: "fatal", Regex: `\bFATAL\b`},
+	},
+}
+
+// LogSource 读取容器日志的来源
+// LogSource the source reading the logs of a container
+type LogSource interface {
+	GetLogs(ctx context.Context, namespace string, name string, options *v1.PodLogOptions) (io.ReadCloser, error)
+}
+
+// ClientsetLogSource 通过pods/log接口读取日志
+// ClientsetLogSource reads the logs through the pods/log API
+type ClientsetLogSource struct {
+	kubernetes.Interface
+}
+
+// GetLogs streams the logs of a container
+func (s ClientsetLogSource) GetLogs(ctx context.Context, namespace string, name string, options *v1.PodLogOptions) (io.ReadCloser, error) {
+	return s.CoreV1().Pods(namespace).GetLogs(name, options).Stream(ctx)
+}
+
+// LogPatternChecker 统计pod日志中各个规则的匹配次数给出校验结果
+// LogPatternChecker gives verdicts by counting the matches of the patterns in the logs of the pods
+type LogPatternChecker struct {
+	patterns []compiledLogPattern
+	source   LogSource
+}
+
+type compiledLogPattern struct {
+	LogPattern
+	regex *regexp.Regexp
+}
+
+// logPatternMatch 一个规则的匹配次数和前几行匹配内容
+// logPatternMatch the match count of a pattern with the first matched lines
+type logPatternMatch struct {
+	count    int
+	snippets []string
+}
+
+// ParseLogPatternConfig parses the json config of the log pattern checker
+func ParseLogPatternConfig(content string) (LogPatternConfig, error) {
+	config := LogPatternConfig{}
+	if err := json.Unmarshal([]byte(content), &config); err != nil {
+		return config, err
+	}
+	if len(config.Patterns) == 0 {
+		return config, fmt.Errorf("log patterns are required")
+	}
+	for _, pattern := range config.Patterns {
+		if _, err := regexp.Compile(pattern.Regex); err != nil {
+			return config, fmt.Errorf("pattern %s: %w", pattern.Name, err)
+		}
+		if pattern.Threshold < 0 {
+			return config, fmt.Errorf("pattern %s: threshold must not be negative", pattern.Name)
+		}
+	}
+	return config, nil
+}
+
+// NewLogPatternChecker returns a checker reading the logs from the source
+func NewLogPatternChecker(config LogPatternConfig, source LogSource) (*LogPatternChecker, error) {
+	patterns := make([]compiledLogPattern, 0, len(config.Patterns))
+	for _, pattern := range config.Patterns {
+		regex, err := regexp.Compile(pattern.Regex)
+		if err != nil {
+			return nil, fmt.Errorf("pattern %s: %w", pattern.Name, err)
+		}
+		patterns = append(patterns, compiledLogPattern{LogPattern: pattern, regex: regex})
+	}
+	return &LogPatternChecker{patterns: patterns, source: source}, nil
+}
+
+// Check 读取pod所有容器从since开始的日志，重启过的容器同时读取上一个容器的日志，返回是否通过以及各个规则的匹配情况
+// Check reads the logs of every container of the pod since the given time, including the previous container of a
+// restarted one, and returns whether the pod passes with the matches of the patterns
+func (c *LogPatternChecker) Check(ctx context.Context, pod *v1.Pod, since time.Time) (bool, string, error) {
+	matches := make([]logPatternMatch, len(c.patterns))
+	restarted := map[string]bool{}
+	for _, status := range pod.Status.ContainerStatuses {
+		restarted[status.Name] = status.RestartCount > 0
+	}
+	sinceTime := metav1.NewTime(since)
+	for _, container := range pod.Spec.Containers {
+		options := &v1.PodLogOptions{Container: container.Name, SinceTime: &sinceTime, LimitBytes: int64Pointer(DefaultLogLimitBytes)}
+		if err := c.scanLogs(ctx, pod, options, matches); err != nil {
+			return false, "", fmt.Errorf("container %s: %w", container.Name, err)
+		}
+		if restarted[container.Name] {
+			previous := *options
+			previous.Previous = true
+			// 上一个容器的日志可能已经被回收，读取失败时忽略
+			// the logs of the previous container may be gone already, a failed read is ignored
+			_ = c.scanLogs(ctx, pod, &previous, matches)
+		}
+	}
+
+	passed := true
+	messages := make([]string, 0, len(c.patterns))
+	for i, pattern := range c.patterns {
+		message := fmt.Sprintf("%s=%d threshold=%d", pattern.Name, matches[i].count, pattern.Threshold)
+		if matches[i].count > pattern.Threshold {
+			passed = false
+			message += " exceeded: " + strings.Join(matches[i].snippets, " | ")
+		}
+		messages = append(messages, message)
+	}
+	return passed, strings.Join(messages, "; "), nil
+}
+
+// scanLogs 逐行匹配一个容器的日志，累加到matches中
+// scanLogs matches the logs of a container line by line and adds up the matches
+func (c *LogPatternChecker) scanLogs(ctx context.Context, pod *v1.Pod, options *v1.PodLogOptions, matches []logPatternMatch) error {
+	logs, err := c.source.GetLogs(ctx, pod.Namespace, pod.Name, options)
+	if err != nil {
+		return err
+	}
+	defer logs.Close()
+	scanner := bufio.NewScanner(logs)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLogLineLength)
+	for scanner.Scan() {
+		line := scanner.Text()
+		for i, pattern := range c.patterns {
+			if !pattern.regex.MatchString(line) {
+				continue
+			}
+			matches[i].count++
+			if len(matches[i].snippets) < MaxSnippets {
+				matches[i].snippets = append(matches[i].snippets, truncate(line, maxSnippetLength))
+			}
+		}
+	}
+	return scanner.Err()
+}
+
+func truncate(line string, length int) string {
+	if len(line) <= length {
+		return line
+	}
+	return strings.ToValidUTF8(line[:length], "") + "..."
+}
+
+func int64Pointer(value int64) *int64 {
+	return &value
+}
@@ -0,0 +1,132 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package checker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// fakeLogSource serves the logs keyed by container, the logs of a previous container are keyed by "previous/<container>"
+type fakeLogSource map[string]string
+
+func (s fakeLogSource) GetLogs(_ context.Context, _ string, _ string, options *v1.PodLogOptions) (io.ReadCloser, error) {
+	key := options.Container
+	if options.Previous {
+		key = "previous/" + key
+	}
+	logs, ok := s[key]
+	if !ok {
+		return nil, fmt.Errorf("no logs of %s", key)
+	}
+	return io.NopCloser(strings.NewReader(logs)), nil
+}
+
+func newLogPod(restarts int32) *v1.Pod {
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "pod", Namespace: "default"},
+		Spec:       v1.PodSpec{Containers: []v1.Container{{Name: "app"}, {Name: "sidecar"}}},
+		Status: v1.PodStatus{ContainerStatuses: []v1.ContainerStatus{
+			{Name: "app", RestartCount: restarts},
+			{Name: "sidecar"},
+		}},
+	}
+}
+
+func newLogPatternChecker(t *testing.T, source LogSource) *LogPatternChecker {
+	config, err := ParseLogPatternConfig(`{"patterns":[
+		{"name":"panic","regex":"^panic: "},
+		{"name":"fatal","regex":"\\bFATAL\\b","threshold":1}]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checker, err := NewLogPatternChecker(config, source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return checker
+}
+
+func TestLogPatternCheck(t *testing.T) {
+	tests := []struct {
+		name     string
+		restarts int32
+		source   fakeLogSource
+		passed   bool
+		message  string
+	}{
+		{name: "clean", source: fakeLogSource{"app": "INFO started\n", "sidecar": "INFO ready\n"},
+			passed: true, message: "panic=0 threshold=0; fatal=0 threshold=1"},
+		{name: "fatal within threshold", source: fakeLogSource{"app": "FATAL db down\n", "sidecar": ""},
+			passed: true, message: "fatal=1 threshold=1"},
+		{name: "fatal over threshold across containers", source: fakeLogSource{"app": "FATAL db down\n", "sidecar": "FATAL no config\n"},
+			message: "fatal=2 threshold=1 exceeded: FATAL db down | FATAL no config"},
+		{name: "panic of the previous container", restarts: 1,
+			source:  fakeLogSource{"app": "INFO started\n", "previous/app": "panic: runtime error\ngoroutine 1 [running]:\n", "sidecar": ""},
+			message: "panic=1 threshold=0 exceeded: panic: runtime error"},
+		{name: "previous logs are gone", restarts: 1, source: fakeLogSource{"app": "", "sidecar": ""}, passed: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			passed, message, err := newLogPatternChecker(t, test.source).Check(context.Background(), newLogPod(test.restarts), time.Now())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if passed != test.passed || !strings.Contains(message, test.message) {
+				t.Fatalf("expected passed %t with message containing %q, got %t with %q", test.passed, test.message, passed, message)
+			}
+		})
+	}
+}
+
+func TestLogPatternCheckSnippets(t *testing.T) {
+	logs := strings.Repeat("panic: "+strings.Repeat("x", 300)+"\n", MaxSnippets+2)
+	_, message, err := newLogPatternChecker(t, fakeLogSource{"app": logs, "sidecar": ""}).Check(context.Background(), newLogPod(0), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(message, fmt.Sprintf("panic=%d", MaxSnippets+2)) || strings.Count(message, "...") != MaxSnippets {
+		t.Fatalf("expected %d truncated snippets, got %q", MaxSnippets, message)
+	}
+}
+
+func TestLogPatternCheckError(t *testing.T) {
+	_, _, err := newLogPatternChecker(t, fakeLogSource{"app": ""}).Check(context.Background(), newLogPod(0), time.Now())
+	if err == nil || !strings.Contains(err.Error(), "sidecar") {
+		t.Fatalf("expected an error of the sidecar container, got %v", err)
+	}
+}
+
+func TestParseLogPatternConfig(t *testing.T) {
+	for _, content := range []string{
+		`{`,
+		`{"patterns":[]}`,
+		`{"patterns":[{"name":"p","regex":"("}]}`,
+		`{"patterns":[{"name":"p","regex":"x","threshold":-1}]}`,
+	} {
+		if _, err := ParseLogPatternConfig(content); err == nil {
+			t.Fatalf("expected an error for %s", content)
+		}
+	}
+}
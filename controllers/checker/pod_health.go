@@ -0,0 +1,155 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package checker
+
+import (
+	"fmt"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/apis/app.ops.cloud.alipay.com/v1alpha1"
+)
+
+const (
+	DefaultObservationWindow = 60 * time.Second
+	DefaultMaxRestarts       = 2
+	DefaultMaxReadinessFlaps = 1
+
+	reasonCrashLoopBackOff = "CrashLoopBackOff"
+	reasonOOMKilled        = "OOMKilled"
+)
+
+// PodHealthChecker 本地的pod健康检查器，不依赖外部服务给出校验结果
+// PodHealthChecker is an in-process checker that gives verdicts from the pod status without any external service
+type PodHealthChecker struct {
+	// ObservationWindow 观察窗口，窗口结束时仍然健康的pod视为通过
+	// ObservationWindow the pods still healthy at the end of the window pass
+	ObservationWindow time.Duration
+	// MaxRestarts 观察窗口内容器重启次数之和超过该值时视为失败
+	// MaxRestarts the pod fails when the sum of its container restarts during the window exceeds it
+	MaxRestarts int32
+	// MaxReadinessFlaps ready状态抖动次数超过该值时视为失败
+	// MaxReadinessFlaps the pod fails when its readiness flaps more often than it
+	MaxReadinessFlaps int
+}
+
+// NewPodHealthChecker returns a checker with the default settings
+func NewPodHealthChecker() *PodHealthChecker {
+	return &PodHealthChecker{
+		ObservationWindow: DefaultObservationWindow,
+		MaxRestarts:       DefaultMaxRestarts,
+		MaxReadinessFlaps: DefaultMaxReadinessFlaps,
+	}
+}
+
+// Check 用pod的当前状态更新健康记录，pod不健康时返回原因，since为观察窗口的开始时间，windowEnded表示观察窗口已经结束
+// Check updates the health record with the current status of the pod and returns the reason when the pod is unhealthy,
+// since is the start of the observation window and windowEnded tells whether the window is over
+func (c *PodHealthChecker) Check(pod *v1.Pod, health *v1alpha1.PodHealth, since time.Time, windowEnded bool) string {
+	health.Pod = pod.Name
+	observeReadiness(pod, health)
+
+	statuses := append(append([]v1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+	restarts := int32(0)
+	for _, status := range statuses {
+		restarts += observeRestarts(status, health)
+		if status.State.Waiting != nil && status.State.Waiting.Reason == reasonCrashLoopBackOff {
+			return fmt.Sprintf("container %s is in %s", status.Name, reasonCrashLoopBackOff)
+		}
+		if reason := terminationReason(status.State.Terminated, since); reason != "" {
+			return fmt.Sprintf("container %s terminated: %s", status.Name, reason)
+		}
+		if reason := terminationReason(status.LastTerminationState.Terminated, since); reason != "" {
+			return fmt.Sprintf("container %s terminated: %s", status.Name, reason)
+		}
+	}
+	health.Restarts = restarts
+	if restarts > c.MaxRestarts {
+		return fmt.Sprintf("containers restarted %d times, more than %d", restarts, c.MaxRestarts)
+	}
+	if health.ReadinessFlaps > c.MaxReadinessFlaps {
+		return fmt.Sprintf("readiness flapped %d times, more than %d", health.ReadinessFlaps, c.MaxReadinessFlaps)
+	}
+	if windowEnded && !isPodReady(pod) {
+		return "pod is not ready at the end of the observation window"
+	}
+	return ""
+}
+
+// observeReadiness 记录ready状态的变化，两次检查之间的抖动通过ready条件的变化时间发现
+// observeReadiness records the readiness changes, a flap between two checks shows up as a new transition time of the ready condition
+func observeReadiness(pod *v1.Pod, health *v1alpha1.PodHealth) {
+	condition := getPodReadyCondition(pod)
+	if condition == nil || condition.Status != v1.ConditionTrue {
+		if health.ReadyTime != 0 {
+			health.ReadinessFlaps++
+			health.ReadyTime = 0
+		}
+		return
+	}
+	readyTime := condition.LastTransitionTime.Unix()
+	if health.ReadyTime != 0 && health.ReadyTime != readyTime {
+		health.ReadinessFlaps++
+	}
+	health.ReadyTime = readyTime
+}
+
+// observeRestarts 返回容器在观察窗口内的重启次数，第一次观察到容器时记录重启次数的基线
+// observeRestarts returns the restarts of the container during the observation window, the restart count seen at the
+// first observation of the container is recorded as its baseline
+func observeRestarts(status v1.ContainerStatus, health *v1alpha1.PodHealth) int32 {
+	if health.RestartBaseline == nil {
+		health.RestartBaseline = make(map[string]int32)
+	}
+	baseline, ok := health.RestartBaseline[status.Name]
+	if !ok || status.RestartCount < baseline {
+		health.RestartBaseline[status.Name] = status.RestartCount
+		return 0
+	}
+	return status.RestartCount - baseline
+}
+
+// terminationReason 返回观察窗口开始后OOMKilled或者异常退出的原因，正常退出或者窗口开始前的退出返回空
+// terminationReason returns the reason of an OOMKilled or failed termination finished after the start of the
+// observation window, it is empty for a clean exit or one that finished before the window
+func terminationReason(terminated *v1.ContainerStateTerminated, since time.Time) string {
+	if terminated == nil || terminated.FinishedAt.Time.Before(since) {
+		return ""
+	}
+	if terminated.Reason == reasonOOMKilled {
+		return reasonOOMKilled
+	}
+	if terminated.ExitCode != 0 {
+		return fmt.Sprintf("%s, exit code %d", terminated.Reason, terminated.ExitCode)
+	}
+	return ""
+}
+
+func isPodReady(pod *v1.Pod) bool {
+	condition := getPodReadyCondition(pod)
+	return condition != nil && condition.Status == v1.ConditionTrue
+}
+
+func getPodReadyCondition(pod *v1.Pod) *v1.PodCondition {
+	for i := range pod.Status.Conditions {
+		if pod.Status.Conditions[i].Type == v1.PodReady {
+			return &pod.Status.Conditions[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package checker
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/apis/app.ops.cloud.alipay.com/v1alpha1"
+)
+
+func newPod(ready bool, readySince time.Time, statuses ...v1.ContainerStatus) *v1.Pod {
+	condition := v1.PodCondition{Type: v1.PodReady, Status: v1.ConditionFalse, LastTransitionTime: metav1.NewTime(readySince)}
+	if ready {
+		condition.Status = v1.ConditionTrue
+	}
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "pod"},
+		Status: v1.PodStatus{
+			Conditions:        []v1.PodCondition{condition},
+			ContainerStatuses: statuses,
+		},
+	}
+}
+
+func TestPodHealthCheck(t *testing.T) {
+	readySince := time.Now().Add(-time.Minute)
+	since := time.Now().Add(-30 * time.Second)
+	inWindow := metav1.NewTime(since.Add(10 * time.Second))
+	beforeWindow := metav1.NewTime(since.Add(-time.Hour))
+	tests := []struct {
+		name        string
+		pod         *v1.Pod
+		windowEnded bool
+		reason      string
+	}{
+		{name: "healthy", pod: newPod(true, readySince, v1.ContainerStatus{Name: "app"}), windowEnded: true},
+		{name: "few restarts", pod: newPod(true, readySince, v1.ContainerStatus{Name: "app", RestartCount: DefaultMaxRestarts})},
+		{name: "too many restarts", pod: newPod(true, readySince, v1.ContainerStatus{Name: "app", RestartCount: DefaultMaxRestarts + 1}),
+			reason: "restarted"},
+		{name: "crash loop", pod: newPod(false, readySince, v1.ContainerStatus{Name: "app",
+			State: v1.ContainerState{Waiting: &v1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}}}), reason: "CrashLoopBackOff"},
+		{name: "oom killed", pod: newPod(true, readySince, v1.ContainerStatus{Name: "app", RestartCount: 1,
+			LastTerminationState: v1.ContainerState{Terminated: &v1.ContainerStateTerminated{Reason: "OOMKilled", ExitCode: 137,
+				FinishedAt: inWindow}}}), reason: "OOMKilled"},
+		{name: "oom killed before the window", pod: newPod(true, readySince, v1.ContainerStatus{Name: "app", RestartCount: 1,
+			LastTerminationState: v1.ContainerState{Terminated: &v1.ContainerStateTerminated{Reason: "OOMKilled", ExitCode: 137,
+				FinishedAt: beforeWindow}}})},
+		{name: "error exit", pod: newPod(true, readySince, v1.ContainerStatus{Name: "app", RestartCount: 1,
+			LastTerminationState: v1.ContainerState{Terminated: &v1.ContainerStateTerminated{Reason: "Error", ExitCode: 1,
+				FinishedAt: inWindow}}}), reason: "exit code 1"},
+		{name: "clean exit", pod: newPod(true, readySince, v1.ContainerStatus{Name: "app", RestartCount: 1,
+			LastTerminationState: v1.ContainerState{Terminated: &v1.ContainerStateTerminated{Reason: "Completed", FinishedAt: inWindow}}})},
+		{name: "not ready during the window", pod: newPod(false, readySince, v1.ContainerStatus{Name: "app"})},
+		{name: "not ready at the end of the window", pod: newPod(false, readySince, v1.ContainerStatus{Name: "app"}), windowEnded: true,
+			reason: "not ready"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			health := v1alpha1.PodHealth{RestartBaseline: map[string]int32{"app": 0}}
+			reason := NewPodHealthChecker().Check(test.pod, &health, since, test.windowEnded)
+			if test.reason == "" && reason != "" {
+				t.Fatalf("expected a healthy pod, got %q", reason)
+			}
+			if test.reason != "" && !strings.Contains(reason, test.reason) {
+				t.Fatalf("expected reason containing %q, got %q", test.reason, reason)
+			}
+		})
+	}
+}
+
+func TestPodHealthCheckReadinessFlaps(t *testing.T) {
+	checker := NewPodHealthChecker()
+	health := v1alpha1.PodHealth{}
+	readySince := time.Now().Add(-time.Minute)
+	container := v1.ContainerStatus{Name: "app"}
+
+	if reason := checker.Check(newPod(true, readySince, container), &health, time.Time{}, false); reason != "" {
+		t.Fatalf("expected a healthy pod, got %q", reason)
+	}
+	// the pod went unready and came back between two checks
+	readySince = readySince.Add(30 * time.Second)
+	if reason := checker.Check(newPod(true, readySince, container), &health, time.Time{}, false); reason != "" || health.ReadinessFlaps != 1 {
+		t.Fatalf("expected one tolerated flap, got %q with %d flaps", reason, health.ReadinessFlaps)
+	}
+	// the pod is seen unready
+	if reason := checker.Check(newPod(false, readySince, container), &health, time.Time{}, false); !strings.Contains(reason, "readiness flapped 2 times") {
+		t.Fatalf("expected a readiness flap failure, got %q", reason)
+	}
+}
+
+func TestPodHealthCheckRestartBaseline(t *testing.T) {
+	checker := NewPodHealthChecker()
+	health := v1alpha1.PodHealth{}
+	readySince := time.Now().Add(-time.Minute)
+
+	// restarts before the window are recorded as the baseline
+	if reason := checker.Check(newPod(true, readySince, v1.ContainerStatus{Name: "app", RestartCount: 10}), &health, time.Time{}, false); reason != "" {
+		t.Fatalf("expected the restarts before the window to be ignored, got %q", reason)
+	}
+	if reason := checker.Check(newPod(true, readySince, v1.ContainerStatus{Name: "app", RestartCount: 10 + DefaultMaxRestarts}), &health, time.Time{}, false); reason != "" || health.Restarts != DefaultMaxRestarts {
+		t.Fatalf("expected %d tolerated restarts, got %q with %d restarts", DefaultMaxRestarts, reason, health.Restarts)
+	}
+	if reason := checker.Check(newPod(true, readySince, v1.ContainerStatus{Name: "app", RestartCount: 11 + DefaultMaxRestarts}), &health, time.Time{}, false); !strings.Contains(reason, "restarted") {
+		t.Fatalf("expected a restart failure, got %q", reason)
+	}
+}
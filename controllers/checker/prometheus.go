@@ -0,0 +1,254 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package checker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+
+	promapi "github.com/prometheus/client_golang/api"
+	promv1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+)
+
+// prometheus检查器给出的结果，同时也是查询没有数据时可以配置的结果
+// the verdicts of the prometheus checker, they are also the choices for a query without data
+const (
+	VerdictPass         = "pass"
+	VerdictFail         = "fail"
+	VerdictInconclusive = "inconclusive"
+)
+
+// PrometheusConfig prometheus检查器的配置，保存在OpsConfigInfo的content中
+// PrometheusConfig the config of the prometheus checker, it is kept in the content of an OpsConfigInfo
+type PrometheusConfig struct {
+	Url     string            `json:"url"`
+	Queries []PrometheusQuery `json:"queries"`
+	// NoData 新版本的查询没有数据时给出的结果，默认为inconclusive，查询可以单独配置
+	// NoData the verdict when a query has no data for the new revision, it defaults to inconclusive and a query can override it
+	NoData string `json:"noData,omitempty"`
+}
+
+// PrometheusQuery 一个PromQL模板以及对应的阈值，模板可以使用Namespace、Deployment、Version、Pods和Window
+// PrometheusQuery a PromQL template with its bounds, the template can use Namespace, Deployment, Version, Pods and Window
+type PrometheusQuery struct {
+	Name  string `json:"name"`
+	Query string `json:"query"`
+	// Threshold 新版本的取值超过该值时失败
+	// Threshold the batch fails when the value of the new revision exceeds it
+	Threshold *float64 `json:"threshold,omitempty"`
+	// MaxRegression 新版本相对旧版本的增长比例超过该值时失败，例如0.2表示增长20%
+	// MaxRegression the batch fails when the new revision regresses more than it relative to the old one, e.g. 0.2 for 20%
+	MaxRegression *float64 `json:"maxRegression,omitempty"`
+	// NoData 该查询没有数据时给出的结果，为空时使用全局配置
+	// NoData the verdict when the query has no data, the global one applies when it is empty
+	NoData string `json:"noData,omitempty"`
+}
+
+// PrometheusScope 渲染查询模板的数据，分别描述新版本和旧版本的pod
+// PrometheusScope the data rendering a query template, it describes the pods of either the new or the old revision
+type PrometheusScope struct {
+	Namespace  string
+	Deployment string
+	Version    string
+	// Pods pod名称的正则，例如pod=~"{{.Pods}}"
+	// Pods the regex of the pod names, e.g. pod=~"{{.Pods}}"
+	Pods   string
+	Window string
+}
+
+// DefaultPrometheusConfig 默认配置中的查询示例：错误率和p99延迟
+// DefaultPrometheusConfig the example queries of the default config: error rate and p99 latency
+var DefaultPrometheusConfig = PrometheusConfig{
+	Url:    "http://prometheus.monitoring:9090",
+	NoData: VerdictInconclusive,
+	Queries: []PrometheusQuery{
+		{
+			Name: "error-rate",
+			Query: `sum(rate(http_requests_total{namespace="{{.Namespace}}",version="{{.Version}}",code=~"5.."}[{{.Window}}]))` +
+				` / sum(rate(http_requests_total{namespace="{{.Namespace}}",version="{{.Version}}"}[{{.Window}}]))`,
+			Threshold:     float64Pointer(0.05),
+			MaxRegression: float64Pointer(0.5),
+		},
+		{
+			Name: "p99-latency",
+			Query: `histogram_quantile(0.99, sum by (le) (rate(http_request_duration_seconds_bucket` +
+				`{namespace="{{.Namespace}}",version="{{.Version}}"}[{{.Window}}])))`,
+			MaxRegression: float64Pointer(0.2),
+		},
+	},
+}
+
+// PrometheusChecker 对比新旧版本的prometheus指标给出校验结果
+// PrometheusChecker gives verdicts by comparing the prometheus metrics of the new revision with the old one
+type PrometheusChecker struct {
+	api     promv1.API
+	queries []PrometheusQuery
+	noData  string
+}
+
+// ParsePrometheusConfig parses the json config of the prometheus checker
+func ParsePrometheusConfig(content string) (PrometheusConfig, error) {
+	config := PrometheusConfig{}
+	if err := json.Unmarshal([]byte(content), &config); err != nil {
+		return config, err
+	}
+	if config.Url == "" {
+		return config, fmt.Errorf("prometheus url is required")
+	}
+	if len(config.Queries) == 0 {
+		return config, fmt.Errorf("prometheus queries are required")
+	}
+	if !isVerdict(config.NoData) {
+		return config, fmt.Errorf("noData must be one of %s, %s or %s", VerdictPass, VerdictFail, VerdictInconclusive)
+	}
+	for _, query := range config.Queries {
+		if _, err := template.New(query.Name).Parse(query.Query); err != nil {
+			return config, fmt.Errorf("query %s: %w", query.Name, err)
+		}
+		if !isVerdict(query.NoData) {
+			return config, fmt.Errorf("query %s: noData must be one of %s, %s or %s", query.Name, VerdictPass, VerdictFail, VerdictInconclusive)
+		}
+	}
+	return config, nil
+}
+
+// NewPrometheusChecker returns a checker querying the prometheus of the config
+func NewPrometheusChecker(config PrometheusConfig) (*PrometheusChecker, error) {
+	client, err := promapi.NewClient(promapi.Config{Address: config.Url})
+	if err != nil {
+		return nil, err
+	}
+	noData := config.NoData
+	if noData == "" {
+		noData = VerdictInconclusive
+	}
+	return &PrometheusChecker{api: promv1.NewAPI(client), queries: config.Queries, noData: noData}, nil
+}
+
+// Check 执行所有查询，返回校验结果以及每个查询的取值，任一查询失败即失败，其次是没有结论，旧版本为空时只比较绝对阈值
+// Check runs every query and returns the verdict with the values of the queries, any failed query fails the batch ahead
+// of an inconclusive one, only the absolute thresholds apply when there is no old revision
+func (c *PrometheusChecker) Check(ctx context.Context, current PrometheusScope, baseline *PrometheusScope) (string, string, error) {
+	passed := true
+	inconclusive := false
+	messages := make([]string, 0, len(c.queries))
+	for _, query := range c.queries {
+		value, err := c.query(ctx, query, current)
+		if err != nil {
+			return "", "", err
+		}
+		if math.IsNaN(value) {
+			noData := query.NoData
+			if noData == "" {
+				noData = c.noData
+			}
+			switch noData {
+			case VerdictFail:
+				passed = false
+			case VerdictInconclusive:
+				inconclusive = true
+			}
+			messages = append(messages, fmt.Sprintf("%s=no data %s", query.Name, noData))
+			continue
+		}
+		message := fmt.Sprintf("%s=%g", query.Name, value)
+		if query.Threshold != nil {
+			message += fmt.Sprintf(" threshold=%g", *query.Threshold)
+			if value > *query.Threshold {
+				passed = false
+				message += " exceeded"
+			}
+		}
+		if query.MaxRegression != nil && baseline != nil {
+			baselineValue, err := c.query(ctx, query, *baseline)
+			if err != nil {
+				return "", "", err
+			}
+			message += fmt.Sprintf(" baseline=%g", baselineValue)
+			if !math.IsNaN(baselineValue) && baselineValue > 0 {
+				regression := (value - baselineValue) / baselineValue
+				message += fmt.Sprintf(" regression=%.1f%% maxRegression=%.1f%%", regression*100, *query.MaxRegression*100)
+				if regression > *query.MaxRegression {
+					passed = false
+					message += " exceeded"
+				}
+			}
+		}
+		messages = append(messages, message)
+	}
+	verdict := VerdictPass
+	if !passed {
+		verdict = VerdictFail
+	} else if inconclusive {
+		verdict = VerdictInconclusive
+	}
+	return verdict, strings.Join(messages, "; "), nil
+}
+
+// query 渲染并执行一个查询，没有数据时返回NaN
+// query renders and runs a query, it returns NaN when there is no data
+func (c *PrometheusChecker) query(ctx context.Context, query PrometheusQuery, scope PrometheusScope) (float64, error) {
+	tmpl, err := template.New(query.Name).Parse(query.Query)
+	if err != nil {
+		return 0, err
+	}
+	promql := bytes.Buffer{}
+	if err := tmpl.Execute(&promql, scope); err != nil {
+		return 0, err
+	}
+	result, _, err := c.api.Query(ctx, promql.String(), time.Now())
+	if err != nil {
+		return 0, fmt.Errorf("query %s: %w", query.Name, err)
+	}
+	switch value := result.(type) {
+	case *model.Scalar:
+		return float64(value.Value), nil
+	case model.Vector:
+		if len(value) == 0 {
+			return math.NaN(), nil
+		}
+		return float64(value[0].Value), nil
+	default:
+		return 0, fmt.Errorf("query %s: unsupported result type %s", query.Name, result.Type())
+	}
+}
+
+// PodsRegex 将pod名称拼接为PromQL的正则
+// PodsRegex joins the pod names into a PromQL regex
+func PodsRegex(pods []string) string {
+	quoted := make([]string, 0, len(pods))
+	for _, pod := range pods {
+		quoted = append(quoted, regexp.QuoteMeta(pod))
+	}
+	return strings.Join(quoted, "|")
+}
+
+func isVerdict(verdict string) bool {
+	return verdict == "" || verdict == VerdictPass || verdict == VerdictFail || verdict == VerdictInconclusive
+}
+
+func float64Pointer(value float64) *float64 {
+	return &value
+}
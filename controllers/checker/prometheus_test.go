@@ -0,0 +1,152 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package checker
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var versionPattern = regexp.MustCompile(`version="([^"]*)"`)
+
+// newPrometheus serves instant queries with the value of the version in the query, versions without a value have no data
+func newPrometheus(t *testing.T, values map[string]string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		match := versionPattern.FindStringSubmatch(r.Form.Get("query"))
+		if match == nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"status":"error","errorType":"bad_data","error":"no version"}`)
+			return
+		}
+		result := "[]"
+		if value, ok := values[match[1]]; ok {
+			result = fmt.Sprintf(`[{"metric":{},"value":[1700000000,"%s"]}]`, value)
+		}
+		fmt.Fprintf(w, `{"status":"success","data":{"resultType":"vector","result":%s}}`, result)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func newPrometheusChecker(t *testing.T, url string) *PrometheusChecker {
+	config, err := ParsePrometheusConfig(fmt.Sprintf(`{"url":%q,"queries":[
+		{"name":"error-rate","query":"error_rate{version=\"{{.Version}}\",pod=~\"{{.Pods}}\"}","threshold":0.05,"maxRegression":0.5}]}`, url))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checker, err := NewPrometheusChecker(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return checker
+}
+
+func TestPrometheusCheck(t *testing.T) {
+	server := newPrometheus(t, map[string]string{"old": "0.02", "good": "0.025", "regressed": "0.04", "bad": "0.08"})
+	checker := newPrometheusChecker(t, server.URL)
+	baseline := &PrometheusScope{Version: "old"}
+	tests := []struct {
+		name     string
+		version  string
+		baseline *PrometheusScope
+		verdict  string
+		message  string
+	}{
+		{name: "within bounds", version: "good", baseline: baseline, verdict: VerdictPass, message: "error-rate=0.025 threshold=0.05 baseline=0.02 regression=25.0%"},
+		{name: "regressed", version: "regressed", baseline: baseline, verdict: VerdictFail, message: "regression=100.0% maxRegression=50.0% exceeded"},
+		{name: "over threshold", version: "bad", baseline: baseline, verdict: VerdictFail, message: "threshold=0.05 exceeded"},
+		{name: "no baseline", version: "regressed", verdict: VerdictPass, message: "error-rate=0.04 threshold=0.05"},
+		{name: "no data", version: "new", baseline: baseline, verdict: VerdictInconclusive, message: "error-rate=no data"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			verdict, message, err := checker.Check(context.Background(), PrometheusScope{Version: test.version}, test.baseline)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if verdict != test.verdict || !strings.Contains(message, test.message) {
+				t.Fatalf("expected %s with message containing %q, got %s with %q", test.verdict, test.message, verdict, message)
+			}
+		})
+	}
+}
+
+func TestPrometheusCheckNoData(t *testing.T) {
+	server := newPrometheus(t, map[string]string{"good": "0.01"})
+	config, err := ParsePrometheusConfig(fmt.Sprintf(`{"url":%q,"noData":"fail","queries":[
+		{"name":"error-rate","query":"error_rate{version=\"{{.Version}}\"}","threshold":0.05},
+		{"name":"optional","query":"optional{version=\"none\"}","noData":"pass"}]}`, server.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checker, err := NewPrometheusChecker(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if verdict, message, err := checker.Check(context.Background(), PrometheusScope{Version: "good"}, nil); err != nil || verdict != VerdictPass {
+		t.Fatalf("expected the query passing on no data to pass, got %s with %q, %v", verdict, message, err)
+	}
+	if verdict, message, err := checker.Check(context.Background(), PrometheusScope{Version: "new"}, nil); err != nil || verdict != VerdictFail {
+		t.Fatalf("expected the global noData to fail, got %s with %q, %v", verdict, message, err)
+	}
+}
+
+func TestPrometheusCheckError(t *testing.T) {
+	server := newPrometheus(t, nil)
+	config, err := ParsePrometheusConfig(fmt.Sprintf(`{"url":%q,"queries":[{"name":"broken","query":"error_rate"}]}`, server.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checker, err := NewPrometheusChecker(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := checker.Check(context.Background(), PrometheusScope{}, nil); err == nil || !strings.Contains(err.Error(), "broken") {
+		t.Fatalf("expected an error of the broken query, got %v", err)
+	}
+}
+
+func TestParsePrometheusConfig(t *testing.T) {
+	for _, content := range []string{
+		`{`,
+		`{"queries":[{"name":"q","query":"up"}]}`,
+		`{"url":"http://prometheus"}`,
+		`{"url":"http://prometheus","queries":[{"name":"q","query":"{{.Version"}]}`,
+		`{"url":"http://prometheus","noData":"ignore","queries":[{"name":"q","query":"up"}]}`,
+		`{"url":"http://prometheus","queries":[{"name":"q","query":"up","noData":"ignore"}]}`,
+	} {
+		if _, err := ParsePrometheusConfig(content); err == nil {
+			t.Fatalf("expected an error for %s", content)
+		}
+	}
+}
+
+func TestPodsRegex(t *testing.T) {
+	if regex := PodsRegex([]string{"app-1.a", "app-2"}); regex != `app-1\.a|app-2` {
+		t.Fatalf("unexpected regex %s", regex)
+	}
+}
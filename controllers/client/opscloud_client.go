@@ -1,16 +1,13 @@
 package client
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/base64"
-	"encoding/json"
-	"errors"
 	"fmt"
-	"io"
 	"net/http"
 	"strconv"
 	"strings"
-	"time"
 
 	"github.com/gin-gonic/gin"
 
@@ -23,6 +20,7 @@ const (
 	HttpHeaderSignKey              = "X-OpsCloud-Sign"
 	HttpHeaderTargetTenant         = "X-Tldc-Target-Tenant"
 	HttpHeaderTarget               = "X-Tldc-Target-Biz"
+	HttpHeaderRequestId            = "X-Request-Id"
 	ApiVersion                     = "v1"
 	OpenApiFormat                  = "/openapi/%s/exe/%s" // uri format: /openapi/{API version}/exe/{action}
 	SubmitChangeExecOrderAction    = "submitChangeExecOrder"
@@ -31,15 +29,15 @@ const (
 )
 
 const (
-	Platform       = "cafed"
-	Token          = "123"
-	TargetTenant   = "cloudbaseapp:crconsole"
-	TargetService  = "topscloud-sdk-api"
-	OpsCloudDomain = "http://localhost:8080"
-	// OpsCloudDomain = "http://topscloud-pool.gzcr60a.cloudrun-uat.local:8080"
-
+	Platform      = "cafed"
+	Token         = "123"
+	TargetTenant  = "cloudbaseapp:crconsole"
+	TargetService = "topscloud-sdk-api"
 )
 
+// OpsCloudDomain is the base url of OpsCloud, it can be pointed at a fake OpsCloud for development
+var OpsCloudDomain = "http://localhost:8080"
+
 const (
 	OpsCloudChangeCheckTypeEnumBatch = "CHANGE_BATCH"
 	DefenseStageEnumPre              = "PRE"
@@ -52,11 +50,6 @@ var DefaultChangeContents = []OpsCloudChangeContent{{
 	},
 	InstanceName: ""}}
 
-const (
-	MaxRetryCount = 3
-	RetryInterval = time.Second * 1
-)
-
 var logger = utils.NewLogger()
 
 type OpsCloudResult struct {
@@ -136,36 +129,19 @@ type OpsCloudChangeFinishNotifyRequest struct {
 	TldcTenantCode string `json:"tldcTenantCode"`
 }
 
-// SubmitChangeExecOrder submit a execute order
-func SubmitChangeExecOrder(request OpsCloudChangeExecOrderSubmitRequest) (OpsCloudResult, error) {
-	return serviceTemplate(request, SubmitChangeExecOrderAction, "SubmitChangeExecOrder")
+// SubmitChangeExecOrder submit a execute order with DefaultClient
+func SubmitChangeExecOrder(ctx context.Context, request OpsCloudChangeExecOrderSubmitRequest) (OpsCloudResult, error) {
+	return DefaultClient.SubmitChangeExecOrder(ctx, request)
 }
 
-// SubmitChangeStartNotify sync batch order start
-func SubmitChangeStartNotify(request OpsCloudChangeExecBatchStartNotifyRequest) (OpsCloudResult, error) {
-	return serviceTemplate(request, SubmitChangeStartNotifyAction, "SubmitChangeStartNotify")
+// SubmitChangeStartNotify sync batch order start with DefaultClient
+func SubmitChangeStartNotify(ctx context.Context, request OpsCloudChangeExecBatchStartNotifyRequest) (OpsCloudResult, error) {
+	return DefaultClient.SubmitChangeStartNotify(ctx, request)
 }
 
-// SubmitChangeFinishNotify async batch order finish
-func SubmitChangeFinishNotify(request OpsCloudChangeFinishNotifyRequest) (OpsCloudResult, error) {
-	return serviceTemplate(request, SubmitChangeFinishNotifyAction, "SubmitChangeFinishNotify")
-}
-
-func serviceTemplate(request interface{}, action string, method string) (OpsCloudResult, error) {
-	startTime := time.Now()
-	var result OpsCloudResult
-	result, err := doPost(buildUri(action), request)
-	if err != nil {
-		logger.WithValues("request", request).WithValues("result", result).Error(err, method+" doPost error"+time.Since(startTime).String()) //, request, result
-		return result, err
-	}
-	if !result.Success {
-		logger.WithValues("msg", result.Msg).WithValues("ResultCode", result.ResultCode).WithValues("request", request).WithValues("result", result).Error(err, method+" failed"+time.Since(startTime).String()) //, result.Msg, result.ResultCode, request, result
-		return result, errors.New(result.Msg)
-	} else {
-		logger.Info(method + " success" + time.Since(startTime).String()) //, request, result
-		return result, nil
-	}
+// SubmitChangeFinishNotify async batch order finish with DefaultClient
+func SubmitChangeFinishNotify(ctx context.Context, request OpsCloudChangeFinishNotifyRequest) (OpsCloudResult, error) {
+	return DefaultClient.SubmitChangeFinishNotify(ctx, request)
 }
 
 // sign for your request
@@ -176,43 +152,13 @@ func sign(currentTime int64, content string) string {
 	return strings.ToUpper(signature)
 }
 
-func doPost(uri string, request interface{}) (OpsCloudResult, error) {
-	bytes, _ := json.Marshal(request)
-	req, _ := http.NewRequest("POST", uri, strings.NewReader(string(bytes)))
-	currentTime := time.Now()
-
-	req.Header.Set(HttpHeaderPlatformKey, Platform)
-	req.Header.Set(HttpHeaderTimestampKey, strconv.FormatInt(currentTime.Unix(), 10))
-	//req.Header.Set(HttpHeaderTargetTenant, TargetTenant)
-	//req.Header.Set(HttpHeaderTarget, TargetService)
-	req.Header.Set(HttpHeaderSignKey, sign(currentTime.Unix(), string(bytes)))
-	req.Header.Set("Content-Type", "application/json")
-	var serviceRes OpsCloudResult
-	var resp *http.Response
-	var err error
-
-	for r := 0; ; r++ {
-		resp, err = (&http.Client{}).Do(req)
-		if err != nil && r <= MaxRetryCount {
-			logger.WithValues("url", uri).WithValues("request", request).Error(err, fmt.Sprintf("doPost execute error, retry after %d seconds, retry count: %d", RetryInterval, r)) //, uri, request
-			time.Sleep(RetryInterval)
-		} else if err == nil {
-			break
-		} else {
-			return serviceRes, err
-		}
-	}
-	defer resp.Body.Close()
-	all, err := io.ReadAll(resp.Body)
+// VerifySign verifies the signature of a request signed by sign
+func VerifySign(timestamp string, content string, signature string) bool {
+	currentTime, err := strconv.ParseInt(timestamp, 10, 64)
 	if err != nil {
-		return OpsCloudResult{}, err
+		return false
 	}
-	err = json.Unmarshal(all, &serviceRes)
-	return serviceRes, err
-}
-
-func buildUri(action string) string {
-	return OpsCloudDomain + fmt.Sprintf(OpenApiFormat, ApiVersion, action)
+	return sign(currentTime, content) == signature
 }
 
 // SubmitChangeExecOrderWeb TODO delete
@@ -225,7 +171,7 @@ func SubmitChangeExecOrderWeb(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, err.Error())
 		return
 	}
-	result, err := SubmitChangeExecOrder(data)
+	result, err := SubmitChangeExecOrder(c.Request.Context(), data)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, err.Error())
 		return
@@ -241,7 +187,7 @@ func SubmitChangeStartNotifyWeb(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, err.Error())
 		return
 	}
-	result, err := SubmitChangeStartNotify(data)
+	result, err := SubmitChangeStartNotify(c.Request.Context(), data)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, err.Error())
 		return
@@ -257,7 +203,7 @@ func SubmitChangeFinishNotifyWeb(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, err.Error())
 		return
 	}
-	result, err := SubmitChangeFinishNotify(data)
+	result, err := SubmitChangeFinishNotify(c.Request.Context(), data)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, err.Error())
 		return
@@ -1,16 +1,61 @@
-package client
+package client_test
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"gitlab.alipay-inc.com/common_release/altershieldoperator/apis/app.ops.cloud.alipay.com/v1alpha1"
+	. "gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/client"
 	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/utils"
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/test/fakeopscloud"
 )
 
+// startFakeOpsCloud points the client at a fake OpsCloud and returns the callbacks it sends
+func startFakeOpsCloud(t *testing.T, rules []fakeopscloud.Rule) (*fakeopscloud.Server, chan OpsCloudChangeCheckCallbackWrapperRequest) {
+	callbacks := make(chan OpsCloudChangeCheckCallbackWrapperRequest, 10)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var data OpsCloudChangeCheckCallbackWrapperRequest
+		if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		callbacks <- data
+	}))
+	t.Cleanup(receiver.Close)
+
+	fake := fakeopscloud.New(fakeopscloud.Options{CallbackURL: receiver.URL, CallbackDelay: 10 * time.Millisecond, Rules: rules})
+	server := httptest.NewServer(fake.Handler())
+	t.Cleanup(server.Close)
+
+	domain := OpsCloudDomain
+	OpsCloudDomain = server.URL
+	t.Cleanup(func() { OpsCloudDomain = domain })
+	return fake, callbacks
+}
+
+func waitCallback(t *testing.T, callbacks chan OpsCloudChangeCheckCallbackWrapperRequest) OpsCloudChangeCheckCallbackRequest {
+	select {
+	case data := <-callbacks:
+		return data.CallbackRequest
+	case <-time.After(5 * time.Second):
+		t.Fatal("no callback received")
+	}
+	return OpsCloudChangeCheckCallbackRequest{}
+}
+
 func TestG2(t *testing.T) {
+	_, callbacks := startFakeOpsCloud(t, []fakeopscloud.Rule{
+		{Match: "testOrder", Stage: DefenseStageEnumPost, Action: fakeopscloud.ActionFail, Msg: "error rate too high"},
+	})
+
 	var bizExeOrderId = fmt.Sprintf("testOrder%d", time.Now().Unix())
 	request := OpsCloudChangeExecOrderSubmitRequest{
 		BizExecOrderId:     bizExeOrderId,
@@ -26,11 +71,9 @@ func TestG2(t *testing.T) {
 		ChangeContents:     DefaultChangeContents,
 		TldcTenantCode:     utils.DefaultTldcTenantCode,
 	}
-	result, err := SubmitChangeExecOrder(request)
-	if err != nil {
-		fmt.Println(err.Error())
+	if _, err := SubmitChangeExecOrder(context.Background(), request); err != nil {
+		t.Fatalf("SubmitChangeExecOrder: %v", err)
 	}
-	fmt.Println(result)
 
 	var podInfos []string
 	podInfo := v1alpha1.PodSummary{
@@ -43,7 +86,7 @@ func TestG2(t *testing.T) {
 	}
 	marshal, err := json.Marshal(podInfo)
 	if err != nil {
-		fmt.Println(err.Error())
+		t.Fatal(err)
 	}
 	podInfos = append(podInfos, string(marshal))
 
@@ -58,33 +101,183 @@ func TestG2(t *testing.T) {
 		TldcTenantCode:           utils.DefaultTldcTenantCode,
 		BizExecOrderId:           bizExeOrderId,
 	}
-	notify, err := SubmitChangeStartNotify(request1)
+	notify, err := SubmitChangeStartNotify(context.Background(), request1)
 	if err != nil {
-		fmt.Println(err.Error())
-	}
-	fmt.Println(notify)
-
-	if notify.Domain == nil {
-		// 空指针处理，可以返回错误信息或者使用默认值
-		fmt.Println(fmt.Errorf("notify.Domain is nil"))
-	} else {
-		m := notify.Domain.(map[string]interface{})
-		// 接下来的操作
-		// submit post check
-		request2 := OpsCloudChangeFinishNotifyRequest{
-			NodeId:         m["nodeId"].(string),
-			Success:        true,
-			ServiceResult:  "{}",
-			Platform:       Platform,
-			ChangeSceneKey: utils.ChangeSceneKeyRollingUpdate,
-			BizExecOrderId: bizExeOrderId,
-			TldcTenantCode: utils.DefaultTldcTenantCode,
-		}
-		finishNotify, err := SubmitChangeFinishNotify(request2)
-		if err != nil {
-			fmt.Println(err.Error())
+		t.Fatalf("SubmitChangeStartNotify: %v", err)
+	}
+	m, ok := notify.Domain.(map[string]interface{})
+	if !ok || m["nodeId"] == nil {
+		t.Fatalf("notify.Domain has no nodeId: %v", notify.Domain)
+	}
+	nodeId := m["nodeId"].(string)
+
+	pre := waitCallback(t, callbacks)
+	if pre.NodeId != nodeId || pre.DefenseStageEnum != DefenseStageEnumPre || pre.Verdict.Verdict != utils.ChangePodVerdictPass {
+		t.Fatalf("unexpected pre callback: %+v", pre)
+	}
+
+	// submit post check
+	request2 := OpsCloudChangeFinishNotifyRequest{
+		NodeId:         nodeId,
+		Success:        true,
+		ServiceResult:  "{}",
+		Platform:       Platform,
+		ChangeSceneKey: utils.ChangeSceneKeyRollingUpdate,
+		BizExecOrderId: bizExeOrderId,
+		TldcTenantCode: utils.DefaultTldcTenantCode,
+	}
+	if _, err := SubmitChangeFinishNotify(context.Background(), request2); err != nil {
+		t.Fatalf("SubmitChangeFinishNotify: %v", err)
+	}
+	post := waitCallback(t, callbacks)
+	if post.NodeId != nodeId || post.DefenseStageEnum != DefenseStageEnumPost || post.Verdict.Verdict != "fail" || post.Verdict.Msg != "error rate too high" {
+		t.Fatalf("unexpected post callback: %+v", post)
+	}
+}
+
+func TestFakeOpsCloudRejectsInvalidSign(t *testing.T) {
+	startFakeOpsCloud(t, nil)
+	req, _ := http.NewRequest(http.MethodPost, OpsCloudDomain+fmt.Sprintf(OpenApiFormat, ApiVersion, SubmitChangeStartNotifyAction),
+		strings.NewReader(`{"bizExecOrderId":"order"}`))
+	req.Header.Set(HttpHeaderPlatformKey, Platform)
+	req.Header.Set(HttpHeaderTimestampKey, fmt.Sprint(time.Now().Unix()))
+	req.Header.Set(HttpHeaderSignKey, "forged")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected %d, got %d", http.StatusForbidden, resp.StatusCode)
+	}
+}
+
+func TestFakeOpsCloudNoAnswer(t *testing.T) {
+	fake, callbacks := startFakeOpsCloud(t, []fakeopscloud.Rule{{Stage: DefenseStageEnumPre, Action: fakeopscloud.ActionNone}})
+	if _, err := SubmitChangeStartNotify(context.Background(), OpsCloudChangeExecBatchStartNotifyRequest{BizExecOrderId: "silent", Platform: Platform}); err != nil {
+		t.Fatalf("SubmitChangeStartNotify: %v", err)
+	}
+	select {
+	case data := <-callbacks:
+		t.Fatalf("unexpected callback: %+v", data)
+	case <-time.After(200 * time.Millisecond):
+	}
+	if nodes := fake.Nodes(); len(nodes) != 1 || nodes[0].BizExecOrderId != "silent" {
+		t.Fatalf("unexpected nodes: %+v", nodes)
+	}
+}
+
+// countingServer answers with the given status codes in order and then with a success
+func countingServer(t *testing.T, statusCodes ...int) (*Client, *int32) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&calls, 1)
+		if int(n) <= len(statusCodes) {
+			w.WriteHeader(statusCodes[n-1])
+			_ = json.NewEncoder(w).Encode(OpsCloudResult{Success: false, ResultCode: "ERROR", Msg: "status"})
+			return
 		}
-		fmt.Println(finishNotify)
+		_ = json.NewEncoder(w).Encode(OpsCloudResult{Success: true, Domain: map[string]string{"nodeId": "node"}})
+	}))
+	t.Cleanup(server.Close)
+	client := NewClient()
+	client.Domain = server.URL
+	client.RetryBaseInterval = time.Millisecond
+	client.RetryMaxInterval = 5 * time.Millisecond
+	return client, &calls
+}
+
+func TestClientRetriesIdempotentServerErrors(t *testing.T) {
+	client, calls := countingServer(t, http.StatusBadGateway, http.StatusServiceUnavailable)
+	if _, err := client.SubmitChangeFinishNotify(context.Background(), OpsCloudChangeFinishNotifyRequest{NodeId: "node"}); err != nil {
+		t.Fatalf("SubmitChangeFinishNotify: %v", err)
 	}
+	if *calls != 3 {
+		t.Fatalf("expected 3 calls, got %d", *calls)
+	}
+}
 
+func TestClientDoesNotRetryStartNotifyOnServerError(t *testing.T) {
+	client, calls := countingServer(t, http.StatusInternalServerError)
+	_, err := client.SubmitChangeStartNotify(context.Background(), OpsCloudChangeExecBatchStartNotifyRequest{BizExecOrderId: "order"})
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusInternalServerError {
+		t.Fatalf("expected status error, got %v", err)
+	}
+	if *calls != 1 {
+		t.Fatalf("expected 1 call, got %d", *calls)
+	}
+}
+
+func TestClientRetriesTooManyRequests(t *testing.T) {
+	client, calls := countingServer(t, http.StatusTooManyRequests)
+	if _, err := client.SubmitChangeStartNotify(context.Background(), OpsCloudChangeExecBatchStartNotifyRequest{BizExecOrderId: "order"}); err != nil {
+		t.Fatalf("SubmitChangeStartNotify: %v", err)
+	}
+	if *calls != 2 {
+		t.Fatalf("expected 2 calls, got %d", *calls)
+	}
+}
+
+func TestClientRejectsClientErrors(t *testing.T) {
+	startFakeOpsCloud(t, nil)
+	client := NewClient()
+	client.Domain = OpsCloudDomain + "/missing"
+	_, err := client.SubmitChangeFinishNotify(context.Background(), OpsCloudChangeFinishNotifyRequest{NodeId: "node"})
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected not found, got %v", err)
+	}
+}
+
+func TestClientTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	t.Cleanup(server.Close)
+	t.Cleanup(func() { close(release) })
+	client := NewClient()
+	client.Domain = server.URL
+	client.Timeout = 20 * time.Millisecond
+	client.MaxRetryCount = 0
+	if _, err := client.SubmitChangeStartNotify(context.Background(), OpsCloudChangeExecBatchStartNotifyRequest{}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+}
+
+func TestClientCancel(t *testing.T) {
+	client, calls := countingServer(t, http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway)
+	client.RetryBaseInterval = time.Hour
+	client.RetryMaxInterval = time.Hour
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := client.SubmitChangeFinishNotify(ctx, OpsCloudChangeFinishNotifyRequest{}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+	if *calls != 1 {
+		t.Fatalf("expected 1 call, got %d", *calls)
+	}
+}
+
+func TestClientCircuitBreaker(t *testing.T) {
+	client, calls := countingServer(t, http.StatusInternalServerError, http.StatusInternalServerError)
+	client.BreakerThreshold = 2
+	client.BreakerCooldown = 50 * time.Millisecond
+	request := OpsCloudChangeExecBatchStartNotifyRequest{BizExecOrderId: "order"}
+	for i := 0; i < 2; i++ {
+		if _, err := client.SubmitChangeStartNotify(context.Background(), request); err == nil {
+			t.Fatal("expected server error")
+		}
+	}
+	if _, err := client.SubmitChangeStartNotify(context.Background(), request); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected open circuit, got %v", err)
+	}
+	if *calls != 2 {
+		t.Fatalf("expected 2 calls, got %d", *calls)
+	}
+	time.Sleep(client.BreakerCooldown)
+	if _, err := client.SubmitChangeStartNotify(context.Background(), request); err != nil {
+		t.Fatalf("expected the half open call to pass, got %v", err)
+	}
 }
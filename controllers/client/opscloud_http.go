@@ -0,0 +1,259 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultTimeout           = 10 * time.Second
+	DefaultMaxRetryCount     = 3
+	DefaultRetryBaseInterval = 500 * time.Millisecond
+	DefaultRetryMaxInterval  = 8 * time.Second
+	DefaultBreakerThreshold  = 5
+	DefaultBreakerCooldown   = 30 * time.Second
+)
+
+// ErrCircuitOpen is returned without calling OpsCloud while the circuit breaker is open
+var ErrCircuitOpen = errors.New("opscloud circuit breaker is open")
+
+// StatusError is returned when OpsCloud answers with a non 2xx status code
+type StatusError struct {
+	StatusCode int
+	Result     OpsCloudResult
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("opscloud returned http status %d, resultCode: %s, msg: %s", e.StatusCode, e.Result.ResultCode, e.Result.Msg)
+}
+
+// idempotentActions can be sent again when the previous attempt may have reached OpsCloud,
+// the exec order and the finish notify are keyed by bizExecOrderId and nodeId while every start notify creates a new node
+var idempotentActions = map[string]bool{
+	SubmitChangeExecOrderAction:    true,
+	SubmitChangeFinishNotifyAction: true,
+}
+
+// Client calls the OpsCloud open api with per attempt timeouts, exponential backoff with jitter and a circuit breaker
+type Client struct {
+	// Domain is the base url of OpsCloud, OpsCloudDomain is used when it is empty
+	Domain string
+	// Timeout bounds a single attempt
+	Timeout time.Duration
+	// MaxRetryCount is the number of retries after the first attempt
+	MaxRetryCount int
+	// RetryBaseInterval is the backoff of the first retry, it doubles on every retry up to RetryMaxInterval
+	RetryBaseInterval time.Duration
+	RetryMaxInterval  time.Duration
+	// BreakerThreshold consecutive failures open the circuit breaker for BreakerCooldown, zero disables it
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+
+	httpClient *http.Client
+
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+}
+
+// DefaultClient is used by the package level Submit functions
+var DefaultClient = NewClient()
+
+// NewClient returns a client with the default settings
+func NewClient() *Client {
+	return &Client{
+		Timeout:           DefaultTimeout,
+		MaxRetryCount:     DefaultMaxRetryCount,
+		RetryBaseInterval: DefaultRetryBaseInterval,
+		RetryMaxInterval:  DefaultRetryMaxInterval,
+		BreakerThreshold:  DefaultBreakerThreshold,
+		BreakerCooldown:   DefaultBreakerCooldown,
+		httpClient:        &http.Client{},
+	}
+}
+
+// SubmitChangeExecOrder submit a execute order
+func (c *Client) SubmitChangeExecOrder(ctx context.Context, request OpsCloudChangeExecOrderSubmitRequest) (OpsCloudResult, error) {
+	return c.serviceTemplate(ctx, request, SubmitChangeExecOrderAction, "SubmitChangeExecOrder")
+}
+
+// SubmitChangeStartNotify sync batch order start
+func (c *Client) SubmitChangeStartNotify(ctx context.Context, request OpsCloudChangeExecBatchStartNotifyRequest) (OpsCloudResult, error) {
+	return c.serviceTemplate(ctx, request, SubmitChangeStartNotifyAction, "SubmitChangeStartNotify")
+}
+
+// SubmitChangeFinishNotify async batch order finish
+func (c *Client) SubmitChangeFinishNotify(ctx context.Context, request OpsCloudChangeFinishNotifyRequest) (OpsCloudResult, error) {
+	return c.serviceTemplate(ctx, request, SubmitChangeFinishNotifyAction, "SubmitChangeFinishNotify")
+}
+
+func (c *Client) serviceTemplate(ctx context.Context, request interface{}, action string, method string) (OpsCloudResult, error) {
+	startTime := time.Now()
+	result, err := c.doPost(ctx, action, request)
+	if err != nil {
+		logger.WithValues("request", request).WithValues("result", result).Error(err, method+" doPost error "+time.Since(startTime).String())
+		return result, err
+	}
+	if !result.Success {
+		logger.WithValues("msg", result.Msg).WithValues("ResultCode", result.ResultCode).WithValues("request", request).WithValues("result", result).Error(err, method+" failed "+time.Since(startTime).String())
+		return result, errors.New(result.Msg)
+	}
+	logger.Info(method + " success " + time.Since(startTime).String())
+	return result, nil
+}
+
+// doPost posts the request, a new http request is built for every attempt because the body is consumed by the previous one
+func (c *Client) doPost(ctx context.Context, action string, request interface{}) (OpsCloudResult, error) {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return OpsCloudResult{}, err
+	}
+	uri := c.buildUri(action)
+	for r := 0; ; r++ {
+		if err := c.allow(); err != nil {
+			return OpsCloudResult{}, err
+		}
+		result, err := c.post(ctx, uri, body)
+		c.record(err)
+		if err == nil || r >= c.MaxRetryCount || !retryable(ctx, action, err) {
+			return result, err
+		}
+		backoff := c.backoff(r)
+		logger.WithValues("url", uri).Error(err, fmt.Sprintf("doPost execute error, retry after %s, retry count: %d", backoff, r+1))
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return result, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func (c *Client) post(ctx context.Context, uri string, body []byte) (OpsCloudResult, error) {
+	var result OpsCloudResult
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, uri, bytes.NewReader(body))
+	if err != nil {
+		return result, err
+	}
+	currentTime := time.Now().Unix()
+	req.Header.Set(HttpHeaderPlatformKey, Platform)
+	req.Header.Set(HttpHeaderTimestampKey, strconv.FormatInt(currentTime, 10))
+	req.Header.Set(HttpHeaderSignKey, sign(currentTime, string(body)))
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return result, err
+	}
+	defer resp.Body.Close()
+	all, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return result, err
+	}
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		// the body is best effort, OpsCloud usually explains the error in it
+		_ = json.Unmarshal(all, &result)
+		return result, &StatusError{StatusCode: resp.StatusCode, Result: result}
+	}
+	err = json.Unmarshal(all, &result)
+	return result, err
+}
+
+// retryable 判断失败的请求能否重试，非幂等的请求只在确认未到达OpsCloud时重试
+// retryable reports whether a failed attempt can be retried, a non idempotent request is only retried when it surely did not reach OpsCloud
+func retryable(ctx context.Context, action string, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		switch {
+		case statusErr.StatusCode == http.StatusTooManyRequests:
+			return true
+		case statusErr.StatusCode >= http.StatusInternalServerError:
+			return idempotentActions[action]
+		default:
+			return false
+		}
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+	return idempotentActions[action]
+}
+
+// backoff returns the exponential backoff of the retry with jitter in [d/2, d)
+func (c *Client) backoff(retry int) time.Duration {
+	d := c.RetryBaseInterval
+	for i := 0; i < retry && d < c.RetryMaxInterval; i++ {
+		d *= 2
+	}
+	if c.RetryMaxInterval > 0 && d > c.RetryMaxInterval {
+		d = c.RetryMaxInterval
+	}
+	if d <= 0 {
+		return 0
+	}
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(d-half)+1))
+}
+
+// allow fails fast while the circuit breaker is open, a single attempt is let through once the cooldown has elapsed
+func (c *Client) allow() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.BreakerThreshold <= 0 || c.failures < c.BreakerThreshold {
+		return nil
+	}
+	now := time.Now()
+	if now.Before(c.openUntil) {
+		return ErrCircuitOpen
+	}
+	// half open, the other calls keep failing fast until this attempt closes the breaker or the cooldown elapses again
+	c.openUntil = now.Add(c.BreakerCooldown)
+	return nil
+}
+
+// record counts transport errors and server errors, client errors mean OpsCloud is up and do not trip the breaker
+func (c *Client) record(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+	var statusErr *StatusError
+	if err == nil || (errors.As(err, &statusErr) && statusErr.StatusCode < http.StatusInternalServerError) {
+		c.failures = 0
+		return
+	}
+	c.failures++
+	if c.BreakerThreshold > 0 && c.failures == c.BreakerThreshold {
+		logger.Error(err, fmt.Sprintf("opscloud circuit breaker opened after %d consecutive failures", c.failures))
+		c.openUntil = time.Now().Add(c.BreakerCooldown)
+	}
+}
+
+func (c *Client) buildUri(action string) string {
+	domain := c.Domain
+	if domain == "" {
+		domain = OpsCloudDomain
+	}
+	return domain + fmt.Sprintf(OpenApiFormat, ApiVersion, action)
+}
@@ -0,0 +1,139 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/apis/app.ops.cloud.alipay.com/v1alpha1"
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/resource"
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/utils"
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/utils/native"
+)
+
+const (
+	cloneSetWorkCount = 5
+)
+
+// CloneSetReconciler 为OpenKruise CloneSet的每个updateRevision创建ChangeWorkload，partition对应ChangePod的批次，校验失败时停住partition。
+// 扩容和配置变更的防御只支持Deployment
+// CloneSetReconciler creates a ChangeWorkload for every updateRevision of an OpenKruise CloneSet, the partition maps to
+// the batches of ChangePods and a failed verdict holds the partition. The scale-up and config change defenses are
+// Deployment only
+type CloneSetReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+}
+
+//+kubebuilder:rbac:groups=apps.kruise.io,resources=clonesets,verbs=get;list;watch;update;patch
+//+kubebuilder:rbac:groups=apps.kruise.io,resources=clonesets/status,verbs=get
+
+// Reconcile creates the ChangeWorkload of the updateRevision of the CloneSet and marks the revision defended
+func (r *CloneSetReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx).WithName("CloneSetReconciler Reconcile")
+	cloneSet := native.NewCloneSet()
+	if err := r.Get(ctx, req.NamespacedName, cloneSet); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	if isDefensed(cloneSet.GetLabels()) {
+		return ctrl.Result{}, nil
+	}
+	// 等待CloneSet控制器为当前模板生成updateRevision，status更新后会再次触发
+	// wait for the CloneSet controller to make the updateRevision of the current template, the status update triggers again
+	updateRevision, ok := native.GetCloneSetUpdateRevision(cloneSet)
+	if !ok {
+		logger.Info("wait for the updateRevision", utils.LogCloneSetResource, utils.GetResource(cloneSet))
+		return ctrl.Result{}, nil
+	}
+	// 创建workload
+	// create workload
+	if err := r.createChangeWorkload(ctx, cloneSet, updateRevision); err != nil {
+		logger.Error(err, "CloneSetReconciler createChangeWorkload error", utils.LogCloneSetResource, utils.GetResource(cloneSet))
+		return ctrl.Result{}, err
+	}
+	// 给cloneSet打上防御标签
+	// add defensed label to cloneSet
+	if err := r.defenseProcessedCloneSet(ctx, cloneSet); err != nil {
+		logger.Error(err, "CloneSetReconciler defenseProcessedCloneSet error", utils.LogCloneSetResource, utils.GetResource(cloneSet))
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{}, nil
+}
+
+// SetupWithManager sets up the controller with the Manager, the CloneSet CRD must be installed.
+func (r *CloneSetReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(native.NewCloneSet()).
+		Owns(&v1alpha1.ChangeWorkload{}).
+		// Set the maximum number of concurrency
+		WithOptions(controller.Options{MaxConcurrentReconciles: cloneSetWorkCount}).
+		// 和deployment一样只处理webhook打上版本并且还没有防御的cloneSet
+		// like the deployments only the cloneSets versioned by the webhook and not defended yet are handled
+		WithEventFilter(predicate.Funcs{
+			UpdateFunc: func(e event.UpdateEvent) bool {
+				return isAdmissionWebhook(e.ObjectNew.GetLabels()) && !isDefensed(e.ObjectNew.GetLabels())
+			},
+			CreateFunc: func(e event.CreateEvent) bool {
+				return isAdmissionWebhook(e.Object.GetLabels()) && !isDefensed(e.Object.GetLabels())
+			},
+		}).
+		Complete(r)
+}
+
+// createChangeWorkload 创建cloneSet的updateRevision的ChangeWorkload，已经存在时忽略
+// createChangeWorkload creates the ChangeWorkload of the updateRevision of the cloneSet, an existing one is kept
+func (r *CloneSetReconciler) createChangeWorkload(ctx context.Context, cloneSet *unstructured.Unstructured, updateRevision string) error {
+	logger := log.FromContext(ctx).WithName("createChangeWorkload")
+	factory := &resource.CloneSetChangeWorkloadFactory{CloneSet: cloneSet, UpdateRevision: updateRevision}
+	workload := factory.NewInstance().(*v1alpha1.ChangeWorkload)
+	if err := controllerutil.SetControllerReference(cloneSet, workload, r.Scheme); err != nil {
+		return err
+	}
+	if err := r.Create(ctx, workload); err != nil && !errors.IsAlreadyExists(err) {
+		logger.Error(err, "create workload error", utils.LogCloneSetResource, utils.GetResource(cloneSet))
+		return err
+	}
+	if err := supersedeChangeWorkloads(ctx, r.Client, workload); err != nil {
+		logger.Error(err, "supersede change workloads error", utils.LogCloneSetResource, utils.GetResource(cloneSet))
+		return err
+	}
+	logger.Info("create workload", utils.LogCloneSetResource, utils.GetResource(cloneSet), utils.LogChangeWorkloadResource, utils.GetResource(workload),
+		"updateRevision", updateRevision, "batches", workload.Spec.Batches)
+	return nil
+}
+
+// defenseProcessedCloneSet 给cloneSet打上defense-status=Processed标记
+// defenseProcessedCloneSet sets the label defense-status=Processed for the cloneSet
+func (r *CloneSetReconciler) defenseProcessedCloneSet(ctx context.Context, cloneSet *unstructured.Unstructured) error {
+	patch := client.MergeFrom(cloneSet.DeepCopy())
+	labels := cloneSet.GetLabels()
+	labels[utils.DefenseStatusLabel] = utils.DefenseStatusLabelProcessed
+	delete(labels, utils.IgnoredSuspendLabel)
+	cloneSet.SetLabels(labels)
+	return r.Patch(ctx, cloneSet, patch)
+}
@@ -0,0 +1,198 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package concurrency
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/apis/app.ops.cloud.alipay.com/v1alpha1"
+)
+
+const (
+	// ModeHold 超过上限的变更排队等待，工作负载在排队期间被暂停
+	// ModeHold the changes over the limit wait in a queue, their workloads are paused while they are queued
+	ModeHold = "hold"
+	// ModeDeny 超过上限时webhook拒绝新的模板更新
+	// ModeDeny the webhook denies the new template updates over the limit
+	ModeDeny = "deny"
+)
+
+// Limit 同时运行的ChangeWorkload上限，保存在OpsConfigInfo的content中，0表示不限制
+// Limit the most ChangeWorkloads running at the same time, it is kept in the content of an OpsConfigInfo and 0 means no limit
+type Limit struct {
+	MaxRunningPerNamespace int    `json:"maxRunningPerNamespace"`
+	MaxRunningPerCluster   int    `json:"maxRunningPerCluster"`
+	Mode                   string `json:"mode"`
+}
+
+// DefaultLimit 默认不限制，配置上限后排队等待
+// DefaultLimit no limit by default, the changes over a configured limit wait in a queue
+var DefaultLimit = Limit{Mode: ModeHold}
+
+// ParseLimit parses the json limit on top of the defaults
+func ParseLimit(content string) (Limit, error) {
+	limit := DefaultLimit
+	if err := json.Unmarshal([]byte(content), &limit); err != nil {
+		return limit, err
+	}
+	if limit.MaxRunningPerNamespace < 0 || limit.MaxRunningPerCluster < 0 {
+		return limit, fmt.Errorf("the max running changes can't be negative")
+	}
+	if limit.Mode != ModeHold && limit.Mode != ModeDeny {
+		return limit, fmt.Errorf("unknown mode %q, it is either %s or %s", limit.Mode, ModeHold, ModeDeny)
+	}
+	return limit, nil
+}
+
+// GetLimit 解析全局配置的并发上限，没有配置或者配置错误时不限制
+// GetLimit parses the concurrency limit of the global config, there is no limit without one or with a broken one
+func GetLimit(content string) Limit {
+	if content == "" {
+		return DefaultLimit
+	}
+	limit, err := ParseLimit(content)
+	if err != nil {
+		log.Log.WithName("concurrency").Error(err, "parse concurrency limit error")
+		return DefaultLimit
+	}
+	return limit
+}
+
+// Enabled 是否配置了任意一个上限
+// Enabled whether any of the limits is set
+func (l Limit) Enabled() bool {
+	return l.MaxRunningPerNamespace > 0 || l.MaxRunningPerCluster > 0
+}
+
+// Change 一个占用或者等待名额的ChangeWorkload
+// Change a ChangeWorkload taking or waiting for a slot
+type Change struct {
+	Namespace      string
+	Name           string
+	CreateTimeUnix int64
+}
+
+// Decision 变更是否可以运行，不能运行时Position为在挡住它的namespace或者集群排队中的位置，从1开始
+// Decision whether the change may run, Position is its place from 1 in the queue of the namespace or the cluster holding
+// it when it may not
+type Decision struct {
+	Admit    bool
+	Position int
+	Reason   string
+}
+
+// NewChange returns the change of a ChangeWorkload
+func NewChange(workload *v1alpha1.ChangeWorkload) Change {
+	return Change{Namespace: workload.Namespace, Name: workload.Name, CreateTimeUnix: workload.Spec.CreateTimeUnix}
+}
+
+// Split 把ChangeWorkload分成运行中和排队中的变更，还没有决定的变更在排队模式下由operator逐个决定，不计入，拒绝模式下它们在运行，
+// skip返回true的被跳过
+// Split splits the ChangeWorkloads into the running and the queued changes, the undecided ones are left out in the hold
+// mode as the operator decides them one by one and they are running in the deny mode, the ones skip returns true for are
+// left out as well
+func (l Limit) Split(workloads []v1alpha1.ChangeWorkload, skip func(workload *v1alpha1.ChangeWorkload) bool) (running []Change, queued []Change) {
+	for i := range workloads {
+		workload := &workloads[i]
+		if skip != nil && skip(workload) {
+			continue
+		}
+		switch workload.Status.Status {
+		case v1alpha1.Running, v1alpha1.TimeOutPreThreshold:
+			running = append(running, NewChange(workload))
+		case v1alpha1.Queued:
+			queued = append(queued, NewChange(workload))
+		case v1alpha1.Init:
+			if l.Mode == ModeDeny {
+				running = append(running, NewChange(workload))
+			}
+		}
+	}
+	return running, queued
+}
+
+// List 通过状态索引从缓存中读取占用或者等待名额的ChangeWorkload，再按Split分成运行中和排队中的变更，statusField为状态索引的字段
+// List reads the ChangeWorkloads taking or waiting for a slot from the cache through the status index and splits them
+// into the running and the queued changes like Split, statusField is the field of the status index
+func (l Limit) List(ctx context.Context, c client.Reader, statusField string, skip func(workload *v1alpha1.ChangeWorkload) bool) (running []Change, queued []Change, err error) {
+	statuses := []string{v1alpha1.Running, v1alpha1.TimeOutPreThreshold, v1alpha1.Queued}
+	if l.Mode == ModeDeny {
+		statuses = append(statuses, v1alpha1.Init)
+	}
+	workloads := make([]v1alpha1.ChangeWorkload, 0)
+	for _, status := range statuses {
+		workloadList := &v1alpha1.ChangeWorkloadList{}
+		if err := c.List(ctx, workloadList, client.MatchingFields{statusField: status}); err != nil {
+			return nil, nil, err
+		}
+		workloads = append(workloads, workloadList.Items...)
+	}
+	running, queued = l.Split(workloads, skip)
+	return running, queued, nil
+}
+
+// Decide 按创建时间先后排队，排在前面的变更先占用名额，同一个namespace和整个集群的名额都有空余时才能运行
+// Decide queues the changes by their create time, the ones ahead take the slots first, a change runs once both its
+// namespace and the cluster have a slot left for it
+func (l Limit) Decide(change Change, running []Change, queued []Change) Decision {
+	sort.Slice(queued, func(i, j int) bool {
+		return before(queued[i], queued[j])
+	})
+	aheadInCluster, aheadInNamespace := 0, 0
+	for _, other := range queued {
+		if !before(other, change) {
+			break
+		}
+		aheadInCluster++
+		if other.Namespace == change.Namespace {
+			aheadInNamespace++
+		}
+	}
+	runningInNamespace := 0
+	for _, other := range running {
+		if other.Namespace == change.Namespace {
+			runningInNamespace++
+		}
+	}
+	decision := Decision{Admit: true}
+	if l.MaxRunningPerNamespace > 0 && runningInNamespace+aheadInNamespace >= l.MaxRunningPerNamespace {
+		decision = Decision{Position: aheadInNamespace + 1, Reason: fmt.Sprintf("%d of %d changes are running in namespace %s with %d queued ahead",
+			runningInNamespace, l.MaxRunningPerNamespace, change.Namespace, aheadInNamespace)}
+	} else if l.MaxRunningPerCluster > 0 && len(running)+aheadInCluster >= l.MaxRunningPerCluster {
+		decision = Decision{Position: aheadInCluster + 1, Reason: fmt.Sprintf("%d of %d changes are running in the cluster with %d queued ahead",
+			len(running), l.MaxRunningPerCluster, aheadInCluster)}
+	}
+	return decision
+}
+
+// before 创建时间相同时按namespace和名称排序，保证所有变更看到相同的顺序
+// before the changes created at the same time are ordered by namespace and name so every change sees the same order
+func before(a Change, b Change) bool {
+	if a.CreateTimeUnix != b.CreateTimeUnix {
+		return a.CreateTimeUnix < b.CreateTimeUnix
+	}
+	if a.Namespace != b.Namespace {
+		return a.Namespace < b.Namespace
+	}
+	return a.Name < b.Name
+}
@@ -0,0 +1,112 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package concurrency
+
+import (
+	"strings"
+	"testing"
+
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/apis/app.ops.cloud.alipay.com/v1alpha1"
+)
+
+func TestParseLimit(t *testing.T) {
+	limit, err := ParseLimit(`{"maxRunningPerCluster": 3}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if limit != (Limit{MaxRunningPerCluster: 3, Mode: ModeHold}) || !limit.Enabled() {
+		t.Fatalf("expected the mode to keep its default, got %+v", limit)
+	}
+	if DefaultLimit.Enabled() {
+		t.Fatal("expected no limit by default")
+	}
+	for _, content := range []string{`{"maxRunningPerNamespace": -1}`, `{"mode": "drop"}`, `not json`} {
+		if _, err := ParseLimit(content); err == nil {
+			t.Fatalf("expected %s to be rejected", content)
+		}
+	}
+}
+
+func TestGetLimit(t *testing.T) {
+	if limit := GetLimit(`{"maxRunningPerNamespace": 2, "mode": "deny"}`); limit != (Limit{MaxRunningPerNamespace: 2, Mode: ModeDeny}) {
+		t.Fatalf("expected the configured limit, got %+v", limit)
+	}
+	for _, content := range []string{"", `{"mode": "drop"}`} {
+		if limit := GetLimit(content); limit != DefaultLimit {
+			t.Fatalf("expected no limit for %q, got %+v", content, limit)
+		}
+	}
+}
+
+func TestSplit(t *testing.T) {
+	workloads := []v1alpha1.ChangeWorkload{
+		{Status: v1alpha1.ChangeWorkloadStatus{Status: v1alpha1.Running}},
+		{Status: v1alpha1.ChangeWorkloadStatus{Status: v1alpha1.TimeOutPreThreshold}},
+		{Status: v1alpha1.ChangeWorkloadStatus{Status: v1alpha1.Queued}},
+		{Status: v1alpha1.ChangeWorkloadStatus{Status: v1alpha1.Init}},
+		{Status: v1alpha1.ChangeWorkloadStatus{Status: v1alpha1.Success}},
+		{Status: v1alpha1.ChangeWorkloadStatus{Status: v1alpha1.Suspend}},
+	}
+	running, queued := Limit{Mode: ModeHold}.Split(workloads, nil)
+	if len(running) != 2 || len(queued) != 1 {
+		t.Fatalf("expected the undecided change to be left out in the hold mode, got %d running and %d queued", len(running), len(queued))
+	}
+	running, queued = Limit{Mode: ModeDeny}.Split(workloads, func(workload *v1alpha1.ChangeWorkload) bool {
+		return workload.Status.Status == v1alpha1.Running
+	})
+	if len(running) != 2 || len(queued) != 1 {
+		t.Fatalf("expected the undecided change to run in the deny mode, got %d running and %d queued", len(running), len(queued))
+	}
+}
+
+func TestDecide(t *testing.T) {
+	limit := Limit{MaxRunningPerNamespace: 1, MaxRunningPerCluster: 2, Mode: ModeHold}
+	running := []Change{{Namespace: "a", Name: "a-1", CreateTimeUnix: 1}}
+	queued := []Change{
+		{Namespace: "c", Name: "c-1", CreateTimeUnix: 4},
+		{Namespace: "a", Name: "a-2", CreateTimeUnix: 2},
+		{Namespace: "b", Name: "b-1", CreateTimeUnix: 3},
+	}
+	cases := []struct {
+		change   Change
+		admit    bool
+		position int
+		reason   string
+	}{
+		// the namespace is full
+		{Change{Namespace: "a", Name: "a-2", CreateTimeUnix: 2}, false, 1, "in namespace a"},
+		// the first one of its namespace takes the last slot of the cluster
+		{Change{Namespace: "b", Name: "b-1", CreateTimeUnix: 3}, false, 2, "in the cluster"},
+		{Change{Namespace: "c", Name: "c-1", CreateTimeUnix: 4}, false, 3, "in the cluster"},
+		// the place in the queue of its namespace
+		{Change{Namespace: "a", Name: "a-3", CreateTimeUnix: 5}, false, 2, "in namespace a"},
+	}
+	for _, c := range cases {
+		decision := limit.Decide(c.change, running, queued)
+		if decision.Admit != c.admit || decision.Position != c.position || !strings.Contains(decision.Reason, c.reason) {
+			t.Fatalf("%s: expected admit %v at %d for %q, got %+v", c.change.Name, c.admit, c.position, c.reason, decision)
+		}
+	}
+	// a-2 held by its namespace still counts against the cluster, b-1 runs once the cluster has a slot left for both
+	limit.MaxRunningPerCluster = 3
+	if decision := limit.Decide(Change{Namespace: "b", Name: "b-1", CreateTimeUnix: 3}, running, queued); !decision.Admit {
+		t.Fatalf("expected b-1 to run once the cluster has a slot for it, got %+v", decision)
+	}
+	if decision := (Limit{}).Decide(Change{Namespace: "a", Name: "a-3"}, running, queued); !decision.Admit {
+		t.Fatalf("expected every change to run without a limit, got %+v", decision)
+	}
+}
@@ -0,0 +1,167 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dependency
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/apis/app.ops.cloud.alipay.com/v1alpha1"
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/utils/native"
+)
+
+const (
+	// StateReady 所有上游deployment当前版本的变更都已经成功
+	// StateReady the changes of the current revisions of all the upstream deployments succeeded
+	StateReady = "Ready"
+	// StateWaiting 还有上游deployment的变更没有成功，下游的发布保持暂停
+	// StateWaiting the change of an upstream deployment has not succeeded yet, the release of the dependent is held
+	StateWaiting = "Waiting"
+	// StateCancelled 上游deployment的变更被暂停，下游的变更被取消
+	// StateCancelled the change of an upstream deployment is suspended, the change of the dependent is cancelled
+	StateCancelled = "Cancelled"
+)
+
+// Result 上游变更的检查结果，Reason为等待或者取消的原因
+// Result the result of checking the upstream changes, Reason is why the dependent waits or is cancelled
+type Result struct {
+	State  string
+	Reason string
+}
+
+// ParseUpstreams 解析逗号分隔的上游deployment，没有namespace的上游和下游在同一个namespace，返回namespace/name
+// ParseUpstreams parses the comma separated upstream deployments into namespace/name, an upstream without a namespace is
+// in the namespace of the dependent
+func ParseUpstreams(value string, namespace string) ([]string, error) {
+	var upstreams []string
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		upstreamNamespace, name, err := cache.SplitMetaNamespaceKey(entry)
+		if err != nil {
+			return nil, err
+		}
+		if upstreamNamespace == "" {
+			upstreamNamespace = namespace
+		}
+		errs := append(validation.IsDNS1123Label(upstreamNamespace), validation.IsDNS1123Subdomain(name)...)
+		if len(errs) > 0 {
+			return nil, fmt.Errorf("invalid upstream %q: %s", entry, strings.Join(errs, ", "))
+		}
+		upstreams = append(upstreams, upstreamNamespace+"/"+name)
+	}
+	return upstreams, nil
+}
+
+// Check 按顺序检查上游deployment当前版本的变更，都成功时就绪，任意一个被暂停或者取消时取消，否则等待，没有被防御的上游不阻塞下游。
+// 上游deployment或者它的变更在deadline之后仍然不存在时取消，避免下游一直等待
+// Check checks the changes of the current revisions of the upstream deployments in order, the dependent is ready once all
+// of them succeed and cancelled once any of them is suspended or cancelled, it waits otherwise, the upstreams that are not
+// defended don't block it. The dependent is cancelled when an upstream deployment or its change is still missing after
+// the deadline so it never waits forever
+func Check(ctx context.Context, reader client.Reader, upstreams []string, deadline time.Time) (Result, error) {
+	missing := func(reason string) Result {
+		if time.Now().After(deadline) {
+			return Result{State: StateCancelled, Reason: fmt.Sprintf("%s before the deadline %s", reason, deadline.UTC().Format(time.RFC3339))}
+		}
+		return Result{State: StateWaiting, Reason: reason}
+	}
+	for _, upstream := range upstreams {
+		namespace, name, err := cache.SplitMetaNamespaceKey(upstream)
+		if err != nil {
+			return Result{}, err
+		}
+		deployment := &appsv1.Deployment{}
+		if err := reader.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, deployment); err != nil {
+			if errors.IsNotFound(err) {
+				return missing(fmt.Sprintf("the upstream deployment %s is not found", upstream)), nil
+			}
+			return Result{}, err
+		}
+		if deployment.Labels[native.AdmissionWebhookVersionLabel] == "" {
+			continue
+		}
+		workload := &v1alpha1.ChangeWorkload{}
+		key := client.ObjectKey{Namespace: namespace, Name: native.GetChangeWorkloadNameByDeployment(deployment)}
+		if err := reader.Get(ctx, key, workload); err != nil {
+			if errors.IsNotFound(err) {
+				return missing(fmt.Sprintf("the change of the upstream deployment %s has not started", upstream)), nil
+			}
+			return Result{}, err
+		}
+		switch workload.Status.Status {
+		case v1alpha1.Success:
+			continue
+		case v1alpha1.Suspend, v1alpha1.Failed, v1alpha1.Cancelled:
+			return Result{State: StateCancelled, Reason: fmt.Sprintf("the change %s of the upstream deployment %s is %s",
+				workload.Name, upstream, strings.ToLower(workload.Status.Status))}, nil
+		default:
+			return Result{State: StateWaiting, Reason: fmt.Sprintf("waiting for the change %s of the upstream deployment %s to succeed",
+				workload.Name, upstream)}, nil
+		}
+	}
+	return Result{State: StateReady}, nil
+}
+
+// FindCycle 沿着上游deployment的annotation查找回到dependent的依赖环，返回环上的deployment，没有环时返回nil，不存在的上游被跳过
+// FindCycle follows the annotation of the upstream deployments looking for a dependency cycle back to the dependent, it
+// returns the deployments of the cycle or nil without one, the missing upstreams are skipped
+func FindCycle(ctx context.Context, reader client.Reader, annotation string, dependent string, upstreams []string) ([]string, error) {
+	visited := map[string]bool{}
+	var visit func(path []string, upstreams []string) ([]string, error)
+	visit = func(path []string, upstreams []string) ([]string, error) {
+		for _, upstream := range upstreams {
+			if upstream == dependent {
+				return append(path, upstream), nil
+			}
+			if visited[upstream] {
+				continue
+			}
+			visited[upstream] = true
+			namespace, name, err := cache.SplitMetaNamespaceKey(upstream)
+			if err != nil {
+				return nil, err
+			}
+			deployment := &appsv1.Deployment{}
+			if err := reader.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, deployment); err != nil {
+				if errors.IsNotFound(err) {
+					continue
+				}
+				return nil, err
+			}
+			next, err := ParseUpstreams(deployment.Annotations[annotation], namespace)
+			if err != nil {
+				continue
+			}
+			if cycle, err := visit(append(path[:len(path):len(path)], upstream), next); err != nil || cycle != nil {
+				return cycle, err
+			}
+		}
+		return nil, nil
+	}
+	return visit([]string{dependent}, upstreams)
+}
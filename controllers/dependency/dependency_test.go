@@ -0,0 +1,134 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dependency
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/apis/app.ops.cloud.alipay.com/v1alpha1"
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/utils/native"
+)
+
+func TestParseUpstreams(t *testing.T) {
+	upstreams, err := ParseUpstreams(" backend, infra/db ,", "shop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(upstreams, ",") != "shop/backend,infra/db" {
+		t.Fatalf("expected the upstreams to default to the namespace of the dependent, got %v", upstreams)
+	}
+	if upstreams, err := ParseUpstreams("", "shop"); err != nil || upstreams != nil {
+		t.Fatalf("expected no upstreams, got %v %v", upstreams, err)
+	}
+	for _, value := range []string{"a/b/c", "Backend", "infra/"} {
+		if _, err := ParseUpstreams(value, "shop"); err == nil {
+			t.Fatalf("expected %s to be rejected", value)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := v1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	deployment := func(name string, version string) *appsv1.Deployment {
+		return &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: name,
+			Labels: map[string]string{native.AdmissionWebhookVersionLabel: version}}}
+	}
+	workload := func(deployment *appsv1.Deployment, status string) *v1alpha1.ChangeWorkload {
+		return &v1alpha1.ChangeWorkload{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: native.GetChangeWorkloadNameByDeployment(deployment)},
+			Status: v1alpha1.ChangeWorkloadStatus{Status: status}}
+	}
+	backend, cache, db := deployment("backend", "v2"), deployment("cache", "v3"), deployment("db", "v4")
+	reader := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		backend, workload(backend, v1alpha1.Success),
+		cache, workload(cache, v1alpha1.Running),
+		db, workload(db, v1alpha1.Suspend),
+		deployment("queue", "v5"),
+		deployment("legacy", ""),
+	).Build()
+	cases := []struct {
+		upstreams []string
+		state     string
+		reason    string
+	}{
+		{[]string{"shop/backend", "shop/legacy"}, StateReady, ""},
+		{[]string{"shop/backend", "shop/cache", "shop/db"}, StateWaiting, "of the upstream deployment shop/cache to succeed"},
+		{[]string{"shop/db", "shop/cache"}, StateCancelled, "of the upstream deployment shop/db is suspend"},
+		{[]string{"shop/queue"}, StateWaiting, "upstream deployment shop/queue has not started"},
+		{[]string{"shop/missing"}, StateWaiting, "shop/missing is not found"},
+	}
+	for _, c := range cases {
+		result, err := Check(context.Background(), client.Reader(reader), c.upstreams, time.Now().Add(time.Minute))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.State != c.state || !strings.Contains(result.Reason, c.reason) {
+			t.Fatalf("%v: expected %s for %q, got %+v", c.upstreams, c.state, c.reason, result)
+		}
+	}
+	for _, upstream := range []string{"shop/missing", "shop/queue"} {
+		result, err := Check(context.Background(), client.Reader(reader), []string{upstream}, time.Now().Add(-time.Minute))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.State != StateCancelled || !strings.Contains(result.Reason, "before the deadline") {
+			t.Fatalf("expected the dependent on %s to be cancelled after the deadline, got %+v", upstream, result)
+		}
+	}
+}
+
+func TestFindCycle(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	deployment := func(namespace string, name string, upstreams string) *appsv1.Deployment {
+		return &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name,
+			Annotations: map[string]string{"depends-on": upstreams}}}
+	}
+	reader := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		deployment("shop", "backend", "infra/db, cache"),
+		deployment("shop", "cache", ""),
+		deployment("infra", "db", "shop/frontend"),
+		deployment("shop", "gateway", "missing"),
+	).Build()
+	cycle, err := FindCycle(context.Background(), reader, "depends-on", "shop/frontend", []string{"shop/gateway", "shop/backend"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(cycle, " -> ") != "shop/frontend -> shop/backend -> infra/db -> shop/frontend" {
+		t.Fatalf("expected the cycle through the other namespace, got %v", cycle)
+	}
+	if cycle, err := FindCycle(context.Background(), reader, "depends-on", "shop/api", []string{"shop/backend"}); err != nil || cycle != nil {
+		t.Fatalf("expected no cycle, got %v %v", cycle, err)
+	}
+}
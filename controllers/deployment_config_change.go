@@ -0,0 +1,416 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/apis/app.ops.cloud.alipay.com/v1alpha1"
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/resource"
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/utils"
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/utils/native"
+)
+
+const (
+	configHashLength     = 16
+	configRevisionLength = 10
+)
+
+// configSnapshot 被引用配置的内容摘要，key为Kind/Name，值为每个key的摘要
+// configSnapshot the content digests of the referenced configs keyed by Kind/Name, the values are the digests of every key
+type configSnapshot map[string]map[string]string
+
+// defendConfigChange 开启配置防御的deployment被引用的配置内容变化时，热加载的配置立即创建配置变更的ChangeWorkload并重新校验
+// 当前版本的pod，只在重启时生效的配置保留基线，等待重启的模板发布一起记录，当前版本还在发布中时等待发布结束
+// defendConfigChange handles a content change of the configs referenced by a deployment with the config defense, a
+// hot-reloaded config gets a config ChangeWorkload right away which checks the pods of the current revision again, the
+// baseline of a config only applied on restart is kept for the template rollout that restarts the pods, and a change
+// waits while the current revision is still rolling out
+func (r *DeploymentReconciler) defendConfigChange(ctx context.Context, deployment *appsv1.Deployment) error {
+	logger := log.FromContext(ctx).WithName("defendConfigChange")
+	snapshot, err := r.getConfigSnapshot(ctx, deployment)
+	if err != nil || snapshot == nil {
+		return err
+	}
+	baseline, ok := getConfigHashes(deployment)
+	if !ok {
+		return r.patchConfigHashes(ctx, deployment, snapshot)
+	}
+	change := diffConfigSnapshot(baseline, snapshot)
+	if change == nil {
+		return r.releaseConfigChangePods(ctx, deployment)
+	}
+	if !isHotReloadChange(&deployment.Spec.Template, change) {
+		return nil
+	}
+	workload, err := r.getChangeWorkloadByDeployment(ctx, deployment)
+	if err != nil || workload.Status.Status != v1alpha1.Success {
+		return client.IgnoreNotFound(err)
+	}
+
+	patch := client.MergeFrom(deployment.DeepCopy())
+	if deployment.Annotations == nil {
+		deployment.Annotations = make(map[string]string)
+	}
+	deployment.Annotations[utils.ChangeRevisionAnnotation] = native.ConfigChangeRevisionPrefix + change.Revision
+	factory := &resource.NativeChangeWorkloadFactory{Deployment: deployment, Replicas: deployment.Spec.Replicas, Config: change}
+	if _, err := r.createNewChangeWorkload(ctx, deployment, factory); err != nil && !errors.IsAlreadyExists(err) {
+		return err
+	}
+	logger.Info("defend config change", utils.LogDeploymentResource, utils.GetResource(deployment), "revision", change.Revision)
+	if err := setConfigHashes(deployment, snapshot); err != nil {
+		return err
+	}
+	if err := r.Patch(ctx, deployment, patch); err != nil {
+		logger.Error(err, "patch deployment config change error", utils.LogDeploymentResource, utils.GetResource(deployment))
+		return err
+	}
+	return r.releaseConfigChangePods(ctx, deployment)
+}
+
+// getTemplateConfigChange 模板发布时获取自上次防御以来被引用配置的内容变更和新的基线，未开启配置防御时均为空
+// getTemplateConfigChange gets the content change of the referenced configs since the last defense and the new baseline
+// for a template rollout, both are empty without the config defense
+func (r *DeploymentReconciler) getTemplateConfigChange(ctx context.Context, deployment *appsv1.Deployment) (*v1alpha1.ConfigChange, configSnapshot, error) {
+	snapshot, err := r.getConfigSnapshot(ctx, deployment)
+	if err != nil || snapshot == nil {
+		return nil, nil, err
+	}
+	baseline, ok := getConfigHashes(deployment)
+	if !ok {
+		return nil, snapshot, nil
+	}
+	return diffConfigSnapshot(baseline, snapshot), snapshot, nil
+}
+
+// releaseConfigChangePods 去掉当前版本pod的防御标签，由还未开始的配置变更ChangeWorkload重新分批校验
+// releaseConfigChangePods removes the defense label of the pods of the current revision, so the config ChangeWorkload that
+// has not started yet checks them again in batches
+func (r *DeploymentReconciler) releaseConfigChangePods(ctx context.Context, deployment *appsv1.Deployment) error {
+	logger := log.FromContext(ctx).WithName("releaseConfigChangePods")
+	if !strings.HasPrefix(deployment.Annotations[utils.ChangeRevisionAnnotation], native.ConfigChangeRevisionPrefix) {
+		return nil
+	}
+	workload, err := r.getChangeWorkloadByDeployment(ctx, deployment)
+	if err != nil || workload.Status.Status != v1alpha1.Init {
+		return client.IgnoreNotFound(err)
+	}
+	podList := &v1.PodList{}
+	if err := r.List(ctx, podList, client.InNamespace(deployment.Namespace),
+		client.MatchingLabels{native.AdmissionWebhookVersionLabel: deployment.Labels[native.AdmissionWebhookVersionLabel]}); err != nil {
+		return err
+	}
+	for i := range podList.Items {
+		pod := &podList.Items[i]
+		if !isDefensed(pod.Labels) {
+			continue
+		}
+		patch := client.MergeFrom(pod.DeepCopy())
+		delete(pod.Labels, utils.DefenseStatusLabel)
+		if err := r.Patch(ctx, pod, patch); err != nil {
+			logger.Error(err, "release pod error", utils.LogPodResource, utils.GetResource(pod))
+			return client.IgnoreNotFound(err)
+		}
+	}
+	return nil
+}
+
+// getConfigSnapshot 计算deployment引用的ConfigMap和Secret每个key的摘要，不存在的配置没有key，未开启配置防御时返回空
+// getConfigSnapshot digests every key of the ConfigMaps and Secrets referenced by the deployment, a missing config has no
+// keys, it returns nil without the config defense
+func (r *DeploymentReconciler) getConfigSnapshot(ctx context.Context, deployment *appsv1.Deployment) (configSnapshot, error) {
+	value, ok := lookupDefenseAnnotation(getDeploymentDefenseAnnotations(ctx, r.Client, deployment), utils.ConfigDefenseAnnotation, isBool)
+	if enabled, _ := strconv.ParseBool(value); !ok || !enabled {
+		return nil, nil
+	}
+	snapshot := configSnapshot{}
+	for ref := range getConfigReferences(&deployment.Spec.Template) {
+		kind, name, _ := strings.Cut(ref, "/")
+		key := types.NamespacedName{Namespace: deployment.Namespace, Name: name}
+		hashes := map[string]string{}
+		switch kind {
+		case native.ConfigMapKind:
+			configMap := &v1.ConfigMap{}
+			if err := r.Get(ctx, key, configMap); err != nil && !errors.IsNotFound(err) {
+				return nil, err
+			}
+			for dataKey, dataValue := range configMap.Data {
+				hashes[dataKey] = hashConfigValue([]byte(dataValue))
+			}
+			for dataKey, dataValue := range configMap.BinaryData {
+				hashes[dataKey] = hashConfigValue(dataValue)
+			}
+		case native.SecretKind:
+			// Secret只缓存元数据，内容直接从api server读取
+			// only the metadata of the Secrets is cached, the content is read from the api server
+			secret := &v1.Secret{}
+			if err := utils.App.APIReader.Get(ctx, key, secret); err != nil && !errors.IsNotFound(err) {
+				return nil, err
+			}
+			for dataKey, dataValue := range secret.Data {
+				hashes[dataKey] = hashConfigValue(dataValue)
+			}
+		}
+		snapshot[ref] = hashes
+	}
+	return snapshot, nil
+}
+
+// watchConfigEventHandler 把ConfigMap和Secret的事件映射到引用它们的deployment，Secret只监听元数据，按照种类区分
+// watchConfigEventHandler maps the events of a ConfigMap or Secret to the deployments referencing it, the kind is given
+// since only the metadata of the Secrets is watched
+func (r *DeploymentReconciler) watchConfigEventHandler(kind string) handler.MapFunc {
+	return func(object client.Object) []reconcile.Request {
+		return r.mapConfigEvent(kind, object)
+	}
+}
+
+func (r *DeploymentReconciler) mapConfigEvent(kind string, object client.Object) []reconcile.Request {
+	deploymentList := &appsv1.DeploymentList{}
+	if err := r.List(context.Background(), deploymentList, client.InNamespace(object.GetNamespace()),
+		client.MatchingFields{utils.DeploymentFieldConfigRefs: configReference(kind, object.GetName())}); err != nil {
+		log.Log.WithName("watchConfigEventHandler").Error(err, "list deployments error", "kind", kind, utils.Namespace, object.GetNamespace(), "name", object.GetName())
+		return nil
+	}
+	requests := make([]reconcile.Request, 0, len(deploymentList.Items))
+	for _, deployment := range deploymentList.Items {
+		requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&deployment)})
+	}
+	return requests
+}
+
+// getConfigReferences 获取pod模板引用的ConfigMap和Secret，值表示是否通过不带subPath的卷挂载到容器从而热加载
+// getConfigReferences gets the ConfigMaps and Secrets referenced by the pod template, the value tells whether it is
+// mounted into a container as a volume without subPath and is therefore hot-reloaded
+func getConfigReferences(template *v1.PodTemplateSpec) map[string]bool {
+	references := map[string]bool{}
+	add := func(kind string, name string, hotReload bool) {
+		if name != "" {
+			references[configReference(kind, name)] = references[configReference(kind, name)] || hotReload
+		}
+	}
+	hotReloadVolumes := map[string]bool{}
+	for _, container := range template.Spec.Containers {
+		for _, mount := range container.VolumeMounts {
+			if mount.SubPath == "" && mount.SubPathExpr == "" {
+				hotReloadVolumes[mount.Name] = true
+			}
+		}
+	}
+	for _, volume := range template.Spec.Volumes {
+		hotReload := hotReloadVolumes[volume.Name]
+		if volume.ConfigMap != nil {
+			add(native.ConfigMapKind, volume.ConfigMap.Name, hotReload)
+		}
+		if volume.Secret != nil {
+			add(native.SecretKind, volume.Secret.SecretName, hotReload)
+		}
+		if volume.Projected != nil {
+			for _, source := range volume.Projected.Sources {
+				if source.ConfigMap != nil {
+					add(native.ConfigMapKind, source.ConfigMap.Name, hotReload)
+				}
+				if source.Secret != nil {
+					add(native.SecretKind, source.Secret.Name, hotReload)
+				}
+			}
+		}
+	}
+	containers := append(append([]v1.Container{}, template.Spec.InitContainers...), template.Spec.Containers...)
+	for _, container := range containers {
+		for _, envFrom := range container.EnvFrom {
+			if envFrom.ConfigMapRef != nil {
+				add(native.ConfigMapKind, envFrom.ConfigMapRef.Name, false)
+			}
+			if envFrom.SecretRef != nil {
+				add(native.SecretKind, envFrom.SecretRef.Name, false)
+			}
+		}
+		for _, env := range container.Env {
+			if env.ValueFrom == nil {
+				continue
+			}
+			if env.ValueFrom.ConfigMapKeyRef != nil {
+				add(native.ConfigMapKind, env.ValueFrom.ConfigMapKeyRef.Name, false)
+			}
+			if env.ValueFrom.SecretKeyRef != nil {
+				add(native.SecretKind, env.ValueFrom.SecretKeyRef.Name, false)
+			}
+		}
+	}
+	return references
+}
+
+// isHotReloadChange 变更的配置中是否有热加载的配置
+// isHotReloadChange reports whether any of the changed configs is hot-reloaded
+func isHotReloadChange(template *v1.PodTemplateSpec, change *v1alpha1.ConfigChange) bool {
+	references := getConfigReferences(template)
+	for _, object := range change.Objects {
+		if references[configReference(object.Kind, object.Name)] {
+			return true
+		}
+	}
+	return false
+}
+
+// diffConfigSnapshot 对比基线和当前的摘要，返回新增、修改和删除的key，没有变化时返回空
+// diffConfigSnapshot compares the baseline with the current digests and returns the added, modified and removed keys, it
+// returns nil without changes
+func diffConfigSnapshot(baseline configSnapshot, snapshot configSnapshot) *v1alpha1.ConfigChange {
+	change := &v1alpha1.ConfigChange{Revision: snapshot.revision()}
+	refs := make([]string, 0, len(snapshot))
+	for ref := range snapshot {
+		refs = append(refs, ref)
+	}
+	sort.Strings(refs)
+	for _, ref := range refs {
+		// 新引用的配置随模板发布生效，不是内容变更
+		// a newly referenced config takes effect with a template rollout, it is not a content change
+		previous, ok := baseline[ref]
+		if !ok {
+			continue
+		}
+		keys := make([]string, 0)
+		for key, hash := range snapshot[ref] {
+			if previous[key] != hash {
+				keys = append(keys, key)
+			}
+		}
+		for key := range previous {
+			if _, ok := snapshot[ref][key]; !ok {
+				keys = append(keys, key)
+			}
+		}
+		if len(keys) == 0 {
+			continue
+		}
+		sort.Strings(keys)
+		kind, name, _ := strings.Cut(ref, "/")
+		change.Objects = append(change.Objects, v1alpha1.ChangedConfig{Kind: kind, Name: name, Keys: keys})
+	}
+	if len(change.Objects) == 0 {
+		return nil
+	}
+	return change
+}
+
+// revision 全部被引用配置内容的摘要
+// revision the digest of the content of all the referenced configs
+func (snapshot configSnapshot) revision() string {
+	lines := make([]string, 0)
+	for ref, hashes := range snapshot {
+		for key, hash := range hashes {
+			lines = append(lines, ref+"/"+key+"="+hash)
+		}
+	}
+	sort.Strings(lines)
+	sum := sha256.Sum256([]byte(strings.Join(lines, "\n")))
+	return hex.EncodeToString(sum[:])[:configRevisionLength]
+}
+
+// patchConfigHashes 只记录配置摘要的基线
+// patchConfigHashes only records the baseline of the config digests
+func (r *DeploymentReconciler) patchConfigHashes(ctx context.Context, deployment *appsv1.Deployment, snapshot configSnapshot) error {
+	patch := client.MergeFrom(deployment.DeepCopy())
+	if err := setConfigHashes(deployment, snapshot); err != nil {
+		return err
+	}
+	return r.Patch(ctx, deployment, patch)
+}
+
+// getConfigHashes 获取deployment上记录的配置摘要基线
+// getConfigHashes gets the baseline of the config digests recorded on the deployment
+func getConfigHashes(deployment *appsv1.Deployment) (configSnapshot, bool) {
+	value, ok := deployment.Annotations[utils.ConfigHashesAnnotation]
+	if !ok {
+		return nil, false
+	}
+	baseline := configSnapshot{}
+	if err := json.Unmarshal([]byte(value), &baseline); err != nil {
+		return nil, false
+	}
+	return baseline, true
+}
+
+// setConfigHashes 把配置摘要记录为下一次配置变更的基线，未开启配置防御时不记录
+// setConfigHashes records the config digests as the baseline of the next config change, nothing is recorded without the config defense
+func setConfigHashes(deployment *appsv1.Deployment, snapshot configSnapshot) error {
+	if snapshot == nil {
+		return nil
+	}
+	if baseline, ok := getConfigHashes(deployment); ok && reflect.DeepEqual(baseline, snapshot) {
+		return nil
+	}
+	value, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	if deployment.Annotations == nil {
+		deployment.Annotations = make(map[string]string)
+	}
+	deployment.Annotations[utils.ConfigHashesAnnotation] = string(value)
+	return nil
+}
+
+// hashConfigValue 配置取值的摘要，只取决于内容，重建内容相同的配置不算变更
+// hashConfigValue the digest of a config value, it only depends on the content so a config recreated with the same
+// content is not a change
+func hashConfigValue(value []byte) string {
+	sum := sha256.Sum256(value)
+	return hex.EncodeToString(sum[:])[:configHashLength]
+}
+
+func configReference(kind string, name string) string {
+	return kind + "/" + name
+}
+
+// isConfigDataChanged ConfigMap的内容是否变化，只监听元数据的Secret按照资源版本判断，内容是否变化由摘要对比决定
+// isConfigDataChanged reports whether the content of a ConfigMap changed, a Secret of which only the metadata is watched
+// is judged by its resource version and the digests tell whether its content changed
+func isConfigDataChanged(oldObject client.Object, newObject client.Object) bool {
+	switch newConfig := newObject.(type) {
+	case *v1.ConfigMap:
+		oldConfig, ok := oldObject.(*v1.ConfigMap)
+		return ok && (!reflect.DeepEqual(oldConfig.Data, newConfig.Data) || !reflect.DeepEqual(oldConfig.BinaryData, newConfig.BinaryData))
+	case *metav1.PartialObjectMetadata:
+		return oldObject.GetResourceVersion() != newConfig.GetResourceVersion()
+	default:
+		return false
+	}
+}
+
+func isBool(value string) bool {
+	_, err := strconv.ParseBool(value)
+	return err == nil
+}
@@ -19,17 +19,26 @@ package controllers
 import (
 	"context"
 	"fmt"
+	"reflect"
+	"strconv"
+	"time"
 
 	v1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	"gitlab.alipay-inc.com/common_release/altershieldoperator/apis/app.ops.cloud.alipay.com/v1alpha1"
 	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/resource"
@@ -49,6 +58,8 @@ type DeploymentReconciler struct {
 
 //+kubebuilder:rbac:groups=apps,resources=deployments,verbs=get;list;watch;update;patch
 //+kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=configmaps;secrets,verbs=get;list;watch
+//+kubebuilder:rbac:groups=autoscaling,resources=horizontalpodautoscalers,verbs=get;list;watch
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -68,18 +79,35 @@ func (r *DeploymentReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 	labels := deployment.Labels
 	defensed := isDefensed(labels)
 	if defensed {
-		return ctrl.Result{}, nil
+		// 已经防御过的版本只需要处理原地变更：副本扩容和配置变更
+		// only the in-place changes are left to handle for a defended revision: replica scale-ups and config changes
+		if result, done, err := r.defendScaleChange(ctx, deployment); err != nil || done {
+			return result, err
+		}
+		return ctrl.Result{}, r.defendConfigChange(ctx, deployment)
+	}
+	// 模板发布记录重启后生效的配置变更
+	// a template rollout records the config changes taking effect on restart
+	configChange, configHashes, err := r.getTemplateConfigChange(ctx, deployment)
+	if err != nil {
+		logger.Error(err, "DeploymentReconciler getTemplateConfigChange error", utils.LogDeploymentResource, utils.GetResource(deployment))
+		return ctrl.Result{}, err
 	}
 	// 创建或者获取workload
 	// create or get workload
-	_, err := r.getOrCreateChangeWorkload(ctx, deployment)
+	workload, err := r.getOrCreateChangeWorkload(ctx, deployment, configChange)
 	if err != nil {
 		logger.Error(err, "DeploymentReconciler getOrCreateChangeWorkload error", utils.LogDeploymentResource, utils.GetResource(deployment))
 		return ctrl.Result{}, err
 	}
+	// 回滚到校验通过的版本后解除暂停，解除后再次处理
+	// a rollback to the verified revision lifts the suspension, the deployment is processed again after that
+	if lifted, err := r.liftRollbackSuspension(ctx, deployment, workload); err != nil || lifted {
+		return ctrl.Result{}, err
+	}
 	// 给deployment打上防御标签
 	// add defensed label to deployment
-	if err = r.defenseProcessedDeployment(ctx, deployment); err != nil {
+	if err = r.defenseProcessedDeployment(ctx, deployment, configHashes); err != nil {
 		logger.Error(err, "DeploymentReconciler defenseProcessedDeployment error", utils.LogDeploymentResource, utils.GetResource(deployment))
 		return ctrl.Result{}, err
 	}
@@ -89,9 +117,29 @@ func (r *DeploymentReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *DeploymentReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	// 按照引用的ConfigMap和Secret索引deployment
+	// index the deployments by the ConfigMaps and Secrets they reference
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &v1.Deployment{}, utils.DeploymentFieldConfigRefs, func(rawObj client.Object) []string {
+		deployment, ok := rawObj.(*v1.Deployment)
+		if !ok {
+			return nil
+		}
+		refs := make([]string, 0)
+		for ref := range getConfigReferences(&deployment.Spec.Template) {
+			refs = append(refs, ref)
+		}
+		return refs
+	}); err != nil {
+		return err
+	}
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&v1.Deployment{}).
 		Owns(&v1alpha1.ChangeWorkload{}).
+		// 监听被引用的ConfigMap和Secret，Secret只缓存元数据，避免缓存集群中全部Secret的内容
+		// watch the referenced ConfigMaps and Secrets, only the metadata of the Secrets is cached so the content of every
+		// Secret in the cluster is not
+		Watches(&source.Kind{Type: &corev1.ConfigMap{}}, handler.EnqueueRequestsFromMapFunc(r.watchConfigEventHandler(native.ConfigMapKind))).
+		Watches(&source.Kind{Type: &corev1.Secret{}}, handler.EnqueueRequestsFromMapFunc(r.watchConfigEventHandler(native.SecretKind)), builder.OnlyMetadata).
 		// Set the maximum number of concurrency
 		WithOptions(controller.Options{MaxConcurrentReconciles: deploymentWorkCount}).
 		// Settings only handle pods that are created or updated and whose label exists CheckStatusLabel=true
@@ -104,8 +152,12 @@ func (r *DeploymentReconciler) SetupWithManager(mgr ctrl.Manager) error {
 
 // handleUpdateEvent handles the event of updating a Pod
 func (r *DeploymentReconciler) handleUpdateEvent(e event.UpdateEvent) bool {
+	switch e.ObjectNew.(type) {
+	case *corev1.ConfigMap, *metav1.PartialObjectMetadata:
+		return isConfigDataChanged(e.ObjectOld, e.ObjectNew)
+	}
 	labels := e.ObjectNew.GetLabels()
-	return r.handleEvent(labels)
+	return r.handleEvent(labels) || isReplicasChanged(e.ObjectOld, e.ObjectNew)
 }
 
 // handleCreateEvent handles the event of creating a new Pod
@@ -123,14 +175,15 @@ func (r *DeploymentReconciler) handleEvent(labels map[string]string) bool {
 
 // getOrCreateChangeWorkload 根据deployment获取或者创建workload
 // getOrCreateChangeWorkload get or create workload by deployment
-func (r *DeploymentReconciler) getOrCreateChangeWorkload(ctx context.Context, deployment *v1.Deployment) (workload *v1alpha1.ChangeWorkload, err error) {
+func (r *DeploymentReconciler) getOrCreateChangeWorkload(ctx context.Context, deployment *v1.Deployment, configChange *v1alpha1.ConfigChange) (workload *v1alpha1.ChangeWorkload, err error) {
 	logger := log.FromContext(ctx).WithName("getOrCreateChangeWorkload")
 	// 1、根据版本label获取workload
 	// 1. get workload by version label
 	workload, err = r.getChangeWorkloadByDeployment(ctx, deployment)
 	if err != nil && errors.IsNotFound(err) {
 		// create workload
-		if workload, err = r.createNewChangeWorkload(ctx, deployment); err != nil {
+		factory := &resource.NativeChangeWorkloadFactory{Deployment: deployment, Replicas: deployment.Spec.Replicas, Config: configChange}
+		if workload, err = r.createNewChangeWorkload(ctx, deployment, factory); err != nil {
 			logger.Error(err, "getOrCreateChangeWorkload create new workload instance error", utils.LogDeploymentResource, utils.GetResource(deployment))
 			return workload, err
 		}
@@ -153,10 +206,9 @@ func (r *DeploymentReconciler) getChangeWorkloadByDeployment(ctx context.Context
 
 // createNewChangeWorkload 新的Deployment类型ChangeWorkload并创建
 // createNewChangeWorkload create new ChangeWorkload
-func (r *DeploymentReconciler) createNewChangeWorkload(ctx context.Context, deployment *v1.Deployment) (workload *v1alpha1.ChangeWorkload, err error) {
+func (r *DeploymentReconciler) createNewChangeWorkload(ctx context.Context, deployment *v1.Deployment, changeWorkloadFactory *resource.NativeChangeWorkloadFactory) (workload *v1alpha1.ChangeWorkload, err error) {
 	logger := log.FromContext(ctx).WithName("createNewChangeWorkload")
 	// create workload
-	changeWorkloadFactory := resource.NativeChangeWorkloadFactory{Deployment: deployment, Replicas: deployment.Spec.Replicas}
 	instance := changeWorkloadFactory.NewInstance()
 	workload, ok := instance.(*v1alpha1.ChangeWorkload)
 	if !ok {
@@ -172,16 +224,51 @@ func (r *DeploymentReconciler) createNewChangeWorkload(ctx context.Context, depl
 			return workload, err
 		}
 	}
+	if err = supersedeChangeWorkloads(ctx, r.Client, workload); err != nil {
+		logger.Error(err, "supersede change workloads error", utils.LogDeploymentResource, utils.GetResource(deployment))
+		return workload, err
+	}
 	return workload, nil
 }
 
+// liftRollbackSuspension 被暂停的deployment回滚到校验通过的版本时解除暂停，和校验通过时一样带上忽略暂停的label
+// liftRollbackSuspension lifts the suspension of a deployment rolled back to the verified revision, it carries the label
+// ignoring the suspension like a passed check does
+func (r *DeploymentReconciler) liftRollbackSuspension(ctx context.Context, deployment *v1.Deployment, workload *v1alpha1.ChangeWorkload) (bool, error) {
+	logger := log.FromContext(ctx).WithName("liftRollbackSuspension")
+	if _, ok := deployment.Labels[utils.SuspendLabel]; !ok || workload.Status.Status != v1alpha1.Success {
+		return false, nil
+	}
+	if deployment.Annotations[utils.VerifiedRevisionAnnotation] != deployment.Labels[native.AdmissionWebhookVersionLabel] {
+		return false, nil
+	}
+	patch := client.MergeFrom(deployment.DeepCopy())
+	suspendedAt := deployment.Labels[utils.SuspendLabel]
+	deployment.Labels[utils.IgnoredSuspendLabel] = utils.True
+	delete(deployment.Labels, utils.SuspendLabel)
+	if err := r.Patch(ctx, deployment, patch); err != nil {
+		logger.Error(err, "lift deployment suspension error", utils.LogDeploymentResource, utils.GetResource(deployment))
+		return false, err
+	}
+	recordWorkloadAudit(ctx, r.Client, workload, suspensionAuditKey(deployment, v1alpha1.AuditUnsuspend, suspendedAt), v1alpha1.AuditRecordSpec{
+		Action:  v1alpha1.AuditUnsuspend,
+		Message: fmt.Sprintf("the suspension is lifted after the rollback to the verified revision %s", workload.Spec.Reversion),
+	})
+	logger.Info("lift the suspension of the deployment rolled back to the verified revision", utils.LogDeploymentResource, utils.GetResource(deployment))
+	return true, nil
+}
+
 // defenseProcessedPod 给deployment打上defense-status=Processed标记
 // defenseProcessedPod sets the label defense-status=Processed for the deployment
-func (r *DeploymentReconciler) defenseProcessedDeployment(ctx context.Context, deployment *v1.Deployment) (err error) {
+func (r *DeploymentReconciler) defenseProcessedDeployment(ctx context.Context, deployment *v1.Deployment, configHashes configSnapshot) (err error) {
 	logger := log.FromContext(ctx).WithName("defenseProcessedDeployment")
 	patch := client.MergeFrom(deployment.DeepCopy())
 	deployment.Labels[utils.DefenseStatusLabel] = utils.DefenseStatusLabelProcessed
 	delete(deployment.Labels, utils.IgnoredSuspendLabel)
+	setDefendedReplicas(deployment)
+	if err = setConfigHashes(deployment, configHashes); err != nil {
+		return err
+	}
 	logger.Info("defense processed deployment", utils.LogPodResource, utils.GetResource(deployment))
 	if err = r.Patch(ctx, deployment, patch); err != nil {
 		logger.Error(err, "update deployment label error", utils.LogPodResource, utils.GetResource(deployment))
@@ -190,6 +277,181 @@ func (r *DeploymentReconciler) defenseProcessedDeployment(ctx context.Context, d
 	return
 }
 
+// defendScaleChange 开启扩容防御的deployment新增副本数达到阈值时，为新增的pod创建一个扩容的ChangeWorkload，
+// HPA在已经校验过的上下限内扩缩容时只跟随副本数，当前变更还没有结束时保留基线，变更结束后再防御这次扩容，返回done时不再处理配置变更
+// defendScaleChange creates a scale-up ChangeWorkload for the added pods once the replicas added to a deployment with the
+// scale defense reach the threshold, the replicas are only followed while an HPA scales within the bounds defended so
+// far, and the baseline is kept while the current change is not over so the scale-up is defended after it, done tells
+// that the config changes are left for later
+func (r *DeploymentReconciler) defendScaleChange(ctx context.Context, deployment *v1.Deployment) (result ctrl.Result, done bool, err error) {
+	logger := log.FromContext(ctx).WithName("defendScaleChange")
+	threshold, ok := lookupDefenseAnnotation(getDeploymentDefenseAnnotations(ctx, r.Client, deployment), utils.ScaleDefenseThresholdAnnotation, isScaleThreshold)
+	if !ok || deployment.Spec.Replicas == nil {
+		return ctrl.Result{}, false, nil
+	}
+	replicas := *deployment.Spec.Replicas
+	defendedReplicas, parseErr := strconv.ParseInt(deployment.Annotations[utils.DefendedReplicasAnnotation], utils.NumberTen, 32)
+	if parseErr == nil && int32(defendedReplicas) == replicas {
+		return ctrl.Result{}, false, nil
+	}
+	autoscaler, err := r.getHorizontalPodAutoscaler(ctx, deployment)
+	if err != nil {
+		logger.Error(err, "get horizontal pod autoscaler error", utils.LogDeploymentResource, utils.GetResource(deployment))
+		return ctrl.Result{}, false, err
+	}
+	patch := client.MergeFrom(deployment.DeepCopy())
+	autoscaling := parseErr == nil && isAutoscaling(deployment, autoscaler, int32(defendedReplicas), replicas)
+	// 没有基线时只记录当前副本数
+	// only the current replicas are recorded without a baseline
+	if parseErr == nil && !autoscaling {
+		workload, err := r.getChangeWorkloadByDeployment(ctx, deployment)
+		if err != nil && !errors.IsNotFound(err) {
+			return ctrl.Result{}, false, err
+		}
+		if err == nil && !isChangeWorkloadOver(workload) {
+			logger.Info("defer scale change until the current change is over", utils.LogDeploymentResource, utils.GetResource(deployment),
+				"from", defendedReplicas, "to", replicas, "status", workload.Status.Status)
+			return ctrl.Result{RequeueAfter: utils.ChangeWorkloadQueueInterval * time.Second}, true, nil
+		}
+		from := int32(defendedReplicas)
+		// 当前变更结束时已经校验过的副本不再校验，变更期间的扩容由它一起校验
+		// the replicas checked by the current change are not checked again, it covers a scale-up during the change
+		if err == nil {
+			if checked := getCheckedReplicas(workload); checked > from {
+				from = checked
+			}
+		}
+		if err == nil && reachesScaleThreshold(threshold, from, replicas) {
+			if deployment.Annotations == nil {
+				deployment.Annotations = make(map[string]string)
+			}
+			deployment.Annotations[utils.ChangeRevisionAnnotation] = native.ScaleChangeRevisionPrefix + strconv.FormatInt(deployment.Generation, utils.NumberTen)
+			// 只按照新增的副本数计算批次
+			// the batches are sized by the added replicas only
+			scale := &v1alpha1.ScaleChange{From: from, To: replicas}
+			added := scale.To - scale.From
+			factory := &resource.NativeChangeWorkloadFactory{Deployment: deployment, Replicas: &added, Scale: scale}
+			if _, err := r.createNewChangeWorkload(ctx, deployment, factory); err != nil && !errors.IsAlreadyExists(err) {
+				return ctrl.Result{}, false, err
+			}
+			done = true
+			logger.Info("defend scale change", utils.LogDeploymentResource, utils.GetResource(deployment), "from", scale.From, "to", scale.To)
+		}
+	}
+	setDefendedReplicas(deployment)
+	// HPA自动扩缩容不会放宽已经校验过的上限，上限只在没有基线或者防御扩容时跟随HPA
+	// autoscaling never widens the defended bounds, they only follow the HPA without a baseline or on a defended scale change
+	if !autoscaling {
+		setDefendedAutoscalerMaxReplicas(deployment, autoscaler)
+	}
+	if err := r.Patch(ctx, deployment, patch); err != nil {
+		logger.Error(err, "patch deployment defended replicas error", utils.LogDeploymentResource, utils.GetResource(deployment))
+		return ctrl.Result{}, false, err
+	}
+	if autoscaling {
+		logger.Info("follow autoscaling", utils.LogDeploymentResource, utils.GetResource(deployment), "from", defendedReplicas, "to", replicas)
+	}
+	return ctrl.Result{}, done, nil
+}
+
+// getHorizontalPodAutoscaler 获取扩缩容目标为该deployment的HPA，没有时返回nil
+// getHorizontalPodAutoscaler gets the HPA scaling the deployment, it is nil when there is none
+func (r *DeploymentReconciler) getHorizontalPodAutoscaler(ctx context.Context, deployment *v1.Deployment) (*autoscalingv2.HorizontalPodAutoscaler, error) {
+	autoscalerList := &autoscalingv2.HorizontalPodAutoscalerList{}
+	if err := r.List(ctx, autoscalerList, client.InNamespace(deployment.Namespace)); err != nil {
+		return nil, err
+	}
+	for i, autoscaler := range autoscalerList.Items {
+		if autoscaler.Spec.ScaleTargetRef.Kind == native.DeploymentKind && autoscaler.Spec.ScaleTargetRef.Name == deployment.Name {
+			return &autoscalerList.Items[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// isAutoscaling 副本数是否在HPA已经校验过的上下限内，上限取HPA当前上限和已经校验过的上限中较小的一个，还没有校验过上限时取副本数基线，
+// 手动修改副本数或者放宽HPA上限后超出的部分按照扩容防御
+// isAutoscaling reports whether the replicas are within the bounds of the HPA defended so far, the upper bound is the
+// smaller of the current one of the HPA and the defended one, which is the replicas baseline before any bound is
+// defended, a manual change of the replicas or the part beyond a widened HPA bound is defended as a scale change
+func isAutoscaling(deployment *v1.Deployment, autoscaler *autoscalingv2.HorizontalPodAutoscaler, defendedReplicas int32, replicas int32) bool {
+	if autoscaler == nil {
+		return false
+	}
+	minReplicas := int32(utils.NumberOne)
+	if autoscaler.Spec.MinReplicas != nil {
+		minReplicas = *autoscaler.Spec.MinReplicas
+	}
+	defendedMax := defendedReplicas
+	if defended, err := strconv.ParseInt(deployment.Annotations[utils.DefendedAutoscalerMaxReplicasAnnotation], utils.NumberTen, 32); err == nil {
+		defendedMax = int32(defended)
+	}
+	maxReplicas := autoscaler.Spec.MaxReplicas
+	if defendedMax < maxReplicas {
+		maxReplicas = defendedMax
+	}
+	return replicas >= minReplicas && replicas <= maxReplicas
+}
+
+// isChangeWorkloadOver 变更是否已经结束，排队、运行、暂停或者超时的变更还没有结束
+// isChangeWorkloadOver reports whether the change is over, a queued, running, suspended or timed out one is not
+func isChangeWorkloadOver(workload *v1alpha1.ChangeWorkload) bool {
+	switch workload.Status.Status {
+	case v1alpha1.Init, v1alpha1.Queued, v1alpha1.Running, v1alpha1.Suspend, v1alpha1.TimeOutPreThreshold:
+		return false
+	}
+	return true
+}
+
+// getCheckedReplicas 变更校验通过的副本数，扩容的ChangeWorkload加上扩容前的副本数
+// getCheckedReplicas the replicas the change passed, plus the replicas before the scale-up for a scale-up ChangeWorkload
+func getCheckedReplicas(workload *v1alpha1.ChangeWorkload) int32 {
+	checked := int32(len(workload.Status.DefenseCheckPassPods))
+	if workload.Spec.Scale != nil {
+		checked += workload.Spec.Scale.From
+	}
+	return checked
+}
+
+// setDefendedAutoscalerMaxReplicas 记录HPA当前的上限作为已经校验过的上限，没有HPA时去掉记录
+// setDefendedAutoscalerMaxReplicas records the current upper bound of the HPA as the defended one, the record is dropped without an HPA
+func setDefendedAutoscalerMaxReplicas(deployment *v1.Deployment, autoscaler *autoscalingv2.HorizontalPodAutoscaler) {
+	if autoscaler == nil {
+		delete(deployment.Annotations, utils.DefendedAutoscalerMaxReplicasAnnotation)
+		return
+	}
+	if deployment.Annotations == nil {
+		deployment.Annotations = make(map[string]string)
+	}
+	deployment.Annotations[utils.DefendedAutoscalerMaxReplicasAnnotation] = strconv.Itoa(int(autoscaler.Spec.MaxReplicas))
+}
+
+// setDefendedReplicas 把当前副本数记录为扩容的基线
+// setDefendedReplicas records the current replicas as the baseline of the scale-ups
+func setDefendedReplicas(deployment *v1.Deployment) {
+	if deployment.Spec.Replicas == nil {
+		return
+	}
+	if deployment.Annotations == nil {
+		deployment.Annotations = make(map[string]string)
+	}
+	deployment.Annotations[utils.DefendedReplicasAnnotation] = strconv.Itoa(int(*deployment.Spec.Replicas))
+}
+
+// isReplicasChanged deployment的副本数是否变化
+// isReplicasChanged reports whether the replicas of the deployment changed
+func isReplicasChanged(oldObject client.Object, newObject client.Object) bool {
+	oldDeployment, ok := oldObject.(*v1.Deployment)
+	if !ok {
+		return false
+	}
+	newDeployment, ok := newObject.(*v1.Deployment)
+	if !ok {
+		return false
+	}
+	return !reflect.DeepEqual(oldDeployment.Spec.Replicas, newDeployment.Spec.Replicas)
+}
+
 // isAdmissionWebhook 当前pod是否是admission-webhook管理的
 // isAdmissionWebhook is admission webhook
 func isAdmissionWebhook(labels map[string]string) bool {
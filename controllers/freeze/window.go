@@ -0,0 +1,210 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package freeze
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/apis/app.ops.cloud.alipay.com/v1alpha1"
+)
+
+// maxScheduleSteps 计算cron冻结时间段时最多遍历的开始时间，防止持续时间远大于间隔的表达式遍历过久
+// maxScheduleSteps the most starts of a cron range walked through, it bounds the schedules firing far more often than
+// their duration
+const maxScheduleSteps = 10000
+
+// Target 判断是否被冻结的工作负载
+// Target the workload checked against the freeze windows
+type Target struct {
+	Namespace       string
+	Name            string
+	Labels          map[string]string
+	NamespaceLabels map[string]string
+}
+
+// State 冻结窗口在某个时间的状态
+// State the state of a freeze window at a point of time
+type State struct {
+	Active      bool
+	ActiveStart time.Time
+	ActiveEnd   time.Time
+	// NextStart 之后最近一次冻结开始的时间，没有时为零值
+	// NextStart the closest start of a range after the point of time, it is zero without one
+	NextStart time.Time
+}
+
+// Evaluate 计算窗口在now的状态，窗口生效时ActiveStart和ActiveEnd覆盖所有生效中的时间段
+// Evaluate computes the state of the window at now, ActiveStart and ActiveEnd span every range in effect while it is active
+func Evaluate(spec *v1alpha1.ChangeFreezeWindowSpec, now time.Time) (State, error) {
+	state := State{}
+	location, err := getLocation(spec.TimeZone)
+	if err != nil {
+		return state, err
+	}
+	for i, freezeRange := range spec.Ranges {
+		start, end, next, err := evaluateRange(freezeRange, location, now)
+		if err != nil {
+			return state, fmt.Errorf("range %d: %w", i, err)
+		}
+		if !start.IsZero() {
+			if !state.Active || start.Before(state.ActiveStart) {
+				state.ActiveStart = start
+			}
+			if !state.Active || end.After(state.ActiveEnd) {
+				state.ActiveEnd = end
+			}
+			state.Active = true
+		}
+		if !next.IsZero() && (state.NextStart.IsZero() || next.Before(state.NextStart)) {
+			state.NextStart = next
+		}
+	}
+	return state, nil
+}
+
+// StatusAt 窗口在now的状态，窗口无效时不生效并在Message中记录原因
+// StatusAt the status of the window at now, an invalid window is not active and the Message tells why
+func StatusAt(spec *v1alpha1.ChangeFreezeWindowSpec, now time.Time) v1alpha1.ChangeFreezeWindowStatus {
+	status := v1alpha1.ChangeFreezeWindowStatus{}
+	state, err := Evaluate(spec, now)
+	if err != nil {
+		status.Message = err.Error()
+		return status
+	}
+	status.Active = state.Active
+	if state.Active {
+		status.ActiveStart = &metav1.Time{Time: state.ActiveStart}
+		status.ActiveEnd = &metav1.Time{Time: state.ActiveEnd}
+	}
+	if !state.NextStart.IsZero() {
+		status.NextStart = &metav1.Time{Time: state.NextStart}
+	}
+	return status
+}
+
+// Selects 窗口是否冻结目标工作负载，目标需要满足选择器并且不在豁免中
+// Selects reports whether the window freezes the target, the target has to meet the selectors and not be exempt
+func Selects(spec *v1alpha1.ChangeFreezeWindowSpec, target Target) (bool, error) {
+	if ok, err := matches(spec.NamespaceSelector, target.NamespaceLabels); err != nil || !ok {
+		return false, err
+	}
+	if ok, err := matches(spec.Selector, target.Labels); err != nil || !ok {
+		return false, err
+	}
+	for _, exemption := range spec.Exemptions {
+		if exemption.Namespace != "" && exemption.Namespace != target.Namespace {
+			continue
+		}
+		if exemption.Name != "" && exemption.Name != target.Name {
+			continue
+		}
+		exempt, err := matches(exemption.Selector, target.Labels)
+		if err != nil {
+			return false, err
+		}
+		if exempt {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// evaluateRange 计算一个时间段在now的开始和结束时间，没有生效时返回零值，以及之后最近一次开始的时间
+// evaluateRange computes the start and the end of a range in effect at now, they are zero when it is not, and the closest
+// start after now
+func evaluateRange(freezeRange v1alpha1.FreezeRange, location *time.Location, now time.Time) (start time.Time, end time.Time, next time.Time, err error) {
+	if freezeRange.Schedule == "" {
+		if freezeRange.Start == nil || freezeRange.End == nil {
+			return start, end, next, fmt.Errorf("either a schedule with a duration or a start and an end is required")
+		}
+		if !freezeRange.End.After(freezeRange.Start.Time) {
+			return start, end, next, fmt.Errorf("end %s is not after start %s", freezeRange.End, freezeRange.Start)
+		}
+		if now.Before(freezeRange.Start.Time) {
+			return start, end, freezeRange.Start.Time, nil
+		}
+		if now.Before(freezeRange.End.Time) {
+			return freezeRange.Start.Time, freezeRange.End.Time, next, nil
+		}
+		return start, end, next, nil
+	}
+	if freezeRange.Duration == nil || freezeRange.Duration.Duration <= 0 {
+		return start, end, next, fmt.Errorf("schedule %q requires a positive duration", freezeRange.Schedule)
+	}
+	duration := freezeRange.Duration.Duration
+	schedule, err := parseSchedule(freezeRange.Schedule, location)
+	if err != nil {
+		return start, end, next, err
+	}
+	// 从now往前一个持续时间开始遍历，开始时间不晚于now的都覆盖now，之后开始在结束前的延长冻结
+	// walk from a duration before now, the starts no later than now cover it and the later ones before the end extend it
+	t := schedule.Next(now.Add(-duration))
+	for steps := 0; !t.IsZero() && steps < maxScheduleSteps; steps++ {
+		if t.After(now) && (start.IsZero() || !t.Before(end)) {
+			break
+		}
+		if start.IsZero() {
+			start = t
+		}
+		end = t.Add(duration)
+		t = schedule.Next(t)
+	}
+	return start, end, t, nil
+}
+
+// parseSchedule 解析标准的5段cron表达式，表达式没有指定时区时使用窗口的时区
+// parseSchedule parses a standard 5 field cron schedule, it takes the time zone of the window unless the schedule sets one
+func parseSchedule(spec string, location *time.Location) (cron.Schedule, error) {
+	if !strings.HasPrefix(spec, "TZ=") && !strings.HasPrefix(spec, "CRON_TZ=") {
+		spec = fmt.Sprintf("CRON_TZ=%s %s", location.String(), spec)
+	}
+	schedule, err := cron.ParseStandard(spec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schedule %q: %w", spec, err)
+	}
+	return schedule, nil
+}
+
+func getLocation(timeZone string) (*time.Location, error) {
+	if timeZone == "" {
+		return time.UTC, nil
+	}
+	location, err := time.LoadLocation(timeZone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid time zone %q: %w", timeZone, err)
+	}
+	return location, nil
+}
+
+// matches 没有选择器时选中全部
+// matches a missing selector selects everything
+func matches(selector *metav1.LabelSelector, set map[string]string) (bool, error) {
+	if selector == nil {
+		return true, nil
+	}
+	labelSelector, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		return false, err
+	}
+	return labelSelector.Matches(labels.Set(set)), nil
+}
@@ -0,0 +1,136 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package freeze
+
+import (
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/apis/app.ops.cloud.alipay.com/v1alpha1"
+)
+
+func parseTime(t *testing.T, value string) time.Time {
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parsed
+}
+
+func TestEvaluateAbsoluteRange(t *testing.T) {
+	start := metav1.NewTime(parseTime(t, "2026-11-11T00:00:00Z"))
+	end := metav1.NewTime(parseTime(t, "2026-11-12T00:00:00Z"))
+	spec := &v1alpha1.ChangeFreezeWindowSpec{Ranges: []v1alpha1.FreezeRange{{Start: &start, End: &end}}}
+
+	state, err := Evaluate(spec, parseTime(t, "2026-11-10T12:00:00Z"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Active || !state.NextStart.Equal(start.Time) {
+		t.Fatalf("expected the range to start later, got %+v", state)
+	}
+	state, _ = Evaluate(spec, parseTime(t, "2026-11-11T12:00:00Z"))
+	if !state.Active || !state.ActiveStart.Equal(start.Time) || !state.ActiveEnd.Equal(end.Time) {
+		t.Fatalf("expected the range to be active, got %+v", state)
+	}
+	state, _ = Evaluate(spec, end.Time)
+	if state.Active || !state.NextStart.IsZero() {
+		t.Fatalf("expected the range to be over at its end, got %+v", state)
+	}
+}
+
+func TestEvaluateScheduledRange(t *testing.T) {
+	// every saturday for the whole weekend in Shanghai
+	spec := &v1alpha1.ChangeFreezeWindowSpec{
+		TimeZone: "Asia/Shanghai",
+		Ranges:   []v1alpha1.FreezeRange{{Schedule: "0 0 * * 6", Duration: &metav1.Duration{Duration: 48 * time.Hour}}},
+	}
+	// 2026-10-24 is a saturday, 00:00 in Shanghai is 16:00 UTC of the day before
+	state, err := Evaluate(spec, parseTime(t, "2026-10-23T15:59:00Z"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Active || !state.NextStart.Equal(parseTime(t, "2026-10-23T16:00:00Z")) {
+		t.Fatalf("expected the weekend to start later, got %+v", state)
+	}
+	state, _ = Evaluate(spec, parseTime(t, "2026-10-25T10:00:00Z"))
+	if !state.Active || !state.ActiveStart.Equal(parseTime(t, "2026-10-23T16:00:00Z")) ||
+		!state.ActiveEnd.Equal(parseTime(t, "2026-10-25T16:00:00Z")) {
+		t.Fatalf("expected the weekend to be active, got %+v", state)
+	}
+}
+
+func TestEvaluateOverlappingStarts(t *testing.T) {
+	// an hour long range starting every half an hour never ends
+	spec := &v1alpha1.ChangeFreezeWindowSpec{
+		Ranges: []v1alpha1.FreezeRange{{Schedule: "*/30 * * * *", Duration: &metav1.Duration{Duration: time.Hour}}},
+	}
+	state, err := Evaluate(spec, parseTime(t, "2026-10-19T10:10:00Z"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !state.Active || !state.ActiveStart.Equal(parseTime(t, "2026-10-19T09:30:00Z")) ||
+		!state.ActiveEnd.After(parseTime(t, "2026-10-20T00:00:00Z")) {
+		t.Fatalf("expected the starts to extend the range, got %+v", state)
+	}
+}
+
+func TestEvaluateInvalidRanges(t *testing.T) {
+	specs := []*v1alpha1.ChangeFreezeWindowSpec{
+		{Ranges: []v1alpha1.FreezeRange{{Schedule: "0 0 * * 6"}}},
+		{Ranges: []v1alpha1.FreezeRange{{Schedule: "not a schedule", Duration: &metav1.Duration{Duration: time.Hour}}}},
+		{Ranges: []v1alpha1.FreezeRange{{}}},
+		{TimeZone: "Nowhere/Land", Ranges: []v1alpha1.FreezeRange{}},
+	}
+	for i, spec := range specs {
+		if _, err := Evaluate(spec, time.Now()); err == nil {
+			t.Fatalf("expected spec %d to be rejected", i)
+		}
+	}
+}
+
+func TestSelects(t *testing.T) {
+	spec := &v1alpha1.ChangeFreezeWindowSpec{
+		NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"env": "prod"}},
+		Exemptions: []v1alpha1.FreezeExemption{
+			{Namespace: "infra"},
+			{Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"hotfix": "true"}}},
+		},
+	}
+	cases := []struct {
+		name     string
+		target   Target
+		selected bool
+	}{
+		{"prod", Target{Namespace: "shop", Name: "web", NamespaceLabels: map[string]string{"env": "prod"}}, true},
+		{"test namespace", Target{Namespace: "shop", Name: "web", NamespaceLabels: map[string]string{"env": "test"}}, false},
+		{"exempt namespace", Target{Namespace: "infra", Name: "dns", NamespaceLabels: map[string]string{"env": "prod"}}, false},
+		{"exempt labels", Target{Namespace: "shop", Name: "web", Labels: map[string]string{"hotfix": "true"},
+			NamespaceLabels: map[string]string{"env": "prod"}}, false},
+	}
+	for _, c := range cases {
+		selected, err := Selects(spec, c.target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if selected != c.selected {
+			t.Fatalf("%s: expected selected %v, got %v", c.name, c.selected, selected)
+		}
+	}
+}
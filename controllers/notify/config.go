@@ -0,0 +1,156 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package notify
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"text/template"
+
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// EventSuspend 变更校验失败，工作负载被暂停
+	// EventSuspend a change failed its checks and the workload is suspended
+	EventSuspend = "Suspend"
+	// EventSuccess 变更的所有pod校验通过
+	// EventSuccess every pod of a change passed its checks
+	EventSuccess = "Success"
+	// EventTimeout 变更等待pod超时
+	// EventTimeout a change timed out waiting for its pods
+	EventTimeout = "Timeout"
+	// EventOverride 用户手动绕过防御，例如恢复被暂停的工作负载或者在冻结窗口内强制更新
+	// EventOverride a user overrode the defense by hand, such as resuming a suspended workload or breaking the glass of a
+	// freeze window
+	EventOverride = "Override"
+)
+
+const (
+	// FormatJSON 通用的json，即Event本身
+	// FormatJSON the generic json, the Event itself
+	FormatJSON = "json"
+	// FormatDingTalk 钉钉机器人的markdown消息
+	// FormatDingTalk the markdown message of a DingTalk robot
+	FormatDingTalk = "dingtalk"
+	// FormatSlack Slack兼容的incoming webhook消息
+	// FormatSlack the Slack compatible incoming webhook message
+	FormatSlack = "slack"
+	// FormatTemplate 使用Go模板渲染Event得到请求体
+	// FormatTemplate the request body is rendered from the Event with a Go template
+	FormatTemplate = "template"
+)
+
+// Sink 一个接收通知的地址，namespaces和events为空时接收所有命名空间和所有类型的通知
+// Sink an endpoint receiving the notifications, it receives the notifications of every namespace and every type when
+// namespaces and events are empty
+type Sink struct {
+	Name          string            `json:"name"`
+	URL           string            `json:"url"`
+	Format        string            `json:"format"`
+	Template      string            `json:"template,omitempty"`
+	Headers       map[string]string `json:"headers,omitempty"`
+	Namespaces    []string          `json:"namespaces,omitempty"`
+	Events        []string          `json:"events,omitempty"`
+	MaxRetries    int               `json:"maxRetries,omitempty"`
+	RatePerMinute int               `json:"ratePerMinute,omitempty"`
+}
+
+// Config 通知的配置，保存在OpsConfigInfo的content中
+// Config the notification settings, they are kept in the content of an OpsConfigInfo
+type Config struct {
+	Sinks []Sink `json:"sinks"`
+}
+
+// DefaultConfig 默认没有通知地址
+// DefaultConfig no sinks by default
+var DefaultConfig = Config{Sinks: []Sink{}}
+
+// GetConfig 解析全局配置的通知地址，没有配置或者配置错误时不发送通知
+// GetConfig parses the notification sinks of the global config, nothing is notified without one or with a broken one
+func GetConfig(content string) Config {
+	if content == "" {
+		return DefaultConfig
+	}
+	config, err := ParseConfig(content)
+	if err != nil {
+		log.Log.WithName("notify").Error(err, "parse notification config error")
+		return DefaultConfig
+	}
+	return config
+}
+
+// ParseConfig parses and validates the json notification settings
+func ParseConfig(content string) (Config, error) {
+	config := Config{}
+	if err := json.Unmarshal([]byte(content), &config); err != nil {
+		return config, err
+	}
+	names := make(map[string]bool, len(config.Sinks))
+	for i := range config.Sinks {
+		sink := &config.Sinks[i]
+		if sink.Name == "" || names[sink.Name] {
+			return config, fmt.Errorf("the sink %d needs a unique name", i)
+		}
+		names[sink.Name] = true
+		if parsed, err := url.Parse(sink.URL); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+			return config, fmt.Errorf("the sink %s needs an http or https url", sink.Name)
+		}
+		if sink.Format == "" {
+			sink.Format = FormatJSON
+		}
+		switch sink.Format {
+		case FormatJSON, FormatDingTalk, FormatSlack:
+		case FormatTemplate:
+			if _, err := template.New(sink.Name).Parse(sink.Template); err != nil {
+				return config, fmt.Errorf("the template of the sink %s is invalid: %v", sink.Name, err)
+			}
+		default:
+			return config, fmt.Errorf("the sink %s has an unknown format %q", sink.Name, sink.Format)
+		}
+		for _, event := range sink.Events {
+			if event != EventSuspend && event != EventSuccess && event != EventTimeout && event != EventOverride {
+				return config, fmt.Errorf("the sink %s has an unknown event %q", sink.Name, event)
+			}
+		}
+		if sink.MaxRetries < 0 || sink.RatePerMinute < 0 {
+			return config, fmt.Errorf("the retries and the rate of the sink %s can't be negative", sink.Name)
+		}
+	}
+	return config, nil
+}
+
+// Matches 通知是否需要发送到这个地址
+// Matches whether the event is routed to the sink
+func (s Sink) Matches(event Event) bool {
+	return contains(s.Namespaces, event.Namespace) && contains(s.Events, event.Type)
+}
+
+// contains 空列表包含任何值
+// contains an empty list contains everything
+func contains(values []string, value string) bool {
+	if len(values) == 0 {
+		return true
+	}
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,98 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Event 一条发送给通知地址的变更事件
+// Event a change event sent to the sinks
+type Event struct {
+	Type           string    `json:"type"`
+	Namespace      string    `json:"namespace"`
+	Kind           string    `json:"kind"`
+	Name           string    `json:"name"`
+	ChangeWorkload string    `json:"changeWorkload,omitempty"`
+	Revision       string    `json:"revision,omitempty"`
+	Message        string    `json:"message"`
+	FailedPods     []string  `json:"failedPods,omitempty"`
+	User           string    `json:"user,omitempty"`
+	Time           time.Time `json:"time"`
+}
+
+// Title 一行的摘要，例如"[AlterShield] Suspend: deployment default/app"
+// Title the one-line summary, e.g. "[AlterShield] Suspend: deployment default/app"
+func (e Event) Title() string {
+	return fmt.Sprintf("[AlterShield] %s: %s %s/%s", e.Type, e.Kind, e.Namespace, e.Name)
+}
+
+// Markdown 标题加上各项详情的markdown文本，bold是加粗的标记
+// Markdown the markdown text of the title and the details, bold is the bold marker
+func (e Event) Markdown(bold string) string {
+	lines := []string{bold + e.Title() + bold, "", e.Message}
+	if e.ChangeWorkload != "" {
+		lines = append(lines, fmt.Sprintf("- ChangeWorkload: %s", e.ChangeWorkload))
+	}
+	if e.Revision != "" {
+		lines = append(lines, fmt.Sprintf("- Revision: %s", e.Revision))
+	}
+	if len(e.FailedPods) > 0 {
+		lines = append(lines, fmt.Sprintf("- Failed pods: %s", strings.Join(e.FailedPods, ", ")))
+	}
+	if e.User != "" {
+		lines = append(lines, fmt.Sprintf("- User: %s", e.User))
+	}
+	lines = append(lines, fmt.Sprintf("- Time: %s", e.Time.UTC().Format(time.RFC3339)))
+	return strings.Join(lines, "\n")
+}
+
+// Format 按照通知地址的格式生成请求体
+// Format renders the request body in the format of the sink
+func Format(sink Sink, event Event) ([]byte, error) {
+	switch sink.Format {
+	case FormatDingTalk:
+		return json.Marshal(map[string]interface{}{
+			"msgtype": "markdown",
+			"markdown": map[string]string{
+				"title": event.Title(),
+				"text":  event.Markdown("**"),
+			},
+		})
+	case FormatSlack:
+		return json.Marshal(map[string]interface{}{
+			"text": event.Markdown("*"),
+		})
+	case FormatTemplate:
+		tmpl, err := template.New(sink.Name).Parse(sink.Template)
+		if err != nil {
+			return nil, err
+		}
+		buffer := &bytes.Buffer{}
+		if err := tmpl.Execute(buffer, event); err != nil {
+			return nil, err
+		}
+		return buffer.Bytes(), nil
+	default:
+		return json.Marshal(event)
+	}
+}
@@ -0,0 +1,168 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package notify
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// DefaultMaxRetries 没有配置重试次数时的重试次数
+	// DefaultMaxRetries the retries of a sink without its own setting
+	DefaultMaxRetries = 3
+	// DefaultRetryInterval 第一次重试前的等待时间，之后每次翻倍
+	// DefaultRetryInterval the wait before the first retry, it doubles for every next one
+	DefaultRetryInterval = time.Second
+	// DefaultTimeout 每次请求的超时时间
+	// DefaultTimeout the timeout of every request
+	DefaultTimeout = 10 * time.Second
+)
+
+// Notifier 把事件异步地发送到匹配的通知地址，失败时重试，超过频率限制的事件被丢弃
+// Notifier sends the events to the matching sinks in the background, a failed request is retried and the events over
+// the rate limit of a sink are dropped
+type Notifier struct {
+	Client        *http.Client
+	RetryInterval time.Duration
+
+	mu       sync.Mutex
+	limiters map[string]*limiter
+}
+
+type limiter struct {
+	ratePerMinute int
+	limiter       *rate.Limiter
+}
+
+// DefaultNotifier operator共用的Notifier
+// DefaultNotifier the Notifier shared by the operator
+var DefaultNotifier = NewNotifier()
+
+// NewNotifier returns a Notifier with the default client and retry interval
+func NewNotifier() *Notifier {
+	return &Notifier{
+		Client:        &http.Client{Timeout: DefaultTimeout},
+		RetryInterval: DefaultRetryInterval,
+		limiters:      make(map[string]*limiter),
+	}
+}
+
+// Notify 在后台把事件发送到所有匹配的通知地址，返回发送的地址个数
+// Notify sends the event to every matching sink in the background and returns how many sinks it is sent to
+func (n *Notifier) Notify(config Config, event Event) int {
+	logger := log.Log.WithName("notify")
+	sent := 0
+	for _, sink := range config.Sinks {
+		if !sink.Matches(event) {
+			continue
+		}
+		if !n.allow(sink) {
+			logger.Info("drop the notification over the rate limit", "sink", sink.Name, "type", event.Type,
+				"namespace", event.Namespace, "name", event.Name)
+			continue
+		}
+		sent++
+		go func(sink Sink) {
+			if err := n.Deliver(context.Background(), sink, event); err != nil {
+				logger.Error(err, "send notification error", "sink", sink.Name, "type", event.Type,
+					"namespace", event.Namespace, "name", event.Name)
+			}
+		}(sink)
+	}
+	return sent
+}
+
+// Deliver 把事件发送到通知地址，网络错误、429和5xx时按照递增的间隔重试
+// Deliver posts the event to the sink, it retries with a growing interval on network errors, 429 and 5xx
+func (n *Notifier) Deliver(ctx context.Context, sink Sink, event Event) error {
+	body, err := Format(sink, event)
+	if err != nil {
+		return err
+	}
+	retries := sink.MaxRetries
+	if retries == 0 {
+		retries = DefaultMaxRetries
+	}
+	interval := n.RetryInterval
+	for attempt := 0; ; attempt++ {
+		retryable, err := n.post(ctx, sink, body)
+		if err == nil || !retryable || attempt >= retries {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+		interval *= 2
+	}
+}
+
+// post 发送一次请求，返回失败时是否可以重试
+// post sends the request once and returns whether a failure can be retried
+func (n *Notifier) post(ctx context.Context, sink Sink, body []byte) (bool, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, sink.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	for key, value := range sink.Headers {
+		request.Header.Set(key, value)
+	}
+	response, err := n.Client.Do(request)
+	if err != nil {
+		return true, err
+	}
+	defer response.Body.Close()
+	_, _ = io.Copy(io.Discard, response.Body)
+	if response.StatusCode >= http.StatusOK && response.StatusCode < http.StatusMultipleChoices {
+		return false, nil
+	}
+	retryable := response.StatusCode == http.StatusTooManyRequests || response.StatusCode >= http.StatusInternalServerError
+	return retryable, fmt.Errorf("the sink %s responded %s", sink.Name, response.Status)
+}
+
+// allow 通知地址是否还有发送的额度，修改频率后重新计算
+// allow whether the sink has room for one more notification, the budget starts over when its rate changes
+func (n *Notifier) allow(sink Sink) bool {
+	if sink.RatePerMinute == 0 {
+		return true
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.limiters == nil {
+		n.limiters = make(map[string]*limiter)
+	}
+	current, ok := n.limiters[sink.Name]
+	if !ok || current.ratePerMinute != sink.RatePerMinute {
+		current = &limiter{
+			ratePerMinute: sink.RatePerMinute,
+			limiter:       rate.NewLimiter(rate.Limit(float64(sink.RatePerMinute)/time.Minute.Seconds()), sink.RatePerMinute),
+		}
+		n.limiters[sink.Name] = current
+	}
+	return current.limiter.Allow()
+}
@@ -0,0 +1,185 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseConfig(t *testing.T) {
+	config, err := ParseConfig(`{"sinks": [{"name": "oncall", "url": "http://example.com/hook", "events": ["Suspend"]}]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Sinks[0].Format != FormatJSON {
+		t.Fatalf("expected the json format by default, got %q", config.Sinks[0].Format)
+	}
+	for _, content := range []string{
+		`{"sinks": [{"name": "a", "url": "http://a"}, {"name": "a", "url": "http://b"}]}`,
+		`{"sinks": [{"name": "a", "url": "ftp://a"}]}`,
+		`{"sinks": [{"name": "a", "url": "http://a", "format": "xml"}]}`,
+		`{"sinks": [{"name": "a", "url": "http://a", "format": "template", "template": "{{.Name"}]}`,
+		`{"sinks": [{"name": "a", "url": "http://a", "events": ["Started"]}]}`,
+		`{"sinks": [{"name": "a", "url": "http://a", "ratePerMinute": -1}]}`,
+		`not json`,
+	} {
+		if _, err := ParseConfig(content); err == nil {
+			t.Fatalf("expected %s to be rejected", content)
+		}
+	}
+}
+
+func TestGetConfig(t *testing.T) {
+	if config := GetConfig(`{"sinks": [{"name": "oncall", "url": "http://example.com/hook"}]}`); len(config.Sinks) != 1 {
+		t.Fatalf("expected the configured sink, got %+v", config)
+	}
+	for _, content := range []string{"", "not json"} {
+		if config := GetConfig(content); len(config.Sinks) != 0 {
+			t.Fatalf("expected no sinks for %q, got %+v", content, config)
+		}
+	}
+}
+
+func TestSinkMatches(t *testing.T) {
+	sink := Sink{Namespaces: []string{"prod"}, Events: []string{EventSuspend, EventOverride}}
+	if !sink.Matches(Event{Type: EventSuspend, Namespace: "prod"}) {
+		t.Fatal("expected the suspension in prod to be routed")
+	}
+	if sink.Matches(Event{Type: EventSuccess, Namespace: "prod"}) || sink.Matches(Event{Type: EventSuspend, Namespace: "dev"}) {
+		t.Fatal("expected the other types and namespaces to be left out")
+	}
+	if !(Sink{}).Matches(Event{Type: EventTimeout, Namespace: "dev"}) {
+		t.Fatal("expected a sink without routes to receive everything")
+	}
+}
+
+func TestFormat(t *testing.T) {
+	event := Event{Type: EventSuspend, Namespace: "prod", Kind: "deployment", Name: "app", ChangeWorkload: "app-1",
+		Message: "the change app-1 is suspended", FailedPods: []string{"app-0"}, Time: time.Unix(0, 0)}
+
+	body, err := Format(Sink{Format: FormatJSON}, event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded := Event{}
+	if err := json.Unmarshal(body, &decoded); err != nil || decoded.ChangeWorkload != "app-1" {
+		t.Fatalf("expected the event itself, got %s", body)
+	}
+
+	body, err = Format(Sink{Format: FormatDingTalk}, event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dingTalk := struct {
+		MsgType  string `json:"msgtype"`
+		Markdown struct {
+			Title string `json:"title"`
+			Text  string `json:"text"`
+		} `json:"markdown"`
+	}{}
+	if err := json.Unmarshal(body, &dingTalk); err != nil || dingTalk.MsgType != "markdown" ||
+		dingTalk.Markdown.Title != "[AlterShield] Suspend: deployment prod/app" || !strings.Contains(dingTalk.Markdown.Text, "- Failed pods: app-0") {
+		t.Fatalf("unexpected DingTalk message %s", body)
+	}
+
+	body, err = Format(Sink{Format: FormatSlack}, event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(body), `"text":"*[AlterShield] Suspend: deployment prod/app*`) {
+		t.Fatalf("unexpected Slack message %s", body)
+	}
+
+	body, err = Format(Sink{Name: "custom", Format: FormatTemplate, Template: `{"alert": "{{.Type}} {{.Namespace}}/{{.Name}}"}`}, event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != `{"alert": "Suspend prod/app"}` {
+		t.Fatalf("unexpected templated message %s", body)
+	}
+}
+
+func TestDeliverRetries(t *testing.T) {
+	var mu sync.Mutex
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts++
+		if attempts < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		if r.Header.Get("X-Token") != "secret" || !strings.Contains(string(body), `"type":"Success"`) {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	notifier := NewNotifier()
+	notifier.RetryInterval = time.Millisecond
+	sink := Sink{Name: "oncall", URL: server.URL, Format: FormatJSON, Headers: map[string]string{"X-Token": "secret"}}
+	if err := notifier.Deliver(context.Background(), sink, Event{Type: EventSuccess}); err != nil {
+		t.Fatal(err)
+	}
+	if attempts != 3 {
+		t.Fatalf("expected 2 retries, got %d attempts", attempts)
+	}
+
+	sink.MaxRetries = 1
+	attempts = 0
+	if err := notifier.Deliver(context.Background(), sink, Event{Type: EventSuccess}); err == nil || attempts != 2 {
+		t.Fatalf("expected to give up after 1 retry, got %d attempts and %v", attempts, err)
+	}
+}
+
+func TestNotifyRateLimit(t *testing.T) {
+	received := make(chan struct{}, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- struct{}{}
+	}))
+	defer server.Close()
+
+	notifier := NewNotifier()
+	config := Config{Sinks: []Sink{
+		{Name: "limited", URL: server.URL, Format: FormatJSON, RatePerMinute: 2},
+		{Name: "other", URL: server.URL, Format: FormatJSON, Namespaces: []string{"other"}},
+	}}
+	sent := 0
+	for i := 0; i < 4; i++ {
+		sent += notifier.Notify(config, Event{Type: EventSuspend, Namespace: "prod"})
+	}
+	if sent != 2 {
+		t.Fatalf("expected the burst of 2 to be sent and the rest dropped, got %d", sent)
+	}
+	for i := 0; i < sent; i++ {
+		select {
+		case <-received:
+		case <-time.After(5 * time.Second):
+			t.Fatal("expected the notifications to be delivered")
+		}
+	}
+}
@@ -18,13 +18,24 @@ package controllers
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
 	"strconv"
 
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/audit"
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/checker"
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/concurrency"
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/notify"
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/revision"
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/scene"
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/suspend"
 	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/utils"
 
 	appv1alpha1 "gitlab.alipay-inc.com/common_release/altershieldoperator/apis/app.ops.cloud.alipay.com/v1alpha1"
@@ -62,16 +73,69 @@ func (r *OpsConfigInfoReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 		}
 		return ctrl.Result{}, nil
 	}
+	r.recordConfigAudit(ctx, opsConfigInfo)
 	// Determine the spec.type of ops ConfigInfo
 	switch opsConfigInfo.Spec.Type {
 	case utils.ConfigTypeIsBranch:
 		return r.configTypeIsBranchHandel(ctx, opsConfigInfo)
 	case utils.ConfigTypeIsBlockingUp:
 		return r.configTypeIsBlockingUpHandel(ctx, opsConfigInfo)
+	case utils.ConfigTypeIsDryRun:
+		return r.configTypeIsDryRunHandel(ctx, opsConfigInfo)
+	case utils.ConfigTypePrometheus:
+		return r.configTypePrometheusHandel(ctx, opsConfigInfo)
+	case utils.ConfigTypeLogPattern:
+		return r.configTypeLogPatternHandel(ctx, opsConfigInfo)
+	case utils.ConfigTypeRevisionHash:
+		return r.configTypeRevisionHashHandel(ctx, opsConfigInfo)
+	case utils.ConfigTypeSuspend:
+		return r.configTypeSuspendHandel(ctx, opsConfigInfo)
+	case utils.ConfigTypeConcurrency:
+		return r.configTypeConcurrencyHandel(ctx, opsConfigInfo)
+	case utils.ConfigTypeNotification:
+		return r.configTypeNotificationHandel(ctx, opsConfigInfo)
+	case utils.ConfigTypeChangeScene:
+		return r.configTypeChangeSceneHandel(ctx, opsConfigInfo)
 	}
 	return ctrl.Result{}, nil
 }
 
+// recordConfigAudit 为OpsConfigInfo的每一个版本写入审计记录，内容只记录哈希，避免把通知地址的凭据写进记录
+// recordConfigAudit writes an audit record for every generation of the OpsConfigInfo, only the hash of the content is
+// recorded so that the credentials of the notification sinks never end up in the records
+func (r *OpsConfigInfoReconciler) recordConfigAudit(ctx context.Context, opsConfigInfo *appv1alpha1.OpsConfigInfo) {
+	hashed := sha256.Sum256([]byte(opsConfigInfo.Spec.Content))
+	generation := strconv.FormatInt(opsConfigInfo.Generation, utils.NumberTen)
+	details := map[string]string{
+		"type":          opsConfigInfo.Spec.Type,
+		"enable":        strconv.FormatBool(opsConfigInfo.Spec.Enable),
+		"generation":    generation,
+		"contentSha256": hex.EncodeToString(hashed[:]),
+	}
+	// 最近一次修改配置的字段管理者，通常是kubectl或者发布平台
+	// the field manager that changed the config last, usually kubectl or the release platform
+	var latest *metav1.ManagedFieldsEntry
+	for i, entry := range opsConfigInfo.ManagedFields {
+		if entry.Subresource == "" && entry.Time != nil && (latest == nil || !entry.Time.Before(latest.Time)) {
+			latest = &opsConfigInfo.ManagedFields[i]
+		}
+	}
+	if latest != nil {
+		details["manager"] = latest.Manager
+	}
+	spec := appv1alpha1.AuditRecordSpec{
+		Action:  appv1alpha1.AuditConfigChange,
+		Kind:    "opsconfiginfo",
+		Name:    opsConfigInfo.Name,
+		Message: fmt.Sprintf("the config %s is enable=%t at the generation %s", opsConfigInfo.Name, opsConfigInfo.Spec.Enable, generation),
+		Details: details,
+	}
+	key := "opsconfiginfo/" + string(opsConfigInfo.UID) + "/" + generation
+	if err := audit.Record(ctx, r.Client, opsConfigInfo.Namespace, key, spec); err != nil {
+		log.FromContext(ctx).WithName("recordConfigAudit").Error(err, "write audit record error", "opsConfigInfo", opsConfigInfo.Name)
+	}
+}
+
 // SetupWithManager sets up the controller with the Manager.
 func (r *OpsConfigInfoReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
@@ -120,3 +184,177 @@ func (r *OpsConfigInfoReconciler) configTypeIsBlockingUpHandel(ctx context.Conte
 		return ctrl.Result{}, nil
 	}
 }
+
+func (r *OpsConfigInfoReconciler) configTypeIsDryRunHandel(ctx context.Context, opsConfigInfo *appv1alpha1.OpsConfigInfo) (ctrl.Result, error) {
+	// Determine if name is ConfigNameIsDryRun, and if not, delete it
+	if opsConfigInfo.Name != utils.ConfigNameIsDryRun {
+		if err := r.Delete(ctx, opsConfigInfo); err != nil {
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{}, nil
+	} else {
+		utils.ConfigIsDryRunChannel <- opsConfigInfo.Spec.Enable
+		return ctrl.Result{}, nil
+	}
+}
+
+func (r *OpsConfigInfoReconciler) configTypePrometheusHandel(ctx context.Context, opsConfigInfo *appv1alpha1.OpsConfigInfo) (ctrl.Result, error) {
+	// Determine if name is ConfigNamePrometheus, and if not, delete it
+	logger := log.FromContext(ctx)
+	if opsConfigInfo.Name != utils.ConfigNamePrometheus {
+		if err := r.Delete(ctx, opsConfigInfo); err != nil {
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{}, nil
+	} else if !opsConfigInfo.Spec.Enable {
+		utils.ConfigPrometheusChannel <- ""
+		return ctrl.Result{}, nil
+	} else {
+		// An invalid content disables the checker, the prometheus changePods then fail and follow their fail policy
+		if _, err := checker.ParsePrometheusConfig(opsConfigInfo.Spec.Content); err != nil {
+			logger.Error(err, "configTypePrometheusHandel parse content error")
+			utils.ConfigPrometheusChannel <- ""
+			return ctrl.Result{}, nil
+		}
+		utils.ConfigPrometheusChannel <- opsConfigInfo.Spec.Content
+		return ctrl.Result{}, nil
+	}
+}
+
+func (r *OpsConfigInfoReconciler) configTypeLogPatternHandel(ctx context.Context, opsConfigInfo *appv1alpha1.OpsConfigInfo) (ctrl.Result, error) {
+	// Determine if name is ConfigNameLogPattern, and if not, delete it
+	logger := log.FromContext(ctx)
+	if opsConfigInfo.Name != utils.ConfigNameLogPattern {
+		if err := r.Delete(ctx, opsConfigInfo); err != nil {
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{}, nil
+	} else if !opsConfigInfo.Spec.Enable {
+		utils.ConfigLogPatternChannel <- ""
+		return ctrl.Result{}, nil
+	} else {
+		// An invalid content disables the checker, the log pattern changePods then fail and follow their fail policy
+		if _, err := checker.ParseLogPatternConfig(opsConfigInfo.Spec.Content); err != nil {
+			logger.Error(err, "configTypeLogPatternHandel parse content error")
+			utils.ConfigLogPatternChannel <- ""
+			return ctrl.Result{}, nil
+		}
+		utils.ConfigLogPatternChannel <- opsConfigInfo.Spec.Content
+		return ctrl.Result{}, nil
+	}
+}
+
+func (r *OpsConfigInfoReconciler) configTypeRevisionHashHandel(ctx context.Context, opsConfigInfo *appv1alpha1.OpsConfigInfo) (ctrl.Result, error) {
+	// Determine if name is ConfigNameRevisionHash, and if not, delete it
+	logger := log.FromContext(ctx)
+	if opsConfigInfo.Name != utils.ConfigNameRevisionHash {
+		if err := r.Delete(ctx, opsConfigInfo); err != nil {
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{}, nil
+	} else if !opsConfigInfo.Spec.Enable {
+		utils.ConfigRevisionHashChannel <- ""
+		return ctrl.Result{}, nil
+	} else {
+		// An invalid content ignores nothing, the revision hash then covers the whole template
+		if _, err := revision.ParseConfig(opsConfigInfo.Spec.Content); err != nil {
+			logger.Error(err, "configTypeRevisionHashHandel parse content error")
+			utils.ConfigRevisionHashChannel <- ""
+			return ctrl.Result{}, nil
+		}
+		utils.ConfigRevisionHashChannel <- opsConfigInfo.Spec.Content
+		return ctrl.Result{}, nil
+	}
+}
+
+func (r *OpsConfigInfoReconciler) configTypeSuspendHandel(ctx context.Context, opsConfigInfo *appv1alpha1.OpsConfigInfo) (ctrl.Result, error) {
+	// Determine if name is ConfigNameSuspend, and if not, delete it
+	logger := log.FromContext(ctx)
+	if opsConfigInfo.Name != utils.ConfigNameSuspend {
+		if err := r.Delete(ctx, opsConfigInfo); err != nil {
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{}, nil
+	} else if !opsConfigInfo.Spec.Enable {
+		utils.ConfigSuspendChannel <- ""
+		return ctrl.Result{}, nil
+	} else {
+		// An invalid content falls back to the former semantics, every update of a suspended workload is denied
+		if _, err := suspend.ParsePolicy(opsConfigInfo.Spec.Content); err != nil {
+			logger.Error(err, "configTypeSuspendHandel parse content error")
+			utils.ConfigSuspendChannel <- ""
+			return ctrl.Result{}, nil
+		}
+		utils.ConfigSuspendChannel <- opsConfigInfo.Spec.Content
+		return ctrl.Result{}, nil
+	}
+}
+
+func (r *OpsConfigInfoReconciler) configTypeConcurrencyHandel(ctx context.Context, opsConfigInfo *appv1alpha1.OpsConfigInfo) (ctrl.Result, error) {
+	// Determine if name is ConfigNameConcurrency, and if not, delete it
+	logger := log.FromContext(ctx)
+	if opsConfigInfo.Name != utils.ConfigNameConcurrency {
+		if err := r.Delete(ctx, opsConfigInfo); err != nil {
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{}, nil
+	} else if !opsConfigInfo.Spec.Enable {
+		utils.ConfigConcurrencyChannel <- ""
+		return ctrl.Result{}, nil
+	} else {
+		// An invalid content leaves the running changes unlimited
+		if _, err := concurrency.ParseLimit(opsConfigInfo.Spec.Content); err != nil {
+			logger.Error(err, "configTypeConcurrencyHandel parse content error")
+			utils.ConfigConcurrencyChannel <- ""
+			return ctrl.Result{}, nil
+		}
+		utils.ConfigConcurrencyChannel <- opsConfigInfo.Spec.Content
+		return ctrl.Result{}, nil
+	}
+}
+
+func (r *OpsConfigInfoReconciler) configTypeNotificationHandel(ctx context.Context, opsConfigInfo *appv1alpha1.OpsConfigInfo) (ctrl.Result, error) {
+	// Determine if name is ConfigNameNotification, and if not, delete it
+	logger := log.FromContext(ctx)
+	if opsConfigInfo.Name != utils.ConfigNameNotification {
+		if err := r.Delete(ctx, opsConfigInfo); err != nil {
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{}, nil
+	} else if !opsConfigInfo.Spec.Enable {
+		utils.ConfigNotificationChannel <- ""
+		return ctrl.Result{}, nil
+	} else {
+		// An invalid content notifies nothing
+		if _, err := notify.ParseConfig(opsConfigInfo.Spec.Content); err != nil {
+			logger.Error(err, "configTypeNotificationHandel parse content error")
+			utils.ConfigNotificationChannel <- ""
+			return ctrl.Result{}, nil
+		}
+		utils.ConfigNotificationChannel <- opsConfigInfo.Spec.Content
+		return ctrl.Result{}, nil
+	}
+}
+
+func (r *OpsConfigInfoReconciler) configTypeChangeSceneHandel(ctx context.Context, opsConfigInfo *appv1alpha1.OpsConfigInfo) (ctrl.Result, error) {
+	// Determine if name is ConfigNameChangeScene, and if not, delete it
+	logger := log.FromContext(ctx)
+	if opsConfigInfo.Name != utils.ConfigNameChangeScene {
+		if err := r.Delete(ctx, opsConfigInfo); err != nil {
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{}, nil
+	} else if !opsConfigInfo.Spec.Enable {
+		utils.ConfigChangeSceneChannel <- ""
+		return ctrl.Result{}, nil
+	} else {
+		// An invalid content maps no namespace, the annotations, the namespace labels and the defaults still apply
+		if _, err := scene.ParseMapping(opsConfigInfo.Spec.Content); err != nil {
+			logger.Error(err, "configTypeChangeSceneHandel parse content error")
+			utils.ConfigChangeSceneChannel <- ""
+			return ctrl.Result{}, nil
+		}
+		utils.ConfigChangeSceneChannel <- opsConfigInfo.Spec.Content
+		return ctrl.Result{}, nil
+	}
+}
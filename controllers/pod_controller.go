@@ -64,12 +64,38 @@ func (r *PodReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.R
 	}
 
 	finished := isFinished(pod)
-	if finished {
+	if finished || !isReleased(pod) {
+		return ctrl.Result{}, nil
+	}
+	// 没有配置烘焙时长时pod运行后直接进入批次，获取owner失败时按照没有owner处理
+	// without a bake window the pod enters a batch as soon as it is running, the pod is treated as having no owner when
+	// the owner can't be read
+	owner, _ := getOwnerByPod(ctx, r.Client, pod)
+	window := getBakeWindow(ctx, r.Client, owner, pod.Namespace)
+	if window <= 0 {
+		return ctrl.Result{}, r.markAsFinished(ctx, pod)
+	}
+	// 没有ready的pod等待ready时的更新事件，ready后需要经过烘焙时长才能进入批次
+	// a pod that is not ready waits for the update event of its readiness, once ready it enters a batch after the bake window
+	if !isReady(pod) {
 		return ctrl.Result{}, nil
 	}
+	if wait := getBakeRemaining(pod, window); wait > 0 {
+		return ctrl.Result{RequeueAfter: wait}, nil
+	}
 	return ctrl.Result{}, r.markAsFinished(ctx, pod)
 }
 
+// getBakeRemaining 获取pod在烘焙时长内还需要保持ready的时长
+// getBakeRemaining gets how much longer the pod has to stay ready within the bake window
+func getBakeRemaining(pod *v1.Pod, window time.Duration) time.Duration {
+	readySince := getReadySince(pod)
+	if readySince.IsZero() {
+		return 0
+	}
+	return time.Until(readySince.Add(window))
+}
+
 // SetupWithManager sets up the controller with the Manager.
 func (r *PodReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
@@ -95,9 +121,13 @@ func (r *PodReconciler) handleUpdateEvent(e event.UpdateEvent) bool {
 	if finished {
 		return false
 	}
-	running := isRunning(newPod) && !isRunning(oldPod)
+	// 原地升级的pod一直是运行中，版本变化后等待升级完成
+	// a pod updated in place keeps running, it waits for the update to be done after its version changes
+	// 没有ready的pod在ready后重新处理
+	// a pod that was not ready is handled again once it gets ready
+	released := isReleased(newPod) && (!isRunning(oldPod) || isFinished(oldPod) || isInPlaceUpdating(oldPod) || !isReady(oldPod))
 	hasVersion := isHasVersion(newPod)
-	return running && hasVersion
+	return released && hasVersion
 }
 
 // handleCreateEvent handles the event of creating a new Pod
@@ -110,9 +140,9 @@ func (r *PodReconciler) handleCreateEvent(e event.CreateEvent) bool {
 	if finished {
 		return false
 	}
-	running := isRunning(pod)
+	released := isReleased(pod)
 	hasVersion := isHasVersion(pod)
-	return running && hasVersion
+	return released && hasVersion
 }
 
 // markAsFinished 给pod打上操作完成标签
@@ -120,6 +150,10 @@ func (r *PodReconciler) handleCreateEvent(e event.CreateEvent) bool {
 func (r *PodReconciler) markAsFinished(ctx context.Context, pod *v1.Pod) (err error) {
 	logger := log.FromContext(ctx).WithName("markAsFinished")
 	pod.Labels[utils.OperateFinishedLabel] = strconv.Itoa(int(time.Now().Unix()))
+	pod.Labels[utils.OperateFinishedVersionLabel] = pod.Labels[native.AdmissionWebhookVersionLabel]
+	// 原地升级的pod带着上一个版本的防御标签
+	// a pod updated in place carries the defense label of the previous version
+	delete(pod.Labels, utils.DefenseStatusLabel)
 	logger.Info("pod finished", utils.LogPodResource, utils.GetResource(pod))
 	if err = r.Update(ctx, pod); err != nil {
 		if utils.IsObjectModifiedErr(err) {
@@ -136,11 +170,54 @@ func isRunning(pod *v1.Pod) bool {
 	return pod.Status.Phase == v1.PodRunning
 }
 
-// isFinished 当前pod是否有操作完成标签
-// isFinished pod is finished label
+// isReleased pod是否运行中并且没有在原地升级
+// isReleased reports whether the pod is running and not being updated in place
+func isReleased(pod *v1.Pod) bool {
+	return isRunning(pod) && !isInPlaceUpdating(pod)
+}
+
+// isReady pod是否ready
+// isReady reports whether the pod is ready
+func isReady(pod *v1.Pod) bool {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == v1.PodReady {
+			return condition.Status == v1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// getReadySince pod最近一次变为ready的时间，没有记录时为零值
+// getReadySince the time the pod last got ready, it is zero when unknown
+func getReadySince(pod *v1.Pod) time.Time {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == v1.PodReady {
+			return condition.LastTransitionTime.Time
+		}
+	}
+	return time.Time{}
+}
+
+// isInPlaceUpdating pod是否正在被OpenKruise原地升级
+// isInPlaceUpdating reports whether the pod is being updated in place by OpenKruise
+func isInPlaceUpdating(pod *v1.Pod) bool {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == native.InPlaceUpdateReadyCondition {
+			return condition.Status != v1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// isFinished 当前pod是否有当前版本的操作完成标签，原地升级后版本变化的pod视为未完成，没有完成版本的pod按照原来的方式视为完成
+// isFinished pod is finished label of its current version, a pod whose version changed by an in-place update is not
+// finished, a pod without the finished version is finished as before
 func isFinished(pod *v1.Pod) bool {
-	_, finished := pod.Labels[utils.OperateFinishedLabel]
-	return finished
+	if _, finished := pod.Labels[utils.OperateFinishedLabel]; !finished {
+		return false
+	}
+	version, ok := pod.Labels[utils.OperateFinishedVersionLabel]
+	return !ok || version == pod.Labels[native.AdmissionWebhookVersionLabel]
 }
 
 // isHasVersion 当前pod是否已经打上版本标签
@@ -0,0 +1,41 @@
+package resource
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/apis/app.ops.cloud.alipay.com/v1alpha1"
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/utils"
+)
+
+type IAuditRecordFactory interface {
+	IFactory
+}
+
+type NativeAuditRecordFactory struct {
+	Key       string
+	Namespace string
+	Spec      v1alpha1.AuditRecordSpec
+}
+
+func (factory *NativeAuditRecordFactory) NewInstance() runtime.Object {
+	auditRecord := v1alpha1.AuditRecord{}
+	// 名称由记录键生成，同一个动作重复记录时创建会冲突
+	// the name is derived from the key so recording the same action again conflicts on create
+	hashed := sha256.Sum256([]byte(factory.Key))
+	auditRecord.Name = utils.AuditRecordNamePrefix + hex.EncodeToString(hashed[:])[:utils.AuditRecordNameHashLength]
+	auditRecord.Namespace = factory.Namespace
+	auditRecord.Labels = map[string]string{
+		utils.AuditActionLabel: factory.Spec.Action,
+		utils.AuditTargetLabel: factory.Spec.Name,
+	}
+	auditRecord.Spec = factory.Spec
+	if auditRecord.Spec.TimeUnix == 0 {
+		auditRecord.Spec.Time = utils.GetNowTime()
+		auditRecord.Spec.TimeUnix = time.Now().Unix()
+	}
+	return &auditRecord
+}
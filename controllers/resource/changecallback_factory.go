@@ -0,0 +1,41 @@
+package resource
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/apis/app.ops.cloud.alipay.com/v1alpha1"
+	opscloudclient "gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/client"
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/utils"
+)
+
+type IChangeCallbackFactory interface {
+	IFactory
+}
+
+type NativeChangeCallbackFactory struct {
+	RequestId string
+	Request   opscloudclient.OpsCloudChangeCheckCallbackRequest
+}
+
+func (factory *NativeChangeCallbackFactory) NewInstance() runtime.Object {
+	changeCallback := v1alpha1.ChangeCallback{}
+	// 名称由请求id生成，重复的回调创建时会冲突
+	// the name is derived from the request id so a duplicate callback conflicts on create
+	hashed := sha256.Sum256([]byte(factory.RequestId))
+	changeCallback.Name = utils.ChangeCallbackNamePrefix + hex.EncodeToString(hashed[:])[:utils.ChangeCallbackNameHashLength]
+	changeCallback.Namespace = utils.AlterShieldOperatorNamespace
+	changeCallback.Spec.RequestId = factory.RequestId
+	changeCallback.Spec.NodeId = factory.Request.NodeId
+	changeCallback.Spec.BizExecOrderId = factory.Request.BizExecOrderId
+	changeCallback.Spec.ChangeSceneKey = factory.Request.ChangeSceneKey
+	changeCallback.Spec.DefenseStage = factory.Request.DefenseStageEnum
+	changeCallback.Spec.Verdict = factory.Request.Verdict.Verdict
+	changeCallback.Spec.Msg = factory.Request.Verdict.Msg
+	changeCallback.Spec.ReceiveTime = utils.GetNowTime()
+	changeCallback.Spec.ReceiveTimeUnix = time.Now().Unix()
+	return &changeCallback
+}
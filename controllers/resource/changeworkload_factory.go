@@ -4,9 +4,12 @@ import (
 	"time"
 
 	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 
 	"gitlab.alipay-inc.com/common_release/altershieldoperator/apis/app.ops.cloud.alipay.com/v1alpha1"
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/dependency"
 	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/utils"
 	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/utils/native"
 )
@@ -18,17 +21,78 @@ type IChangeWorkloadFactory interface {
 type NativeChangeWorkloadFactory struct {
 	Deployment *appsv1.Deployment
 	Replicas   *int32
+	Scale      *v1alpha1.ScaleChange
+	Config     *v1alpha1.ConfigChange
 }
 
 func (factory *NativeChangeWorkloadFactory) NewInstance() runtime.Object {
+	workload := newChangeWorkload(factory.Deployment, *factory.Replicas)
+	workload.Spec.Scale = factory.Scale
+	workload.Spec.Config = factory.Config
+	return workload
+}
+
+// RolloutChangeWorkloadFactory Argo Rollout的ChangeWorkload，按照canary步骤划分批次
+// RolloutChangeWorkloadFactory the ChangeWorkload of an Argo Rollout, the batches follow the canary steps
+type RolloutChangeWorkloadFactory struct {
+	Rollout *unstructured.Unstructured
+}
+
+func (factory *RolloutChangeWorkloadFactory) NewInstance() runtime.Object {
+	workload := newChangeWorkload(factory.Rollout, native.GetRolloutReplicas(factory.Rollout))
+	workload.Spec.Batches = native.GetRolloutBatches(factory.Rollout)
+	if len(workload.Spec.Batches) > 0 {
+		workload.Spec.CountThreshold = int(workload.Spec.Batches[0])
+	}
+	return workload
+}
+
+// CloneSetChangeWorkloadFactory OpenKruise CloneSet的updateRevision对应的ChangeWorkload，按照partition划分批次
+// CloneSetChangeWorkloadFactory the ChangeWorkload of the updateRevision of an OpenKruise CloneSet, the batches follow
+// the partition
+type CloneSetChangeWorkloadFactory struct {
+	CloneSet       *unstructured.Unstructured
+	UpdateRevision string
+}
+
+func (factory *CloneSetChangeWorkloadFactory) NewInstance() runtime.Object {
+	workload := newChangeWorkload(factory.CloneSet, native.GetCloneSetReplicas(factory.CloneSet))
+	workload.Spec.UpdateRevision = factory.UpdateRevision
+	workload.Spec.Batches = native.GetCloneSetBatches(factory.CloneSet)
+	if len(workload.Spec.Batches) > 0 {
+		workload.Spec.CountThreshold = int(workload.Spec.Batches[0])
+	}
+	return workload
+}
+
+// AdvancedStatefulSetChangeWorkloadFactory OpenKruise Advanced StatefulSet的updateRevision对应的ChangeWorkload，按照partition划分批次
+// AdvancedStatefulSetChangeWorkloadFactory the ChangeWorkload of the updateRevision of an OpenKruise Advanced StatefulSet,
+// the batches follow the partition
+type AdvancedStatefulSetChangeWorkloadFactory struct {
+	StatefulSet    *unstructured.Unstructured
+	UpdateRevision string
+}
+
+func (factory *AdvancedStatefulSetChangeWorkloadFactory) NewInstance() runtime.Object {
+	workload := newChangeWorkload(factory.StatefulSet, native.GetAdvancedStatefulSetReplicas(factory.StatefulSet))
+	workload.Spec.UpdateRevision = factory.UpdateRevision
+	workload.Spec.Batches = native.GetAdvancedStatefulSetBatches(factory.StatefulSet)
+	if len(workload.Spec.Batches) > 0 {
+		workload.Spec.CountThreshold = int(workload.Spec.Batches[0])
+	}
+	return workload
+}
+
+// newChangeWorkload 被防御的工作负载当前版本的ChangeWorkload
+// newChangeWorkload the ChangeWorkload of the current revision of the defended workload
+func newChangeWorkload(object metav1.Object, replicas int32) *v1alpha1.ChangeWorkload {
 	workload := v1alpha1.ChangeWorkload{}
-	workload.Name = native.GetChangeWorkloadNameByDeployment(factory.Deployment)
-	workload.Namespace = factory.Deployment.Namespace
+	workload.Name = native.GetChangeWorkloadName(object)
+	workload.Namespace = object.GetNamespace()
 	workload.Spec.ChangeWorkloadId = workload.Name
-	workload.Spec.ServiceName = factory.Deployment.Name
-	workload.Spec.Reversion = factory.Deployment.Labels[native.AdmissionWebhookVersionLabel]
+	workload.Spec.ServiceName = object.GetName()
+	workload.Spec.Reversion = object.GetLabels()[native.AdmissionWebhookVersionLabel]
 	if utils.ConfigIsBatch() {
-		replicas := *factory.Replicas
 		workload.Spec.CountThreshold = utils.Percent(int(replicas), utils.ConfigBatchCount())
 	} else {
 		workload.Spec.CountThreshold = utils.NumberOne
@@ -36,9 +100,12 @@ func (factory *NativeChangeWorkloadFactory) NewInstance() runtime.Object {
 	workload.Spec.WaitTimeThreshold = utils.ChangeWorkloadWaitTimeThreshold
 	workload.Spec.CreateTime = utils.GetNowTime()
 	workload.Spec.CreateTimeUnix = time.Now().Unix()
-	workload.Spec.AppName = factory.Deployment.Name
+	workload.Spec.AppName = object.GetName()
 	workload.Labels = make(map[string]string)
-	workload.Labels[native.DeploymentNameLabel] = factory.Deployment.Name
-	workload.Labels[native.AdmissionWebhookVersionLabel] = factory.Deployment.Labels[native.AdmissionWebhookVersionLabel]
+	workload.Labels[native.DeploymentNameLabel] = object.GetName()
+	workload.Labels[native.AdmissionWebhookVersionLabel] = object.GetLabels()[native.AdmissionWebhookVersionLabel]
+	// 非法的上游在webhook中被拒绝
+	// the invalid upstreams are denied by the webhook
+	workload.Spec.DependsOn, _ = dependency.ParseUpstreams(object.GetAnnotations()[utils.DependsOnAnnotation], object.GetNamespace())
 	return &workload
 }
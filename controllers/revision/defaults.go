@@ -0,0 +1,149 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package revision
+
+import (
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// defaultVolumeMode the default mode of the files projected from configMaps, secrets and the downward API
+const defaultVolumeMode int32 = 0644
+
+// setPodSpecDefaults 补齐apiserver为pod模板设置的默认值，显式填写默认值和不填写得到相同的版本
+// setPodSpecDefaults fills in the defaults the apiserver sets on a pod template, so a default written explicitly and a
+// missing one get the same revision
+func setPodSpecDefaults(spec *v1.PodSpec) {
+	if spec.RestartPolicy == "" {
+		spec.RestartPolicy = v1.RestartPolicyAlways
+	}
+	if spec.DNSPolicy == "" {
+		spec.DNSPolicy = v1.DNSClusterFirst
+	}
+	if spec.TerminationGracePeriodSeconds == nil {
+		spec.TerminationGracePeriodSeconds = int64Pointer(v1.DefaultTerminationGracePeriodSeconds)
+	}
+	if spec.SchedulerName == "" {
+		spec.SchedulerName = v1.DefaultSchedulerName
+	}
+	if spec.EnableServiceLinks == nil {
+		enableServiceLinks := v1.DefaultEnableServiceLinks
+		spec.EnableServiceLinks = &enableServiceLinks
+	}
+	for i := range spec.InitContainers {
+		setContainerDefaults(&spec.InitContainers[i])
+	}
+	for i := range spec.Containers {
+		setContainerDefaults(&spec.Containers[i])
+	}
+	for i := range spec.Volumes {
+		setVolumeDefaults(&spec.Volumes[i].VolumeSource)
+	}
+}
+
+func setContainerDefaults(container *v1.Container) {
+	if container.ImagePullPolicy == "" {
+		container.ImagePullPolicy = defaultImagePullPolicy(container.Image)
+	}
+	if container.TerminationMessagePath == "" {
+		container.TerminationMessagePath = v1.TerminationMessagePathDefault
+	}
+	if container.TerminationMessagePolicy == "" {
+		container.TerminationMessagePolicy = v1.TerminationMessageReadFile
+	}
+	for i := range container.Ports {
+		if container.Ports[i].Protocol == "" {
+			container.Ports[i].Protocol = v1.ProtocolTCP
+		}
+	}
+	for i := range container.Env {
+		if from := container.Env[i].ValueFrom; from != nil && from.FieldRef != nil && from.FieldRef.APIVersion == "" {
+			from.FieldRef.APIVersion = "v1"
+		}
+	}
+	for _, probe := range []*v1.Probe{container.LivenessProbe, container.ReadinessProbe, container.StartupProbe} {
+		setProbeDefaults(probe)
+	}
+}
+
+// defaultImagePullPolicy 镜像没有tag或者tag是latest时总是拉取，按digest引用的镜像不会变化
+// defaultImagePullPolicy an image without a tag or tagged latest is always pulled, an image referenced by digest never changes
+func defaultImagePullPolicy(image string) v1.PullPolicy {
+	if strings.Contains(image, "@") {
+		return v1.PullIfNotPresent
+	}
+	name := image[strings.LastIndex(image, "/")+1:]
+	if _, tag, ok := strings.Cut(name, ":"); ok && tag != "latest" {
+		return v1.PullIfNotPresent
+	}
+	return v1.PullAlways
+}
+
+func setProbeDefaults(probe *v1.Probe) {
+	if probe == nil {
+		return
+	}
+	if probe.TimeoutSeconds == 0 {
+		probe.TimeoutSeconds = 1
+	}
+	if probe.PeriodSeconds == 0 {
+		probe.PeriodSeconds = 10
+	}
+	if probe.SuccessThreshold == 0 {
+		probe.SuccessThreshold = 1
+	}
+	if probe.FailureThreshold == 0 {
+		probe.FailureThreshold = 3
+	}
+	if get := probe.HTTPGet; get != nil {
+		if get.Path == "" {
+			get.Path = "/"
+		}
+		if get.Scheme == "" {
+			get.Scheme = v1.URISchemeHTTP
+		}
+	}
+}
+
+func setVolumeDefaults(source *v1.VolumeSource) {
+	switch {
+	case source.ConfigMap != nil && source.ConfigMap.DefaultMode == nil:
+		source.ConfigMap.DefaultMode = int32Pointer(defaultVolumeMode)
+	case source.Secret != nil && source.Secret.DefaultMode == nil:
+		source.Secret.DefaultMode = int32Pointer(defaultVolumeMode)
+	case source.DownwardAPI != nil && source.DownwardAPI.DefaultMode == nil:
+		source.DownwardAPI.DefaultMode = int32Pointer(defaultVolumeMode)
+	case source.Projected != nil && source.Projected.DefaultMode == nil:
+		source.Projected.DefaultMode = int32Pointer(defaultVolumeMode)
+	}
+	if source.DownwardAPI != nil {
+		for i := range source.DownwardAPI.Items {
+			if ref := source.DownwardAPI.Items[i].FieldRef; ref != nil && ref.APIVersion == "" {
+				ref.APIVersion = "v1"
+			}
+		}
+	}
+}
+
+func int32Pointer(value int32) *int32 {
+	return &value
+}
+
+func int64Pointer(value int64) *int64 {
+	return &value
+}
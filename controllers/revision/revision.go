@@ -0,0 +1,257 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package revision
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// HashLength 版本hash的长度，label的取值最长63个字符，取SHA-256的前32个十六进制字符
+// HashLength the length of the revision hash, a label value is at most 63 characters so the first 32 hex characters of
+// the SHA-256 are kept
+const HashLength = 32
+
+// Config 计算版本hash时忽略的label、注解和容器，保存在OpsConfigInfo的content中
+// Config the labels, annotations and containers ignored by the revision hash, it is kept in the content of an OpsConfigInfo
+type Config struct {
+	// IgnoredLabels 忽略的pod模板label，例如其他控制器更新的label
+	// IgnoredLabels the ignored labels of the pod template, such as the ones bumped by other controllers
+	IgnoredLabels []string `json:"ignoredLabels"`
+	// IgnoredAnnotations 忽略的pod模板注解
+	// IgnoredAnnotations the ignored annotations of the pod template
+	IgnoredAnnotations []string `json:"ignoredAnnotations"`
+	// IgnoredContainers 忽略的容器名称，包括init容器，例如注入的sidecar
+	// IgnoredContainers the ignored container names including the init containers, such as the injected sidecars
+	IgnoredContainers []string `json:"ignoredContainers"`
+}
+
+// DefaultConfig 默认不忽略任何内容
+// DefaultConfig nothing is ignored by default
+var DefaultConfig = Config{
+	IgnoredLabels:      []string{},
+	IgnoredAnnotations: []string{},
+	IgnoredContainers:  []string{},
+}
+
+// ParseConfig parses the json config of the revision hash
+func ParseConfig(content string) (Config, error) {
+	config := Config{}
+	if err := json.Unmarshal([]byte(content), &config); err != nil {
+		return config, err
+	}
+	for _, keys := range [][]string{config.IgnoredLabels, config.IgnoredAnnotations, config.IgnoredContainers} {
+		for _, key := range keys {
+			if key == "" {
+				return config, fmt.Errorf("ignored keys and container names must not be empty")
+			}
+		}
+	}
+	return config, nil
+}
+
+// Hash 计算pod模板的版本hash，返回hash和参与计算的规范化内容。模板先去掉忽略的内容并补齐apiserver的默认值，再去掉空值并按照key排序，
+// 因此字段顺序、默认值是否显式填写以及空值和缺省的差异都不会产生新的版本
+// Hash computes the revision hash of the pod template and returns it with the canonical content it is computed over. The
+// ignored content is removed and the apiserver defaults are filled in first, then the empty values are dropped and the
+// keys are sorted, so neither the field order, explicit defaults nor empty versus missing values make a new revision
+func Hash(template v1.PodTemplateSpec, config Config) (string, []byte, error) {
+	inputs, err := Canonicalize(template, config)
+	if err != nil {
+		return "", nil, err
+	}
+	sum := sha256.Sum256(inputs)
+	return hex.EncodeToString(sum[:])[:HashLength], inputs, nil
+}
+
+// Canonicalize returns the canonical json of the pod template the revision hash is computed over
+func Canonicalize(template v1.PodTemplateSpec, config Config) ([]byte, error) {
+	// 只有label和注解会带到pod上，其他元数据不参与计算
+	// only the labels and annotations are carried to the pods, the other metadata is left out
+	canonical := v1.PodTemplateSpec{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels:      without(template.Labels, config.IgnoredLabels),
+			Annotations: without(template.Annotations, config.IgnoredAnnotations),
+		},
+		Spec: *template.Spec.DeepCopy(),
+	}
+	canonical.Spec.InitContainers = withoutContainers(canonical.Spec.InitContainers, config.IgnoredContainers)
+	canonical.Spec.Containers = withoutContainers(canonical.Spec.Containers, config.IgnoredContainers)
+	setPodSpecDefaults(&canonical.Spec)
+
+	raw, err := json.Marshal(canonical)
+	if err != nil {
+		return nil, err
+	}
+	var value interface{}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	// 保持数字的原始写法，避免大整数精度丢失
+	// keep the numbers as written so large integers don't lose precision
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	// encoding/json按照key排序输出map
+	// encoding/json writes the maps sorted by key
+	return json.Marshal(prune(value))
+}
+
+// prune 递归去掉null、空字符串、空对象和空数组
+// prune drops the nulls, empty strings, empty objects and empty arrays recursively
+func prune(value interface{}) interface{} {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		for key, item := range typed {
+			if item = prune(item); isEmpty(item) {
+				delete(typed, key)
+			} else {
+				typed[key] = item
+			}
+		}
+		return typed
+	case []interface{}:
+		for i, item := range typed {
+			typed[i] = prune(item)
+		}
+		return typed
+	default:
+		return value
+	}
+}
+
+func isEmpty(value interface{}) bool {
+	switch typed := value.(type) {
+	case nil:
+		return true
+	case string:
+		return typed == ""
+	case map[string]interface{}:
+		return len(typed) == 0
+	case []interface{}:
+		return len(typed) == 0
+	default:
+		return false
+	}
+}
+
+func without(values map[string]string, ignored []string) map[string]string {
+	result := make(map[string]string, len(values))
+	for key, value := range values {
+		result[key] = value
+	}
+	for _, key := range ignored {
+		delete(result, key)
+	}
+	return result
+}
+
+func withoutContainers(containers []v1.Container, ignored []string) []v1.Container {
+	ignoredNames := make(map[string]bool, len(ignored))
+	for _, name := range ignored {
+		ignoredNames[name] = true
+	}
+	result := make([]v1.Container, 0, len(containers))
+	for _, container := range containers {
+		if !ignoredNames[container.Name] {
+			result = append(result, container)
+		}
+	}
+	return result
+}
+
+// MaxSummaryFields 版本摘要最多记录的字段数，超出的只记录个数，避免注解过大
+// MaxSummaryFields the most fields kept in a revision summary, only the number of the others is kept so the annotation
+// stays small
+const MaxSummaryFields = 64
+
+// fieldHashLength 摘要中每个字段取值的hash长度
+// fieldHashLength the length of the hash of every field value in a summary
+const fieldHashLength = 8
+
+// Summary 版本hash的摘要，只记录参与计算的字段路径和取值的hash，不记录取值本身，例如环境变量中的密钥
+// Summary the summary of a revision hash, it only keeps the paths of the fields the hash is computed over with the hashes
+// of their values, never the values themselves such as the credentials in the environment variables
+type Summary struct {
+	// Hash 版本hash
+	// Hash the revision hash
+	Hash string `json:"hash"`
+	// Fields 按路径排序的字段，格式为path=hash，对比两个版本的摘要可以看出哪些字段产生了新的版本
+	// Fields the fields sorted by path as path=hash, comparing the summaries of two revisions tells the fields that made
+	// the new one
+	Fields []string `json:"fields"`
+	// Truncated 超出MaxSummaryFields没有记录的字段数
+	// Truncated the number of the fields beyond MaxSummaryFields that are left out
+	Truncated int `json:"truncated,omitempty"`
+}
+
+// Summarize 根据Hash返回的规范化内容生成版本摘要的json
+// Summarize returns the json summary of a revision from the canonical content returned by Hash
+func Summarize(hash string, inputs []byte) (string, error) {
+	var value interface{}
+	decoder := json.NewDecoder(bytes.NewReader(inputs))
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err != nil {
+		return "", err
+	}
+	fields := make([]string, 0)
+	flatten("", value, &fields)
+	sort.Strings(fields)
+	summary := Summary{Hash: hash, Fields: fields}
+	if len(fields) > MaxSummaryFields {
+		summary.Fields = fields[:MaxSummaryFields]
+		summary.Truncated = len(fields) - MaxSummaryFields
+	}
+	raw, err := json.Marshal(summary)
+	if err != nil {
+		return "", err
+	}
+	return string(raw), nil
+}
+
+// flatten 把规范化内容展开为叶子字段的path=hash
+// flatten expands the canonical content into path=hash of the leaf fields
+func flatten(path string, value interface{}, fields *[]string) {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		for key, item := range typed {
+			flatten(joinPath(path, key), item, fields)
+		}
+	case []interface{}:
+		for i, item := range typed {
+			flatten(joinPath(path, strconv.Itoa(i)), item, fields)
+		}
+	default:
+		raw, _ := json.Marshal(typed)
+		sum := sha256.Sum256(raw)
+		*fields = append(*fields, path+"="+hex.EncodeToString(sum[:])[:fieldHashLength])
+	}
+}
+
+func joinPath(path string, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
@@ -0,0 +1,238 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package revision
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newTemplate() v1.PodTemplateSpec {
+	return v1.PodTemplateSpec{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels:      map[string]string{"app": "demo"},
+			Annotations: map[string]string{"example.com/owner": "team"},
+		},
+		Spec: v1.PodSpec{
+			Containers: []v1.Container{{
+				Name:           "app",
+				Image:          "nginx:1.23",
+				Ports:          []v1.ContainerPort{{ContainerPort: 80}},
+				ReadinessProbe: &v1.Probe{ProbeHandler: v1.ProbeHandler{HTTPGet: &v1.HTTPGetAction{}}},
+			}},
+			Volumes: []v1.Volume{{Name: "config", VolumeSource: v1.VolumeSource{
+				ConfigMap: &v1.ConfigMapVolumeSource{LocalObjectReference: v1.LocalObjectReference{Name: "config"}},
+			}}},
+		},
+	}
+}
+
+func mustHash(t *testing.T, template v1.PodTemplateSpec, config Config) string {
+	hash, _, err := Hash(template, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hash) != HashLength {
+		t.Fatalf("expected a hash of %d characters, got %q", HashLength, hash)
+	}
+	return hash
+}
+
+func TestHashEqual(t *testing.T) {
+	config := Config{
+		IgnoredLabels:      []string{"example.com/bumped"},
+		IgnoredAnnotations: []string{"example.com/restarted"},
+		IgnoredContainers:  []string{"sidecar"},
+	}
+	tests := []struct {
+		name   string
+		mutate func(template *v1.PodTemplateSpec)
+	}{
+		{name: "explicit defaults", mutate: func(template *v1.PodTemplateSpec) {
+			grace := int64(30)
+			template.Spec.RestartPolicy = v1.RestartPolicyAlways
+			template.Spec.TerminationGracePeriodSeconds = &grace
+			container := &template.Spec.Containers[0]
+			container.ImagePullPolicy = v1.PullIfNotPresent
+			container.TerminationMessagePath = v1.TerminationMessagePathDefault
+			container.Ports[0].Protocol = v1.ProtocolTCP
+			container.ReadinessProbe.PeriodSeconds = 10
+			container.ReadinessProbe.HTTPGet.Scheme = v1.URISchemeHTTP
+			mode := int32(0644)
+			template.Spec.Volumes[0].ConfigMap.DefaultMode = &mode
+		}},
+		{name: "empty versus missing", mutate: func(template *v1.PodTemplateSpec) {
+			template.Spec.Containers[0].Env = []v1.EnvVar{}
+			template.Spec.NodeSelector = map[string]string{}
+			template.Spec.Containers[0].Resources.Limits = v1.ResourceList{}
+		}},
+		{name: "ignored label", mutate: func(template *v1.PodTemplateSpec) {
+			template.Labels["example.com/bumped"] = "2"
+		}},
+		{name: "ignored annotation", mutate: func(template *v1.PodTemplateSpec) {
+			template.Annotations["example.com/restarted"] = "now"
+		}},
+		{name: "ignored sidecar", mutate: func(template *v1.PodTemplateSpec) {
+			template.Spec.Containers = append(template.Spec.Containers, v1.Container{Name: "sidecar", Image: "proxy:1"})
+			template.Spec.InitContainers = []v1.Container{{Name: "sidecar", Image: "proxy-init:1"}}
+		}},
+		{name: "metadata besides labels and annotations", mutate: func(template *v1.PodTemplateSpec) {
+			template.CreationTimestamp = metav1.Now()
+		}},
+	}
+	expected := mustHash(t, newTemplate(), config)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			template := newTemplate()
+			test.mutate(&template)
+			if hash := mustHash(t, template, config); hash != expected {
+				t.Fatalf("expected the hash %s, got %s", expected, hash)
+			}
+		})
+	}
+}
+
+func TestHashChanged(t *testing.T) {
+	tests := []struct {
+		name   string
+		mutate func(template *v1.PodTemplateSpec)
+	}{
+		{name: "image", mutate: func(template *v1.PodTemplateSpec) {
+			template.Spec.Containers[0].Image = "nginx:1.24"
+		}},
+		{name: "pull policy", mutate: func(template *v1.PodTemplateSpec) {
+			template.Spec.Containers[0].ImagePullPolicy = v1.PullAlways
+		}},
+		{name: "annotation", mutate: func(template *v1.PodTemplateSpec) {
+			template.Annotations["example.com/restarted"] = "now"
+		}},
+		{name: "sidecar", mutate: func(template *v1.PodTemplateSpec) {
+			template.Spec.Containers = append(template.Spec.Containers, v1.Container{Name: "sidecar", Image: "proxy:1"})
+		}},
+	}
+	expected := mustHash(t, newTemplate(), DefaultConfig)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			template := newTemplate()
+			test.mutate(&template)
+			if hash := mustHash(t, template, DefaultConfig); hash == expected {
+				t.Fatalf("expected a new hash, got %s", hash)
+			}
+		})
+	}
+}
+
+func TestCanonicalize(t *testing.T) {
+	template := newTemplate()
+	inputs, err := Canonicalize(template, DefaultConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{`"imagePullPolicy":"IfNotPresent"`, `"defaultMode":420`, `"metadata":{"annotations"`} {
+		if !strings.Contains(string(inputs), expected) {
+			t.Fatalf("expected %s in %s", expected, inputs)
+		}
+	}
+	for _, unexpected := range []string{"null", "{}", "[]", `""`, "creationTimestamp"} {
+		if strings.Contains(string(inputs), unexpected) {
+			t.Fatalf("unexpected %s in %s", unexpected, inputs)
+		}
+	}
+	if template.Spec.Containers[0].ImagePullPolicy != "" {
+		t.Fatal("expected the template to be left untouched")
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	template := newTemplate()
+	template.Spec.Containers[0].Env = []v1.EnvVar{{Name: "TOKEN", Value: "s3cr3t"}}
+	hash, inputs, err := Hash(template, DefaultConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := Summarize(hash, inputs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	summary := Summary{}
+	if err := json.Unmarshal([]byte(raw), &summary); err != nil {
+		t.Fatal(err)
+	}
+	if summary.Hash != hash || summary.Truncated != 0 {
+		t.Fatalf("expected the hash %s without truncation, got %+v", hash, summary)
+	}
+	for _, expected := range []string{"spec.containers.0.env.0.value=", "spec.containers.0.image=", "metadata.annotations.example.com/owner="} {
+		if !strings.Contains(raw, expected) {
+			t.Fatalf("expected %s in %s", expected, raw)
+		}
+	}
+	for _, unexpected := range []string{"s3cr3t", "nginx", "team"} {
+		if strings.Contains(raw, unexpected) {
+			t.Fatalf("unexpected %s in %s", unexpected, raw)
+		}
+	}
+
+	for i := 0; i < MaxSummaryFields; i++ {
+		template.Annotations[fmt.Sprintf("example.com/key-%d", i)] = "value"
+	}
+	hash, inputs, err = Hash(template, DefaultConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if raw, err = Summarize(hash, inputs); err != nil {
+		t.Fatal(err)
+	}
+	summary = Summary{}
+	if err := json.Unmarshal([]byte(raw), &summary); err != nil {
+		t.Fatal(err)
+	}
+	if len(summary.Fields) != MaxSummaryFields || summary.Truncated == 0 {
+		t.Fatalf("expected %d fields and the rest truncated, got %d and %d", MaxSummaryFields, len(summary.Fields), summary.Truncated)
+	}
+}
+
+func TestDefaultImagePullPolicy(t *testing.T) {
+	for image, expected := range map[string]v1.PullPolicy{
+		"nginx":                        v1.PullAlways,
+		"nginx:latest":                 v1.PullAlways,
+		"nginx:1.23":                   v1.PullIfNotPresent,
+		"registry:5000/nginx":          v1.PullAlways,
+		"registry:5000/nginx:1.23":     v1.PullIfNotPresent,
+		"nginx@sha256:0123456789abcde": v1.PullIfNotPresent,
+	} {
+		if policy := defaultImagePullPolicy(image); policy != expected {
+			t.Fatalf("expected %s for %s, got %s", expected, image, policy)
+		}
+	}
+}
+
+func TestParseConfig(t *testing.T) {
+	for _, content := range []string{`{`, `{"ignoredLabels":[""]}`, `{"ignoredContainers":"sidecar"}`} {
+		if _, err := ParseConfig(content); err == nil {
+			t.Fatalf("expected an error for %s", content)
+		}
+	}
+	config, err := ParseConfig(`{"ignoredAnnotations":["example.com/restarted"]}`)
+	if err != nil || len(config.IgnoredAnnotations) != 1 {
+		t.Fatalf("expected the ignored annotation, got %+v %v", config, err)
+	}
+}
@@ -0,0 +1,130 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/apis/app.ops.cloud.alipay.com/v1alpha1"
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/resource"
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/utils"
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/utils/native"
+)
+
+const (
+	rolloutWorkCount = 5
+)
+
+// RolloutReconciler 为Argo Rollout的每个版本创建ChangeWorkload，canary步骤对应ChangePod的批次，校验失败时中止Rollout。
+// 扩容和配置变更的防御只支持Deployment
+// RolloutReconciler creates a ChangeWorkload for every revision of an Argo Rollout, the canary steps map to the batches
+// of ChangePods and a failed verdict aborts the Rollout. The scale-up and config change defenses are Deployment only
+type RolloutReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+}
+
+//+kubebuilder:rbac:groups=argoproj.io,resources=rollouts,verbs=get;list;watch;update;patch
+//+kubebuilder:rbac:groups=argoproj.io,resources=rollouts/status,verbs=get;update;patch
+
+// Reconcile creates the ChangeWorkload of the current revision of the Rollout and marks the revision defended
+func (r *RolloutReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx).WithName("RolloutReconciler Reconcile")
+	rollout := native.NewRollout()
+	if err := r.Get(ctx, req.NamespacedName, rollout); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	if isDefensed(rollout.GetLabels()) {
+		return ctrl.Result{}, nil
+	}
+	// 创建workload
+	// create workload
+	if err := r.createChangeWorkload(ctx, rollout); err != nil {
+		logger.Error(err, "RolloutReconciler createChangeWorkload error", utils.LogRolloutResource, utils.GetResource(rollout))
+		return ctrl.Result{}, err
+	}
+	// 给rollout打上防御标签
+	// add defensed label to rollout
+	if err := r.defenseProcessedRollout(ctx, rollout); err != nil {
+		logger.Error(err, "RolloutReconciler defenseProcessedRollout error", utils.LogRolloutResource, utils.GetResource(rollout))
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{}, nil
+}
+
+// SetupWithManager sets up the controller with the Manager, the Rollout CRD must be installed.
+func (r *RolloutReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(native.NewRollout()).
+		Owns(&v1alpha1.ChangeWorkload{}).
+		// Set the maximum number of concurrency
+		WithOptions(controller.Options{MaxConcurrentReconciles: rolloutWorkCount}).
+		// 和deployment一样只处理webhook打上版本并且还没有防御的rollout
+		// like the deployments only the rollouts versioned by the webhook and not defended yet are handled
+		WithEventFilter(predicate.Funcs{
+			UpdateFunc: func(e event.UpdateEvent) bool {
+				return isAdmissionWebhook(e.ObjectNew.GetLabels()) && !isDefensed(e.ObjectNew.GetLabels())
+			},
+			CreateFunc: func(e event.CreateEvent) bool {
+				return isAdmissionWebhook(e.Object.GetLabels()) && !isDefensed(e.Object.GetLabels())
+			},
+		}).
+		Complete(r)
+}
+
+// createChangeWorkload 创建rollout当前版本的ChangeWorkload，已经存在时忽略
+// createChangeWorkload creates the ChangeWorkload of the current revision of the rollout, an existing one is kept
+func (r *RolloutReconciler) createChangeWorkload(ctx context.Context, rollout *unstructured.Unstructured) error {
+	logger := log.FromContext(ctx).WithName("createChangeWorkload")
+	factory := &resource.RolloutChangeWorkloadFactory{Rollout: rollout}
+	workload := factory.NewInstance().(*v1alpha1.ChangeWorkload)
+	if err := controllerutil.SetControllerReference(rollout, workload, r.Scheme); err != nil {
+		return err
+	}
+	if err := r.Create(ctx, workload); err != nil && !errors.IsAlreadyExists(err) {
+		logger.Error(err, "create workload error", utils.LogRolloutResource, utils.GetResource(rollout))
+		return err
+	}
+	if err := supersedeChangeWorkloads(ctx, r.Client, workload); err != nil {
+		logger.Error(err, "supersede change workloads error", utils.LogRolloutResource, utils.GetResource(rollout))
+		return err
+	}
+	logger.Info("create workload", utils.LogRolloutResource, utils.GetResource(rollout), utils.LogChangeWorkloadResource, utils.GetResource(workload), "batches", workload.Spec.Batches)
+	return nil
+}
+
+// defenseProcessedRollout 给rollout打上defense-status=Processed标记
+// defenseProcessedRollout sets the label defense-status=Processed for the rollout
+func (r *RolloutReconciler) defenseProcessedRollout(ctx context.Context, rollout *unstructured.Unstructured) error {
+	patch := client.MergeFrom(rollout.DeepCopy())
+	labels := rollout.GetLabels()
+	labels[utils.DefenseStatusLabel] = utils.DefenseStatusLabelProcessed
+	delete(labels, utils.IgnoredSuspendLabel)
+	rollout.SetLabels(labels)
+	return r.Patch(ctx, rollout, patch)
+}
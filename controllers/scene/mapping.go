@@ -0,0 +1,64 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scene
+
+import (
+	"encoding/json"
+
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/apis/app.ops.cloud.alipay.com/v1alpha1"
+)
+
+// Mapping 按照namespace配置管控端请求的租户和变更场景，保存在OpsConfigInfo的content中，namespace没有配置的项使用Default
+// Mapping the tenant and change scene of the OpsCloud requests per namespace, it is kept in the content of an
+// OpsConfigInfo and the items a namespace leaves out come from Default
+type Mapping struct {
+	Default    v1alpha1.ChangeScene            `json:"default"`
+	Namespaces map[string]v1alpha1.ChangeScene `json:"namespaces"`
+}
+
+// DefaultMapping 默认不配置任何namespace，所有项使用operator的默认值
+// DefaultMapping no namespace is mapped by default, every item takes the default of the operator
+var DefaultMapping = Mapping{Namespaces: map[string]v1alpha1.ChangeScene{}}
+
+// ParseMapping parses the json mapping
+func ParseMapping(content string) (Mapping, error) {
+	mapping := Mapping{}
+	if err := json.Unmarshal([]byte(content), &mapping); err != nil {
+		return mapping, err
+	}
+	return mapping, nil
+}
+
+// Lookup 返回namespace的租户和变更场景，namespace的配置优先于Default，都没有配置的项为空
+// Lookup returns the tenant and change scene of the namespace, its own items take precedence over Default and the
+// items neither of them sets are empty
+func (m Mapping) Lookup(namespace string) v1alpha1.ChangeScene {
+	changeScene := m.Namespaces[namespace]
+	if changeScene.TenantCode == "" {
+		changeScene.TenantCode = m.Default.TenantCode
+	}
+	if changeScene.ScenarioCode == "" {
+		changeScene.ScenarioCode = m.Default.ScenarioCode
+	}
+	if changeScene.Phase == "" {
+		changeScene.Phase = m.Default.Phase
+	}
+	if changeScene.SceneKey == "" {
+		changeScene.SceneKey = m.Default.SceneKey
+	}
+	return changeScene
+}
@@ -0,0 +1,46 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scene
+
+import (
+	"testing"
+
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/apis/app.ops.cloud.alipay.com/v1alpha1"
+)
+
+func TestMappingLookup(t *testing.T) {
+	mapping, err := ParseMapping(`{"default":{"tenantCode":"SHARED","phase":"prod_phase"},
+		"namespaces":{"team-a":{"tenantCode":"TEAM_A","scenarioCode":"A1"}}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changeScene := mapping.Lookup("team-a"); changeScene != (v1alpha1.ChangeScene{TenantCode: "TEAM_A", ScenarioCode: "A1", Phase: "prod_phase"}) {
+		t.Fatalf("unexpected change scene of a mapped namespace %+v", changeScene)
+	}
+	if changeScene := mapping.Lookup("team-b"); changeScene != (v1alpha1.ChangeScene{TenantCode: "SHARED", Phase: "prod_phase"}) {
+		t.Fatalf("unexpected change scene of an unmapped namespace %+v", changeScene)
+	}
+	if changeScene := DefaultMapping.Lookup("team-a"); changeScene != (v1alpha1.ChangeScene{}) {
+		t.Fatalf("expected an empty change scene by default, got %+v", changeScene)
+	}
+}
+
+func TestParseMapping(t *testing.T) {
+	if _, err := ParseMapping(`{"namespaces":[]}`); err == nil {
+		t.Fatal("expected an error for a malformed mapping")
+	}
+}
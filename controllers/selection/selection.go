@@ -0,0 +1,190 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package selection
+
+import (
+	"hash/fnv"
+	"math/rand"
+	"sort"
+	"time"
+)
+
+const (
+	// StrategySpread 在zone之间轮流挑选pod，同一个zone内再在节点之间轮流挑选，每一批尽量覆盖所有的故障域
+	// StrategySpread picks the pods from the zones in turn and from the nodes of a zone in turn, so that every batch
+	// covers as many failure domains as possible
+	StrategySpread = "spread"
+	// StrategyOldest 按照创建时间从早到晚挑选pod
+	// StrategyOldest picks the pods from the oldest to the newest
+	StrategyOldest = "oldest"
+	// StrategyRandom 按照批次的名称确定的随机顺序挑选pod，同一个批次重试时顺序不变
+	// StrategyRandom picks the pods in a random order seeded by the name of the batch, a retry of the same batch gets
+	// the same order
+	StrategyRandom = "random"
+)
+
+// IsStrategy 是否为支持的挑选策略
+// IsStrategy whether the value is a supported selection strategy
+func IsStrategy(value string) bool {
+	return value == StrategySpread || value == StrategyOldest || value == StrategyRandom
+}
+
+// Candidate 可以被放进批次的pod和它所在的拓扑位置，没有拓扑标签的节点zone和region为空
+// Candidate a pod that can be put into a batch and where it runs, the zone and region are empty for the nodes without
+// the topology labels
+type Candidate struct {
+	Name       string
+	Node       string
+	Zone       string
+	Region     string
+	CreateTime time.Time
+}
+
+// domain 返回候选pod所在的故障域，没有zone时以节点作为故障域
+// domain returns the failure domain of the candidate, it is the node when the zone is unknown
+func (c Candidate) domain() string {
+	if c.Zone == "" && c.Region == "" {
+		return "node/" + c.Node
+	}
+	return "zone/" + c.Region + "/" + c.Zone
+}
+
+// Domains 返回候选pod覆盖的故障域个数
+// Domains returns the number of failure domains the candidates cover
+func Domains(candidates []Candidate) int {
+	domains := make(map[string]struct{})
+	for _, candidate := range candidates {
+		domains[candidate.domain()] = struct{}{}
+	}
+	return len(domains)
+}
+
+// Select 按照策略从候选pod中挑选最多count个，返回它们在candidates中的下标，seed决定random策略的顺序
+// Select picks at most count candidates with the strategy and returns their indexes in candidates, the seed decides
+// the order of the random strategy
+func Select(strategy string, candidates []Candidate, count int, seed string) []int {
+	var order []int
+	switch strategy {
+	case StrategyOldest:
+		order = oldestOrder(candidates)
+	case StrategyRandom:
+		order = randomOrder(candidates, seed)
+	default:
+		order = spreadOrder(candidates)
+	}
+	if count < len(order) {
+		order = order[:count]
+	}
+	return order
+}
+
+func oldestOrder(candidates []Candidate) []int {
+	order := make([]int, len(candidates))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		a, b := candidates[order[i]], candidates[order[j]]
+		if !a.CreateTime.Equal(b.CreateTime) {
+			return a.CreateTime.Before(b.CreateTime)
+		}
+		return a.Name < b.Name
+	})
+	return order
+}
+
+func randomOrder(candidates []Candidate, seed string) []int {
+	order := make([]int, len(candidates))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return candidates[order[i]].Name < candidates[order[j]].Name
+	})
+	hash := fnv.New64a()
+	_, _ = hash.Write([]byte(seed))
+	random := rand.New(rand.NewSource(int64(hash.Sum64())))
+	random.Shuffle(len(order), func(i, j int) {
+		order[i], order[j] = order[j], order[i]
+	})
+	return order
+}
+
+// group 一个故障域或者一个节点，members按照挑选顺序排列
+// group a failure domain or a node, the members are in the order they are picked
+type group struct {
+	key     string
+	members []int
+	next    int
+}
+
+// spreadOrder 在故障域之间轮流挑选，故障域内部在节点之间轮流挑选，同一个节点上先挑选最早的pod
+// spreadOrder picks from the failure domains in turn and from the nodes of a domain in turn, the oldest pod of a node
+// is picked first
+func spreadOrder(candidates []Candidate) []int {
+	domains := make(map[string]map[string][]int)
+	for _, index := range oldestOrder(candidates) {
+		candidate := candidates[index]
+		nodes, ok := domains[candidate.domain()]
+		if !ok {
+			nodes = make(map[string][]int)
+			domains[candidate.domain()] = nodes
+		}
+		nodes[candidate.Node] = append(nodes[candidate.Node], index)
+	}
+
+	domainGroups := make([]*group, 0, len(domains))
+	nodeGroups := make(map[string][]*group, len(domains))
+	for domainKey, nodes := range domains {
+		domainGroups = append(domainGroups, &group{key: domainKey})
+		for nodeKey, members := range nodes {
+			nodeGroups[domainKey] = append(nodeGroups[domainKey], &group{key: nodeKey, members: members})
+		}
+		sortGroups(nodeGroups[domainKey])
+	}
+	sortGroups(domainGroups)
+
+	order := make([]int, 0, len(candidates))
+	for len(order) < len(candidates) {
+		for _, domain := range domainGroups {
+			if index, ok := pickFromNodes(domain, nodeGroups[domain.key]); ok {
+				order = append(order, index)
+			}
+		}
+	}
+	return order
+}
+
+// pickFromNodes 从故障域中下一个还有剩余pod的节点挑选一个pod
+// pickFromNodes picks a pod from the next node of the domain that still has pods left
+func pickFromNodes(domain *group, nodes []*group) (int, bool) {
+	for i := 0; i < len(nodes); i++ {
+		node := nodes[(domain.next+i)%len(nodes)]
+		if node.next < len(node.members) {
+			domain.next = (domain.next + i + 1) % len(nodes)
+			node.next++
+			return node.members[node.next-1], true
+		}
+	}
+	return 0, false
+}
+
+func sortGroups(groups []*group) {
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].key < groups[j].key
+	})
+}
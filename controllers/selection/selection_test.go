@@ -0,0 +1,98 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package selection
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func names(candidates []Candidate, indexes []int) []string {
+	result := make([]string, 0, len(indexes))
+	for _, index := range indexes {
+		result = append(result, candidates[index].Name)
+	}
+	return result
+}
+
+func TestSelectSpread(t *testing.T) {
+	now := time.Now()
+	candidates := []Candidate{
+		{Name: "a-1", Node: "node-1", Zone: "zone-a", CreateTime: now},
+		{Name: "a-2", Node: "node-1", Zone: "zone-a", CreateTime: now.Add(time.Second)},
+		{Name: "a-3", Node: "node-2", Zone: "zone-a", CreateTime: now.Add(2 * time.Second)},
+		{Name: "a-4", Node: "node-2", Zone: "zone-a", CreateTime: now.Add(3 * time.Second)},
+		{Name: "b-1", Node: "node-3", Zone: "zone-b", CreateTime: now.Add(4 * time.Second)},
+		{Name: "c-1", Node: "node-4", Zone: "zone-c", CreateTime: now.Add(5 * time.Second)},
+	}
+	if Domains(candidates) != 3 {
+		t.Fatalf("expected 3 failure domains, got %d", Domains(candidates))
+	}
+	selected := names(candidates, Select(StrategySpread, candidates, 3, ""))
+	if !reflect.DeepEqual(selected, []string{"a-1", "b-1", "c-1"}) {
+		t.Fatalf("expected one pod of every zone, got %v", selected)
+	}
+	selected = names(candidates, Select(StrategySpread, candidates, len(candidates), ""))
+	if !reflect.DeepEqual(selected, []string{"a-1", "b-1", "c-1", "a-3", "a-2", "a-4"}) {
+		t.Fatalf("expected the nodes of a zone to take turns, got %v", selected)
+	}
+}
+
+func TestSelectSpreadWithoutZones(t *testing.T) {
+	candidates := []Candidate{
+		{Name: "p-1", Node: "node-1"},
+		{Name: "p-2", Node: "node-1"},
+		{Name: "p-3", Node: "node-2"},
+	}
+	if Domains(candidates) != 2 {
+		t.Fatalf("expected the nodes to be the failure domains, got %d", Domains(candidates))
+	}
+	selected := names(candidates, Select(StrategySpread, candidates, 2, ""))
+	if !reflect.DeepEqual(selected, []string{"p-1", "p-3"}) {
+		t.Fatalf("expected one pod of every node, got %v", selected)
+	}
+}
+
+func TestSelectOldest(t *testing.T) {
+	now := time.Now()
+	candidates := []Candidate{
+		{Name: "new", CreateTime: now.Add(time.Minute)},
+		{Name: "old-b", CreateTime: now},
+		{Name: "old-a", CreateTime: now},
+	}
+	selected := names(candidates, Select(StrategyOldest, candidates, 2, ""))
+	if !reflect.DeepEqual(selected, []string{"old-a", "old-b"}) {
+		t.Fatalf("expected the oldest pods ordered by name, got %v", selected)
+	}
+}
+
+func TestSelectRandom(t *testing.T) {
+	candidates := []Candidate{{Name: "p-1"}, {Name: "p-2"}, {Name: "p-3"}, {Name: "p-4"}, {Name: "p-5"}}
+	reversed := []Candidate{{Name: "p-5"}, {Name: "p-4"}, {Name: "p-3"}, {Name: "p-2"}, {Name: "p-1"}}
+	first := names(candidates, Select(StrategyRandom, candidates, 3, "change-1"))
+	again := names(reversed, Select(StrategyRandom, reversed, 3, "change-1"))
+	if !reflect.DeepEqual(first, again) {
+		t.Fatalf("expected the same seed to give the same pods whatever the list order, got %v and %v", first, again)
+	}
+	if len(first) != 3 {
+		t.Fatalf("expected 3 pods, got %v", first)
+	}
+	if !IsStrategy(StrategyRandom) || IsStrategy("first") {
+		t.Fatal("unexpected strategy validation")
+	}
+}
@@ -0,0 +1,107 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package suspend
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Policy 被暂停的工作负载允许哪些操作，保存在OpsConfigInfo的content中，没有填写的字段使用默认值
+// Policy what a suspended workload still allows, it is kept in the content of an OpsConfigInfo and the missing fields
+// keep their defaults
+type Policy struct {
+	// BlockDelete 拒绝删除被暂停的工作负载
+	// BlockDelete denies deleting a suspended workload
+	BlockDelete bool `json:"blockDelete"`
+	// MaxScaleDownPercent 允许缩容的最大副本比例，超过的缩容被拒绝，100允许任意缩容
+	// MaxScaleDownPercent the largest share of the replicas a scale-down may remove, a larger one is denied and 100
+	// allows every scale-down
+	MaxScaleDownPercent int `json:"maxScaleDownPercent"`
+	// AllowVerifiedRevision 允许把模板回滚到最近一次校验通过的版本
+	// AllowVerifiedRevision allows rolling the template back to the last revision that passed the checks
+	AllowVerifiedRevision bool `json:"allowVerifiedRevision"`
+}
+
+// DefaultPolicy 默认拒绝删除和缩容一半以上的副本，允许回滚到校验通过的版本
+// DefaultPolicy denies the deletes and the scale-downs of more than half of the replicas and allows the rollbacks to the
+// verified revision by default
+var DefaultPolicy = Policy{
+	BlockDelete:           true,
+	MaxScaleDownPercent:   50,
+	AllowVerifiedRevision: true,
+}
+
+// ParsePolicy parses the json policy of the suspended workloads on top of the defaults
+func ParsePolicy(content string) (Policy, error) {
+	policy := DefaultPolicy
+	if err := json.Unmarshal([]byte(content), &policy); err != nil {
+		return policy, err
+	}
+	if policy.MaxScaleDownPercent < 0 || policy.MaxScaleDownPercent > 100 {
+		return policy, fmt.Errorf("maxScaleDownPercent must be between 0 and 100, got %d", policy.MaxScaleDownPercent)
+	}
+	return policy, nil
+}
+
+// Update 对被暂停的工作负载的一次更新
+// Update an update of a suspended workload
+type Update struct {
+	OldReplicas int32
+	NewReplicas int32
+	// Version 更新后模板的版本，VerifiedRevision 最近一次校验通过的版本，没有时为空
+	// Version the revision of the updated template, VerifiedRevision the last revision that passed the checks, it is
+	// empty without one
+	Version          string
+	VerifiedRevision string
+	// TemplateChanged 模板是否变化，OtherSpecChanged 副本数和模板以外的spec是否变化
+	// TemplateChanged whether the template changed, OtherSpecChanged whether the spec other than the replicas and the
+	// template changed
+	TemplateChanged  bool
+	OtherSpecChanged bool
+}
+
+// ValidateDelete 按照策略校验删除被暂停的工作负载
+// ValidateDelete validates deleting a suspended workload by the policy
+func (p Policy) ValidateDelete(kind string, name string) error {
+	if p.BlockDelete {
+		return fmt.Errorf("%s %s is suspended, it can't be deleted", kind, name)
+	}
+	return nil
+}
+
+// ValidateUpdate 按照策略校验被暂停的工作负载的更新：超过比例的缩容总是被拒绝，回滚到校验通过的版本和只缩容或者只修改元数据的更新被允许，
+// 其他更新被拒绝
+// ValidateUpdate validates an update of a suspended workload by the policy: a scale-down beyond the share is always
+// denied, a rollback to the verified revision and an update only scaling down or only touching the metadata are
+// allowed, and every other update is denied
+func (p Policy) ValidateUpdate(kind string, name string, update Update) error {
+	if removed := update.OldReplicas - update.NewReplicas; removed > 0 && int(removed)*100 > int(update.OldReplicas)*p.MaxScaleDownPercent {
+		return fmt.Errorf("%s %s is suspended, scaling down from %d to %d replicas removes more than %d%% of them",
+			kind, name, update.OldReplicas, update.NewReplicas, p.MaxScaleDownPercent)
+	}
+	if update.TemplateChanged {
+		if p.AllowVerifiedRevision && update.VerifiedRevision != "" && update.Version == update.VerifiedRevision {
+			return nil
+		}
+		return fmt.Errorf("%s %s is suspended", kind, name)
+	}
+	if update.OtherSpecChanged || update.NewReplicas > update.OldReplicas {
+		return fmt.Errorf("%s %s is suspended", kind, name)
+	}
+	return nil
+}
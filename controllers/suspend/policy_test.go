@@ -0,0 +1,79 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package suspend
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParsePolicy(t *testing.T) {
+	policy, err := ParsePolicy(`{"blockDelete": false}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := DefaultPolicy
+	expected.BlockDelete = false
+	if policy != expected {
+		t.Fatalf("expected the missing fields to keep their defaults, got %+v", policy)
+	}
+	if _, err := ParsePolicy(`{"maxScaleDownPercent": 101}`); err == nil {
+		t.Fatal("expected an out of range percent to be rejected")
+	}
+	if _, err := ParsePolicy(`not json`); err == nil {
+		t.Fatal("expected invalid json to be rejected")
+	}
+}
+
+func TestValidateDelete(t *testing.T) {
+	if err := DefaultPolicy.ValidateDelete("deployment", "demo"); err == nil || !strings.Contains(err.Error(), "can't be deleted") {
+		t.Fatalf("expected the delete to be denied, got %v", err)
+	}
+	if err := (Policy{}).ValidateDelete("deployment", "demo"); err != nil {
+		t.Fatalf("expected the delete to be allowed, got %v", err)
+	}
+}
+
+func TestValidateUpdate(t *testing.T) {
+	cases := []struct {
+		name    string
+		policy  Policy
+		update  Update
+		allowed bool
+	}{
+		{"metadata only", DefaultPolicy, Update{OldReplicas: 4, NewReplicas: 4}, true},
+		{"small scale-down", DefaultPolicy, Update{OldReplicas: 4, NewReplicas: 2}, true},
+		{"large scale-down", DefaultPolicy, Update{OldReplicas: 4, NewReplicas: 1}, false},
+		{"scale-up", DefaultPolicy, Update{OldReplicas: 4, NewReplicas: 5}, false},
+		{"other spec", DefaultPolicy, Update{OldReplicas: 4, NewReplicas: 4, OtherSpecChanged: true}, false},
+		{"new revision", DefaultPolicy, Update{OldReplicas: 4, NewReplicas: 4, TemplateChanged: true, Version: "b", VerifiedRevision: "a"}, false},
+		{"no verified revision", DefaultPolicy, Update{OldReplicas: 4, NewReplicas: 4, TemplateChanged: true, Version: "a"}, false},
+		{"rollback", DefaultPolicy, Update{OldReplicas: 4, NewReplicas: 5, TemplateChanged: true, Version: "a", VerifiedRevision: "a"}, true},
+		{"rollback with a large scale-down", DefaultPolicy, Update{OldReplicas: 4, NewReplicas: 1, TemplateChanged: true, Version: "a", VerifiedRevision: "a"}, false},
+		{"rollback disabled", Policy{MaxScaleDownPercent: 100}, Update{OldReplicas: 4, NewReplicas: 4, TemplateChanged: true, Version: "a", VerifiedRevision: "a"}, false},
+		{"every scale-down allowed", Policy{MaxScaleDownPercent: 100}, Update{OldReplicas: 4, NewReplicas: 0}, true},
+	}
+	for _, c := range cases {
+		err := c.policy.ValidateUpdate("deployment", "demo", c.update)
+		if c.allowed && err != nil {
+			t.Errorf("%s: expected the update to be allowed, got %v", c.name, err)
+		}
+		if !c.allowed && err == nil {
+			t.Errorf("%s: expected the update to be denied", c.name)
+		}
+	}
+}
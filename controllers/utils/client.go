@@ -15,6 +15,9 @@ type AppClient struct {
 	cache.Cache
 	K8sClient *kubernetes.Clientset
 	K8sConfig *rest.Config
+	// APIReader 不经过缓存直接读取api server，用于需要读到刚刚写入内容的场景
+	// APIReader reads from the api server without the cache, for the reads that have to see the latest writes
+	APIReader client.Reader
 }
 
 func NewApp(client client.Client, cache cache.Cache, config *rest.Config) AppClient {
@@ -22,6 +25,14 @@ func NewApp(client client.Client, cache cache.Cache, config *rest.Config) AppCli
 	if err != nil {
 		panic(err)
 	}
-	App = AppClient{client, cache, k8sClient, config}
+	apiReader, err := newAPIReader(client, config)
+	if err != nil {
+		panic(err)
+	}
+	App = AppClient{client, cache, k8sClient, config, apiReader}
 	return App
 }
+
+func newAPIReader(c client.Client, config *rest.Config) (client.Reader, error) {
+	return client.New(config, client.Options{Scheme: c.Scheme(), Mapper: c.RESTMapper()})
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/gin-gonic/gin"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
@@ -20,6 +21,14 @@ var (
 	ConfigIsBatchChannel      = make(chan bool)
 	ConfigBatchCountChannel   = make(chan int)
 	ConfigIsBlockingUpChannel = make(chan bool)
+	ConfigIsDryRunChannel     = make(chan bool)
+	ConfigPrometheusChannel   = make(chan string)
+	ConfigLogPatternChannel   = make(chan string)
+	ConfigRevisionHashChannel = make(chan string)
+	ConfigSuspendChannel      = make(chan string)
+	ConfigConcurrencyChannel  = make(chan string)
+	ConfigNotificationChannel = make(chan string)
+	ConfigChangeSceneChannel  = make(chan string)
 	Env                       = EnvCache{cache: map[string]string{}}
 )
 
@@ -186,6 +195,8 @@ func GetResource(obj runtime.Object) string {
 		return fmt.Sprintf("%s/%s", o.Namespace, o.Name)
 	case *v1alpha1.ChangePod:
 		return fmt.Sprintf("%s/%s", o.Namespace, o.Name)
+	case *unstructured.Unstructured:
+		return fmt.Sprintf("%s/%s", o.GetNamespace(), o.GetName())
 	default:
 		return ""
 	}
@@ -6,6 +6,7 @@ import (
 	"sync"
 	"time"
 
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log"
@@ -19,10 +20,30 @@ var (
 	configIsBatch      = false
 	configBatchCount   = 1
 	configIsBlockingUp = true
+	configIsDryRun     = false
+	configPrometheus   = ""
+	configLogPattern   = ""
+	configRevisionHash = ""
+	configSuspend      = ""
+	configConcurrency  = ""
+	configNotification = ""
+	configChangeScene  = ""
 
 	configIsBatchIsReady      = false
 	configBatchCountReady     = false
 	configIsBlockingUpIsReady = false
+	configIsDryRunIsReady     = false
+	configPrometheusIsReady   = false
+	configLogPatternIsReady   = false
+	configRevisionHashIsReady = false
+	configSuspendIsReady      = false
+	configConcurrencyIsReady  = false
+	configNotificationIsReady = false
+	configChangeSceneIsReady  = false
+
+	// configMutex 保护ConfigRun写入、准入webhook不等待读取的配置
+	// configMutex guards the configs written by ConfigRun and read by the admission webhooks without waiting
+	configMutex sync.RWMutex
 )
 
 // ConfigRun is used to listen for changes to config
@@ -50,6 +71,73 @@ func ConfigRun() {
 					logger.Info("configIsBlockingUp is ready")
 					configIsBlockingUpIsReady = true
 				}
+			case isDryRun := <-ConfigIsDryRunChannel:
+				logger.Info("configIsDryRun is :" + strconv.FormatBool(isDryRun))
+				configMutex.Lock()
+				configIsDryRun = isDryRun
+				if !configIsDryRunIsReady {
+					logger.Info("configIsDryRun is ready")
+					configIsDryRunIsReady = true
+				}
+				configMutex.Unlock()
+			case configPrometheus = <-ConfigPrometheusChannel:
+				// prometheus的地址中可能带有凭证，只记录发生了变化
+				// the prometheus url may carry credentials, only the change is logged
+				logger.Info("configPrometheus is changed")
+				if !configPrometheusIsReady {
+					logger.Info("configPrometheus is ready")
+					configPrometheusIsReady = true
+				}
+			case configLogPattern = <-ConfigLogPatternChannel:
+				logger.Info("configLogPattern is :" + configLogPattern)
+				if !configLogPatternIsReady {
+					logger.Info("configLogPattern is ready")
+					configLogPatternIsReady = true
+				}
+			case revisionHash := <-ConfigRevisionHashChannel:
+				logger.Info("configRevisionHash is :" + revisionHash)
+				configMutex.Lock()
+				configRevisionHash = revisionHash
+				if !configRevisionHashIsReady {
+					logger.Info("configRevisionHash is ready")
+					configRevisionHashIsReady = true
+				}
+				configMutex.Unlock()
+			case suspend := <-ConfigSuspendChannel:
+				logger.Info("configSuspend is :" + suspend)
+				configMutex.Lock()
+				configSuspend = suspend
+				if !configSuspendIsReady {
+					logger.Info("configSuspend is ready")
+					configSuspendIsReady = true
+				}
+				configMutex.Unlock()
+			case concurrency := <-ConfigConcurrencyChannel:
+				logger.Info("configConcurrency is :" + concurrency)
+				configMutex.Lock()
+				configConcurrency = concurrency
+				if !configConcurrencyIsReady {
+					logger.Info("configConcurrency is ready")
+					configConcurrencyIsReady = true
+				}
+				configMutex.Unlock()
+			case notification := <-ConfigNotificationChannel:
+				// 通知配置中包含地址和请求头中的凭证，只记录发生了变化
+				// the notification config holds credentials in its urls and headers, only the change is logged
+				logger.Info("configNotification is changed")
+				configMutex.Lock()
+				configNotification = notification
+				if !configNotificationIsReady {
+					logger.Info("configNotification is ready")
+					configNotificationIsReady = true
+				}
+				configMutex.Unlock()
+			case configChangeScene = <-ConfigChangeSceneChannel:
+				logger.Info("configChangeScene is :" + configChangeScene)
+				if !configChangeSceneIsReady {
+					logger.Info("configChangeScene is ready")
+					configChangeSceneIsReady = true
+				}
 			}
 		}
 	}()
@@ -60,6 +148,14 @@ func configInit() {
 	for {
 		newBatchConfig()
 		newBlockUpConfig()
+		newDryRunConfig()
+		newPrometheusConfig()
+		newLogPatternConfig()
+		newRevisionHashConfig()
+		newSuspendConfig()
+		newConcurrencyConfig()
+		newNotificationConfig()
+		newChangeSceneConfig()
 		time.Sleep(time.Second)
 	}
 }
@@ -98,6 +194,142 @@ func newBlockUpConfig() {
 	}
 }
 
+// newDryRunConfig is used to initialize config
+func newDryRunConfig() {
+	opsConfigInfo := v1alpha1.OpsConfigInfo{}
+	err := App.Client.Get(context.Background(), client.ObjectKey{Name: ConfigNameIsDryRun, Namespace: AlterShieldOperatorNamespace}, &opsConfigInfo)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			newRecord := NewOpsConfigInfoDryRunFunc()
+			err := App.Client.Create(context.Background(), newRecord)
+			if err != nil {
+				log.FromContext(context.Background()).Error(err, "newDryRunConfig:create dry run config error")
+			}
+		} else {
+			log.FromContext(context.Background()).Error(err, "newDryRunConfig:get dry run config error")
+		}
+	}
+}
+
+// newPrometheusConfig is used to initialize config
+func newPrometheusConfig() {
+	opsConfigInfo := v1alpha1.OpsConfigInfo{}
+	err := App.Client.Get(context.Background(), client.ObjectKey{Name: ConfigNamePrometheus, Namespace: AlterShieldOperatorNamespace}, &opsConfigInfo)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			newRecord := NewOpsConfigInfoPrometheusFunc()
+			err := App.Client.Create(context.Background(), newRecord)
+			if err != nil {
+				log.FromContext(context.Background()).Error(err, "newPrometheusConfig:create prometheus config error")
+			}
+		} else {
+			log.FromContext(context.Background()).Error(err, "newPrometheusConfig:get prometheus config error")
+		}
+	}
+}
+
+// newLogPatternConfig is used to initialize config
+func newLogPatternConfig() {
+	opsConfigInfo := v1alpha1.OpsConfigInfo{}
+	err := App.Client.Get(context.Background(), client.ObjectKey{Name: ConfigNameLogPattern, Namespace: AlterShieldOperatorNamespace}, &opsConfigInfo)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			newRecord := NewOpsConfigInfoLogPatternFunc()
+			err := App.Client.Create(context.Background(), newRecord)
+			if err != nil {
+				log.FromContext(context.Background()).Error(err, "newLogPatternConfig:create log pattern config error")
+			}
+		} else {
+			log.FromContext(context.Background()).Error(err, "newLogPatternConfig:get log pattern config error")
+		}
+	}
+}
+
+// newRevisionHashConfig is used to initialize config
+func newRevisionHashConfig() {
+	opsConfigInfo := v1alpha1.OpsConfigInfo{}
+	err := App.Client.Get(context.Background(), client.ObjectKey{Name: ConfigNameRevisionHash, Namespace: AlterShieldOperatorNamespace}, &opsConfigInfo)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			newRecord := NewOpsConfigInfoRevisionHashFunc()
+			err := App.Client.Create(context.Background(), newRecord)
+			if err != nil {
+				log.FromContext(context.Background()).Error(err, "newRevisionHashConfig:create revision hash config error")
+			}
+		} else {
+			log.FromContext(context.Background()).Error(err, "newRevisionHashConfig:get revision hash config error")
+		}
+	}
+}
+
+// newSuspendConfig is used to initialize config
+func newSuspendConfig() {
+	opsConfigInfo := v1alpha1.OpsConfigInfo{}
+	err := App.Client.Get(context.Background(), client.ObjectKey{Name: ConfigNameSuspend, Namespace: AlterShieldOperatorNamespace}, &opsConfigInfo)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			newRecord := NewOpsConfigInfoSuspendFunc()
+			err := App.Client.Create(context.Background(), newRecord)
+			if err != nil {
+				log.FromContext(context.Background()).Error(err, "newSuspendConfig:create suspend policy config error")
+			}
+		} else {
+			log.FromContext(context.Background()).Error(err, "newSuspendConfig:get suspend policy config error")
+		}
+	}
+}
+
+// newConcurrencyConfig is used to initialize config
+func newConcurrencyConfig() {
+	opsConfigInfo := v1alpha1.OpsConfigInfo{}
+	err := App.Client.Get(context.Background(), client.ObjectKey{Name: ConfigNameConcurrency, Namespace: AlterShieldOperatorNamespace}, &opsConfigInfo)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			newRecord := NewOpsConfigInfoConcurrencyFunc()
+			err := App.Client.Create(context.Background(), newRecord)
+			if err != nil {
+				log.FromContext(context.Background()).Error(err, "newConcurrencyConfig:create concurrency limit config error")
+			}
+		} else {
+			log.FromContext(context.Background()).Error(err, "newConcurrencyConfig:get concurrency limit config error")
+		}
+	}
+}
+
+// newNotificationConfig is used to initialize config
+func newNotificationConfig() {
+	opsConfigInfo := v1alpha1.OpsConfigInfo{}
+	err := App.Client.Get(context.Background(), client.ObjectKey{Name: ConfigNameNotification, Namespace: AlterShieldOperatorNamespace}, &opsConfigInfo)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			newRecord := NewOpsConfigInfoNotificationFunc()
+			err := App.Client.Create(context.Background(), newRecord)
+			if err != nil {
+				log.FromContext(context.Background()).Error(err, "newNotificationConfig:create notification sinks config error")
+			}
+		} else {
+			log.FromContext(context.Background()).Error(err, "newNotificationConfig:get notification sinks config error")
+		}
+	}
+}
+
+// newChangeSceneConfig is used to initialize config
+func newChangeSceneConfig() {
+	opsConfigInfo := v1alpha1.OpsConfigInfo{}
+	err := App.Client.Get(context.Background(), client.ObjectKey{Name: ConfigNameChangeScene, Namespace: AlterShieldOperatorNamespace}, &opsConfigInfo)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			newRecord := NewOpsConfigInfoChangeSceneFunc()
+			err := App.Client.Create(context.Background(), newRecord)
+			if err != nil {
+				log.FromContext(context.Background()).Error(err, "newChangeSceneConfig:create change scene mapping config error")
+			}
+		} else {
+			log.FromContext(context.Background()).Error(err, "newChangeSceneConfig:get change scene mapping config error")
+		}
+	}
+}
+
 // ConfigIsBatch It is guaranteed to be called when configIsBatchIsReady is true
 func ConfigIsBatch() bool {
 	// Without volatile, using lock guarantees visibility, has an impact on performance, and can be modified if there is a better way
@@ -142,3 +374,173 @@ func ConfigIsBlockingUp() bool {
 		return ConfigIsBlockingUp()
 	}
 }
+
+// ConfigIsDryRun It is guaranteed to be called when configIsDryRunIsReady is true
+func ConfigIsDryRun() bool {
+	for {
+		if isDryRun, ok := loadConfigIsDryRun(); ok {
+			return isDryRun
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+// CurrentConfigIsDryRun 不等待配置就绪地读取观察模式，供准入webhook使用，配置就绪前返回默认值false，即执行防御
+// CurrentConfigIsDryRun reads the dry-run mode without waiting for the config, it is used by the admission webhooks and
+// returns the default false before the config is ready, i.e. the defense is enforced
+func CurrentConfigIsDryRun() bool {
+	isDryRun, _ := loadConfigIsDryRun()
+	return isDryRun
+}
+
+// loadConfigIsDryRun 在锁内读取观察模式以及它是否就绪
+// loadConfigIsDryRun reads the dry-run mode and whether it is ready under the lock
+func loadConfigIsDryRun() (bool, bool) {
+	configMutex.RLock()
+	defer configMutex.RUnlock()
+	return configIsDryRun, configIsDryRunIsReady
+}
+
+// IsDryRun 判断命名空间是否运行在观察模式，命名空间的注解优先于全局配置
+// IsDryRun reports whether the namespace runs in dry-run mode, the namespace annotation takes precedence over the global config
+func IsDryRun(ctx context.Context, c client.Reader, namespace string) bool {
+	return isDryRun(ctx, c, namespace, ConfigIsDryRun)
+}
+
+// IsAdmissionDryRun 与IsDryRun相同，但不等待全局配置就绪，供准入webhook使用
+// IsAdmissionDryRun is IsDryRun without waiting for the global config, it is used by the admission webhooks
+func IsAdmissionDryRun(ctx context.Context, c client.Reader, namespace string) bool {
+	return isDryRun(ctx, c, namespace, CurrentConfigIsDryRun)
+}
+
+// isDryRun 命名空间没有合法的观察模式注解时使用全局配置
+// isDryRun falls back to the global config when the namespace has no valid dry-run annotation
+func isDryRun(ctx context.Context, c client.Reader, namespace string, global func() bool) bool {
+	logger := log.FromContext(ctx).WithName("IsDryRun")
+	ns := &corev1.Namespace{}
+	if err := c.Get(ctx, client.ObjectKey{Name: namespace}, ns); err != nil {
+		logger.Error(err, "get namespace error", Namespace, namespace)
+	} else if value, ok := ns.Annotations[DryRunAnnotation]; ok {
+		if dryRun, err := strconv.ParseBool(value); err == nil {
+			return dryRun
+		}
+		logger.Info("invalid dry-run annotation, use the global config", Namespace, namespace, "value", value)
+	}
+	return global()
+}
+
+// ConfigPrometheus It is guaranteed to be called when configPrometheusIsReady is true, it is empty when the prometheus checker is disabled
+func ConfigPrometheus() string {
+	// Without volatile, using lock guarantees visibility, has an impact on performance, and can be modified if there is a better way
+	mutex := &sync.Mutex{}
+	mutex.Lock()
+	if configPrometheusIsReady {
+		defer mutex.Unlock()
+		return configPrometheus
+	} else {
+		defer mutex.Unlock()
+		time.Sleep(time.Second)
+		return ConfigPrometheus()
+	}
+}
+
+// ConfigLogPattern It is guaranteed to be called when configLogPatternIsReady is true, it is empty when the log pattern checker is disabled
+func ConfigLogPattern() string {
+	// Without volatile, using lock guarantees visibility, has an impact on performance, and can be modified if there is a better way
+	mutex := &sync.Mutex{}
+	mutex.Lock()
+	if configLogPatternIsReady {
+		defer mutex.Unlock()
+		return configLogPattern
+	} else {
+		defer mutex.Unlock()
+		time.Sleep(time.Second)
+		return ConfigLogPattern()
+	}
+}
+
+// ConfigRevisionHash It is guaranteed to be called when configRevisionHashIsReady is true, it is empty when nothing is ignored by the revision hash
+func ConfigRevisionHash() string {
+	return waitConfig(&configRevisionHash, &configRevisionHashIsReady)
+}
+
+// CurrentConfigRevisionHash 不等待配置就绪地读取版本hash的忽略列表，供准入webhook使用，配置就绪前返回默认值空，即不忽略任何内容
+// CurrentConfigRevisionHash reads the ignore list of the revision hash without waiting for the config, it is used by the
+// admission webhooks and returns the default empty content before the config is ready, i.e. nothing is ignored
+func CurrentConfigRevisionHash() string {
+	content, _ := loadConfig(&configRevisionHash, &configRevisionHashIsReady)
+	return content
+}
+
+// ConfigSuspend It is guaranteed to be called when configSuspendIsReady is true, it is empty when every update of a suspended workload is denied
+func ConfigSuspend() string {
+	return waitConfig(&configSuspend, &configSuspendIsReady)
+}
+
+// CurrentConfigSuspend 不等待配置就绪地读取暂停策略，供准入webhook使用，配置就绪前返回默认值空，即拒绝被暂停的工作负载的所有更新
+// CurrentConfigSuspend reads the suspend policy without waiting for the config, it is used by the admission webhooks and
+// returns the default empty content before the config is ready, i.e. every update of a suspended workload is denied
+func CurrentConfigSuspend() string {
+	content, _ := loadConfig(&configSuspend, &configSuspendIsReady)
+	return content
+}
+
+// ConfigConcurrency It is guaranteed to be called when configConcurrencyIsReady is true, it is empty when the running changes are not limited
+func ConfigConcurrency() string {
+	return waitConfig(&configConcurrency, &configConcurrencyIsReady)
+}
+
+// CurrentConfigConcurrency 不等待配置就绪地读取并发限制，供准入webhook使用，配置就绪前返回默认值空，即不限制运行中的变更
+// CurrentConfigConcurrency reads the concurrency limit without waiting for the config, it is used by the admission
+// webhooks and returns the default empty content before the config is ready, i.e. the running changes are not limited
+func CurrentConfigConcurrency() string {
+	content, _ := loadConfig(&configConcurrency, &configConcurrencyIsReady)
+	return content
+}
+
+// ConfigNotification It is guaranteed to be called when configNotificationIsReady is true, it is empty when nothing is notified
+func ConfigNotification() string {
+	return waitConfig(&configNotification, &configNotificationIsReady)
+}
+
+// CurrentConfigNotification 不等待配置就绪地读取通知的接收方，供准入webhook使用，配置就绪前返回默认值空，即不发送通知
+// CurrentConfigNotification reads the notification sinks without waiting for the config, it is used by the admission
+// webhooks and returns the default empty content before the config is ready, i.e. nothing is notified
+func CurrentConfigNotification() string {
+	content, _ := loadConfig(&configNotification, &configNotificationIsReady)
+	return content
+}
+
+// ConfigChangeScene It is guaranteed to be called when configChangeSceneIsReady is true, it is empty when no namespace is mapped
+func ConfigChangeScene() string {
+	// Without volatile, using lock guarantees visibility, has an impact on performance, and can be modified if there is a better way
+	mutex := &sync.Mutex{}
+	mutex.Lock()
+	if configChangeSceneIsReady {
+		defer mutex.Unlock()
+		return configChangeScene
+	} else {
+		defer mutex.Unlock()
+		time.Sleep(time.Second)
+		return ConfigChangeScene()
+	}
+}
+
+// waitConfig 等待配置就绪后返回它的内容
+// waitConfig returns the content of a config once it is ready
+func waitConfig(content *string, ready *bool) string {
+	for {
+		if value, ok := loadConfig(content, ready); ok {
+			return value
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+// loadConfig 在锁内读取配置的内容以及它是否就绪
+// loadConfig reads the content of a config and whether it is ready under the lock
+func loadConfig(content *string, ready *bool) (string, bool) {
+	configMutex.RLock()
+	defer configMutex.RUnlock()
+	return *content, *ready
+}
@@ -0,0 +1,99 @@
+package native
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const AdvancedStatefulSetKind = "StatefulSet"
+
+// AdvancedStatefulSetGroupVersionKind OpenKruise的Advanced StatefulSet，和CloneSet一样通过unstructured读写，
+// 和原生StatefulSet同名，通过group区分
+// AdvancedStatefulSetGroupVersionKind the Advanced StatefulSet of OpenKruise, it is read and written as unstructured like
+// the CloneSet and told apart from the native StatefulSet of the same kind by its group
+var AdvancedStatefulSetGroupVersionKind = schema.GroupVersionKind{Group: "apps.kruise.io", Version: "v1beta1", Kind: AdvancedStatefulSetKind}
+
+// AdvancedStatefulSetPartitionFields Advanced StatefulSet的partition字段，AdvancedStatefulSetPausedFields 暂停发布的字段
+// AdvancedStatefulSetPartitionFields the partition field of an Advanced StatefulSet, AdvancedStatefulSetPausedFields the
+// field pausing its release
+var (
+	AdvancedStatefulSetPartitionFields = []string{"spec", "updateStrategy", "rollingUpdate", "partition"}
+	AdvancedStatefulSetPausedFields    = []string{"spec", "updateStrategy", "rollingUpdate", "paused"}
+)
+
+// NewAdvancedStatefulSet returns an empty unstructured Advanced StatefulSet to read into
+func NewAdvancedStatefulSet() *unstructured.Unstructured {
+	statefulSet := &unstructured.Unstructured{}
+	statefulSet.SetGroupVersionKind(AdvancedStatefulSetGroupVersionKind)
+	return statefulSet
+}
+
+// IsAdvancedStatefulSetInstalled 集群是否安装了Advanced StatefulSet的CRD，没有安装时不能监听Advanced StatefulSet
+// IsAdvancedStatefulSetInstalled reports whether the Advanced StatefulSet CRD is installed, the Advanced StatefulSets
+// can't be watched without it
+func IsAdvancedStatefulSetInstalled(mapper meta.RESTMapper) bool {
+	_, err := mapper.RESTMapping(AdvancedStatefulSetGroupVersionKind.GroupKind(), AdvancedStatefulSetGroupVersionKind.Version)
+	return err == nil
+}
+
+// IsAdvancedStatefulSetReference owner reference是否指向Advanced StatefulSet，原生StatefulSet的group不同
+// IsAdvancedStatefulSetReference reports whether the owner reference points to an Advanced StatefulSet, the native
+// StatefulSet has another group
+func IsAdvancedStatefulSetReference(ownerReference *metav1.OwnerReference) bool {
+	if ownerReference == nil || ownerReference.Kind != AdvancedStatefulSetKind {
+		return false
+	}
+	groupVersion, err := schema.ParseGroupVersion(ownerReference.APIVersion)
+	return err == nil && groupVersion.Group == AdvancedStatefulSetGroupVersionKind.Group
+}
+
+// GetAdvancedStatefulSetReplicas Advanced StatefulSet的副本数，没有填写时为1
+// GetAdvancedStatefulSetReplicas the replicas of the Advanced StatefulSet, it is 1 when missing
+func GetAdvancedStatefulSetReplicas(statefulSet *unstructured.Unstructured) int32 {
+	return getSpecReplicas(statefulSet)
+}
+
+// GetAdvancedStatefulSetTemplate Advanced StatefulSet的pod模板
+// GetAdvancedStatefulSetTemplate the pod template of the Advanced StatefulSet
+func GetAdvancedStatefulSetTemplate(statefulSet *unstructured.Unstructured) (*corev1.PodTemplateSpec, bool, error) {
+	return getSpecTemplate(statefulSet)
+}
+
+// GetAdvancedStatefulSetMinReadySeconds Advanced StatefulSet滚动升级的minReadySeconds，没有填写时为0
+// GetAdvancedStatefulSetMinReadySeconds the minReadySeconds of the rolling update of the Advanced StatefulSet, it is 0 when missing
+func GetAdvancedStatefulSetMinReadySeconds(statefulSet *unstructured.Unstructured) int32 {
+	minReadySeconds, _, _ := unstructured.NestedInt64(statefulSet.Object, "spec", "updateStrategy", "rollingUpdate", "minReadySeconds")
+	return int32(minReadySeconds)
+}
+
+// GetAdvancedStatefulSetUpdateRevision Advanced StatefulSet控制器为当前模板生成的updateRevision，控制器还没有处理最新的spec时返回false
+// GetAdvancedStatefulSetUpdateRevision the updateRevision the Advanced StatefulSet controller made for the current
+// template, it returns false while the controller has not observed the latest spec yet
+func GetAdvancedStatefulSetUpdateRevision(statefulSet *unstructured.Unstructured) (string, bool) {
+	return getUpdateRevision(statefulSet)
+}
+
+// GetAdvancedStatefulSetPartition Advanced StatefulSet保持旧版本的pod数，序号小于partition的pod不升级
+// GetAdvancedStatefulSetPartition the pods the Advanced StatefulSet keeps at the old revision, the pods of an ordinal
+// below the partition are not updated
+func GetAdvancedStatefulSetPartition(statefulSet *unstructured.Unstructured) int32 {
+	return getPartition(statefulSet, AdvancedStatefulSetPartitionFields...)
+}
+
+// GetAdvancedStatefulSetBatches 和CloneSet一样按照partition划分批次，没有partition时为空
+// GetAdvancedStatefulSetBatches splits the batches by the partition like the CloneSet, it is empty without a partition
+func GetAdvancedStatefulSetBatches(statefulSet *unstructured.Unstructured) []int32 {
+	return getPartitionBatches(GetAdvancedStatefulSetReplicas(statefulSet), GetAdvancedStatefulSetPartition(statefulSet))
+}
+
+// GetAdvancedStatefulSetHeldPartition 停住Advanced StatefulSet升级的partition，即还没有升级到updateRevision的pod数，
+// 升级从最大的序号开始，因此这些pod正好是序号小于partition的pod
+// GetAdvancedStatefulSetHeldPartition the partition holding the update of the Advanced StatefulSet, that is the pods
+// not updated to the updateRevision yet, which are exactly the pods of an ordinal below the partition since the update
+// starts from the highest ordinal
+func GetAdvancedStatefulSetHeldPartition(statefulSet *unstructured.Unstructured) int64 {
+	return getHeldPartition(statefulSet)
+}
@@ -0,0 +1,80 @@
+package native
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	CloneSetKind = "CloneSet"
+	// InPlaceUpdateReadyCondition OpenKruise原地升级pod时置为False的pod condition，升级完成后恢复为True
+	// InPlaceUpdateReadyCondition the pod condition OpenKruise sets to False while updating a pod in place and back to True
+	// once the update is done
+	InPlaceUpdateReadyCondition corev1.PodConditionType = "InPlaceUpdateReady"
+)
+
+// CloneSetPartitionFields CloneSet的partition字段，CloneSetPausedFields CloneSet暂停发布的字段
+// CloneSetPartitionFields the partition field of a CloneSet, CloneSetPausedFields the field pausing the release of a CloneSet
+var (
+	CloneSetPartitionFields = []string{"spec", "updateStrategy", "partition"}
+	CloneSetPausedFields    = []string{"spec", "updateStrategy", "paused"}
+)
+
+// CloneSetGroupVersionKind OpenKruise的CloneSet，和Argo Rollout一样通过unstructured读写
+// CloneSetGroupVersionKind the CloneSet of OpenKruise, it is read and written as unstructured like the Argo Rollout
+var CloneSetGroupVersionKind = schema.GroupVersionKind{Group: "apps.kruise.io", Version: "v1alpha1", Kind: CloneSetKind}
+
+// NewCloneSet returns an empty unstructured CloneSet to read into
+func NewCloneSet() *unstructured.Unstructured {
+	cloneSet := &unstructured.Unstructured{}
+	cloneSet.SetGroupVersionKind(CloneSetGroupVersionKind)
+	return cloneSet
+}
+
+// IsCloneSetInstalled 集群是否安装了CloneSet的CRD，没有安装时不能监听CloneSet
+// IsCloneSetInstalled reports whether the CloneSet CRD is installed, the CloneSets can't be watched without it
+func IsCloneSetInstalled(mapper meta.RESTMapper) bool {
+	_, err := mapper.RESTMapping(CloneSetGroupVersionKind.GroupKind(), CloneSetGroupVersionKind.Version)
+	return err == nil
+}
+
+// GetCloneSetReplicas CloneSet的副本数，没有填写时为1
+// GetCloneSetReplicas the replicas of the CloneSet, it is 1 when missing
+func GetCloneSetReplicas(cloneSet *unstructured.Unstructured) int32 {
+	return getSpecReplicas(cloneSet)
+}
+
+// GetCloneSetTemplate CloneSet的pod模板
+// GetCloneSetTemplate the pod template of the CloneSet
+func GetCloneSetTemplate(cloneSet *unstructured.Unstructured) (*corev1.PodTemplateSpec, bool, error) {
+	return getSpecTemplate(cloneSet)
+}
+
+// GetCloneSetUpdateRevision CloneSet控制器为当前模板生成的updateRevision，控制器还没有处理最新的spec时返回false
+// GetCloneSetUpdateRevision the updateRevision the CloneSet controller made for the current template, it returns false
+// while the controller has not observed the latest spec yet
+func GetCloneSetUpdateRevision(cloneSet *unstructured.Unstructured) (string, bool) {
+	return getUpdateRevision(cloneSet)
+}
+
+// GetCloneSetPartition CloneSet保持旧版本的pod数，百分比和OpenKruise一样向上取整
+// GetCloneSetPartition the pods the CloneSet keeps at the old revision, a percentage is rounded up like OpenKruise does
+func GetCloneSetPartition(cloneSet *unstructured.Unstructured) int32 {
+	return getPartition(cloneSet, CloneSetPartitionFields...)
+}
+
+// GetCloneSetBatches 按照partition划分批次，第一批为partition放开升级的pod，其余pod为后续每批的大小，没有partition时为空
+// GetCloneSetBatches splits the batches by the partition, the first batch is the pods the partition lets update and the
+// rest of the pods sizes every later batch, it is empty without a partition
+func GetCloneSetBatches(cloneSet *unstructured.Unstructured) []int32 {
+	return getPartitionBatches(GetCloneSetReplicas(cloneSet), GetCloneSetPartition(cloneSet))
+}
+
+// GetCloneSetHeldPartition 停住CloneSet升级的partition，即还没有升级到updateRevision的pod数
+// GetCloneSetHeldPartition the partition holding the update of the CloneSet, that is the pods not updated to the
+// updateRevision yet
+func GetCloneSetHeldPartition(cloneSet *unstructured.Unstructured) int64 {
+	return getHeldPartition(cloneSet)
+}
@@ -2,6 +2,7 @@ package native
 
 import (
 	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/utils"
 )
@@ -16,9 +17,16 @@ const (
 	AdmissionWebhookNamespaceLabel = "admission-webhook-altershield"
 )
 
+const (
+	ScaleChangeRevisionPrefix  = "scale-"
+	ConfigChangeRevisionPrefix = "config-"
+)
+
 const (
 	DeploymentKind = "Deployment"
 	ReplicaSetKind = "ReplicaSet"
+	ConfigMapKind  = "ConfigMap"
+	SecretKind     = "Secret"
 )
 
 const (
@@ -26,6 +34,42 @@ const (
 	PodStatusTerminating = "Terminating"
 )
 
+// GetChangeWorkloadNameByDeployment 当前版本的ChangeWorkload名称，版本被防御过原地变更时为最近一次原地变更的ChangeWorkload
+// GetChangeWorkloadNameByDeployment the name of the ChangeWorkload of the current revision, it is the ChangeWorkload of the
+// latest in-place change once an in-place change of the revision is defended
 func GetChangeWorkloadNameByDeployment(deployment *appsv1.Deployment) string {
-	return utils.CombineString(deployment.Name, deployment.Labels[AdmissionWebhookVersionLabel])
+	return GetChangeWorkloadName(deployment)
+}
+
+// GetChangeWorkloadTarget ChangeWorkload所属工作负载的类型和名称，没有owner reference的ChangeWorkload属于deployment
+// GetChangeWorkloadTarget the kind and the name of the workload the ChangeWorkload belongs to, a ChangeWorkload without
+// an owner reference belongs to a deployment
+func GetChangeWorkloadTarget(workload metav1.Object) (string, string) {
+	ownerReference := metav1.GetControllerOf(workload)
+	if ownerReference == nil {
+		return "deployment", workload.GetLabels()[DeploymentNameLabel]
+	}
+	switch ownerReference.Kind {
+	case RolloutKind:
+		return "rollout", ownerReference.Name
+	case CloneSetKind:
+		return "cloneset", ownerReference.Name
+	case AdvancedStatefulSetKind:
+		if IsAdvancedStatefulSetReference(ownerReference) {
+			return "advancedstatefulset", ownerReference.Name
+		}
+		return "deployment", ownerReference.Name
+	default:
+		return "deployment", ownerReference.Name
+	}
+}
+
+// GetChangeWorkloadName 被防御的工作负载当前的ChangeWorkload名称
+// GetChangeWorkloadName the name of the current ChangeWorkload of the defended workload
+func GetChangeWorkloadName(object metav1.Object) string {
+	name := utils.CombineString(object.GetName(), object.GetLabels()[AdmissionWebhookVersionLabel])
+	if changeRevision, ok := object.GetAnnotations()[utils.ChangeRevisionAnnotation]; ok {
+		name = utils.CombineString(name, changeRevision)
+	}
+	return name
 }
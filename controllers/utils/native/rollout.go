@@ -0,0 +1,86 @@
+package native
+
+import (
+	"math"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	RolloutKind = "Rollout"
+	// RolloutRevisionAnnotation Argo Rollouts记录在replicaSet上的版本序号
+	// RolloutRevisionAnnotation the revision number Argo Rollouts records on a replicaSet
+	RolloutRevisionAnnotation = "rollout.argoproj.io/revision"
+)
+
+// RolloutGroupVersionKind Argo Rollouts的Rollout，通过unstructured读写，不依赖Argo Rollouts的代码
+// RolloutGroupVersionKind the Rollout of Argo Rollouts, it is read and written as unstructured without depending on the
+// Argo Rollouts code
+var RolloutGroupVersionKind = schema.GroupVersionKind{Group: "argoproj.io", Version: "v1alpha1", Kind: RolloutKind}
+
+// NewRollout returns an empty unstructured Rollout to read into
+func NewRollout() *unstructured.Unstructured {
+	rollout := &unstructured.Unstructured{}
+	rollout.SetGroupVersionKind(RolloutGroupVersionKind)
+	return rollout
+}
+
+// IsRolloutInstalled 集群是否安装了Rollout的CRD，没有安装时不能监听Rollout
+// IsRolloutInstalled reports whether the Rollout CRD is installed, the Rollouts can't be watched without it
+func IsRolloutInstalled(mapper meta.RESTMapper) bool {
+	_, err := mapper.RESTMapping(RolloutGroupVersionKind.GroupKind(), RolloutGroupVersionKind.Version)
+	return err == nil
+}
+
+// GetRolloutReplicas Rollout的副本数，没有填写时为1
+// GetRolloutReplicas the replicas of the Rollout, it is 1 when missing
+func GetRolloutReplicas(rollout *unstructured.Unstructured) int32 {
+	return getSpecReplicas(rollout)
+}
+
+// GetRolloutTemplate Rollout的pod模板，通过workloadRef引用Deployment模板的Rollout没有模板，返回false
+// GetRolloutTemplate the pod template of the Rollout, it returns false for a Rollout referencing the template of a
+// Deployment by workloadRef
+func GetRolloutTemplate(rollout *unstructured.Unstructured) (*corev1.PodTemplateSpec, bool, error) {
+	return getSpecTemplate(rollout)
+}
+
+// GetRolloutBatches 按照canary的setWeight步骤划分每批的pod数，和Argo Rollouts一样按照权重向上取整计算每一步的canary副本数，
+// 最后一步之后剩余的副本为最后一批，blueGreen发布所有pod为一批
+// GetRolloutBatches splits the pods into batches by the setWeight steps of the canary strategy, the canary replicas of a
+// step are the weight rounded up like Argo Rollouts does, the replicas left after the last step are the last batch and a
+// blueGreen release is a single batch
+func GetRolloutBatches(rollout *unstructured.Unstructured) []int32 {
+	replicas := GetRolloutReplicas(rollout)
+	if replicas <= 0 {
+		return nil
+	}
+	steps, _, _ := unstructured.NestedSlice(rollout.Object, "spec", "strategy", "canary", "steps")
+	batches := make([]int32, 0, len(steps)+1)
+	var placed int32
+	for _, step := range steps {
+		stepMap, ok := step.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		weight, found, err := unstructured.NestedInt64(stepMap, "setWeight")
+		if err != nil || !found {
+			continue
+		}
+		target := int32(math.Ceil(float64(weight) * float64(replicas) / 100))
+		if target > replicas {
+			target = replicas
+		}
+		if target > placed {
+			batches = append(batches, target-placed)
+			placed = target
+		}
+	}
+	if placed < replicas {
+		batches = append(batches, replicas-placed)
+	}
+	return batches
+}
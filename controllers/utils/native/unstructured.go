@@ -0,0 +1,101 @@
+package native
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// getSpecReplicas 第三方工作负载spec.replicas的副本数，没有填写时为1
+// getSpecReplicas the spec.replicas of a third-party workload, it is 1 when missing
+func getSpecReplicas(object *unstructured.Unstructured) int32 {
+	replicas, found, err := unstructured.NestedInt64(object.Object, "spec", "replicas")
+	if err != nil || !found {
+		return 1
+	}
+	return int32(replicas)
+}
+
+// getSpecTemplate 第三方工作负载spec.template的pod模板，没有模板时返回false
+// getSpecTemplate the spec.template pod template of a third-party workload, it returns false without a template
+func getSpecTemplate(object *unstructured.Unstructured) (*corev1.PodTemplateSpec, bool, error) {
+	template := &corev1.PodTemplateSpec{}
+	raw, found, err := unstructured.NestedMap(object.Object, "spec", "template")
+	if err != nil || !found {
+		return template, false, err
+	}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(raw, template); err != nil {
+		return template, false, err
+	}
+	return template, true, nil
+}
+
+// GetMinReadySeconds 第三方工作负载spec.minReadySeconds，Argo Rollout和CloneSet都使用这个字段，没有填写时为0
+// GetMinReadySeconds the spec.minReadySeconds of a third-party workload, both Argo Rollouts and CloneSets use the field,
+// it is 0 when missing
+func GetMinReadySeconds(object *unstructured.Unstructured) int32 {
+	minReadySeconds, _, _ := unstructured.NestedInt64(object.Object, "spec", "minReadySeconds")
+	return int32(minReadySeconds)
+}
+
+// getUpdateRevision OpenKruise控制器为当前模板生成的updateRevision，控制器还没有处理最新的spec时返回false
+// getUpdateRevision the updateRevision an OpenKruise controller made for the current template, it returns false while
+// the controller has not observed the latest spec yet
+func getUpdateRevision(object *unstructured.Unstructured) (string, bool) {
+	observedGeneration, _, _ := unstructured.NestedInt64(object.Object, "status", "observedGeneration")
+	if observedGeneration < object.GetGeneration() {
+		return "", false
+	}
+	updateRevision, _, _ := unstructured.NestedString(object.Object, "status", "updateRevision")
+	return updateRevision, updateRevision != ""
+}
+
+// getPartition OpenKruise工作负载保持旧版本的pod数，百分比和OpenKruise一样向上取整
+// getPartition the pods an OpenKruise workload keeps at the old revision, a percentage is rounded up like OpenKruise does
+func getPartition(object *unstructured.Unstructured, fields ...string) int32 {
+	replicas := getSpecReplicas(object)
+	raw, found, err := unstructured.NestedFieldNoCopy(object.Object, fields...)
+	if err != nil || !found {
+		return 0
+	}
+	var partition intstr.IntOrString
+	switch typed := raw.(type) {
+	case int64:
+		partition = intstr.FromInt(int(typed))
+	case string:
+		partition = intstr.FromString(typed)
+	default:
+		return 0
+	}
+	value, err := intstr.GetScaledValueFromIntOrPercent(&partition, int(replicas), true)
+	if err != nil || value < 0 {
+		return 0
+	}
+	if int32(value) > replicas {
+		return replicas
+	}
+	return int32(value)
+}
+
+// getPartitionBatches 按照partition划分批次，第一批为partition放开升级的pod，其余pod为后续每批的大小，没有partition时为空
+// getPartitionBatches splits the batches by the partition, the first batch is the pods the partition lets update and
+// the rest of the pods sizes every later batch, it is empty without a partition
+func getPartitionBatches(replicas int32, partition int32) []int32 {
+	if partition <= 0 || partition >= replicas {
+		return nil
+	}
+	return []int32{replicas - partition, partition}
+}
+
+// getHeldPartition 停住OpenKruise工作负载升级的partition，即还没有升级到updateRevision的pod数
+// getHeldPartition the partition holding the update of an OpenKruise workload, that is the pods not updated to the
+// updateRevision yet
+func getHeldPartition(object *unstructured.Unstructured) int64 {
+	updatedReplicas, _, _ := unstructured.NestedInt64(object.Object, "status", "updatedReplicas")
+	held := int64(getSpecReplicas(object)) - updatedReplicas
+	if held < 0 {
+		return 0
+	}
+	return held
+}
@@ -16,4 +16,43 @@ const (
 
 	// ChangePodPostTimeoutThreshold node后检超时阈值，单位秒
 	ChangePodPostTimeoutThreshold = 120
+
+	// ChangePodMaxRetryTimes retry策略下node的最大重试次数
+	ChangePodMaxRetryTimes = 3
+
+	// ChangePodRetryInterval retry策略下node的重试间隔，单位秒
+	ChangePodRetryInterval = 10
+
+	// PodHealthCheckInterval pod-health检查器的检查间隔，单位秒
+	PodHealthCheckInterval = 5
+
+	// PrometheusQueryTimeout prometheus检查器一次校验的查询超时，单位秒
+	PrometheusQueryTimeout = 10
+
+	// ChangeWorkloadQueueInterval 排队的ChangeWorkload重新判断能否运行的间隔，单位秒
+	ChangeWorkloadQueueInterval = 3
+
+	// SuspensionEnforceInterval 重新中止暂停的Rollout或者保持暂停的CloneSet和Advanced StatefulSet的partition的间隔，单位秒
+	SuspensionEnforceInterval = 5
+
+	// DependencyMissingTimeout 上游deployment或者它的变更不存在时下游等待的时间，超时后取消下游的变更，单位秒
+	DependencyMissingTimeout = 600
+
+	// ChangeWorkloadNotifyMaxAge 超过这个时间的状态变化不再发送通知，避免升级后为历史的变更发送通知，单位秒
+	ChangeWorkloadNotifyMaxAge = 600
+
+	// ChangeCallbackTTL 提前到达的回调的保存时间，单位秒，过期后删除
+	ChangeCallbackTTL = 600
+
+	// ChangeCallbackExpireInterval 检查回调是否过期的间隔，单位秒
+	ChangeCallbackExpireInterval = 60
+
+	// AuditRecordExpireInterval 开启了审计记录的保存时间时检查记录是否过期的间隔，单位秒
+	AuditRecordExpireInterval = 60
+
+	// QueryDefaultPageSize 查询接口默认的每页条数
+	QueryDefaultPageSize = 20
+
+	// QueryMaxPageSize 查询接口每页条数的上限
+	QueryMaxPageSize = 100
 )
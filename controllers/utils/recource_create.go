@@ -1,9 +1,16 @@
 package utils
 
 import (
+	"encoding/json"
 	"strconv"
 
 	"gitlab.alipay-inc.com/common_release/altershieldoperator/apis/app.ops.cloud.alipay.com/v1alpha1"
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/checker"
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/concurrency"
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/notify"
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/revision"
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/scene"
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/suspend"
 )
 
 func NewOpsConfigInfoBatchFunc() *v1alpha1.OpsConfigInfo {
@@ -26,3 +33,97 @@ func NewOpsConfigInfoBlockFunc() *v1alpha1.OpsConfigInfo {
 	opsConfigInfo.Spec.Enable = true
 	return &opsConfigInfo
 }
+
+func NewOpsConfigInfoDryRunFunc() *v1alpha1.OpsConfigInfo {
+	opsConfigInfo := v1alpha1.OpsConfigInfo{}
+	opsConfigInfo.Name = ConfigNameIsDryRun
+	opsConfigInfo.Namespace = AlterShieldOperatorNamespace
+	opsConfigInfo.Spec.Type = ConfigTypeIsDryRun
+	opsConfigInfo.Spec.Remark = "Enabling Dry Run"
+	opsConfigInfo.Spec.Enable = false
+	return &opsConfigInfo
+}
+
+func NewOpsConfigInfoPrometheusFunc() *v1alpha1.OpsConfigInfo {
+	opsConfigInfo := v1alpha1.OpsConfigInfo{}
+	opsConfigInfo.Name = ConfigNamePrometheus
+	opsConfigInfo.Namespace = AlterShieldOperatorNamespace
+	opsConfigInfo.Spec.Type = ConfigTypePrometheus
+	content, _ := json.MarshalIndent(checker.DefaultPrometheusConfig, "", "  ")
+	opsConfigInfo.Spec.Content = string(content)
+	opsConfigInfo.Spec.Remark = "Enabling Prometheus Checker"
+	opsConfigInfo.Spec.Enable = false
+	return &opsConfigInfo
+}
+
+func NewOpsConfigInfoLogPatternFunc() *v1alpha1.OpsConfigInfo {
+	opsConfigInfo := v1alpha1.OpsConfigInfo{}
+	opsConfigInfo.Name = ConfigNameLogPattern
+	opsConfigInfo.Namespace = AlterShieldOperatorNamespace
+	opsConfigInfo.Spec.Type = ConfigTypeLogPattern
+	content, _ := json.MarshalIndent(checker.DefaultLogPatternConfig, "", "  ")
+	opsConfigInfo.Spec.Content = string(content)
+	opsConfigInfo.Spec.Remark = "Enabling Log Pattern Checker"
+	opsConfigInfo.Spec.Enable = true
+	return &opsConfigInfo
+}
+
+func NewOpsConfigInfoRevisionHashFunc() *v1alpha1.OpsConfigInfo {
+	opsConfigInfo := v1alpha1.OpsConfigInfo{}
+	opsConfigInfo.Name = ConfigNameRevisionHash
+	opsConfigInfo.Namespace = AlterShieldOperatorNamespace
+	opsConfigInfo.Spec.Type = ConfigTypeRevisionHash
+	content, _ := json.MarshalIndent(revision.DefaultConfig, "", "  ")
+	opsConfigInfo.Spec.Content = string(content)
+	opsConfigInfo.Spec.Remark = "Labels, annotations and containers ignored by the revision hash"
+	opsConfigInfo.Spec.Enable = true
+	return &opsConfigInfo
+}
+
+func NewOpsConfigInfoSuspendFunc() *v1alpha1.OpsConfigInfo {
+	opsConfigInfo := v1alpha1.OpsConfigInfo{}
+	opsConfigInfo.Name = ConfigNameSuspend
+	opsConfigInfo.Namespace = AlterShieldOperatorNamespace
+	opsConfigInfo.Spec.Type = ConfigTypeSuspend
+	content, _ := json.MarshalIndent(suspend.DefaultPolicy, "", "  ")
+	opsConfigInfo.Spec.Content = string(content)
+	opsConfigInfo.Spec.Remark = "Operations still allowed on the suspended workloads"
+	opsConfigInfo.Spec.Enable = true
+	return &opsConfigInfo
+}
+
+func NewOpsConfigInfoConcurrencyFunc() *v1alpha1.OpsConfigInfo {
+	opsConfigInfo := v1alpha1.OpsConfigInfo{}
+	opsConfigInfo.Name = ConfigNameConcurrency
+	opsConfigInfo.Namespace = AlterShieldOperatorNamespace
+	opsConfigInfo.Spec.Type = ConfigTypeConcurrency
+	content, _ := json.MarshalIndent(concurrency.DefaultLimit, "", "  ")
+	opsConfigInfo.Spec.Content = string(content)
+	opsConfigInfo.Spec.Remark = "The most ChangeWorkloads running at the same time per namespace and per cluster, 0 means no limit"
+	opsConfigInfo.Spec.Enable = true
+	return &opsConfigInfo
+}
+
+func NewOpsConfigInfoNotificationFunc() *v1alpha1.OpsConfigInfo {
+	opsConfigInfo := v1alpha1.OpsConfigInfo{}
+	opsConfigInfo.Name = ConfigNameNotification
+	opsConfigInfo.Namespace = AlterShieldOperatorNamespace
+	opsConfigInfo.Spec.Type = ConfigTypeNotification
+	content, _ := json.MarshalIndent(notify.DefaultConfig, "", "  ")
+	opsConfigInfo.Spec.Content = string(content)
+	opsConfigInfo.Spec.Remark = "The sinks notified when a change is suspended, succeeds, times out or is overridden by hand"
+	opsConfigInfo.Spec.Enable = true
+	return &opsConfigInfo
+}
+
+func NewOpsConfigInfoChangeSceneFunc() *v1alpha1.OpsConfigInfo {
+	opsConfigInfo := v1alpha1.OpsConfigInfo{}
+	opsConfigInfo.Name = ConfigNameChangeScene
+	opsConfigInfo.Namespace = AlterShieldOperatorNamespace
+	opsConfigInfo.Spec.Type = ConfigTypeChangeScene
+	content, _ := json.MarshalIndent(scene.DefaultMapping, "", "  ")
+	opsConfigInfo.Spec.Content = string(content)
+	opsConfigInfo.Spec.Remark = "The tenant and change scene of the OpsCloud requests per namespace, below the annotations and the namespace labels"
+	opsConfigInfo.Spec.Enable = true
+	return &opsConfigInfo
+}
@@ -11,6 +11,9 @@ const (
 	LogPodResource            = "pod resource"
 	LogDeploymentResource     = "deployment resource"
 	LogReplicaSetResource     = "replicaSet resource"
+	LogRolloutResource        = "rollout resource"
+	LogCloneSetResource       = "cloneSet resource"
+	LogStatefulSetResource    = "statefulSet resource"
 	LogChangeWorkloadResource = "change workload resource"
 	LogChangePodResource      = "change pod resource"
 )
@@ -22,17 +25,47 @@ const (
 	// DefenseStatusLabel 变更后置标签-防控状态标签
 
 	ChangePodVerdictPass        = "pass"
+	ChangePodVerdictFail        = "fail"
 	DefenseStatusLabelProcessed = "processed"
 
+	// ChangePodVerdictInconclusive 没有足够的观察结果，与失败一样不会放行
+	// ChangePodVerdictInconclusive there is not enough to observe, it does not pass just like a failure
+	ChangePodVerdictInconclusive = "inconclusive"
+
 	ConfigTypeIsBranch     = "isBranch"
 	ConfigNameIsBranch     = "branch"
 	ConfigTypeIsBlockingUp = "isBlockingUp"
 	ConfigNameIsBlockingUp = "blocking"
+	ConfigTypeIsDryRun     = "isDryRun"
+	ConfigNameIsDryRun     = "dryrun"
+	ConfigTypePrometheus   = "prometheusChecker"
+	ConfigNamePrometheus   = "prometheus"
+	ConfigTypeLogPattern   = "logPatternChecker"
+	ConfigNameLogPattern   = "log-pattern"
+	ConfigTypeRevisionHash = "revisionHash"
+	ConfigNameRevisionHash = "revision-hash"
+	ConfigTypeSuspend      = "suspendPolicy"
+	ConfigNameSuspend      = "suspend-policy"
+	ConfigTypeConcurrency  = "concurrencyLimit"
+	ConfigNameConcurrency  = "concurrency-limit"
+	ConfigTypeNotification = "notificationSinks"
+	ConfigNameNotification = "notification-sinks"
+	ConfigTypeChangeScene  = "changeSceneMapping"
+	ConfigNameChangeScene  = "change-scene"
 
 	ChangePodFieldStatus           = "changePod.status"
 	ChangePodFieldChangePodId      = "changePod.changePodId"
 	ChangePodFieldChangeWorkloadId = "changePod.changeWorkloadId"
 	ChangeWorkloadFieldStatus      = "changeWorkload.status"
+	ChangeCallbackFieldNodeId      = "changeCallback.nodeId"
+	DeploymentFieldConfigRefs      = "deployment.configRefs"
+
+	// ChangeCallbackNamePrefix 提前到达的回调的名称前缀，后接请求id的哈希
+	ChangeCallbackNamePrefix     = "callback-"
+	ChangeCallbackNameHashLength = 16
+	// AuditRecordNamePrefix 审计记录的名称前缀，后接记录键的哈希，同一个动作重复记录时创建会冲突
+	AuditRecordNamePrefix     = "audit-"
+	AuditRecordNameHashLength = 16
 
 	// StringRecordSpecEffectiveTargetType 管控端字段
 	StringRecordSpecEffectiveTargetType = "paas.pod"
@@ -44,6 +77,8 @@ const (
 	// DefaultTldcTenantCode 租户不能为空
 	DefaultTldcTenantCode = "MAYITNSC"
 	DefaultCreator        = "altershieldoperator"
+	// DefaultWorkspace 节点没有zone标签时pod的workspace
+	DefaultWorkspace = "default"
 )
 
 // label
@@ -52,6 +87,152 @@ const (
 	DefenseStatusLabel   = "altershield.defense.antgroup.com/defense-status"
 	SuspendLabel         = "altershield.defense.antgroup.com/suspend"
 	IgnoredSuspendLabel  = "altershield.defense.antgroup.com/ignored-suspend"
+	// OperateFinishedVersionLabel pod完成发布时的版本，原地升级后版本变化的pod需要重新防御
+	// OperateFinishedVersionLabel the version a pod finished its release at, a pod whose version changes by an in-place
+	// update is defended again
+	OperateFinishedVersionLabel = "altershield.defense.antgroup.com/operate-finished-version"
+	// AuditActionLabel AuditTargetLabel 审计记录的动作和对象名称，用于按动作或者对象查询记录
+	// AuditActionLabel AuditTargetLabel the action and the object name of an audit record, to list the records by them
+	AuditActionLabel = "altershield.defense.antgroup.com/audit-action"
+	AuditTargetLabel = "altershield.defense.antgroup.com/audit-target"
+)
+
+// annotation
+const (
+	// StartNotifyAnnotation changePod提交变更开始通知的进度，提交前为StartNotifyPending，提交成功后为管控端返回的nodeId
+	// StartNotifyAnnotation the progress of the change start notify of a changePod, it is StartNotifyPending before the
+	// notify is submitted and the nodeId returned by OpsCloud once it succeeds
+	StartNotifyAnnotation = "altershield.defense.antgroup.com/start-notify"
+	StartNotifyPending    = "pending"
+	// DryRunAnnotation 命名空间级别的观察模式开关，优先于全局配置
+	// DryRunAnnotation namespace level switch of the dry-run mode, it takes precedence over the global config
+	DryRunAnnotation = "altershield.defense.antgroup.com/dry-run"
+	// FailPolicyAnnotation 管控端不可用时的处理策略，deployment上的注解优先于namespace上的注解
+	// FailPolicyAnnotation the policy when the defense backend is unavailable, the deployment annotation takes precedence over the namespace one
+	FailPolicyAnnotation = "altershield.defense.antgroup.com/fail-policy"
+	// CheckerAnnotation 给出校验结果的检查器，没有外部检查器的命名空间可以使用本地的pod-health
+	// CheckerAnnotation the checker giving the verdicts, namespaces without an external checker can use the local pod-health
+	CheckerAnnotation = "altershield.defense.antgroup.com/checker"
+	// ObservationWindowAnnotation 本地检查器的观察窗口，例如60s
+	// ObservationWindowAnnotation the observation window of the local checkers, e.g. 60s
+	ObservationWindowAnnotation = "altershield.defense.antgroup.com/observation-window"
+	// MaxRestartsAnnotation pod-health检查器允许的容器重启次数
+	// MaxRestartsAnnotation the container restarts tolerated by the pod-health checker
+	MaxRestartsAnnotation = "altershield.defense.antgroup.com/max-restarts"
+	// MaxReadinessFlapsAnnotation pod-health检查器允许的ready状态抖动次数
+	// MaxReadinessFlapsAnnotation the readiness flaps tolerated by the pod-health checker
+	MaxReadinessFlapsAnnotation = "altershield.defense.antgroup.com/max-readiness-flaps"
+	// BakeWindowAnnotation pod连续ready多久后才能进入批次，例如30s，实际取值不小于工作负载的minReadySeconds，默认只要求ready
+	// BakeWindowAnnotation how long a pod has to stay ready before it can enter a batch, e.g. 30s, the workload's
+	// minReadySeconds is used when it is longer and only readiness is required by default
+	BakeWindowAnnotation = "altershield.defense.antgroup.com/bake-window"
+	// PostSubmitDelayAnnotation 前置校验通过后等待多久再提交后置校验，例如30s，默认不等待
+	// PostSubmitDelayAnnotation how long to wait after the pre check passes before the post check is submitted, e.g. 30s,
+	// no wait by default
+	PostSubmitDelayAnnotation = "altershield.defense.antgroup.com/post-submit-delay"
+	// TenantCodeAnnotation 管控端请求的租户，默认为DefaultTldcTenantCode，租户和变更场景的四个key也可以作为namespace的标签
+	// TenantCodeAnnotation the tenant of the OpsCloud requests, DefaultTldcTenantCode by default, the four keys of the
+	// tenant and change scene can also be namespace labels
+	TenantCodeAnnotation = "altershield.defense.antgroup.com/tenant-code"
+	// ChangeScenarioCodeAnnotation 管控端请求的变更场景编码，默认为ChangeScenarioCode
+	// ChangeScenarioCodeAnnotation the change scenario code of the OpsCloud requests, ChangeScenarioCode by default
+	ChangeScenarioCodeAnnotation = "altershield.defense.antgroup.com/change-scenario-code"
+	// ChangePhaseAnnotation 管控端请求的变更阶段，默认为ChangePhase
+	// ChangePhaseAnnotation the change phase of the OpsCloud requests, ChangePhase by default
+	ChangePhaseAnnotation = "altershield.defense.antgroup.com/change-phase"
+	// ChangeSceneKeyAnnotation 管控端请求的变更场景key，默认为ChangeSceneKeyRollingUpdate
+	// ChangeSceneKeyAnnotation the change scene key of the OpsCloud requests, ChangeSceneKeyRollingUpdate by default
+	ChangeSceneKeyAnnotation = "altershield.defense.antgroup.com/change-scene-key"
+	// ScaleDefenseThresholdAnnotation 扩容防御的阈值，新增副本数达到阈值时为新增的pod创建ChangeWorkload，取值为副本数如50或者相对扩容前副本数的百分比如100%，未配置时不防御扩容
+	// ScaleDefenseThresholdAnnotation the threshold of the scale defense, a ChangeWorkload is created for the added pods once
+	// the added replicas reach it, it is a replica count such as 50 or a percentage of the replicas before the scale-up such
+	// as 100%, scale-ups are not defended without it
+	ScaleDefenseThresholdAnnotation = "altershield.defense.antgroup.com/scale-defense-threshold"
+	// DefendedReplicasAnnotation 已经校验过的副本数，由operator维护，作为下一次扩容的基线
+	// DefendedReplicasAnnotation the replicas defended so far, it is kept by the operator as the baseline of the next scale-up
+	DefendedReplicasAnnotation = "altershield.defense.antgroup.com/defended-replicas"
+	// DefendedAutoscalerMaxReplicasAnnotation 已经校验过的HPA上限，由operator维护，HPA在该上限内扩缩容时不防御
+	// DefendedAutoscalerMaxReplicasAnnotation the defended upper bound of the HPA, it is kept by the operator and the HPA
+	// scales within it without a defense
+	DefendedAutoscalerMaxReplicasAnnotation = "altershield.defense.antgroup.com/defended-autoscaler-max-replicas"
+	// ConfigDefenseAnnotation 配置变更防御开关，开启后被引用的ConfigMap和Secret的内容变更会触发防御
+	// ConfigDefenseAnnotation the switch of the config defense, content changes of the referenced ConfigMaps and Secrets are
+	// defended once it is on
+	ConfigDefenseAnnotation = "altershield.defense.antgroup.com/config-defense"
+	// ConfigHashesAnnotation 被引用配置每个key的摘要，由operator维护，作为下一次配置变更的基线
+	// ConfigHashesAnnotation the digests of every key of the referenced configs, it is kept by the operator as the baseline
+	// of the next config change
+	ConfigHashesAnnotation = "altershield.defense.antgroup.com/config-hashes"
+	// ChangeRevisionAnnotation 当前版本最近一次被防御的原地变更，例如扩容或者配置变更，由operator维护，模板变更时被webhook清除
+	// ChangeRevisionAnnotation the latest defended in-place change of the current revision, such as a scale-up or a config
+	// change, it is kept by the operator and cleared by the webhook when the template changes
+	ChangeRevisionAnnotation = "altershield.defense.antgroup.com/change-revision"
+	// RevisionHashSummaryAnnotation 当前版本hash的摘要，包括参与计算的字段路径和取值的hash，不包括取值本身，由webhook在产生新版本时写入，
+	// 用于排查多余的版本
+	// RevisionHashSummaryAnnotation the summary of the hash of the current revision with the paths of the fields it is
+	// computed over and the hashes of their values but not the values, it is written by the webhook on a new revision to
+	// debug spurious revisions
+	RevisionHashSummaryAnnotation = "altershield.defense.antgroup.com/revision-hash-summary"
+	// VerifiedRevisionAnnotation 工作负载最近一次校验通过的模板版本，暂停后允许回滚到这个版本
+	// VerifiedRevisionAnnotation the last template revision of the workload that passed the checks, a suspended workload
+	// may roll back to it
+	VerifiedRevisionAnnotation = "altershield.defense.antgroup.com/verified-revision"
+	// FreezeBreakGlassAnnotation 在冻结窗口内强制更新模板的原因，每次强制更新需要填写新的原因，会被记录到事件中
+	// FreezeBreakGlassAnnotation the reason to force a template update inside a freeze window, every forced update takes a
+	// new reason and it is recorded in an event
+	FreezeBreakGlassAnnotation = "altershield.defense.antgroup.com/freeze-break-glass"
+	// QueueHeldAnnotation 工作负载因为变更排队被operator暂停，获得名额后恢复，用户自己暂停的工作负载没有这个注解
+	// QueueHeldAnnotation the workload is paused by the operator while its change is queued and resumed once the change
+	// gets a slot, a workload paused by its user doesn't carry it
+	QueueHeldAnnotation = "altershield.defense.antgroup.com/queue-held"
+	// DependencyHeldAnnotation 工作负载因为等待上游被operator暂停，上游的变更都成功后恢复，和QueueHeldAnnotation分别记录，
+	// 两个原因都解除后才恢复
+	// DependencyHeldAnnotation the workload is paused by the operator while its change waits for the upstreams and resumed
+	// once their changes succeed, it is kept apart from the QueueHeldAnnotation and the workload is resumed once neither
+	// reason holds it
+	DependencyHeldAnnotation = "altershield.defense.antgroup.com/dependency-held"
+	// DependsOnAnnotation 逗号分隔的上游deployment，name或者namespace/name，上游当前版本的变更成功后才开始发布，上游被暂停时取消
+	// DependsOnAnnotation the comma separated upstream deployments as name or namespace/name, the release starts once the
+	// changes of their current revisions succeed and is cancelled when one of them is suspended
+	DependsOnAnnotation = "altershield.defense.antgroup.com/depends-on"
+	// BatchSelectionAnnotation 挑选每一批pod的策略，spread、oldest或者random，默认spread让第一批覆盖所有的故障域
+	// BatchSelectionAnnotation the strategy to pick the pods of every batch, spread, oldest or random, spread by default
+	// so that the first batch covers every failure domain
+	BatchSelectionAnnotation = "altershield.defense.antgroup.com/batch-selection"
+	// NotifiedStatusAnnotation ChangeWorkload最近一次发送通知的状态，由operator维护，每个状态只通知一次
+	// NotifiedStatusAnnotation the status of the ChangeWorkload notified last, it is kept by the operator so that every
+	// status is notified once
+	NotifiedStatusAnnotation = "altershield.defense.antgroup.com/notified-status"
+)
+
+// HeldAnnotations operator暂停工作负载的所有原因
+// HeldAnnotations all the reasons the operator holds a workload for
+var HeldAnnotations = []string{QueueHeldAnnotation, DependencyHeldAnnotation}
+
+// fail policy
+const (
+	// FailPolicyPass 管控端失败或超时视为校验通过
+	// FailPolicyPass treats backend errors and timeouts as pass
+	FailPolicyPass = "pass"
+	// FailPolicyFail 管控端失败或超时视为校验失败，发布会被暂停
+	// FailPolicyFail treats backend errors and timeouts as fail, the release is suspended
+	FailPolicyFail = "fail"
+	// FailPolicyRetry 重新提交失败或超时的校验，重试次数用尽后视为校验失败
+	// FailPolicyRetry resubmits the failed or timed out check, it is treated as fail once the retries are used up
+	FailPolicyRetry = "retry"
+)
+
+// event
+const (
+	EventReasonWouldSuspend     = "WouldSuspend"
+	EventReasonFreezeBreakGlass = "FreezeBreakGlass"
+	EventReasonChangeCancelled  = "ChangeCancelled"
+	// EventReasonWouldDeny EventReasonWouldHold EventReasonWouldCancel 观察模式下本应拒绝的更新、暂停的发布和取消的变更
+	// EventReasonWouldDeny EventReasonWouldHold EventReasonWouldCancel the update that would have been denied, the
+	// release that would have been held and the change that would have been cancelled in dry-run mode
+	EventReasonWouldDeny   = "WouldDeny"
+	EventReasonWouldHold   = "WouldHold"
+	EventReasonWouldCancel = "WouldCancel"
 )
 
 // webhook
@@ -59,3 +240,19 @@ const (
 	ContentTypeHeader = "Content-Type"
 	ContentTypeJSON   = "application/json"
 )
+
+// checker
+const (
+	// CheckerOpsCloud 由OpsCloud给出校验结果
+	// CheckerOpsCloud the verdicts are given by OpsCloud
+	CheckerOpsCloud = "opscloud"
+	// CheckerPodHealth 由本地的pod健康检查器给出校验结果
+	// CheckerPodHealth the verdicts are given by the local pod health checker
+	CheckerPodHealth = "pod-health"
+	// CheckerPrometheus 对比新旧版本的prometheus指标给出校验结果
+	// CheckerPrometheus the verdicts are given by comparing the prometheus metrics of the new revision with the old one
+	CheckerPrometheus = "prometheus"
+	// CheckerLogPattern 统计新pod日志中的异常模式给出校验结果
+	// CheckerLogPattern the verdicts are given by counting the error patterns in the logs of the new pods
+	CheckerLogPattern = "log-pattern"
+)
@@ -0,0 +1,353 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/apis/app.ops.cloud.alipay.com/v1alpha1"
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/utils"
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/utils/native"
+)
+
+// rolloutAbortPatch 和kubectl argo rollouts abort一样通过status中止Rollout
+// rolloutAbortPatch aborts a Rollout through its status like kubectl argo rollouts abort does
+const rolloutAbortPatch = `{"status":{"abort":true}}`
+
+// getWorkloadOwner 获取ChangeWorkload防御的Deployment、Argo Rollout、CloneSet或者Advanced StatefulSet，按照controller owner的类型区分，
+// 没有owner时按照名称label获取Deployment
+// getWorkloadOwner gets the Deployment, Argo Rollout, CloneSet or Advanced StatefulSet the ChangeWorkload defends by the
+// kind of its controller owner, the Deployment is got by the name label without an owner
+func getWorkloadOwner(ctx context.Context, c client.Client, workload *v1alpha1.ChangeWorkload) (client.Object, error) {
+	var owner client.Object = &appsv1.Deployment{}
+	name := workload.Labels[native.DeploymentNameLabel]
+	if ownerReference := metav1.GetControllerOf(workload); ownerReference != nil {
+		name = ownerReference.Name
+		switch ownerReference.Kind {
+		case native.RolloutKind:
+			owner = native.NewRollout()
+		case native.CloneSetKind:
+			owner = native.NewCloneSet()
+		case native.AdvancedStatefulSetKind:
+			if native.IsAdvancedStatefulSetReference(ownerReference) {
+				owner = native.NewAdvancedStatefulSet()
+			}
+		}
+	}
+	if err := c.Get(ctx, client.ObjectKey{Namespace: workload.Namespace, Name: name}, owner); err != nil {
+		return nil, err
+	}
+	return owner, nil
+}
+
+// getOwnerByReplicaSet 获取replicaSet所属的Deployment或者Argo Rollout，不属于两者时返回nil
+// getOwnerByReplicaSet gets the Deployment or Argo Rollout owning the replicaSet, it is nil when owned by neither
+func getOwnerByReplicaSet(ctx context.Context, c client.Client, replicaSet *appsv1.ReplicaSet) (client.Object, error) {
+	for _, ownerReference := range replicaSet.OwnerReferences {
+		var owner client.Object
+		switch ownerReference.Kind {
+		case native.DeploymentKind:
+			owner = &appsv1.Deployment{}
+		case native.RolloutKind:
+			owner = native.NewRollout()
+		default:
+			continue
+		}
+		if err := c.Get(ctx, client.ObjectKey{Namespace: replicaSet.Namespace, Name: ownerReference.Name}, owner); err != nil {
+			return nil, err
+		}
+		return owner, nil
+	}
+	return nil, nil
+}
+
+// getCloneSetByPod 获取直接管理pod的CloneSet，不属于CloneSet时返回nil
+// getCloneSetByPod gets the CloneSet managing the pod directly, it is nil when the pod is not owned by a CloneSet
+func getCloneSetByPod(ctx context.Context, c client.Client, pod *corev1.Pod) (client.Object, error) {
+	ownerReference := metav1.GetControllerOf(pod)
+	if ownerReference == nil || ownerReference.Kind != native.CloneSetKind {
+		return nil, nil
+	}
+	cloneSet := native.NewCloneSet()
+	if err := c.Get(ctx, client.ObjectKey{Namespace: pod.Namespace, Name: ownerReference.Name}, cloneSet); err != nil {
+		return nil, err
+	}
+	return cloneSet, nil
+}
+
+// getAdvancedStatefulSetByPod 获取直接管理pod的Advanced StatefulSet，不属于Advanced StatefulSet时返回nil
+// getAdvancedStatefulSetByPod gets the Advanced StatefulSet managing the pod directly, it is nil when the pod is not
+// owned by an Advanced StatefulSet
+func getAdvancedStatefulSetByPod(ctx context.Context, c client.Client, pod *corev1.Pod) (client.Object, error) {
+	ownerReference := metav1.GetControllerOf(pod)
+	if !native.IsAdvancedStatefulSetReference(ownerReference) {
+		return nil, nil
+	}
+	statefulSet := native.NewAdvancedStatefulSet()
+	if err := c.Get(ctx, client.ObjectKey{Namespace: pod.Namespace, Name: ownerReference.Name}, statefulSet); err != nil {
+		return nil, err
+	}
+	return statefulSet, nil
+}
+
+// getOwnerByPod 获取pod所属的Deployment、Argo Rollout、CloneSet或者Advanced StatefulSet
+// getOwnerByPod get the Deployment, Argo Rollout, CloneSet or Advanced StatefulSet owning the pod
+func getOwnerByPod(ctx context.Context, c client.Client, pod *corev1.Pod) (client.Object, error) {
+	logger := log.FromContext(ctx).WithName("getOwnerByPod")
+	// CloneSet直接管理pod，没有ReplicaSet
+	// a CloneSet manages its pods directly without a ReplicaSet
+	if cloneSet, err := getCloneSetByPod(ctx, c, pod); err != nil || cloneSet != nil {
+		if err != nil {
+			logger.Error(err, "getOwnerByPod get cloneSet error", utils.LogPodResource, utils.GetResource(pod))
+		}
+		return cloneSet, err
+	}
+	if statefulSet, err := getAdvancedStatefulSetByPod(ctx, c, pod); err != nil || statefulSet != nil {
+		if err != nil {
+			logger.Error(err, "getOwnerByPod get advanced statefulSet error", utils.LogPodResource, utils.GetResource(pod))
+		}
+		return statefulSet, err
+	}
+	// 查询该 Pod 所属的 ReplicaSet
+	replicaSet, err := getReplicaSetByPod(ctx, c, pod)
+	if err != nil {
+		logger.Error(err, "getOwnerByPod get replicaSet error", utils.LogPodResource, utils.GetResource(pod))
+		return nil, err
+	}
+	owner, err := getOwnerByReplicaSet(ctx, c, replicaSet)
+	if err != nil {
+		logger.Error(err, "getOwnerByPod get owner error", utils.LogPodResource, utils.GetResource(pod))
+		return nil, err
+	}
+	return owner, nil
+}
+
+// getReplicaSetByPod 获取replicaSet通过pod
+// getReplicaSetByPod get replicaSet by pod
+func getReplicaSetByPod(ctx context.Context, c client.Client, pod *corev1.Pod) (replicaSet *appsv1.ReplicaSet, err error) {
+	// 查询该 Pod 所属的 ReplicaSet
+	replicaSet = &appsv1.ReplicaSet{}
+	ownerReferences := pod.OwnerReferences
+	for _, ownerReference := range ownerReferences {
+		if ownerReference.Kind == native.ReplicaSetKind {
+			if err := c.Get(ctx, client.ObjectKey{
+				Namespace: pod.Namespace,
+				Name:      ownerReference.Name,
+			}, replicaSet); err != nil {
+				return nil, err
+			}
+			break
+		}
+	}
+	return replicaSet, err
+}
+
+// getOwnerReplicas Deployment、Rollout、CloneSet或者Advanced StatefulSet的副本数
+// getOwnerReplicas the replicas of the Deployment, Rollout, CloneSet or Advanced StatefulSet
+func getOwnerReplicas(owner client.Object) int32 {
+	switch typed := owner.(type) {
+	case *appsv1.Deployment:
+		if typed.Spec.Replicas != nil {
+			return *typed.Spec.Replicas
+		}
+	case *unstructured.Unstructured:
+		if isCloneSet(typed) {
+			return native.GetCloneSetReplicas(typed)
+		}
+		if isAdvancedStatefulSet(typed) {
+			return native.GetAdvancedStatefulSetReplicas(typed)
+		}
+		return native.GetRolloutReplicas(typed)
+	}
+	return 1
+}
+
+// getOwnerMinReadySeconds Deployment、Rollout、CloneSet或者Advanced StatefulSet的minReadySeconds
+// getOwnerMinReadySeconds the minReadySeconds of the Deployment, Rollout, CloneSet or Advanced StatefulSet
+func getOwnerMinReadySeconds(owner client.Object) int32 {
+	switch typed := owner.(type) {
+	case *appsv1.Deployment:
+		return typed.Spec.MinReadySeconds
+	case *unstructured.Unstructured:
+		if isAdvancedStatefulSet(typed) {
+			return native.GetAdvancedStatefulSetMinReadySeconds(typed)
+		}
+		return native.GetMinReadySeconds(typed)
+	}
+	return 0
+}
+
+// isRollout owner是否是Argo Rollout
+// isRollout reports whether the owner is an Argo Rollout
+func isRollout(owner client.Object) bool {
+	return owner.GetObjectKind().GroupVersionKind() == native.RolloutGroupVersionKind
+}
+
+// isCloneSet owner是否是OpenKruise CloneSet
+// isCloneSet reports whether the owner is an OpenKruise CloneSet
+func isCloneSet(owner client.Object) bool {
+	return owner.GetObjectKind().GroupVersionKind() == native.CloneSetGroupVersionKind
+}
+
+// isAdvancedStatefulSet owner是否是OpenKruise Advanced StatefulSet
+// isAdvancedStatefulSet reports whether the owner is an OpenKruise Advanced StatefulSet
+func isAdvancedStatefulSet(owner client.Object) bool {
+	return owner.GetObjectKind().GroupVersionKind() == native.AdvancedStatefulSetGroupVersionKind
+}
+
+// getOwnerKind 事件和日志中使用的工作负载类型
+// getOwnerKind the kind of the workload used in the events and logs
+func getOwnerKind(owner client.Object) string {
+	switch {
+	case isRollout(owner):
+		return "rollout"
+	case isCloneSet(owner):
+		return "cloneset"
+	case isAdvancedStatefulSet(owner):
+		return "advancedstatefulset"
+	default:
+		return "deployment"
+	}
+}
+
+// isControlledBy ChangeWorkload是否由owner创建，同名的Deployment、Rollout和CloneSet通过uid区分
+// isControlledBy reports whether the ChangeWorkload is created for the owner, the workloads of the same name
+// are told apart by their uid
+func isControlledBy(workload *v1alpha1.ChangeWorkload, owner client.Object) bool {
+	ownerReference := metav1.GetControllerOf(workload)
+	return ownerReference == nil || ownerReference.UID == owner.GetUID()
+}
+
+// abortRollout 中止Rollout，Argo Rollouts把流量切回稳定版本并缩容canary
+// abortRollout aborts the Rollout, Argo Rollouts shifts the traffic back to the stable revision and scales the canary down
+func abortRollout(ctx context.Context, c client.Client, rollout client.Object) error {
+	return c.Status().Patch(ctx, rollout, client.RawPatch(types.MergePatchType, []byte(rolloutAbortPatch)))
+}
+
+// isRolloutAborted Rollout是否已经被中止
+// isRolloutAborted reports whether the Rollout is aborted
+func isRolloutAborted(rollout client.Object) bool {
+	typed, ok := rollout.(*unstructured.Unstructured)
+	if !ok {
+		return false
+	}
+	aborted, _, _ := unstructured.NestedBool(typed.Object, "status", "abort")
+	return aborted
+}
+
+// holdPartition 把CloneSet或者Advanced StatefulSet的partition设置为还没有升级的pod数，停住后续批次的升级，已经升级的pod保持不变，
+// partition已经停住时不再修改
+// holdPartition sets the partition of the CloneSet or Advanced StatefulSet to the pods not updated yet, so the later
+// batches hold while the updated pods are kept, a partition already holding is left alone
+func holdPartition(ctx context.Context, c client.Client, owner client.Object) (bool, error) {
+	object := owner.(*unstructured.Unstructured)
+	fields, held, partition := native.CloneSetPartitionFields, native.GetCloneSetHeldPartition(object), native.GetCloneSetPartition(object)
+	if isAdvancedStatefulSet(owner) {
+		fields, held, partition = native.AdvancedStatefulSetPartitionFields, native.GetAdvancedStatefulSetHeldPartition(object), native.GetAdvancedStatefulSetPartition(object)
+	}
+	if int64(partition) >= held {
+		return false, nil
+	}
+	patch, err := json.Marshal(nestedPatch(fields, held))
+	if err != nil {
+		return false, err
+	}
+	return true, c.Patch(ctx, owner, client.RawPatch(types.MergePatchType, patch))
+}
+
+// nestedPatch 把取值放到字段路径下，用于合并补丁
+// nestedPatch puts the value under the field path for a merge patch
+func nestedPatch(fields []string, value interface{}) map[string]interface{} {
+	patch := map[string]interface{}{fields[len(fields)-1]: value}
+	for i := len(fields) - 2; i >= 0; i-- {
+		patch = map[string]interface{}{fields[i]: patch}
+	}
+	return patch
+}
+
+// isOwnerPaused 工作负载的发布是否被暂停，CloneSet和Advanced StatefulSet通过updateStrategy暂停
+// isOwnerPaused reports whether the release of the workload is paused, a CloneSet and an Advanced StatefulSet are
+// paused through their updateStrategy
+func isOwnerPaused(owner client.Object) bool {
+	switch owner := owner.(type) {
+	case *appsv1.Deployment:
+		return owner.Spec.Paused
+	case *unstructured.Unstructured:
+		paused, _, _ := unstructured.NestedBool(owner.Object, getPausedFields(owner)...)
+		return paused
+	default:
+		return false
+	}
+}
+
+// holdOrReleaseOwner 按原因暂停或者恢复工作负载，每个原因对应utils.HeldAnnotations中的一个注解，所有原因都解除后才恢复，
+// 用户自己暂停的工作负载没有这些注解，保持不变
+// holdOrReleaseOwner holds or releases the workload for a reason, every reason is one of the utils.HeldAnnotations and
+// the workload is resumed once none of them is left, a workload paused by its user carries none of them and is kept
+func holdOrReleaseOwner(ctx context.Context, c client.Client, owner client.Object, reason string, hold bool) error {
+	_, held := owner.GetAnnotations()[reason]
+	if hold == held {
+		return nil
+	}
+	heldByOthers := false
+	for _, other := range utils.HeldAnnotations {
+		if _, ok := owner.GetAnnotations()[other]; ok && other != reason {
+			heldByOthers = true
+		}
+	}
+	if hold && isOwnerPaused(owner) && !heldByOthers {
+		return nil
+	}
+	// 合并补丁中的null删除注解
+	// a null in the merge patch removes the annotation
+	var annotation interface{}
+	merged := map[string]interface{}{}
+	if hold {
+		annotation = utils.True
+		merged = nestedPatch(getPausedFields(owner), true)
+	} else if !heldByOthers {
+		merged = nestedPatch(getPausedFields(owner), false)
+	}
+	merged["metadata"] = map[string]interface{}{"annotations": map[string]interface{}{reason: annotation}}
+	patch, err := json.Marshal(merged)
+	if err != nil {
+		return err
+	}
+	return c.Patch(ctx, owner, client.RawPatch(types.MergePatchType, patch))
+}
+
+// getPausedFields 暂停工作负载发布的字段
+// getPausedFields the field pausing the release of the workload
+func getPausedFields(owner client.Object) []string {
+	switch {
+	case isCloneSet(owner):
+		return native.CloneSetPausedFields
+	case isAdvancedStatefulSet(owner):
+		return native.AdvancedStatefulSetPausedFields
+	default:
+		return []string{"spec", "paused"}
+	}
+}
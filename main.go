@@ -21,9 +21,12 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"time"
 
 	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers"
+	opscloudclient "gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/client"
 	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/utils"
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/utils/native"
 	"gitlab.alipay-inc.com/common_release/altershieldoperator/routers"
 	"gitlab.alipay-inc.com/common_release/altershieldoperator/runnable"
 
@@ -58,11 +61,16 @@ func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
 	var probeAddr string
+	var auditRecordRetention time.Duration
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8089", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8088", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.DurationVar(&opscloudclient.DefaultClient.Timeout, "opscloud-timeout", opscloudclient.DefaultTimeout,
+		"The timeout of a single request to OpsCloud.")
+	flag.DurationVar(&auditRecordRetention, "audit-record-retention", 0,
+		"How long the AuditRecords are kept before they are deleted. The records are kept forever when it is 0.")
 
 	// Construct a new logr.logger.
 	if err := utils.LogInit(); err != nil {
@@ -71,6 +79,10 @@ func main() {
 	}
 	getenv := os.Getenv("test")
 	fmt.Println(getenv)
+	// OPSCLOUD_DOMAIN points the operator at another OpsCloud, e.g. the fake one in cmd/fakeopscloud
+	if domain := os.Getenv("OPSCLOUD_DOMAIN"); domain != "" {
+		opscloudclient.OpsCloudDomain = domain
+	}
 	r := routers.SetupRouter()
 	go func() {
 		if err := r.Run(":8080"); err != nil {
@@ -140,8 +152,9 @@ func main() {
 			os.Exit(1)
 		}
 		if err = (&controllers.ChangeWorkloadReconciler{
-			Client: mgr.GetClient(),
-			Scheme: mgr.GetScheme(),
+			Client:   mgr.GetClient(),
+			Scheme:   mgr.GetScheme(),
+			Recorder: mgr.GetEventRecorderFor("changeworkload-controller"),
 		}).SetupWithManager(mgr); err != nil {
 			setupLog.Error(err, "unable to create controller", "controller", "ChangeWorkload")
 			os.Exit(1)
@@ -153,10 +166,75 @@ func main() {
 			setupLog.Error(err, "unable to create controller", "controller", "ChangePod")
 			os.Exit(1)
 		}
+		if err = (&controllers.ChangeFreezeWindowReconciler{
+			Client: mgr.GetClient(),
+			Scheme: mgr.GetScheme(),
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "ChangeFreezeWindow")
+			os.Exit(1)
+		}
+		if err = (&controllers.ChangeWorkloadNotifyReconciler{
+			Client: mgr.GetClient(),
+			Scheme: mgr.GetScheme(),
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "ChangeWorkloadNotify")
+			os.Exit(1)
+		}
 		if err = (&appsv1.DeploymentWebhook{}).SetupWebhookWithManager(mgr); err != nil {
 			setupLog.Error(err, "unable to create webhook", "webhook", "Deployment")
 			os.Exit(1)
 		}
+		// Argo Rollouts是可选的，没有安装Rollout的CRD时不监听Rollout
+		// Argo Rollouts is optional, the Rollouts are not watched without the Rollout CRD installed
+		if native.IsRolloutInstalled(mgr.GetRESTMapper()) {
+			if err = (&controllers.RolloutReconciler{
+				Client: mgr.GetClient(),
+				Scheme: mgr.GetScheme(),
+			}).SetupWithManager(mgr); err != nil {
+				setupLog.Error(err, "unable to create controller", "controller", "Rollout")
+				os.Exit(1)
+			}
+		} else {
+			setupLog.Info("the Rollout CRD is not installed, Argo Rollouts are not defended")
+		}
+		if err = (&appsv1.RolloutWebhook{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "Rollout")
+			os.Exit(1)
+		}
+		// OpenKruise是可选的，没有安装CloneSet的CRD时不监听CloneSet
+		// OpenKruise is optional, the CloneSets are not watched without the CloneSet CRD installed
+		if native.IsCloneSetInstalled(mgr.GetRESTMapper()) {
+			if err = (&controllers.CloneSetReconciler{
+				Client: mgr.GetClient(),
+				Scheme: mgr.GetScheme(),
+			}).SetupWithManager(mgr); err != nil {
+				setupLog.Error(err, "unable to create controller", "controller", "CloneSet")
+				os.Exit(1)
+			}
+		} else {
+			setupLog.Info("the CloneSet CRD is not installed, OpenKruise CloneSets are not defended")
+		}
+		if err = (&appsv1.CloneSetWebhook{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "CloneSet")
+			os.Exit(1)
+		}
+		// OpenKruise是可选的，没有安装Advanced StatefulSet的CRD时不监听Advanced StatefulSet
+		// OpenKruise is optional, the Advanced StatefulSets are not watched without the Advanced StatefulSet CRD installed
+		if native.IsAdvancedStatefulSetInstalled(mgr.GetRESTMapper()) {
+			if err = (&controllers.AdvancedStatefulSetReconciler{
+				Client: mgr.GetClient(),
+				Scheme: mgr.GetScheme(),
+			}).SetupWithManager(mgr); err != nil {
+				setupLog.Error(err, "unable to create controller", "controller", "AdvancedStatefulSet")
+				os.Exit(1)
+			}
+		} else {
+			setupLog.Info("the Advanced StatefulSet CRD is not installed, OpenKruise Advanced StatefulSets are not defended")
+		}
+		if err = (&appsv1.AdvancedStatefulSetWebhook{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "AdvancedStatefulSet")
+			os.Exit(1)
+		}
 		//+kubebuilder:scaffold:builder
 
 		if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
@@ -171,6 +249,10 @@ func main() {
 		utils.ConfigRun()
 		runnable.ChangeWorkloadTimeoutValidRun()
 		runnable.ChangePodTimeoutValidRun()
+		runnable.ChangeCallbackExpireRun(utils.ChangeCallbackExpireInterval * time.Second)
+		if auditRecordRetention > 0 {
+			runnable.AuditRecordExpireRun(auditRecordRetention, utils.AuditRecordExpireInterval*time.Second)
+		}
 		runnable.DeploymentStatusRollBackRun()
 		// runable.DeploymentStatusPauseRun()
 
@@ -20,6 +20,12 @@ func SetupRouter() *gin.Engine {
 
 		altershieldOpenapi.GET("/suspend/deployment", callback.GetSuspendDeployment)
 		altershieldOpenapi.PUT("/deployment/rollback", callback.DeploymentRollback)
+		altershieldOpenapi.GET("/dryrun/decisions", callback.GetDryRunDecisions)
+		altershieldOpenapi.GET("/freeze/windows", callback.GetFreezeWindows)
+		altershieldOpenapi.GET("/changeworkloads", callback.ListChangeWorkloads)
+		altershieldOpenapi.GET("/changeworkload", callback.GetChangeWorkload)
+		altershieldOpenapi.GET("/deployment/history", callback.GetDeploymentHistory)
+		altershieldOpenapi.GET("/config/effective", callback.GetEffectiveConfig)
 	}
 
 	// TODO delete
@@ -0,0 +1,38 @@
+package runnable
+
+import (
+	"context"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/apis/app.ops.cloud.alipay.com/v1alpha1"
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/utils"
+)
+
+//+kubebuilder:rbac:groups=app.ops.cloud.alipay.com,resources=auditrecords,verbs=delete
+
+// AuditRecordExpireRun 每隔interval删除超过保存时间的审计记录，只在开启了保存时间时运行，记录已经同时输出到日志中
+// AuditRecordExpireRun deletes the audit records older than the retention once every interval, it only runs when a
+// retention is set, every record is logged as well when it is written
+func AuditRecordExpireRun(retention time.Duration, interval time.Duration) {
+	go func() {
+		logger := utils.NewLogger()
+		for {
+			time.Sleep(interval)
+			auditRecordList := v1alpha1.AuditRecordList{}
+			if err := utils.App.Client.List(context.Background(), &auditRecordList); err != nil {
+				logger.Error(err, "AuditRecordExpireRun: get audit record list error")
+				continue
+			}
+			for _, auditRecord := range auditRecordList.Items {
+				if time.Since(time.Unix(auditRecord.Spec.TimeUnix, 0)) <= retention {
+					continue
+				}
+				if err := utils.App.Client.Delete(context.Background(), &auditRecord); client.IgnoreNotFound(err) != nil {
+					logger.Error(err, "AuditRecordExpireRun: delete audit record error", "namespace", auditRecord.Namespace, "auditRecord", auditRecord.Name)
+				}
+			}
+		}
+	}()
+}
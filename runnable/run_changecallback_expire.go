@@ -0,0 +1,38 @@
+package runnable
+
+import (
+	"context"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/apis/app.ops.cloud.alipay.com/v1alpha1"
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/utils"
+)
+
+// ChangeCallbackExpireRun 删除超过保存时间的回调，未应用的回调过期说明没有等到对应的changePod
+// ChangeCallbackExpireRun deletes the callbacks older than the TTL, a pending callback that expires never found its changePod.
+// The callbacks are checked once every interval
+func ChangeCallbackExpireRun(interval time.Duration) {
+	go func() {
+		logger := utils.NewLogger()
+		for {
+			time.Sleep(interval)
+			changeCallbackList := v1alpha1.ChangeCallbackList{}
+			if err := utils.App.Client.List(context.Background(), &changeCallbackList, client.InNamespace(utils.AlterShieldOperatorNamespace)); err != nil {
+				logger.Error(err, "ChangeCallbackExpireRun: get change callback list error")
+				continue
+			}
+			for _, changeCallback := range changeCallbackList.Items {
+				if time.Now().Unix()-changeCallback.Spec.ReceiveTimeUnix <= utils.ChangeCallbackTTL {
+					continue
+				}
+				if err := utils.App.Client.Delete(context.Background(), &changeCallback); client.IgnoreNotFound(err) != nil {
+					logger.Error(err, "ChangeCallbackExpireRun: delete change callback error", "changeCallback", changeCallback.Name)
+				} else if changeCallback.Status.Status == v1alpha1.CallbackPending {
+					logger.Info("ChangeCallbackExpireRun: pending change callback expired", "changeCallback", changeCallback.Name, "nodeId", changeCallback.Spec.NodeId, "stage", changeCallback.Spec.DefenseStage)
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,148 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fakeopscloud
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	opscloudclient "gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/client"
+)
+
+const (
+	// ActionPass answers the check with a pass verdict
+	ActionPass = "pass"
+	// ActionFail answers the check with a fail verdict
+	ActionFail = "fail"
+	// ActionDelay answers the check with a pass verdict after DelaySeconds
+	ActionDelay = "delay"
+	// ActionNone never answers the check, the operator is expected to time out
+	ActionNone = "none"
+
+	verdictPass = "pass"
+	verdictFail = "fail"
+)
+
+// Rule decides how the fake OpsCloud answers a check. Rules are evaluated in order and the first
+// matching rule wins, a check that matches no rule is passed.
+type Rule struct {
+	// Match is a substring of the bizExecOrderId, empty matches every order
+	Match string `json:"match,omitempty"`
+	// Stage is PRE or POST, empty matches both stages
+	Stage string `json:"stage,omitempty"`
+	// Action is one of pass, fail, delay and none
+	Action string `json:"action"`
+	// DelaySeconds delays the callback, it applies to every action except none
+	DelaySeconds int `json:"delaySeconds,omitempty"`
+	// Msg is returned as the verdict message
+	Msg string `json:"msg,omitempty"`
+	// Times limits how many checks the rule answers, zero means unlimited
+	Times int `json:"times,omitempty"`
+	// Early sends the callback before answering the notify, so the callback overtakes the response
+	// and arrives before the operator has recorded the node, DelaySeconds is ignored
+	Early bool `json:"early,omitempty"`
+}
+
+// decision is the answer of a rule for one check
+type decision struct {
+	verdict string
+	msg     string
+	delay   time.Duration
+	skip    bool
+	early   bool
+}
+
+// ruleSet is a concurrency safe list of rules with their hit counters
+type ruleSet struct {
+	mu    sync.Mutex
+	rules []Rule
+	hits  []int
+}
+
+// LoadRules reads a json array of rules from file
+func LoadRules(file string) ([]Rule, error) {
+	bytes, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var rules []Rule
+	if err := json.Unmarshal(bytes, &rules); err != nil {
+		return nil, fmt.Errorf("parse rules file %s: %w", file, err)
+	}
+	return rules, validateRules(rules)
+}
+
+func validateRules(rules []Rule) error {
+	for i, rule := range rules {
+		switch rule.Action {
+		case ActionPass, ActionFail, ActionDelay, ActionNone:
+		default:
+			return fmt.Errorf("rule %d: unknown action %q", i, rule.Action)
+		}
+		if rule.Stage != "" && rule.Stage != opscloudclient.DefenseStageEnumPre && rule.Stage != opscloudclient.DefenseStageEnumPost {
+			return fmt.Errorf("rule %d: unknown stage %q", i, rule.Stage)
+		}
+	}
+	return nil
+}
+
+func (s *ruleSet) set(rules []Rule) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rules = append([]Rule(nil), rules...)
+	s.hits = make([]int, len(rules))
+}
+
+func (s *ruleSet) get() []Rule {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Rule(nil), s.rules...)
+}
+
+// decide returns the decision of the first matching rule and counts the hit
+func (s *ruleSet) decide(orderId string, stage string, defaultDelay time.Duration) decision {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, rule := range s.rules {
+		if rule.Match != "" && !strings.Contains(orderId, rule.Match) {
+			continue
+		}
+		if rule.Stage != "" && rule.Stage != stage {
+			continue
+		}
+		if rule.Times > 0 && s.hits[i] >= rule.Times {
+			continue
+		}
+		s.hits[i]++
+		d := decision{verdict: verdictPass, msg: rule.Msg, delay: defaultDelay, early: rule.Early}
+		if rule.DelaySeconds > 0 {
+			d.delay = time.Duration(rule.DelaySeconds) * time.Second
+		}
+		switch rule.Action {
+		case ActionFail:
+			d.verdict = verdictFail
+		case ActionNone:
+			d.skip = true
+		}
+		return d
+	}
+	return decision{verdict: verdictPass, delay: defaultDelay}
+}
@@ -0,0 +1,338 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package fakeopscloud implements a local stand-in of the OpsCloud openapi used by the operator,
+// it answers change orders and batch notifies and calls the operator back with scriptable verdicts.
+package fakeopscloud
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	opscloudclient "gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/client"
+	"gitlab.alipay-inc.com/common_release/altershieldoperator/controllers/utils"
+)
+
+const (
+	// DefaultCallbackURL is the callback api of an operator running on the same host
+	DefaultCallbackURL = "http://localhost:8080/openapi/altershield/callback"
+	// DefaultCallbackDelay gives the operator time to persist the node id before the callback arrives
+	DefaultCallbackDelay = time.Second
+
+	resultCodeSuccess     = "SUCCESS"
+	resultCodeInvalidSign = "INVALID_SIGN"
+	resultCodeBadRequest  = "INVALID_PARAM"
+)
+
+var logger = utils.NewLogger().WithName("FakeOpsCloud")
+
+// Options configures the fake OpsCloud
+type Options struct {
+	// CallbackURL is where verdicts are posted, defaults to DefaultCallbackURL
+	CallbackURL string
+	// CallbackDelay is the delay of callbacks whose rule does not set one, defaults to DefaultCallbackDelay
+	CallbackDelay time.Duration
+	// Rules decide the verdicts, checks matching no rule pass
+	Rules []Rule
+}
+
+// Node is a batch created by submitChangeExecBatchStartNotify
+type Node struct {
+	NodeId                   string   `json:"nodeId"`
+	BizExecOrderId           string   `json:"bizExecOrderId"`
+	ChangeSceneKey           string   `json:"changeSceneKey"`
+	ChangePhase              string   `json:"changePhase"`
+	TldcTenantCode           string   `json:"tldcTenantCode"`
+	EffectiveTargetLocations []string `json:"effectiveTargetLocations"`
+	Finished                 bool     `json:"finished"`
+}
+
+// Callback records a verdict sent to the operator
+type Callback struct {
+	NodeId     string `json:"nodeId"`
+	Stage      string `json:"stage"`
+	Verdict    string `json:"verdict"`
+	StatusCode int    `json:"statusCode"`
+	Error      string `json:"error,omitempty"`
+}
+
+// Server is the fake OpsCloud
+type Server struct {
+	options    Options
+	rules      ruleSet
+	httpClient *http.Client
+
+	mu        sync.Mutex
+	orders    map[string]opscloudclient.OpsCloudChangeExecOrderSubmitRequest
+	nodes     map[string]*Node
+	nodeOrder []string
+	callbacks []Callback
+	nodeSeq   int
+}
+
+// New creates a fake OpsCloud
+func New(options Options) *Server {
+	if options.CallbackURL == "" {
+		options.CallbackURL = DefaultCallbackURL
+	}
+	if options.CallbackDelay <= 0 {
+		options.CallbackDelay = DefaultCallbackDelay
+	}
+	s := &Server{
+		options:    options,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+	}
+	s.rules.set(options.Rules)
+	s.Reset()
+	return s
+}
+
+// Handler returns the http handler of the openapi and of the /fake admin api
+func (s *Server) Handler() http.Handler {
+	r := gin.New()
+	r.Use(gin.Recovery())
+	openapi := r.Group(fmt.Sprintf("/openapi/%s/exe", opscloudclient.ApiVersion))
+	openapi.Use(s.verifySign)
+	{
+		openapi.POST("/"+opscloudclient.SubmitChangeExecOrderAction, s.submitChangeExecOrder)
+		openapi.POST("/"+opscloudclient.SubmitChangeStartNotifyAction, s.submitChangeStartNotify)
+		openapi.POST("/"+opscloudclient.SubmitChangeFinishNotifyAction, s.submitChangeFinishNotify)
+	}
+	admin := r.Group("/fake")
+	{
+		admin.GET("/rules", func(c *gin.Context) { c.JSON(http.StatusOK, s.Rules()) })
+		admin.PUT("/rules", s.putRules)
+		admin.GET("/orders", func(c *gin.Context) { c.JSON(http.StatusOK, s.Orders()) })
+		admin.GET("/nodes", func(c *gin.Context) { c.JSON(http.StatusOK, s.Nodes()) })
+		admin.GET("/callbacks", func(c *gin.Context) { c.JSON(http.StatusOK, s.Callbacks()) })
+		admin.POST("/reset", func(c *gin.Context) {
+			s.Reset()
+			c.JSON(http.StatusOK, utils.GetCommonCallbackSuccess())
+		})
+	}
+	return r
+}
+
+// SetRules replaces the rules and resets their hit counters
+func (s *Server) SetRules(rules []Rule) error {
+	if err := validateRules(rules); err != nil {
+		return err
+	}
+	s.rules.set(rules)
+	return nil
+}
+
+// Rules returns the current rules
+func (s *Server) Rules() []Rule {
+	return s.rules.get()
+}
+
+// Orders returns the submitted orders by their bizExecOrderId
+func (s *Server) Orders() map[string]opscloudclient.OpsCloudChangeExecOrderSubmitRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	orders := make(map[string]opscloudclient.OpsCloudChangeExecOrderSubmitRequest, len(s.orders))
+	for id, order := range s.orders {
+		orders[id] = order
+	}
+	return orders
+}
+
+// Nodes returns the nodes in creation order
+func (s *Server) Nodes() []Node {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	nodes := make([]Node, 0, len(s.nodeOrder))
+	for _, id := range s.nodeOrder {
+		nodes = append(nodes, *s.nodes[id])
+	}
+	return nodes
+}
+
+// Callbacks returns the callbacks sent so far
+func (s *Server) Callbacks() []Callback {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Callback(nil), s.callbacks...)
+}
+
+// Reset forgets all orders, nodes and callbacks, the rules are kept
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.orders = map[string]opscloudclient.OpsCloudChangeExecOrderSubmitRequest{}
+	s.nodes = map[string]*Node{}
+	s.nodeOrder = nil
+	s.callbacks = nil
+}
+
+// verifySign rejects requests whose X-OpsCloud-Sign does not match the body
+func (s *Server) verifySign(c *gin.Context) {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		abort(c, http.StatusBadRequest, resultCodeBadRequest, err.Error())
+		return
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	if c.GetHeader(opscloudclient.HttpHeaderPlatformKey) == "" {
+		abort(c, http.StatusForbidden, resultCodeInvalidSign, "missing platform header")
+		return
+	}
+	if !opscloudclient.VerifySign(c.GetHeader(opscloudclient.HttpHeaderTimestampKey), string(body), c.GetHeader(opscloudclient.HttpHeaderSignKey)) {
+		abort(c, http.StatusForbidden, resultCodeInvalidSign, "invalid signature")
+		return
+	}
+	c.Next()
+}
+
+func (s *Server) submitChangeExecOrder(c *gin.Context) {
+	var request opscloudclient.OpsCloudChangeExecOrderSubmitRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		abort(c, http.StatusBadRequest, resultCodeBadRequest, err.Error())
+		return
+	}
+	if request.BizExecOrderId == "" {
+		abort(c, http.StatusBadRequest, resultCodeBadRequest, "bizExecOrderId is required")
+		return
+	}
+	s.mu.Lock()
+	s.orders[request.BizExecOrderId] = request
+	s.mu.Unlock()
+	success(c, map[string]interface{}{"bizExecOrderId": request.BizExecOrderId})
+}
+
+func (s *Server) submitChangeStartNotify(c *gin.Context) {
+	var request opscloudclient.OpsCloudChangeExecBatchStartNotifyRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		abort(c, http.StatusBadRequest, resultCodeBadRequest, err.Error())
+		return
+	}
+	if request.BizExecOrderId == "" {
+		abort(c, http.StatusBadRequest, resultCodeBadRequest, "bizExecOrderId is required")
+		return
+	}
+	s.mu.Lock()
+	s.nodeSeq++
+	node := &Node{
+		NodeId:                   fmt.Sprintf("node-%d-%d", time.Now().UnixNano(), s.nodeSeq),
+		BizExecOrderId:           request.BizExecOrderId,
+		ChangeSceneKey:           request.ChangeSceneKey,
+		ChangePhase:              request.ChangePhase,
+		TldcTenantCode:           request.TldcTenantCode,
+		EffectiveTargetLocations: request.EffectiveTargetLocations,
+	}
+	s.nodes[node.NodeId] = node
+	s.nodeOrder = append(s.nodeOrder, node.NodeId)
+	s.mu.Unlock()
+
+	s.scheduleCallback(*node, opscloudclient.DefenseStageEnumPre)
+	success(c, map[string]interface{}{"nodeId": node.NodeId})
+}
+
+func (s *Server) submitChangeFinishNotify(c *gin.Context) {
+	var request opscloudclient.OpsCloudChangeFinishNotifyRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		abort(c, http.StatusBadRequest, resultCodeBadRequest, err.Error())
+		return
+	}
+	s.mu.Lock()
+	node, ok := s.nodes[request.NodeId]
+	if ok {
+		node.Finished = true
+	}
+	s.mu.Unlock()
+	if !ok {
+		abort(c, http.StatusOK, resultCodeBadRequest, fmt.Sprintf("node %s not found", request.NodeId))
+		return
+	}
+	s.scheduleCallback(*node, opscloudclient.DefenseStageEnumPost)
+	success(c, nil)
+}
+
+func (s *Server) putRules(c *gin.Context) {
+	var rules []Rule
+	if err := c.ShouldBindJSON(&rules); err != nil {
+		c.JSON(http.StatusBadRequest, utils.GetCommonCallbackErr(err))
+		return
+	}
+	if err := s.SetRules(rules); err != nil {
+		c.JSON(http.StatusBadRequest, utils.GetCommonCallbackErr(err))
+		return
+	}
+	c.JSON(http.StatusOK, utils.GetCommonCallbackSuccess())
+}
+
+// scheduleCallback answers the check of a node according to the rules, asynchronously unless the rule is early
+func (s *Server) scheduleCallback(node Node, stage string) {
+	d := s.rules.decide(node.BizExecOrderId, stage, s.options.CallbackDelay)
+	if d.skip {
+		logger.Info("no answer for check", "nodeId", node.NodeId, "stage", stage)
+		return
+	}
+	if d.early {
+		s.sendCallback(node, stage, d)
+		return
+	}
+	go func() {
+		time.Sleep(d.delay)
+		s.sendCallback(node, stage, d)
+	}()
+}
+
+func (s *Server) sendCallback(node Node, stage string, d decision) {
+	request := opscloudclient.OpsCloudChangeCheckCallbackWrapperRequest{
+		ChangeCheckType: opscloudclient.OpsCloudChangeCheckTypeEnumBatch,
+		CallbackRequest: opscloudclient.OpsCloudChangeCheckCallbackRequest{
+			NodeId:         node.NodeId,
+			ChangeSceneKey: node.ChangeSceneKey,
+			BizExecOrderId: node.BizExecOrderId,
+			Verdict: opscloudclient.OpsCloudChangeCheckVerdict{
+				Verdict: d.verdict,
+				Msg:     d.msg,
+				NodeId:  node.NodeId,
+			},
+			DefenseStageEnum: stage,
+		},
+	}
+	record := Callback{NodeId: node.NodeId, Stage: stage, Verdict: d.verdict}
+	body, _ := json.Marshal(request)
+	resp, err := s.httpClient.Post(s.options.CallbackURL, utils.ContentTypeJSON, bytes.NewReader(body))
+	if err != nil {
+		record.Error = err.Error()
+		logger.Error(err, "send callback error", "nodeId", node.NodeId, "stage", stage)
+	} else {
+		record.StatusCode = resp.StatusCode
+		_ = resp.Body.Close()
+	}
+	s.mu.Lock()
+	s.callbacks = append(s.callbacks, record)
+	s.mu.Unlock()
+}
+
+func success(c *gin.Context, domain interface{}) {
+	c.JSON(http.StatusOK, opscloudclient.OpsCloudResult{Success: true, ResultCode: resultCodeSuccess, Domain: domain})
+}
+
+func abort(c *gin.Context, status int, code string, msg string) {
+	c.AbortWithStatusJSON(status, opscloudclient.OpsCloudResult{Success: false, ResultCode: code, Msg: msg})
+}